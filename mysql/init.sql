@@ -46,10 +46,12 @@ CREATE TABLE IF NOT EXISTS menus (
     FOREIGN KEY (parent_id) REFERENCES menus(id)
 );
 
--- 插入初始数据
+-- 角色、菜单和权限由 rbac.yaml 维护，后端启动时同步（RBAC_MANIFEST）；这里插入未配置同步时也必须存在的基础角色和菜单：
+-- admin 为管理员账号的角色，user 为注册、邀请和导入用户的默认角色
 INSERT INTO roles (name, description) VALUES 
 ('admin', '系统管理员'),
-('user', '普通用户')
+('user', '普通用户'),
+('platform_admin', '平台超级管理员')
 ON DUPLICATE KEY UPDATE description = VALUES(description);
 
 -- 插入管理员用户 (密码: admin123)
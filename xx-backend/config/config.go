@@ -6,10 +6,18 @@ import (
 )
 
 type Config struct {
-	App   AppConfig
-	MySQL MySQLConfig
-	Redis RedisConfig
-	Kafka KafkaConfig
+	App        AppConfig
+	MySQL      MySQLConfig
+	Redis      RedisConfig
+	Kafka      KafkaConfig
+	Approval   ApprovalConfig
+	RBAC       RBACConfig
+	Export     ExportConfig
+	Bulk       BulkConfig
+	RecycleBin RecycleBinConfig
+	Search     SearchConfig
+	Invite     InviteConfig
+	Authz      AuthzConfig
 }
 
 type AppConfig struct {
@@ -38,6 +46,50 @@ type KafkaConfig struct {
 	TopicSystemLogs string
 }
 
+// ApprovalConfig 需要审批的变更类型，逗号分隔，设置为 none 表示不启用审批
+type ApprovalConfig struct {
+	Actions string
+}
+
+// RBACConfig 启动时同步到默认租户的RBAC配置文件路径，为空表示不同步
+type RBACConfig struct {
+	Manifest string
+}
+
+// ExportConfig 用户导出配置：后台导出任务的文件目录、同步导出的行数上限（超过时转为后台任务，0表示不限制）和文件保留小时数
+type ExportConfig struct {
+	Dir            string
+	SyncLimit      int
+	RetentionHours int
+}
+
+// BulkConfig 批量操作的最大并发数，请求中指定的并发数不能超过该值
+type BulkConfig struct {
+	MaxWorkers int
+}
+
+// RecycleBinConfig 回收站中已删除记录的保留天数，超过后自动永久删除，0表示不自动删除
+type RecycleBinConfig struct {
+	RetentionDays int
+}
+
+// SearchConfig 用户全文索引的存储目录，为空时使用内存索引并在启动时从数据库重建
+type SearchConfig struct {
+	IndexPath string
+}
+
+// InviteConfig 邀请用户配置：邀请链接的页面地址（token 作为查询参数附加）、签名密钥和有效小时数
+type InviteConfig struct {
+	URL      string
+	Secret   string
+	TTLHours int
+}
+
+// AuthzConfig 策略引擎在没有适用策略时的默认决策：allow 或 deny，默认为 deny
+type AuthzConfig struct {
+	DefaultDecision string
+}
+
 func Load() *Config {
 	return &Config{
 		App: AppConfig{
@@ -62,6 +114,34 @@ func Load() *Config {
 			TopicUserEvents: getEnv("KAFKA_TOPIC_USER_EVENTS", "user_events"),
 			TopicSystemLogs: getEnv("KAFKA_TOPIC_SYSTEM_LOGS", "system_logs"),
 		},
+		Approval: ApprovalConfig{
+			Actions: getEnv("APPROVAL_ACTIONS", "role_assign,role_permissions,user_delete"),
+		},
+		RBAC: RBACConfig{
+			Manifest: getEnv("RBAC_MANIFEST", ""),
+		},
+		Export: ExportConfig{
+			Dir:            getEnv("EXPORT_DIR", "exports"),
+			SyncLimit:      getEnvAsInt("EXPORT_SYNC_LIMIT", 10000),
+			RetentionHours: getEnvAsInt("EXPORT_RETENTION_HOURS", 24),
+		},
+		Bulk: BulkConfig{
+			MaxWorkers: getEnvAsInt("BULK_MAX_WORKERS", 5),
+		},
+		RecycleBin: RecycleBinConfig{
+			RetentionDays: getEnvAsInt("RECYCLE_BIN_RETENTION_DAYS", 30),
+		},
+		Search: SearchConfig{
+			IndexPath: getEnv("SEARCH_INDEX_PATH", ""),
+		},
+		Invite: InviteConfig{
+			URL:      getEnv("INVITE_URL", "http://localhost:3000/invite"),
+			Secret:   getEnv("INVITE_SECRET", "your-invite-secret"),
+			TTLHours: getEnvAsInt("INVITE_TTL_HOURS", 72),
+		},
+		Authz: AuthzConfig{
+			DefaultDecision: getEnv("AUTHZ_DEFAULT_DECISION", "deny"),
+		},
 	}
 }
 
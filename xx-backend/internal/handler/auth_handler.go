@@ -83,7 +83,7 @@ func GetProfile(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		user, err := userService.GetProfile(userID.(int))
+		user, err := userService.GetProfile(c.Request.Context(), userID.(int))
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    500,
@@ -112,7 +112,7 @@ func Register(userService *service.UserService) gin.HandlerFunc {
 			c.JSON(400, gin.H{"code": 400, "message": "参数错误", "error": err.Error()})
 			return
 		}
-		if err := userService.Register(req.Username, req.Password, req.Email); err != nil {
+		if err := userService.Register(c.Request.Context(), req.Username, req.Password, req.Email); err != nil {
 			c.JSON(400, gin.H{"code": 400, "message": err.Error()})
 			return
 		}
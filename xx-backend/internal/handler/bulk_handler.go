@@ -0,0 +1,72 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// BulkUsers 以后台任务批量操作用户，返回202和任务信息。
+// PUT /bulk/:action 执行 enable、disable、assign-role、reset-password，DELETE /bulk 批量删除
+func BulkUsers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			UserIDs     []int  `json:"user_ids" binding:"required"`
+			RoleID      int    `json:"role_id"`
+			Password    string `json:"password"`
+			Reason      string `json:"reason"`
+			Concurrency int    `json:"concurrency"`
+		}
+		if err := c.ShouldBindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		// 删除只能通过DELETE方法，保证策略按删除操作授权
+		action := c.Param("action")
+		if c.Request.Method == http.MethodDelete {
+			action = service.BulkDelete
+		} else if action == service.BulkDelete {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "批量删除请使用 DELETE /api/users/bulk"})
+			return
+		}
+
+		job, err := userService.StartBulkJob(c.Request.Context(), c.GetInt("user_id"), &service.BulkRequest{
+			Action:      action,
+			UserIDs:     body.UserIDs,
+			RoleID:      body.RoleID,
+			Password:    body.Password,
+			Reason:      body.Reason,
+			Concurrency: body.Concurrency,
+		})
+		if errors.Is(err, service.ErrFieldForbidden) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "创建批量操作任务失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "创建批量操作任务失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    202,
+			"message": "批量操作任务已创建",
+			"data":    job,
+		})
+	}
+}
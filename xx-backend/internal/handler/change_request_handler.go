@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// approvalContext 把请求中的变更原因（?reason=xxx）写入上下文，变更需要审批时作为变更请求的原因
+func approvalContext(c *gin.Context) context.Context {
+	return service.WithChangeReason(c.Request.Context(), c.Query("reason"))
+}
+
+// respondApprovalRequired 变更需要审批、已提交变更请求时返回202和变更请求
+func respondApprovalRequired(c *gin.Context, err error) bool {
+	var approval *service.ApprovalRequiredError
+	if !errors.As(err, &approval) {
+		return false
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"code":    202,
+		"message": "变更需要审批，已提交变更请求",
+		"data":    approval.Request,
+	})
+	return true
+}
+
+// GetChangeRequests 获取变更请求列表
+func GetChangeRequests(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.ChangeRequestListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := userService.GetChangeRequests(c.Request.Context(), c.GetInt("user_id"), query)
+		respondList(c, result, err, "获取变更请求失败")
+	}
+}
+
+// GetChangeRequest 获取变更请求详情
+func GetChangeRequest(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的变更请求ID"})
+			return
+		}
+
+		request, err := userService.GetChangeRequest(c.Request.Context(), c.GetInt("user_id"), id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "变更请求不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    request,
+		})
+	}
+}
+
+// ApproveChangeRequest 审批通过变更请求
+func ApproveChangeRequest(userService *service.UserService) gin.HandlerFunc {
+	return reviewChangeRequest(userService.ApproveChangeRequest, "审批通过")
+}
+
+// RejectChangeRequest 驳回变更请求
+func RejectChangeRequest(userService *service.UserService) gin.HandlerFunc {
+	return reviewChangeRequest(userService.RejectChangeRequest, "已驳回")
+}
+
+type reviewFunc func(ctx context.Context, reviewerID, id int, comment string) (*model.ChangeRequest, error)
+
+func reviewChangeRequest(review reviewFunc, successMessage string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的变更请求ID"})
+			return
+		}
+
+		var req struct {
+			Comment string `json:"comment"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		request, err := review(c.Request.Context(), c.GetInt("user_id"), id, req.Comment)
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "变更请求不存在"})
+			case errors.Is(err, service.ErrSelfApproval), errors.Is(err, service.ErrReviewForbidden):
+				c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "审批失败", "error": err.Error()})
+			case errors.Is(err, service.ErrConflict):
+				c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "审批失败", "error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "审批失败", "error": err.Error(), "data": request})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": successMessage,
+			"data":    request,
+		})
+	}
+}
@@ -0,0 +1,170 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetDepartments 获取部门列表
+func GetDepartments(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.DepartmentListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := userService.GetDepartments(c.Request.Context(), query)
+		respondList(c, result, err, "获取部门列表失败")
+	}
+}
+
+// CreateDepartment 创建部门
+func CreateDepartment(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var department model.Department
+		if err := c.ShouldBindJSON(&department); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.CreateDepartment(c.Request.Context(), &department); err != nil {
+			respondUpdateError(c, err, "部门不存在", "创建部门失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "创建成功",
+			"data":    department,
+		})
+	}
+}
+
+// UpdateDepartment 按合并补丁更新部门
+func UpdateDepartment(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的部门ID",
+			})
+			return
+		}
+
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		update, err := service.DecodeDepartmentUpdate(body)
+		if err != nil {
+			respondUpdateError(c, err, "部门不存在", "更新部门失败")
+			return
+		}
+
+		if err := userService.UpdateDepartment(c.Request.Context(), id, update); err != nil {
+			respondUpdateError(c, err, "部门不存在", "更新部门失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "更新成功",
+		})
+	}
+}
+
+// DeleteDepartment 删除部门
+func DeleteDepartment(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的部门ID",
+			})
+			return
+		}
+
+		if err := userService.DeleteDepartment(c.Request.Context(), id); err != nil {
+			if errors.Is(err, service.ErrConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"code":    409,
+					"message": "删除部门失败",
+					"error":   err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "删除部门失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
+
+// SetRoleDataScope 设置角色数据范围
+func SetRoleDataScope(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的角色ID",
+			})
+			return
+		}
+
+		var req struct {
+			DataScope     string `json:"data_scope" binding:"required"`
+			DepartmentIDs []int  `json:"department_ids"`
+			GroupIDs      []int  `json:"group_ids"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.SetRoleDataScope(c.Request.Context(), c.GetInt("user_id"), id, req.DataScope, req.DepartmentIDs, req.GroupIDs); err != nil {
+			respondDataScopeError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "设置成功",
+		})
+	}
+}
+
+// respondDataScopeError 数据范围、部门或用户组不合法时返回400，字段错误列在 errors 中；
+// 没有 role:data_scope 权限返回403，角色不存在返回404
+func respondDataScopeError(c *gin.Context, err error) {
+	var fieldErrs service.FieldErrors
+	if errors.As(err, &fieldErrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error(), "errors": fieldErrs})
+		return
+	}
+	respondUpdateError(c, err, "角色不存在", "设置数据范围失败")
+}
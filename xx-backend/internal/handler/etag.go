@@ -0,0 +1,37 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag 以版本号作为 ETag 返回，客户端修改或删除时通过 If-Match 带回
+func setETag(c *gin.Context, version int) {
+	c.Header("ETag", strconv.Quote(strconv.Itoa(version)))
+}
+
+// ifMatchVersion 解析 If-Match 请求头中的版本号，没有该请求头或为 * 时返回0（不检查）。
+// 值不是本服务返回的 ETag（包括弱 ETag）时不可能匹配，直接返回412
+func ifMatchVersion(c *gin.Context) (int, bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return 0, true
+	}
+	if value, err := strconv.Unquote(header); err == nil {
+		if version, err := strconv.Atoi(value); err == nil && version > 0 {
+			return version, true
+		}
+	}
+	respondPreconditionFailed(c)
+	return 0, false
+}
+
+func respondPreconditionFailed(c *gin.Context) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{
+		"code":    412,
+		"message": "数据已被修改，请刷新后重试",
+	})
+}
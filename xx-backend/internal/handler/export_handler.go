@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xx-backend/internal/service"
+	"xx-backend/pkg/listquery"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportUsers 导出用户（format=csv|xlsx|jsonl，columns 指定导出的列，过滤和排序参数与用户列表相同）。
+// 匹配的用户超过同步导出上限或 async=true 时转为后台任务，返回202和任务信息
+func ExportUsers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		schema, err := userService.UserListSchema(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "导出用户失败", "error": err.Error()})
+			return
+		}
+		query, err := listquery.Parse(c.Request.URL.Query(), schema, "format", "columns", "async")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+		opts, err := userService.ParseUserExportOptions(c.Request.Context(), c.Query("format"), c.Query("columns"), query)
+		if err != nil {
+			if !errors.Is(err, listquery.ErrInvalidQuery) {
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "导出用户失败", "error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+		opts.Filter = c.Request.URL.RawQuery
+
+		exportUsers(c, userService, opts)
+	}
+}
+
+// exportUsers 同步导出时直接输出文件，否则创建后台任务
+func exportUsers(c *gin.Context, userService *service.UserService, opts *service.UserExportOptions) {
+	ctx := c.Request.Context()
+	operatorID := c.GetInt("user_id")
+
+	async, _ := strconv.ParseBool(c.Query("async"))
+	if !async {
+		var err error
+		if async, err = userService.ShouldExportInBackground(ctx, operatorID, opts.Query); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "导出用户失败", "error": err.Error()})
+			return
+		}
+	}
+
+	if async {
+		job, err := userService.StartUserExportJob(ctx, operatorID, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建导出任务失败", "error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    202,
+			"message": "导出任务已创建",
+			"data":    job,
+		})
+		return
+	}
+
+	filename := fmt.Sprintf("users_%s.%s", time.Now().Format("20060102150405"), opts.Format)
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", service.ExportContentType(opts.Format))
+	if err := userService.ExportUsers(ctx, operatorID, opts, c.Writer, nil); err != nil {
+		if c.Writer.Written() {
+			// 已经开始输出文件，只能中断响应
+			log.Printf("Failed to export users: %v", err)
+			return
+		}
+		c.Header("Content-Disposition", "")
+		status := http.StatusInternalServerError
+		if errors.Is(err, listquery.ErrInvalidQuery) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"code": status, "message": "导出用户失败", "error": err.Error()})
+	}
+}
@@ -0,0 +1,185 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetUserPermissions 获取用户的有效权限（主角色加当前生效的限时授权）
+func GetUserPermissions(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+			return
+		}
+
+		// 先按数据范围确认可以访问该用户
+		if _, err := userService.GetUser(c.Request.Context(), c.GetInt("user_id"), id); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "用户不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		permissions, err := userService.GetUserPermissions(c.Request.Context(), uint(id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "获取用户权限失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    permissions,
+		})
+	}
+}
+
+// GetRoleGrants 获取用户的限时角色授权
+func GetRoleGrants(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+			return
+		}
+
+		grants, err := userService.GetRoleGrants(c.Request.Context(), c.GetInt("user_id"), uint(id))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "用户不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "获取授权记录失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    grants,
+		})
+	}
+}
+
+// CreateRoleGrant 限时授予用户角色
+func CreateRoleGrant(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+			return
+		}
+
+		var req struct {
+			RoleID    int       `json:"role_id" binding:"required"`
+			StartsAt  time.Time `json:"starts_at"`
+			ExpiresAt time.Time `json:"expires_at" binding:"required"`
+			Reason    string    `json:"reason" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		grant := model.RoleGrant{
+			UserID:    uint(id),
+			RoleID:    req.RoleID,
+			StartsAt:  req.StartsAt,
+			ExpiresAt: req.ExpiresAt,
+			Reason:    req.Reason,
+		}
+		// 需要审批时返回202和变更请求
+		if err := userService.CreateRoleGrant(approvalContext(c), c.GetInt("user_id"), &grant); err != nil {
+			if respondApprovalRequired(c, err) {
+				return
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "用户不存在"})
+				return
+			}
+			if errors.Is(err, service.ErrSelfGrant) || errors.Is(err, service.ErrFieldForbidden) {
+				c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": "授权失败", "error": err.Error()})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "授权失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "授权成功",
+			"data":    grant,
+		})
+	}
+}
+
+// RevokeRoleGrant 撤销限时角色授权
+func RevokeRoleGrant(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误"})
+			return
+		}
+		grantID, err := strconv.Atoi(c.Param("grant_id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的授权ID"})
+			return
+		}
+
+		reason := c.DefaultQuery("reason", "revoked")
+		if err := userService.RevokeRoleGrant(c.Request.Context(), c.GetInt("user_id"), uint(id), grantID, reason); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "授权不存在"})
+				return
+			}
+			if errors.Is(err, service.ErrConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"code":    409,
+					"message": "撤销授权失败",
+					"error":   err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "撤销授权失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "撤销成功",
+		})
+	}
+}
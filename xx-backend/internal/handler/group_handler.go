@@ -0,0 +1,262 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+	"xx-backend/pkg/listquery"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetGroups 获取用户组列表
+func GetGroups(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.GroupListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := userService.GetGroups(c.Request.Context(), query)
+		respondList(c, result, err, "获取用户组列表失败")
+	}
+}
+
+// GetGroup 获取用户组详情
+func GetGroup(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		group, err := userService.GetGroup(c.Request.Context(), id)
+		if err != nil {
+			respondUpdateError(c, err, "用户组不存在", "获取用户组失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    group,
+		})
+	}
+}
+
+// CreateGroup 创建用户组
+func CreateGroup(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var group model.Group
+		if err := c.ShouldBindJSON(&group); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.CreateGroup(c.Request.Context(), &group); err != nil {
+			respondUpdateError(c, err, "用户组不存在", "创建用户组失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "创建成功",
+			"data":    group,
+		})
+	}
+}
+
+// UpdateGroup 按合并补丁更新用户组
+func UpdateGroup(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		update, err := service.DecodeGroupUpdate(body)
+		if err != nil {
+			respondUpdateError(c, err, "用户组不存在", "更新用户组失败")
+			return
+		}
+
+		if err := userService.UpdateGroup(c.Request.Context(), id, update); err != nil {
+			respondUpdateError(c, err, "用户组不存在", "更新用户组失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "更新成功",
+		})
+	}
+}
+
+// DeleteGroup 删除用户组
+func DeleteGroup(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		if err := userService.DeleteGroup(c.Request.Context(), id); err != nil {
+			respondUpdateError(c, err, "用户组不存在", "删除用户组失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
+
+// GetGroupMembers 获取用户组成员（recursive=true 时包括子组成员），过滤和排序参数与用户列表相同
+func GetGroupMembers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		schema, err := userService.UserListSchema(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户组成员失败", "error": err.Error()})
+			return
+		}
+		query, err := listquery.Parse(c.Request.URL.Query(), schema, "recursive")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+		recursive, _ := strconv.ParseBool(c.Query("recursive"))
+
+		result, err := userService.GetGroupMembers(c.Request.Context(), c.GetInt("user_id"), id, recursive, query)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "用户组不存在", "error": err.Error()})
+			return
+		}
+		respondList(c, result, err, "获取用户组成员失败")
+	}
+}
+
+// groupMembersRequest 添加或移除用户组成员的请求
+type groupMembersRequest struct {
+	UserIDs []uint `json:"user_ids"`
+}
+
+// AddGroupMembers 把用户加入用户组
+func AddGroupMembers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		var req groupMembersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.AddGroupMembers(approvalContext(c), c.GetInt("user_id"), id, req.UserIDs); err != nil {
+			respondUpdateError(c, err, "用户组不存在", "添加成员失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "添加成功",
+		})
+	}
+}
+
+// RemoveGroupMembers 把用户移出用户组
+func RemoveGroupMembers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		var req groupMembersRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.RemoveGroupMembers(c.Request.Context(), c.GetInt("user_id"), id, req.UserIDs); err != nil {
+			respondUpdateError(c, err, "用户组不存在", "移除成员失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "移除成功",
+		})
+	}
+}
+
+// SetGroupRoles 设置分配给用户组的角色
+func SetGroupRoles(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户组ID"})
+			return
+		}
+
+		var req struct {
+			RoleIDs []int `json:"role_ids"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.SetGroupRoles(approvalContext(c), c.GetInt("user_id"), id, req.RoleIDs); err != nil {
+			respondUpdateError(c, err, "用户组不存在", "设置角色失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "设置成功",
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/service"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/listquery"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetUserHistory 获取用户的变更历史
+func GetUserHistory(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, query, ok := parseHistoryQuery(c)
+		if !ok {
+			return
+		}
+		result, err := userService.GetUserHistory(c.Request.Context(), c.GetInt("user_id"), id, query)
+		respondHistory(c, result, err, "用户不存在")
+	}
+}
+
+// GetRoleHistory 获取角色的变更历史
+func GetRoleHistory(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, query, ok := parseHistoryQuery(c)
+		if !ok {
+			return
+		}
+		result, err := userService.GetRoleHistory(c.Request.Context(), id, query)
+		respondHistory(c, result, err, "角色不存在")
+	}
+}
+
+// GetMenuHistory 获取菜单的变更历史
+func GetMenuHistory(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, query, ok := parseHistoryQuery(c)
+		if !ok {
+			return
+		}
+		result, err := userService.GetMenuHistory(c.Request.Context(), id, query)
+		respondHistory(c, result, err, "菜单不存在")
+	}
+}
+
+func parseHistoryQuery(c *gin.Context) (int, *listquery.Query, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return 0, nil, false
+	}
+	query, ok := parseListQuery(c, service.ChangeHistoryListSchema)
+	return id, query, ok
+}
+
+func respondHistory(c *gin.Context, result *listquery.Result[history.Entry], err error, notFoundMessage string) {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": notFoundMessage})
+		return
+	}
+	respondList(c, result, err, "获取变更历史失败")
+}
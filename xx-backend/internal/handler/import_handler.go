@@ -0,0 +1,71 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxImportFileSize 导入文件的大小上限
+const maxImportFileSize = 10 << 20
+
+// ImportUsers 从上传的CSV或XLSX文件（表单字段 file）批量导入用户，dry_run=true 时只校验并返回报告
+func ImportUsers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+
+		header, err := c.FormFile("file")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请上传导入文件",
+				"error":   err.Error(),
+			})
+			return
+		}
+		file, err := header.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "读取导入文件失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+		defer file.Close()
+
+		rows, err := service.ParseUserImport(header.Filename, file)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "导入文件无效",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+		report, err := userService.ImportUsers(approvalContext(c), c.GetInt("user_id"), rows, dryRun)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "导入用户失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		message := "导入完成"
+		if dryRun {
+			message = "校验完成"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": message,
+			"data":    report,
+		})
+	}
+}
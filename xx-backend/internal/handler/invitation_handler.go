@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetInvitations 获取邀请列表
+func GetInvitations(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.InvitationListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := userService.GetInvitations(c.Request.Context(), query)
+		respondList(c, result, err, "获取邀请列表失败")
+	}
+}
+
+// GetInvitation 获取邀请详情
+func GetInvitation(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的邀请ID"})
+			return
+		}
+
+		invitation, err := userService.GetInvitation(c.Request.Context(), id)
+		if err != nil {
+			respondUpdateError(c, err, "邀请不存在", "获取邀请失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    invitation,
+		})
+	}
+}
+
+// CreateInvitation 邀请新用户，创建待激活的用户并发送邀请链接
+func CreateInvitation(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.InvitationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		invitation, err := userService.CreateInvitation(approvalContext(c), c.GetInt("user_id"), &req)
+		if err != nil {
+			// 已以普通用户角色邀请，指定的角色需要审批
+			var approval *service.ApprovalRequiredError
+			if invitation != nil && errors.As(err, &approval) {
+				c.JSON(http.StatusAccepted, gin.H{
+					"code":           202,
+					"message":        "邀请已创建，分配角色需要审批，已提交变更请求",
+					"data":           invitation,
+					"change_request": approval.Request,
+				})
+				return
+			}
+			respondUpdateError(c, err, "邀请不存在", "创建邀请失败")
+			return
+		}
+
+		message := "邀请已发送"
+		if invitation.SendError != "" {
+			message = "邀请已创建，但发送失败，请稍后重新发送"
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": message,
+			"data":    invitation,
+		})
+	}
+}
+
+// ResendInvitation 重新发送邀请，之前的链接失效
+func ResendInvitation(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的邀请ID"})
+			return
+		}
+
+		invitation, err := userService.ResendInvitation(c.Request.Context(), c.GetInt("user_id"), id)
+		if err != nil {
+			if errors.Is(err, service.ErrNotificationUnavailable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "发送邀请失败", "error": err.Error()})
+				return
+			}
+			respondUpdateError(c, err, "邀请不存在", "发送邀请失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "邀请已发送",
+			"data":    invitation,
+		})
+	}
+}
+
+// RevokeInvitation 撤销邀请并删除待激活的用户
+func RevokeInvitation(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的邀请ID"})
+			return
+		}
+
+		invitation, err := userService.RevokeInvitation(c.Request.Context(), c.GetInt("user_id"), id)
+		if err != nil {
+			respondUpdateError(c, err, "邀请不存在", "撤销邀请失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "撤销成功",
+			"data":    invitation,
+		})
+	}
+}
+
+// GetInvitationInfo 受邀人打开邀请链接时获取邀请信息（无需登录）
+func GetInvitationInfo(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		info, err := userService.GetInvitationInfo(c.Request.Context(), c.Query("token"))
+		if err != nil {
+			respondInvitationError(c, err, "获取邀请信息失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    info,
+		})
+	}
+}
+
+// AcceptInvitation 受邀人设置密码和个人资料，激活账号（无需登录）
+func AcceptInvitation(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.AcceptInvitationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		user, err := userService.AcceptInvitation(c.Request.Context(), &req)
+		if err != nil {
+			respondInvitationError(c, err, "激活账号失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "激活成功，请登录",
+			"data":    user,
+		})
+	}
+}
+
+// respondInvitationError 邀请链接无效时返回400，其他错误按更新错误处理
+func respondInvitationError(c *gin.Context, err error, failMessage string) {
+	if errors.Is(err, service.ErrInvalidInvitation) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "邀请链接无效",
+			"error":   err.Error(),
+		})
+		return
+	}
+	respondUpdateError(c, err, "邀请不存在", failMessage)
+}
@@ -0,0 +1,159 @@
+package handler
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// jobEventInterval 推送任务进度的间隔
+const jobEventInterval = time.Second
+
+// GetJobs 获取当前用户创建的后台任务列表
+func GetJobs(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.JobListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := userService.GetJobs(c.Request.Context(), c.GetInt("user_id"), query)
+		respondList(c, result, err, "获取任务列表失败")
+	}
+}
+
+// GetJob 获取后台任务的状态和进度
+func GetJob(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+			return
+		}
+
+		job, err := userService.GetJob(c.Request.Context(), c.GetInt("user_id"), id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "任务不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取任务失败", "error": err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    job,
+		})
+	}
+}
+
+// DownloadJobFile 下载后台任务生成的文件
+func DownloadJobFile(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+			return
+		}
+
+		job, err := userService.GetJobFile(c.Request.Context(), c.GetInt("user_id"), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "任务不存在"})
+			case errors.Is(err, service.ErrConflict):
+				c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "下载任务文件失败", "error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "下载任务文件失败", "error": err.Error()})
+			}
+			return
+		}
+
+		c.FileAttachment(job.FilePath, job.FileName)
+	}
+}
+
+// CancelJob 取消自己创建的未结束任务
+func CancelJob(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+			return
+		}
+
+		job, err := userService.CancelJob(c.Request.Context(), c.GetInt("user_id"), id)
+		if err != nil {
+			switch {
+			case errors.Is(err, gorm.ErrRecordNotFound):
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "任务不存在"})
+			case errors.Is(err, service.ErrConflict):
+				c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "取消任务失败", "error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "取消任务失败", "error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "已请求取消",
+			"data":    job,
+		})
+	}
+}
+
+// JobEvents 以Server-Sent Events推送任务进度（progress 事件），任务结束时发送 done 事件并关闭连接
+func JobEvents(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的任务ID"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		operatorID := c.GetInt("user_id")
+		job, err := userService.GetJob(ctx, operatorID, id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "任务不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取任务失败", "error": err.Error()})
+			return
+		}
+
+		ticker := time.NewTicker(jobEventInterval)
+		defer ticker.Stop()
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+		c.Stream(func(w io.Writer) bool {
+			if job.Finished() {
+				c.SSEvent("done", job)
+				return false
+			}
+			c.SSEvent("progress", job)
+			select {
+			case <-ctx.Done():
+				return false
+			case <-ticker.C:
+			}
+			// 任务可能由其他实例执行，进度以数据库为准
+			if job, err = userService.GetJob(ctx, operatorID, id); err != nil {
+				c.SSEvent("error", gin.H{"message": err.Error()})
+				return false
+			}
+			return true
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package handler
+
+import (
+	"net/http"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLifecyclePolicy 获取当前租户的账号生命周期策略
+func GetLifecyclePolicy(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		policy, err := userService.GetLifecyclePolicy(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "获取生命周期策略失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    policy,
+		})
+	}
+}
+
+// SetLifecyclePolicy 设置当前租户的账号生命周期策略
+func SetLifecyclePolicy(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.LifecyclePolicyRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		policy, err := userService.SetLifecyclePolicy(c.Request.Context(), &req)
+		if err != nil {
+			respondUpdateError(c, err, "生命周期策略不存在", "设置生命周期策略失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "设置成功",
+			"data":    policy,
+		})
+	}
+}
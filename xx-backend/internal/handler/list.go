@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"xx-backend/pkg/listquery"
+
+	"github.com/gin-gonic/gin"
+)
+
+// parseListQuery 按列表字段声明解析查询参数，参数无效时直接返回400
+func parseListQuery(c *gin.Context, schema *listquery.Schema) (*listquery.Query, bool) {
+	query, err := listquery.Parse(c.Request.URL.Query(), schema)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return query, true
+}
+
+// respondList 输出统一格式的列表响应
+func respondList[T any](c *gin.Context, result *listquery.Result[T], err error, failMessage string) {
+	if err != nil {
+		if errors.Is(err, listquery.ErrInvalidQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"code":    500,
+			"message": failMessage,
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	var list interface{} = result.List
+	if len(result.Fields) > 0 {
+		if list, err = selectFields(result.List, result.Fields); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": failMessage,
+				"error":   err.Error(),
+			})
+			return
+		}
+	}
+
+	data := gin.H{
+		"list":        list,
+		"page":        result.Page,
+		"size":        result.PageSize,
+		"next_cursor": result.NextCursor,
+		"prev_cursor": result.PrevCursor,
+	}
+	if result.Total != nil {
+		data["total"] = *result.Total
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code":    200,
+		"message": "获取成功",
+		"data":    data,
+	})
+}
+
+// selectFields 只保留列表中指定的字段（按JSON字段名）
+func selectFields(list interface{}, fields []string) ([]map[string]interface{}, error) {
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, err
+	}
+	var items []map[string]interface{}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	for i, item := range items {
+		selected := make(map[string]interface{}, len(fields))
+		for _, field := range fields {
+			if value, ok := item[field]; ok {
+				selected[field] = value
+			}
+		}
+		items[i] = selected
+	}
+	return items, nil
+}
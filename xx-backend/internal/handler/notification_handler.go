@@ -0,0 +1,41 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SendNotification 向指定用户和用户组成员发送通知
+func SendNotification(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.NotificationRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		result, err := userService.SendNotification(c.Request.Context(), c.GetInt("user_id"), &req)
+		if err != nil {
+			if errors.Is(err, service.ErrNotificationUnavailable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "发送通知失败", "error": err.Error()})
+				return
+			}
+			respondUpdateError(c, err, "用户组不存在", "发送通知失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "发送成功",
+			"data":    result,
+		})
+	}
+}
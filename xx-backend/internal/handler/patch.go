@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// readMergePatch 读取更新请求体，PUT 和 PATCH 都按 JSON Merge Patch（RFC 7396）处理，
+// 请求头可以是 application/json 或 application/merge-patch+json
+func readMergePatch(c *gin.Context) ([]byte, bool) {
+	if contentType := c.GetHeader("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/json" && mediaType != "application/merge-patch+json") {
+			c.JSON(http.StatusUnsupportedMediaType, gin.H{
+				"code":    415,
+				"message": "请求体必须是 application/json 或 application/merge-patch+json",
+			})
+			return nil, false
+		}
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "请求参数错误",
+			"error":   err.Error(),
+		})
+		return nil, false
+	}
+	return body, true
+}
+
+// respondUpdateError 输出更新失败的响应：字段错误返回422并按字段列出原因，没有字段权限返回403，版本号不匹配返回412
+func respondUpdateError(c *gin.Context, err error, notFoundMessage, failMessage string) {
+	if respondApprovalRequired(c, err) {
+		return
+	}
+	var syntaxErr *json.SyntaxError
+	var fieldErrs service.FieldErrors
+	switch {
+	case errors.As(err, &syntaxErr):
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+	case errors.As(err, &fieldErrs):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"code": 422, "message": failMessage, "error": err.Error(), "errors": fieldErrs})
+	case errors.Is(err, service.ErrPreconditionFailed):
+		respondPreconditionFailed(c)
+	case errors.Is(err, service.ErrFieldForbidden), errors.Is(err, service.ErrOutOfDataScope):
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "message": failMessage, "error": err.Error()})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": notFoundMessage})
+	case errors.Is(err, service.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": failMessage, "error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": failMessage, "error": err.Error()})
+	}
+}
+
+// respondDeleteError 删除接口的错误响应：删除策略等查询参数不合法时返回400，其余同 respondUpdateError
+func respondDeleteError(c *gin.Context, err error, notFoundMessage, failMessage string) {
+	var fieldErrs service.FieldErrors
+	if errors.As(err, &fieldErrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error(), "errors": fieldErrs})
+		return
+	}
+	respondUpdateError(c, err, notFoundMessage, failMessage)
+}
@@ -0,0 +1,110 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+func TestRespondUpdateError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		delete bool
+		status int
+	}{
+		{name: "approval required", err: &service.ApprovalRequiredError{Request: &model.ChangeRequest{ID: 1}}, status: http.StatusAccepted},
+		{name: "syntax error", err: json.Unmarshal([]byte("{"), &struct{}{}), status: http.StatusBadRequest},
+		{name: "field errors", err: service.FieldErrors{"username": "不支持的字段"}, status: http.StatusUnprocessableEntity},
+		{name: "precondition failed", err: service.ErrPreconditionFailed, status: http.StatusPreconditionFailed},
+		{name: "field forbidden", err: fmt.Errorf("%w: role_id", service.ErrFieldForbidden), status: http.StatusForbidden},
+		{name: "out of data scope", err: service.ErrOutOfDataScope, status: http.StatusForbidden},
+		{name: "not found", err: gorm.ErrRecordNotFound, status: http.StatusNotFound},
+		{name: "conflict", err: service.ErrRoleCycle, status: http.StatusConflict},
+		{name: "internal", err: errors.New("boom"), status: http.StatusInternalServerError},
+		{name: "delete with invalid strategy", err: service.FieldErrors{"strategy": "不支持的删除策略"}, delete: true, status: http.StatusBadRequest},
+		{name: "delete conflict", err: service.ErrConflict, delete: true, status: http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			if tt.delete {
+				respondDeleteError(c, tt.err, "不存在", "删除失败")
+			} else {
+				respondUpdateError(c, tt.err, "不存在", "更新失败")
+			}
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d (body %s)", w.Code, tt.status, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMergePatchRequest(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		errors      string
+	}{
+		{name: "valid", contentType: "application/merge-patch+json", body: `{"nickname":"bob"}`, status: http.StatusOK},
+		{name: "json with charset", contentType: "application/json; charset=utf-8", body: `{"nickname":"bob"}`, status: http.StatusOK},
+		{name: "unsupported media type", contentType: "text/plain", body: `{"nickname":"bob"}`, status: http.StatusUnsupportedMediaType},
+		{name: "unknown field", contentType: "application/json", body: `{"username":"root"}`, status: http.StatusUnprocessableEntity, errors: `{"username":"不支持的字段"}`},
+		{name: "not an object", contentType: "application/json", body: `[1]`, status: http.StatusUnprocessableEntity, errors: `{"$":"请求体必须是JSON对象"}`},
+		{name: "malformed", contentType: "application/json", body: `{"nickname"`, status: http.StatusBadRequest},
+	}
+
+	router := gin.New()
+	router.PATCH("/users/:id", func(c *gin.Context) {
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		if _, err := service.DecodeUserUpdate(body); err != nil {
+			respondUpdateError(c, err, "用户不存在", "更新用户失败")
+			return
+		}
+		c.Status(http.StatusOK)
+	})
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/users/1", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d (body %s)", w.Code, tt.status, w.Body.String())
+			}
+			if tt.errors == "" {
+				return
+			}
+			var resp struct {
+				Errors json.RawMessage `json:"errors"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if string(resp.Errors) != tt.errors {
+				t.Errorf("errors = %s, want %s", resp.Errors, tt.errors)
+			}
+		})
+	}
+}
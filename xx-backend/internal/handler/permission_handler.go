@@ -0,0 +1,186 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPermissions 获取权限列表
+func GetPermissions(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.PermissionListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := userService.GetPermissions(c.Request.Context(), query)
+		respondList(c, result, err, "获取权限列表失败")
+	}
+}
+
+// CreatePermission 创建权限
+func CreatePermission(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var permission model.Permission
+		if err := c.ShouldBindJSON(&permission); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.CreatePermission(c.Request.Context(), &permission); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "创建权限失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "创建成功",
+			"data":    permission,
+		})
+	}
+}
+
+// DeletePermission 删除权限
+func DeletePermission(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的权限ID",
+			})
+			return
+		}
+
+		if err := userService.DeletePermission(c.Request.Context(), id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "删除权限失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
+
+// GetRolePermissions 获取角色的有效权限（包含继承的权限和菜单）
+func GetRolePermissions(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的角色ID",
+			})
+			return
+		}
+
+		permissions, err := userService.GetEffectivePermissions(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "获取角色权限失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    permissions,
+		})
+	}
+}
+
+// SetRolePermissions 设置角色权限
+func SetRolePermissions(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的角色ID",
+			})
+			return
+		}
+
+		var req struct {
+			PermissionIDs []int `json:"permission_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		// 需要审批时返回202和变更请求
+		if err := userService.SetRolePermissions(approvalContext(c), c.GetInt("user_id"), id, req.PermissionIDs); err != nil {
+			respondUpdateError(c, err, "角色不存在", "设置角色权限失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "设置成功",
+		})
+	}
+}
+
+// SetRoleMenus 设置角色菜单
+func SetRoleMenus(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的角色ID",
+			})
+			return
+		}
+
+		var req struct {
+			MenuIDs []int `json:"menu_ids" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		// 需要审批时返回202和变更请求
+		if err := userService.SetRoleMenus(approvalContext(c), c.GetInt("user_id"), id, req.MenuIDs); err != nil {
+			respondUpdateError(c, err, "角色不存在", "设置角色菜单失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "设置成功",
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportPersonalData 导出用户的个人数据（zip 归档），需要 user:personal_data 权限
+func ExportPersonalData(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户ID"})
+			return
+		}
+		exportPersonalData(c, userService, id)
+	}
+}
+
+// ExportMyPersonalData 导出当前用户自己的个人数据（zip 归档）
+func ExportMyPersonalData(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		exportPersonalData(c, userService, c.GetInt("user_id"))
+	}
+}
+
+func exportPersonalData(c *gin.Context, userService *service.UserService, id int) {
+	ctx := c.Request.Context()
+	operatorID := c.GetInt("user_id")
+
+	user, err := userService.PreparePersonalDataExport(ctx, operatorID, id)
+	if err != nil {
+		respondUpdateError(c, err, "用户不存在", "导出个人数据失败")
+		return
+	}
+
+	filename := fmt.Sprintf("personal_data_%d_%s.zip", user.ID, time.Now().Format("20060102150405"))
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Header("Content-Type", "application/zip")
+	if err := userService.WritePersonalData(ctx, operatorID, user, c.Writer); err != nil {
+		if c.Writer.Written() {
+			// 已经开始输出文件，只能中断响应
+			log.Printf("Failed to export personal data of user %d: %v", user.ID, err)
+			return
+		}
+		c.Header("Content-Disposition", "")
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "导出个人数据失败", "error": err.Error()})
+	}
+}
+
+// EraseUser 删除（匿名化）用户的个人数据并发布墓碑事件，需要 user:erase 权限
+func EraseUser(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的用户ID"})
+			return
+		}
+
+		var req service.EraseRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		user, err := userService.EraseUser(c.Request.Context(), c.GetInt("user_id"), id, &req)
+		if err != nil {
+			if errors.Is(err, service.ErrErasureUnavailable) {
+				c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "删除个人数据失败", "error": err.Error()})
+				return
+			}
+			respondUpdateError(c, err, "用户不存在", "删除个人数据失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "个人数据已删除",
+			"data":    user,
+		})
+	}
+}
@@ -0,0 +1,242 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetPolicies 获取策略列表
+func GetPolicies(policyService *service.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.PolicyListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := policyService.GetPolicies(c.Request.Context(), query)
+		respondList(c, result, err, "获取策略列表失败")
+	}
+}
+
+// CreatePolicy 创建策略
+func CreatePolicy(policyService *service.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var policy model.Policy
+		if err := c.ShouldBindJSON(&policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := policyService.CreatePolicy(c.Request.Context(), &policy); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "创建策略失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "创建成功",
+			"data":    policy,
+		})
+	}
+}
+
+// UpdatePolicy 更新策略
+func UpdatePolicy(policyService *service.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的策略ID",
+			})
+			return
+		}
+
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+		update, err := service.DecodePolicyUpdate(data)
+		if err != nil {
+			respondPolicyUpdateError(c, err)
+			return
+		}
+
+		if err := policyService.UpdatePolicy(c.Request.Context(), id, update); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "策略不存在"})
+				return
+			}
+			respondPolicyUpdateError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "更新成功",
+		})
+	}
+}
+
+// respondPolicyUpdateError 策略的更新内容无效（如 effect 不是 allow 或 deny）时返回400，字段错误列在 errors 中
+func respondPolicyUpdateError(c *gin.Context, err error) {
+	var fieldErrs service.FieldErrors
+	if errors.As(err, &fieldErrs) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "更新策略失败", "error": err.Error(), "errors": fieldErrs})
+		return
+	}
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "更新策略失败", "error": err.Error()})
+}
+
+// DeletePolicy 删除策略
+func DeletePolicy(policyService *service.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的策略ID",
+			})
+			return
+		}
+
+		if err := policyService.DeletePolicy(c.Request.Context(), id); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "删除策略失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
+
+// EvaluatePolicy 模拟一次授权请求，返回策略引擎的决策
+func EvaluatePolicy(policyService *service.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			UserID      int                    `json:"user_id" binding:"required"`
+			Object      string                 `json:"object" binding:"required"`
+			Action      string                 `json:"action" binding:"required"`
+			ObjectAttrs map[string]interface{} `json:"object_attrs"`
+			Env         map[string]interface{} `json:"env"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		subject, err := policyService.SubjectAttributes(c.Request.Context(), req.UserID)
+		if err == nil && subject["tenant_id"] != c.GetUint("tenant_id") && !c.GetBool("is_platform_admin") {
+			err = gorm.ErrRecordNotFound
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "用户不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		env := service.EnvironmentAttributes(c.ClientIP(), time.Now())
+		for k, v := range req.Env {
+			env[k] = v
+		}
+
+		decision := policyService.Evaluate(&service.AuthzRequest{
+			TenantID:    c.GetUint("tenant_id"),
+			Subject:     subject,
+			Object:      req.Object,
+			ObjectAttrs: req.ObjectAttrs,
+			Action:      req.Action,
+			Env:         env,
+		})
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    decision,
+		})
+	}
+}
+
+// ExplainPolicy 解释用户对权限或路由的授权决策，返回角色、限时授权、数据范围和策略组成的决策链
+func ExplainPolicy(policyService *service.PolicyService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req service.ExplainRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		subject, err := policyService.SubjectAttributes(c.Request.Context(), req.UserID)
+		if err == nil && subject["tenant_id"] != c.GetUint("tenant_id") && !c.GetBool("is_platform_admin") {
+			err = gorm.ErrRecordNotFound
+		}
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{
+				"code":    404,
+				"message": "用户不存在",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		explanation, err := policyService.Explain(c.Request.Context(), &req, service.EnvironmentAttributes(c.ClientIP(), time.Now()))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "解释授权决策失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    explanation,
+		})
+	}
+}
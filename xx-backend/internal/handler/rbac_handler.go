@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportRBAC 导出当前租户的RBAC配置（format=yaml|json）
+func ExportRBAC(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		manifest, err := userService.ExportRBAC(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "导出RBAC配置失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		format := c.DefaultQuery("format", "yaml")
+		var data []byte
+		var contentType string
+		switch format {
+		case "yaml":
+			data, err = yaml.Marshal(manifest)
+			contentType = "application/x-yaml; charset=utf-8"
+		case "json":
+			data, err = json.MarshalIndent(manifest, "", "  ")
+			contentType = "application/json; charset=utf-8"
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "不支持的格式: " + format})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "导出RBAC配置失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", "attachment; filename=rbac."+format)
+		c.Data(http.StatusOK, contentType, data)
+	}
+}
+
+// SyncRBAC 按请求体中的YAML或JSON配置同步RBAC（dry_run=true 只返回差异，prune=true 删除多余数据）
+func SyncRBAC(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		data, err := c.GetRawData()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "读取请求体失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		manifest, err := service.ParseRBACManifest(data)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "RBAC配置无效",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(c.Query("dry_run"))
+		prune, _ := strconv.ParseBool(c.Query("prune"))
+		result, err := userService.SyncRBAC(c.Request.Context(), manifest, service.SyncOptions{DryRun: dryRun, Prune: prune})
+		if err != nil {
+			if errors.Is(err, service.ErrConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"code":    409,
+					"message": "同步RBAC配置失败",
+					"error":   err.Error(),
+				})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "同步RBAC配置失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "同步成功",
+			"data":    result,
+		})
+	}
+}
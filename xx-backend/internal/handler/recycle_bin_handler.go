@@ -0,0 +1,112 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// GetRecycleBin 获取回收站中已删除的用户、角色或菜单，:type 为 users、roles 或 menus
+func GetRecycleBin(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		switch c.Param("type") {
+		case service.RecycleUsers:
+			query, ok := parseListQuery(c, service.DeletedUserListSchema)
+			if !ok {
+				return
+			}
+			result, err := userService.GetDeletedUsers(ctx, c.GetInt("user_id"), query)
+			respondList(c, result, err, "获取回收站失败")
+		case service.RecycleRoles:
+			query, ok := parseListQuery(c, service.DeletedRoleListSchema)
+			if !ok {
+				return
+			}
+			result, err := userService.GetDeletedRoles(ctx, query)
+			respondList(c, result, err, "获取回收站失败")
+		case service.RecycleMenus:
+			query, ok := parseListQuery(c, service.DeletedMenuListSchema)
+			if !ok {
+				return
+			}
+			result, err := userService.GetDeletedMenus(ctx, query)
+			respondList(c, result, err, "获取回收站失败")
+		default:
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "不支持的回收站类型"})
+		}
+	}
+}
+
+// RestoreRecycleBin 从回收站恢复记录，用户名、邮箱或角色名已被占用时返回冲突
+func RestoreRecycleBin(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind, id, ok := parseRecycleBinTarget(c)
+		if !ok {
+			return
+		}
+
+		if err := userService.RestoreRecord(c.Request.Context(), c.GetInt("user_id"), kind, id); err != nil {
+			respondRecycleBinError(c, err, "恢复失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "恢复成功",
+		})
+	}
+}
+
+// PurgeRecycleBin 从回收站永久删除记录
+func PurgeRecycleBin(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		kind, id, ok := parseRecycleBinTarget(c)
+		if !ok {
+			return
+		}
+
+		if err := userService.PurgeRecord(c.Request.Context(), c.GetInt("user_id"), kind, id); err != nil {
+			respondRecycleBinError(c, err, "永久删除失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "永久删除成功",
+		})
+	}
+}
+
+func parseRecycleBinTarget(c *gin.Context) (string, int, bool) {
+	kind := c.Param("type")
+	switch kind {
+	case service.RecycleUsers, service.RecycleRoles, service.RecycleMenus:
+	default:
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "不支持的回收站类型"})
+		return "", 0, false
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的ID"})
+		return "", 0, false
+	}
+	return kind, id, true
+}
+
+func respondRecycleBinError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "回收站中不存在该记录"})
+	case errors.Is(err, service.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": message, "error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": message, "error": err.Error()})
+	}
+}
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SearchUsers 全文搜索用户，支持前缀、模糊匹配和中文片段，结果按相关度排序并带高亮片段
+func SearchUsers(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": "page 必须是整数"})
+			return
+		}
+		pageSize, err := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": "page_size 必须是整数"})
+			return
+		}
+
+		result, err := userService.SearchUsers(c.Request.Context(), c.GetInt("user_id"), &service.UserSearchRequest{
+			Query:    c.Query("q"),
+			Page:     page,
+			PageSize: pageSize,
+		})
+		if err != nil {
+			switch {
+			case errors.Is(err, service.ErrInvalidSearch):
+				c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请求参数错误", "error": err.Error()})
+			case errors.Is(err, service.ErrSearchDisabled):
+				c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "message": "搜索失败", "error": err.Error()})
+			default:
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "搜索失败", "error": err.Error()})
+			}
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    result,
+		})
+	}
+}
+
+// RebuildSearchIndex 创建后台任务，从数据库重建用户搜索索引
+func RebuildSearchIndex(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		job, err := userService.StartSearchRebuildJob(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrSearchDisabled) {
+				status = http.StatusServiceUnavailable
+			}
+			c.JSON(status, gin.H{
+				"code":    status,
+				"message": "创建重建索引任务失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    202,
+			"message": "重建索引任务已创建",
+			"data":    job,
+		})
+	}
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTenants 获取租户列表
+func GetTenants(tenantService *service.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := parseListQuery(c, service.TenantListSchema)
+		if !ok {
+			return
+		}
+
+		result, err := tenantService.GetTenants(c.Request.Context(), query)
+		respondList(c, result, err, "获取租户列表失败")
+	}
+}
+
+// CreateTenant 创建租户
+func CreateTenant(tenantService *service.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var t model.Tenant
+		if err := c.ShouldBindJSON(&t); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := tenantService.CreateTenant(c.Request.Context(), &t); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "创建租户失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "创建成功",
+			"data":    t,
+		})
+	}
+}
+
+// UpdateTenant 更新租户
+func UpdateTenant(tenantService *service.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的租户ID",
+			})
+			return
+		}
+
+		var updates map[string]interface{}
+		if err := c.ShouldBindJSON(&updates); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := tenantService.UpdateTenant(c.Request.Context(), uint(id), updates); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "更新租户失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "更新成功",
+		})
+	}
+}
+
+// DeleteTenant 删除租户
+func DeleteTenant(tenantService *service.TenantService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "无效的租户ID",
+			})
+			return
+		}
+
+		if err := tenantService.DeleteTenant(c.Request.Context(), uint(id)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "删除租户失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"xx-backend/internal/model"
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUserFields 获取当前租户的用户自定义字段
+func GetUserFields(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		fields, err := userService.GetUserFields(c.Request.Context())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "获取自定义字段失败",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    fields,
+		})
+	}
+}
+
+// GetUserField 获取自定义字段详情
+func GetUserField(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的字段ID"})
+			return
+		}
+
+		field, err := userService.GetUserField(c.Request.Context(), id)
+		if err != nil {
+			respondUpdateError(c, err, "自定义字段不存在", "获取自定义字段失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    field,
+		})
+	}
+}
+
+// CreateUserField 创建自定义字段
+func CreateUserField(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var field model.UserField
+		if err := c.ShouldBindJSON(&field); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		if err := userService.CreateUserField(c.Request.Context(), &field); err != nil {
+			respondUpdateError(c, err, "自定义字段不存在", "创建自定义字段失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "创建成功",
+			"data":    field,
+		})
+	}
+}
+
+// UpdateUserField 按合并补丁更新自定义字段，键名和类型不能修改
+func UpdateUserField(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的字段ID"})
+			return
+		}
+
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		update, err := service.DecodeUserFieldUpdate(body)
+		if err != nil {
+			respondUpdateError(c, err, "自定义字段不存在", "更新自定义字段失败")
+			return
+		}
+
+		field, err := userService.UpdateUserField(c.Request.Context(), id, update)
+		if err != nil {
+			respondUpdateError(c, err, "自定义字段不存在", "更新自定义字段失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "更新成功",
+			"data":    field,
+		})
+	}
+}
+
+// DeleteUserField 删除自定义字段，同时移除所有用户在该字段上的值
+func DeleteUserField(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的字段ID"})
+			return
+		}
+
+		if err := userService.DeleteUserField(c.Request.Context(), id); err != nil {
+			respondUpdateError(c, err, "自定义字段不存在", "删除自定义字段失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
@@ -8,34 +9,24 @@ import (
 	"xx-backend/internal/service"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
+// GetUsers 获取用户列表，可以用 attr.<key> 按自定义字段过滤
 func GetUsers(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-		search := c.Query("search")
-
-		users, total, err := userService.GetUsers(page, pageSize, search)
+		schema, err := userService.UserListSchema(c.Request.Context(), c.GetInt("user_id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "获取用户列表失败",
-				"error":   err.Error(),
-			})
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取用户列表失败", "error": err.Error()})
+			return
+		}
+		query, ok := parseListQuery(c, schema)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"code":    200,
-			"message": "获取成功",
-			"data": gin.H{
-				"list":  users,
-				"total": total,
-				"page":  page,
-				"size":  pageSize,
-			},
-		})
+		result, err := userService.GetUsers(c.Request.Context(), c.GetInt("user_id"), query)
+		respondList(c, result, err, "获取用户列表失败")
 	}
 }
 
@@ -48,7 +39,7 @@ func GetUser(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		user, err := userService.GetUser(int(id))
+		user, err := userService.GetUser(c.Request.Context(), c.GetInt("user_id"), int(id))
 		if err != nil {
 			c.JSON(http.StatusNotFound, gin.H{
 				"code":    404,
@@ -58,6 +49,7 @@ func GetUser(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
+		setETag(c, user.Version)
 		c.JSON(http.StatusOK, gin.H{
 			"code":    200,
 			"message": "获取成功",
@@ -78,12 +70,19 @@ func CreateUser(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		if err := userService.CreateUser(&user); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "创建用户失败",
-				"error":   err.Error(),
-			})
+		if err := userService.CreateUser(approvalContext(c), c.GetInt("user_id"), &user); err != nil {
+			// 用户已以普通用户角色创建，指定的角色需要审批
+			var approval *service.ApprovalRequiredError
+			if errors.As(err, &approval) {
+				c.JSON(http.StatusAccepted, gin.H{
+					"code":           202,
+					"message":        "创建成功，分配角色需要审批，已提交变更请求",
+					"data":           user,
+					"change_request": approval.Request,
+				})
+				return
+			}
+			respondUpdateError(c, err, "用户不存在", "创建用户失败")
 			return
 		}
 
@@ -95,6 +94,7 @@ func CreateUser(userService *service.UserService) gin.HandlerFunc {
 	}
 }
 
+// UpdateUser 按合并补丁更新用户，只能修改允许的字段
 func UpdateUser(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idStr := c.Param("id")
@@ -104,25 +104,28 @@ func UpdateUser(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		var updates map[string]interface{}
-		if err := c.ShouldBindJSON(&updates); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"code":    400,
-				"message": "请求参数错误",
-				"error":   err.Error(),
-			})
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		update, err := service.DecodeUserUpdate(body)
+		if err != nil {
+			respondUpdateError(c, err, "用户不存在", "更新用户失败")
 			return
 		}
 
-		if err := userService.UpdateUser(int(id), updates); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "更新用户失败",
-				"error":   err.Error(),
-			})
+		// 修改角色需要审批时返回202和变更请求
+		newVersion, err := userService.UpdateUser(approvalContext(c), c.GetInt("user_id"), id, update, version)
+		if err != nil {
+			respondUpdateError(c, err, "用户不存在", "更新用户失败")
 			return
 		}
 
+		setETag(c, newVersion)
 		c.JSON(http.StatusOK, gin.H{
 			"code":    200,
 			"message": "更新成功",
@@ -139,7 +142,24 @@ func DeleteUser(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		if err := userService.DeleteUser(int(id)); err != nil {
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+
+		// 需要审批时返回202和变更请求
+		if err := userService.DeleteUser(approvalContext(c), c.GetInt("user_id"), int(id), version); err != nil {
+			if respondApprovalRequired(c, err) {
+				return
+			}
+			if errors.Is(err, service.ErrPreconditionFailed) {
+				respondPreconditionFailed(c)
+				return
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "用户不存在"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    500,
 				"message": "删除用户失败",
@@ -158,21 +178,13 @@ func DeleteUser(userService *service.UserService) gin.HandlerFunc {
 // 角色相关处理器
 func GetRoles(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		roles, err := userService.GetRoles()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "获取角色列表失败",
-				"error":   err.Error(),
-			})
+		query, ok := parseListQuery(c, service.RoleListSchema)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"code":    200,
-			"message": "获取成功",
-			"data":    roles,
-		})
+		result, err := userService.GetRoles(c.Request.Context(), query)
+		respondList(c, result, err, "获取角色列表失败")
 	}
 }
 
@@ -188,12 +200,8 @@ func CreateRole(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		if err := userService.CreateRole(&role); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "创建角色失败",
-				"error":   err.Error(),
-			})
+		if err := userService.CreateRole(c.Request.Context(), c.GetInt("user_id"), &role); err != nil {
+			respondUpdateError(c, err, "角色不存在", "创建角色失败")
 			return
 		}
 
@@ -205,9 +213,38 @@ func CreateRole(userService *service.UserService) gin.HandlerFunc {
 	}
 }
 
+// GetRole 获取角色详情，ETag 为角色的版本号
+func GetRole(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的角色ID"})
+			return
+		}
+
+		role, err := userService.GetRole(c.Request.Context(), id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "角色不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取角色失败", "error": err.Error()})
+			return
+		}
+
+		setETag(c, role.Version)
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    role,
+		})
+	}
+}
+
+// UpdateRole 按合并补丁更新角色
 func UpdateRole(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -216,25 +253,28 @@ func UpdateRole(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		var updates map[string]interface{}
-		if err := c.ShouldBindJSON(&updates); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"code":    400,
-				"message": "请求参数错误",
-				"error":   err.Error(),
-			})
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		update, err := service.DecodeRoleUpdate(body)
+		if err != nil {
+			respondUpdateError(c, err, "角色不存在", "更新角色失败")
 			return
 		}
 
-		if err := userService.UpdateRole(uint(id), updates); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "更新角色失败",
-				"error":   err.Error(),
-			})
+		// 修改父角色需要审批时返回202和变更请求
+		newVersion, err := userService.UpdateRole(approvalContext(c), c.GetInt("user_id"), id, update, version)
+		if err != nil {
+			respondUpdateError(c, err, "角色不存在", "更新角色失败")
 			return
 		}
 
+		setETag(c, newVersion)
 		c.JSON(http.StatusOK, gin.H{
 			"code":    200,
 			"message": "更新成功",
@@ -253,12 +293,15 @@ func DeleteRole(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		if err := userService.DeleteRole(uint(id)); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "删除角色失败",
-				"error":   err.Error(),
-			})
+		strategy := c.DefaultQuery("strategy", service.RoleDeleteBlock)
+		reassignTo, _ := strconv.Atoi(c.Query("reassign_to"))
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+
+		if err := userService.DeleteRole(approvalContext(c), c.GetInt("user_id"), uint(id), strategy, reassignTo, version); err != nil {
+			respondDeleteError(c, err, "角色不存在", "删除角色失败")
 			return
 		}
 
@@ -272,21 +315,13 @@ func DeleteRole(userService *service.UserService) gin.HandlerFunc {
 // 菜单相关处理器
 func GetMenus(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		menus, err := userService.GetMenus()
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "获取菜单列表失败",
-				"error":   err.Error(),
-			})
+		query, ok := parseListQuery(c, service.MenuListSchema)
+		if !ok {
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"code":    200,
-			"message": "获取成功",
-			"data":    menus,
-		})
+		result, err := userService.GetMenus(c.Request.Context(), query)
+		respondList(c, result, err, "获取菜单列表失败")
 	}
 }
 
@@ -302,7 +337,7 @@ func CreateMenu(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		if err := userService.CreateMenu(&menu); err != nil {
+		if err := userService.CreateMenu(c.Request.Context(), &menu); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    500,
 				"message": "创建菜单失败",
@@ -319,9 +354,38 @@ func CreateMenu(userService *service.UserService) gin.HandlerFunc {
 	}
 }
 
+// GetMenu 获取菜单详情，ETag 为菜单的版本号
+func GetMenu(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的菜单ID"})
+			return
+		}
+
+		menu, err := userService.GetMenu(c.Request.Context(), id)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "菜单不存在"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "获取菜单失败", "error": err.Error()})
+			return
+		}
+
+		setETag(c, menu.Version)
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "获取成功",
+			"data":    menu,
+		})
+	}
+}
+
+// UpdateMenu 按合并补丁更新菜单
 func UpdateMenu(userService *service.UserService) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		id, err := strconv.Atoi(c.Param("id"))
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{
 				"code":    400,
@@ -330,25 +394,27 @@ func UpdateMenu(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		var updates map[string]interface{}
-		if err := c.ShouldBindJSON(&updates); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{
-				"code":    400,
-				"message": "请求参数错误",
-				"error":   err.Error(),
-			})
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+		body, ok := readMergePatch(c)
+		if !ok {
+			return
+		}
+		update, err := service.DecodeMenuUpdate(body)
+		if err != nil {
+			respondUpdateError(c, err, "菜单不存在", "更新菜单失败")
 			return
 		}
 
-		if err := userService.UpdateMenu(uint(id), updates); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{
-				"code":    500,
-				"message": "更新菜单失败",
-				"error":   err.Error(),
-			})
+		newVersion, err := userService.UpdateMenu(c.Request.Context(), id, update, version)
+		if err != nil {
+			respondUpdateError(c, err, "菜单不存在", "更新菜单失败")
 			return
 		}
 
+		setETag(c, newVersion)
 		c.JSON(http.StatusOK, gin.H{
 			"code":    200,
 			"message": "更新成功",
@@ -367,10 +433,70 @@ func DeleteMenu(userService *service.UserService) gin.HandlerFunc {
 			return
 		}
 
-		if err := userService.DeleteMenu(uint(id)); err != nil {
+		strategy := c.DefaultQuery("strategy", service.MenuDeleteBlock)
+		version, ok := ifMatchVersion(c)
+		if !ok {
+			return
+		}
+
+		if err := userService.DeleteMenu(c.Request.Context(), uint(id), strategy, version); err != nil {
+			respondDeleteError(c, err, "菜单不存在", "删除菜单失败")
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": "删除成功",
+		})
+	}
+}
+
+// MoveMenu 移动菜单或按完整菜单树批量排序
+func MoveMenu(userService *service.UserService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			service.MenuMoveRequest
+			Tree []service.MenuTreeNode `json:"tree"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   err.Error(),
+			})
+			return
+		}
+
+		var err error
+		if req.Tree != nil {
+			err = userService.ReorderMenus(c.Request.Context(), req.Tree)
+		} else if req.ID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "请求参数错误",
+				"error":   "需要指定菜单ID或完整菜单树",
+			})
+			return
+		} else {
+			err = userService.MoveMenu(c.Request.Context(), req.MenuMoveRequest)
+		}
+
+		if err != nil {
+			if errors.Is(err, service.ErrConflict) {
+				c.JSON(http.StatusConflict, gin.H{
+					"code":    409,
+					"message": "移动菜单失败",
+					"error":   err.Error(),
+				})
+				return
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "菜单不存在"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code":    500,
-				"message": "删除菜单失败",
+				"message": "移动菜单失败",
 				"error":   err.Error(),
 			})
 			return
@@ -378,7 +504,7 @@ func DeleteMenu(userService *service.UserService) gin.HandlerFunc {
 
 		c.JSON(http.StatusOK, gin.H{
 			"code":    200,
-			"message": "删除成功",
+			"message": "移动成功",
 		})
 	}
 }
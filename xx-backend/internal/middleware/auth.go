@@ -6,6 +6,8 @@ import (
 
 	"xx-backend/internal/model"
 	"xx-backend/internal/service"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/tenant"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -48,7 +50,7 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		userID, err := authService.(*service.AuthService).ValidateToken(token)
+		userID, tokenTenantID, err := authService.(*service.AuthService).ValidateToken(token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"code":    401,
@@ -59,18 +61,39 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 获取用户名
+		// 获取用户名，并判断是否为平台超级管理员
 		username := "unknown"
+		isPlatformAdmin := false
 		if db, exists := c.Get("db"); exists {
 			var user model.User
-			if err := db.(*gorm.DB).First(&user, userID).Error; err == nil {
+			ctx := tenant.WithTenant(c.Request.Context(), tokenTenantID)
+			if err := db.(*gorm.DB).WithContext(ctx).Preload("Role").First(&user, userID).Error; err == nil {
 				username = user.Username
+				isPlatformAdmin = user.TenantID == model.DefaultTenantID && user.Role.Name == model.PlatformAdminRole
 			}
 		}
 
-		// 将用户ID和用户名存储到context中
+		// token所属租户与请求指定的租户不一致时，只有平台超级管理员可以切换租户
+		tenantID := tokenTenantID
+		if requested := c.GetUint("tenant_id"); c.GetBool("tenant_explicit") && requested != tokenTenantID {
+			if !isPlatformAdmin {
+				c.JSON(http.StatusForbidden, gin.H{
+					"code":    403,
+					"message": "无权访问该租户",
+				})
+				c.Abort()
+				return
+			}
+			tenantID = requested
+		}
+
+		// 将用户ID、用户名和租户存储到context中
 		c.Set("user_id", userID)
 		c.Set("username", username)
+		c.Set("tenant_id", tenantID)
+		c.Set("is_platform_admin", isPlatformAdmin)
+		ctx := tenant.WithTenant(c.Request.Context(), tenantID)
+		c.Request = c.Request.WithContext(history.WithActor(ctx, uint(userID)))
 		c.Next()
 	}
 }
@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"xx-backend/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExplainHeader 授权决策链的请求头和响应头：非生产模式下，请求带有该头时在同名响应头中返回决策链
+const ExplainHeader = "X-Authz-Explain"
+
+// Authorize 使用策略引擎对资源访问进行授权，需在 AuthMiddleware 之后使用。
+// 存在适用策略时按策略决策，没有适用策略时按 PolicyService 配置的默认决策（默认拒绝）。
+func Authorize(policyService *service.PolicyService, resource string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		subject, err := policyService.SubjectAttributes(c.Request.Context(), c.GetInt("user_id"))
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "无法获取用户信息",
+				"error":   err.Error(),
+			})
+			c.Abort()
+			return
+		}
+
+		action := service.MethodActions[c.Request.Method]
+		env := service.EnvironmentAttributes(c.ClientIP(), time.Now())
+		decision := policyService.Evaluate(&service.AuthzRequest{
+			TenantID:    c.GetUint("tenant_id"),
+			Subject:     subject,
+			Object:      resource,
+			ObjectAttrs: service.ObjectAttributes(c.Param("id")),
+			Action:      action,
+			Env:         env,
+		})
+
+		if gin.Mode() != gin.ReleaseMode && c.GetHeader(ExplainHeader) != "" {
+			setExplainHeader(c, policyService, resource, action, env)
+		}
+
+		if policyService.Decide(decision) != service.DecisionAllow {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "无权执行该操作",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// setExplainHeader 把授权决策链写入响应头，便于排查403（仅非生产模式且请求带有 ExplainHeader 时）
+func setExplainHeader(c *gin.Context, policyService *service.PolicyService, resource, action string, env map[string]interface{}) {
+	explanation, err := policyService.Explain(c.Request.Context(), &service.ExplainRequest{
+		UserID:   c.GetInt("user_id"),
+		Object:   resource,
+		Action:   action,
+		Resource: c.Param("id"),
+	}, env)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(explanation)
+	if err != nil {
+		return
+	}
+	c.Header(ExplainHeader, asciiJSON(data))
+}
+
+// asciiJSON 把JSON中的非ASCII字符转义为 \uXXXX，保证可以放在响应头中
+func asciiJSON(data []byte) string {
+	var b strings.Builder
+	for _, r := range string(data) {
+		if r < utf8.RuneSelf {
+			b.WriteRune(r)
+			continue
+		}
+		for _, u := range utf16.Encode([]rune{r}) {
+			fmt.Fprintf(&b, "\\u%04x", u)
+		}
+	}
+	return b.String()
+}
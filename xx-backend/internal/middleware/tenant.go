@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/tenant"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Tenant 解析当前请求的租户：优先读取 X-Tenant-ID 请求头（租户ID或编码），其次是子域名，
+// 都没有时使用默认租户。已登录请求的租户最终由 AuthMiddleware 根据token确定。
+func Tenant() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		db, exists := c.Get("db")
+		if !exists {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"code":    500,
+				"message": "数据库未初始化",
+			})
+			c.Abort()
+			return
+		}
+
+		var t model.Tenant
+		var err error
+		explicit := true
+		if header := c.GetHeader("X-Tenant-ID"); header != "" {
+			t, err = findTenant(db.(*gorm.DB), header)
+		} else if code := subdomain(c.Request.Host); code != "" {
+			t, err = findTenant(db.(*gorm.DB), code)
+		} else {
+			explicit = false
+			err = db.(*gorm.DB).First(&t, model.DefaultTenantID).Error
+		}
+
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code":    400,
+				"message": "租户不存在",
+			})
+			c.Abort()
+			return
+		}
+		if t.Status != 1 {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "租户已被禁用",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Set("tenant_id", t.ID)
+		c.Set("tenant_explicit", explicit)
+		c.Request = c.Request.WithContext(tenant.WithTenant(c.Request.Context(), t.ID))
+		c.Next()
+	}
+}
+
+// PlatformAdmin 仅允许平台超级管理员访问，需在 AuthMiddleware 之后使用
+func PlatformAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !c.GetBool("is_platform_admin") {
+			c.JSON(http.StatusForbidden, gin.H{
+				"code":    403,
+				"message": "需要平台超级管理员权限",
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func findTenant(db *gorm.DB, key string) (model.Tenant, error) {
+	var t model.Tenant
+	if id, err := strconv.ParseUint(key, 10, 64); err == nil {
+		err := db.First(&t, id).Error
+		return t, err
+	}
+	err := db.Where("code = ?", key).First(&t).Error
+	return t, err
+}
+
+// subdomain 从 Host 中提取子域名，如 acme.example.com 返回 acme
+func subdomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if net.ParseIP(host) != nil {
+		return ""
+	}
+	parts := strings.Split(host, ".")
+	if len(parts) < 3 || parts[0] == "www" {
+		return ""
+	}
+	return parts[0]
+}
@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// 需要审批的变更类型
+const (
+	ChangeRoleAssign      = "role_assign"      // 修改用户角色
+	ChangeRolePermissions = "role_permissions" // 修改角色权限
+	ChangeUserDelete      = "user_delete"      // 删除用户
+	ChangeRoleGrant       = "role_grant"       // 限时授予用户角色，按 role_assign 决定是否需要审批
+	ChangeRoleMenus       = "role_menus"       // 修改角色菜单，按 role_permissions 决定是否需要审批
+	ChangeRoleParent      = "role_parent"      // 修改角色的父角色（继承的权限），按 role_permissions 决定是否需要审批
+	ChangeGroupMembers    = "group_members"    // 把用户加入用户组（继承组的角色），按 role_assign 决定是否需要审批
+	ChangeGroupRoles      = "group_roles"      // 设置用户组的角色，按 role_assign 决定是否需要审批
+	ChangeRoleDelete      = "role_delete"      // 删除角色并把用户和用户组转移到其他角色，按 role_assign 决定是否需要审批
+)
+
+// 变更请求状态
+const (
+	ChangeStatusPending  = "pending"
+	ChangeStatusApproved = "approved"
+	ChangeStatusRejected = "rejected"
+	ChangeStatusFailed   = "failed" // 审批通过但执行失败
+)
+
+// ChangeRequest 待审批的特权变更，由提交人以外的用户审批通过后才会执行
+type ChangeRequest struct {
+	ID            int        `json:"id" gorm:"primarykey"`
+	TenantID      uint       `json:"tenant_id" gorm:"not null;default:1;index"`
+	Type          string     `json:"type" gorm:"not null;size:50"`
+	TargetID      int        `json:"target_id" gorm:"not null"`
+	Payload       string     `json:"payload" gorm:"type:text"` // 变更内容（JSON）
+	Reason        string     `json:"reason" gorm:"size:255"`
+	Status        string     `json:"status" gorm:"not null;size:20;default:pending;index"`
+	RequestedBy   uint       `json:"requested_by" gorm:"not null"`
+	ReviewedBy    *uint      `json:"reviewed_by"`
+	ReviewComment string     `json:"review_comment" gorm:"size:255"`
+	ReviewedAt    *time.Time `json:"reviewed_at"`
+	Error         string     `json:"error" gorm:"type:text"` // 执行失败时的错误信息
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// IsValidChangeType 判断是否为支持审批的变更类型
+func IsValidChangeType(changeType string) bool {
+	switch changeType {
+	case ChangeRoleAssign, ChangeRolePermissions, ChangeUserDelete,
+		ChangeRoleGrant, ChangeRoleMenus, ChangeRoleParent, ChangeGroupMembers, ChangeGroupRoles, ChangeRoleDelete:
+		return true
+	}
+	return false
+}
+
+// ApprovalAction 变更类型对应的审批开关（APPROVAL_ACTIONS 中的取值）：分配角色的各种途径都按 role_assign，
+// 改变角色权限的各种途径都按 role_permissions 决定是否需要审批
+func ApprovalAction(changeType string) string {
+	switch changeType {
+	case ChangeRoleGrant, ChangeGroupMembers, ChangeGroupRoles, ChangeRoleDelete:
+		return ChangeRoleAssign
+	case ChangeRoleMenus, ChangeRoleParent:
+		return ChangeRolePermissions
+	}
+	return changeType
+}
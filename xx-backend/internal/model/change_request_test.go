@@ -0,0 +1,32 @@
+package model
+
+import "testing"
+
+func TestApprovalAction(t *testing.T) {
+	tests := []struct {
+		changeType string
+		want       string
+		valid      bool
+	}{
+		{ChangeRoleAssign, ChangeRoleAssign, true},
+		{ChangeRoleGrant, ChangeRoleAssign, true},
+		{ChangeGroupMembers, ChangeRoleAssign, true},
+		{ChangeGroupRoles, ChangeRoleAssign, true},
+		{ChangeRoleDelete, ChangeRoleAssign, true},
+		{ChangeRolePermissions, ChangeRolePermissions, true},
+		{ChangeRoleMenus, ChangeRolePermissions, true},
+		{ChangeRoleParent, ChangeRolePermissions, true},
+		{ChangeUserDelete, ChangeUserDelete, true},
+		{"unknown", "unknown", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.changeType, func(t *testing.T) {
+			if got := ApprovalAction(tt.changeType); got != tt.want {
+				t.Errorf("ApprovalAction(%q) = %q, want %q", tt.changeType, got, tt.want)
+			}
+			if got := IsValidChangeType(tt.changeType); got != tt.valid {
+				t.Errorf("IsValidChangeType(%q) = %v, want %v", tt.changeType, got, tt.valid)
+			}
+		})
+	}
+}
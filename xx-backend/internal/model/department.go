@@ -0,0 +1,38 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Department struct {
+	ID        int            `json:"id" gorm:"primarykey"`
+	TenantID  uint           `json:"tenant_id" gorm:"not null;default:1;index"`
+	Name      string         `json:"name" gorm:"not null;size:50"`
+	ParentID  *int           `json:"parent_id" gorm:"index"`
+	Sort      int            `json:"sort" gorm:"default:0"`
+	Status    int            `json:"status" gorm:"default:1"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// 角色数据范围
+const (
+	DataScopeAll             = "all"               // 全部数据
+	DataScopeDept            = "dept"              // 本部门
+	DataScopeDeptAndChildren = "dept_and_children" // 本部门及以下
+	DataScopeSelf            = "self"              // 仅本人
+	DataScopeCustom          = "custom"            // 自定义部门和用户组
+	DataScopeGroup           = "group"             // 本人所在用户组（包括子组）的成员
+)
+
+// IsValidDataScope 判断数据范围取值是否合法
+func IsValidDataScope(scope string) bool {
+	switch scope {
+	case DataScopeAll, DataScopeDept, DataScopeDeptAndChildren, DataScopeSelf, DataScopeCustom, DataScopeGroup:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+// Group 用户组（如项目组），与部门无关，一个用户可以属于多个组。
+// 组可以嵌套：子组的成员同时是所有上级组的成员，分配给组的角色由全部成员继承
+type Group struct {
+	ID          int       `json:"id" gorm:"primarykey"`
+	TenantID    uint      `json:"tenant_id" gorm:"not null;default:1;uniqueIndex:idx_groups_tenant_name,priority:1"`
+	Name        string    `json:"name" gorm:"not null;size:50;uniqueIndex:idx_groups_tenant_name,priority:2"`
+	Description string    `json:"description" gorm:"size:255"`
+	ParentID    *int      `json:"parent_id" gorm:"index"` // 上级组
+	Members     []User    `json:"members,omitempty" gorm:"many2many:group_members"`
+	Roles       []Role    `json:"roles,omitempty" gorm:"many2many:group_roles"` // 成员继承的角色
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
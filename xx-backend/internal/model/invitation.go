@@ -0,0 +1,32 @@
+package model
+
+import "time"
+
+// 邀请状态
+const (
+	InvitationPending  = "pending"  // 已发送，等待受邀人接受
+	InvitationAccepted = "accepted" // 受邀人已设置密码并激活账号
+	InvitationRevoked  = "revoked"  // 已撤销，待激活的用户随之删除
+	InvitationExpired  = "expired"  // 超过有效期未接受，可以重新发送
+)
+
+// Invitation 邀请新用户加入。创建时生成待激活的用户，邀请链接中的token由服务端签名，
+// 包含邀请ID和 TokenNonce，重新发送时更换 TokenNonce 使之前的链接失效
+type Invitation struct {
+	ID         int        `json:"id" gorm:"primarykey"`
+	TenantID   uint       `json:"tenant_id" gorm:"not null;default:1;index"`
+	UserID     uint       `json:"user_id" gorm:"not null;index"`
+	Email      string     `json:"email" gorm:"not null;size:100"`
+	Status     string     `json:"status" gorm:"not null;size:20;default:pending;index"`
+	TokenNonce string     `json:"-" gorm:"not null;size:64"`
+	ExpiresAt  time.Time  `json:"expires_at" gorm:"index"`
+	SentCount  int        `json:"sent_count" gorm:"not null;default:0"`
+	LastSentAt *time.Time `json:"last_sent_at"`
+	SendError  string     `json:"send_error" gorm:"size:255"` // 最近一次发送失败的原因，发送成功后清空
+	InvitedBy  uint       `json:"invited_by"`
+	AcceptedAt *time.Time `json:"accepted_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	RevokedBy  *uint      `json:"revoked_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,45 @@
+package model
+
+import "time"
+
+// 后台任务类型
+const (
+	JobUserExport    = "user_export"    // 导出用户
+	JobUserBulk      = "user_bulk"      // 批量操作用户
+	JobSearchRebuild = "search_rebuild" // 重建用户搜索索引
+)
+
+// 后台任务状态
+const (
+	JobStatusPending   = "pending"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+	JobStatusCancelled = "cancelled"
+)
+
+// Job 后台任务，记录进度和执行结果，只有创建人可以查看
+type Job struct {
+	ID         int        `json:"id" gorm:"primarykey"`
+	TenantID   uint       `json:"tenant_id" gorm:"not null;default:1;index"`
+	Type       string     `json:"type" gorm:"not null;size:50"`
+	Status     string     `json:"status" gorm:"not null;size:20;default:pending;index"`
+	Params     string     `json:"params" gorm:"type:text"` // 任务参数（JSON）
+	Total      int        `json:"total"`
+	Processed  int        `json:"processed"`
+	Result     string     `json:"result" gorm:"type:mediumtext"` // 执行结果（JSON），如批量操作每一项的结果
+	FileName   string     `json:"file_name" gorm:"size:255"`     // 任务生成的文件，可下载
+	FilePath   string     `json:"-" gorm:"size:255"`
+	Error      string     `json:"error" gorm:"type:text"`
+	Cancelling bool       `json:"cancelling" gorm:"not null;default:false"` // 已请求取消，执行中的实例会尽快停止
+	CreatedBy  uint       `json:"created_by" gorm:"not null;index"`
+	StartedAt  *time.Time `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// Finished 判断任务是否已结束
+func (j *Job) Finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed || j.Status == JobStatusCancelled
+}
@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// 账号生命周期的自动操作类型
+const (
+	LifecycleInactivity   = "inactivity"   // 长期未登录自动禁用
+	LifecycleDeactivation = "deactivation" // 到达计划停用时间自动禁用
+)
+
+// DefaultLifecycleWarningDays 未设置生命周期策略时提前提醒的天数
+const DefaultLifecycleWarningDays = 7
+
+// LifecyclePolicy 租户的账号生命周期策略，每个租户一条
+type LifecyclePolicy struct {
+	ID           int       `json:"id" gorm:"primarykey"`
+	TenantID     uint      `json:"tenant_id" gorm:"not null;default:1;uniqueIndex"`
+	InactiveDays int       `json:"inactive_days" gorm:"not null"`                               // 超过该天数未登录自动禁用，0表示不启用
+	WarningDays  int       `json:"warning_days" gorm:"not null"`                                // 自动禁用前提前提醒的天数，0表示不提醒
+	ExemptRoles  []Role    `json:"exempt_roles" gorm:"many2many:lifecycle_policy_exempt_roles"` // 不会因未登录被禁用的角色
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// LifecycleNotice 已发送的自动禁用提醒，同一用户同一类型同一到期时间只提醒一次
+type LifecycleNotice struct {
+	ID        int       `json:"id" gorm:"primarykey"`
+	TenantID  uint      `json:"tenant_id" gorm:"not null;default:1;index"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_lifecycle_notices_user_kind_due,priority:1"`
+	Kind      string    `json:"kind" gorm:"not null;size:20;uniqueIndex:idx_lifecycle_notices_user_kind_due,priority:2"`
+	DueAt     time.Time `json:"due_at" gorm:"uniqueIndex:idx_lifecycle_notices_user_kind_due,priority:3"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// LoginRecord 用户登录记录，用于个人数据导出；删除个人数据时一并删除
+type LoginRecord struct {
+	ID        int       `json:"id" gorm:"primarykey"`
+	TenantID  uint      `json:"tenant_id" gorm:"not null;default:1;index"`
+	UserID    uint      `json:"user_id" gorm:"not null;index"`
+	IP        string    `json:"ip" gorm:"size:255"`
+	UserAgent string    `json:"user_agent" gorm:"size:255"`
+	CreatedAt time.Time `json:"created_at"`
+}
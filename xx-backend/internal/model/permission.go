@@ -0,0 +1,18 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type Permission struct {
+	ID          int            `json:"id" gorm:"primarykey"`
+	TenantID    uint           `json:"tenant_id" gorm:"not null;default:1;uniqueIndex:idx_permissions_tenant_code,priority:1"`
+	Code        string         `json:"code" gorm:"uniqueIndex:idx_permissions_tenant_code,priority:2;not null;size:100"` // 如 user:create
+	Name        string         `json:"name" gorm:"not null;size:50"`
+	Description string         `json:"description" gorm:"size:255"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
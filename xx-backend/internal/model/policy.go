@@ -0,0 +1,33 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 策略效果
+const (
+	PolicyEffectAllow = "allow"
+	PolicyEffectDeny  = "deny"
+)
+
+// Policy 基于属性的访问控制策略。Subject/Object/Action 决定策略是否适用，
+// Condition 为表达式，可以引用 sub（主体）、obj（资源）、env（环境）三类属性，
+// 例如 `sub.id == obj.id` 或 `env.hour >= 9 && env.hour < 18 && cidr(env.ip, "10.0.0.0/8")`
+type Policy struct {
+	ID          int            `json:"id" gorm:"primarykey"`
+	TenantID    uint           `json:"tenant_id" gorm:"not null;default:1;index"`
+	Name        string         `json:"name" gorm:"not null;size:100"`
+	Subject     string         `json:"subject" gorm:"not null;size:100"` // 角色名、user:<用户ID> 或 *
+	Object      string         `json:"object" gorm:"not null;size:100"`  // 资源名，支持 * 通配，如 user、menu、*
+	Action      string         `json:"action" gorm:"not null;size:50"`   // read、create、update、delete 或 *
+	Condition   string         `json:"condition" gorm:"type:text"`
+	Effect      string         `json:"effect" gorm:"not null;size:10;default:allow"`
+	Priority    int            `json:"priority" gorm:"default:0"` // 数值越大越先匹配，仅影响解释结果中的顺序
+	Status      int            `json:"status" gorm:"default:1"`
+	Description string         `json:"description" gorm:"size:255"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+}
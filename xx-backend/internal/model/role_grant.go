@@ -0,0 +1,26 @@
+package model
+
+import "time"
+
+// RoleGrant 限时授予用户的额外角色，到期后由后台任务自动撤销
+type RoleGrant struct {
+	ID           int        `json:"id" gorm:"primarykey"`
+	TenantID     uint       `json:"tenant_id" gorm:"not null;default:1;index"`
+	UserID       uint       `json:"user_id" gorm:"not null;index"`
+	RoleID       int        `json:"role_id" gorm:"not null"`
+	Role         Role       `json:"role" gorm:"foreignKey:RoleID"`
+	StartsAt     time.Time  `json:"starts_at"`
+	ExpiresAt    time.Time  `json:"expires_at" gorm:"index"`
+	Reason       string     `json:"reason" gorm:"not null;size:255"`
+	GrantedBy    uint       `json:"granted_by"`
+	RevokedAt    *time.Time `json:"revoked_at" gorm:"index"`
+	RevokedBy    *uint      `json:"revoked_by"` // 为空表示到期自动撤销
+	RevokeReason string     `json:"revoke_reason" gorm:"size:255"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+// ActiveAt 判断授权在指定时间是否生效
+func (g *RoleGrant) ActiveAt(t time.Time) bool {
+	return g.RevokedAt == nil && !t.Before(g.StartsAt) && t.Before(g.ExpiresAt)
+}
@@ -0,0 +1,23 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// DefaultTenantID 默认租户（平台租户），单租户部署和平台超级管理员都属于该租户
+const DefaultTenantID uint = 1
+
+// PlatformAdminRole 平台超级管理员角色名，仅在默认租户中有效
+const PlatformAdminRole = "platform_admin"
+
+type Tenant struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	Code      string         `json:"code" gorm:"uniqueIndex;not null;size:50"` // 租户编码，同时作为子域名
+	Name      string         `json:"name" gorm:"not null;size:100"`
+	Status    int            `json:"status" gorm:"default:1"` // 1:正常 0:禁用
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+}
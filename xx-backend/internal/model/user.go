@@ -7,32 +7,59 @@ import (
 )
 
 type User struct {
-	ID        uint           `json:"id" gorm:"primarykey"`
-	Username  string         `json:"username" gorm:"uniqueIndex;not null;size:50"`
-	Password  string         `json:"-" gorm:"not null;size:255"`
-	Email     string         `json:"email" gorm:"uniqueIndex;size:100"`
-	Nickname  string         `json:"nickname" gorm:"size:50"`
-	Avatar    string         `json:"avatar" gorm:"size:255"`
-	Status    int            `json:"status" gorm:"default:1"` // 1:正常 0:禁用
-	RoleID    int            `json:"role_id"`
-	Role      Role           `json:"role" gorm:"foreignKey:RoleID"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID           uint           `json:"id" gorm:"primarykey"`
+	TenantID     uint           `json:"tenant_id" gorm:"not null;default:1;uniqueIndex:idx_users_tenant_username_deleted,priority:1;uniqueIndex:idx_users_tenant_email_deleted,priority:1"`
+	Username     string         `json:"username" gorm:"uniqueIndex:idx_users_tenant_username_deleted,priority:2;not null;size:50"`
+	Password     string         `json:"-" gorm:"not null;size:255"`
+	Email        string         `json:"email" gorm:"uniqueIndex:idx_users_tenant_email_deleted,priority:2;size:100"`
+	Nickname     string         `json:"nickname" gorm:"size:50"`
+	Avatar       string         `json:"avatar" gorm:"size:255"`
+	Status       int            `json:"status" gorm:"default:1"` // 1:正常 0:禁用 2:待激活（已邀请，尚未接受邀请）
+	RoleID       int            `json:"role_id"`
+	Role         Role           `json:"role" gorm:"foreignKey:RoleID"`
+	DepartmentID *int           `json:"department_id" gorm:"index"`
+	Department   *Department    `json:"department,omitempty" gorm:"foreignKey:DepartmentID"`
+	Attributes   Attributes     `json:"attributes" gorm:"type:json"` // 自定义字段的值
+	LastLoginAt  *time.Time     `json:"last_login_at"`
+	EnabledAt    *time.Time     `json:"enabled_at"`                 // 最近一次被重新启用的时间，不活跃天数从最近登录、启用和创建中最晚的时间算起
+	DeactivateAt *time.Time     `json:"deactivate_at" gorm:"index"` // 计划停用时间（如外包人员合同到期），到期后自动禁用
+	ErasedAt     *time.Time     `json:"erased_at"`                  // 个人数据被删除（匿名化）的时间，之后不能再修改
+	CreatedAt    time.Time      `json:"created_at"`
+	UpdatedAt    time.Time      `json:"updated_at"`
+	DeletedAt    gorm.DeletedAt `json:"-" gorm:"index"`
+	DeletedKey   uint           `json:"-" gorm:"not null;default:0;uniqueIndex:idx_users_tenant_username_deleted,priority:3;uniqueIndex:idx_users_tenant_email_deleted,priority:3"` // 未删除时为0，软删除时为ID，使已删除的用户不再占用用户名和邮箱
+	Version      int            `json:"version" gorm:"not null;default:1"`                                                                                                          // 每次更新加1，用于乐观锁
 }
 
+// 用户状态
+const (
+	UserStatusDisabled = 0
+	UserStatusActive   = 1
+	UserStatusPending  = 2 // 已邀请、尚未设置密码，不能登录
+)
+
 type Role struct {
-	ID          int            `json:"id" gorm:"primarykey"`
-	Name        string         `json:"name" gorm:"uniqueIndex;not null;size:50"`
-	Description string         `json:"description" gorm:"size:255"`
-	Status      int            `json:"status" gorm:"default:1"`
-	CreatedAt   time.Time      `json:"created_at"`
-	UpdatedAt   time.Time      `json:"updated_at"`
-	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
+	ID                   int            `json:"id" gorm:"primarykey"`
+	TenantID             uint           `json:"tenant_id" gorm:"not null;default:1;uniqueIndex:idx_roles_tenant_name_deleted,priority:1"`
+	Name                 string         `json:"name" gorm:"uniqueIndex:idx_roles_tenant_name_deleted,priority:2;not null;size:50"`
+	Description          string         `json:"description" gorm:"size:255"`
+	Status               int            `json:"status" gorm:"default:1"`
+	ParentID             *int           `json:"parent_id" gorm:"index"` // 父角色，继承其权限和菜单
+	Permissions          []Permission   `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+	Menus                []Menu         `json:"menus,omitempty" gorm:"many2many:role_menus"`
+	DataScope            string         `json:"data_scope" gorm:"size:20;default:all"`                                         // 数据范围，见 DataScope* 常量
+	DataScopeDepartments []Department   `json:"data_scope_departments,omitempty" gorm:"many2many:role_data_scope_departments"` // 自定义数据范围可访问的部门
+	DataScopeGroups      []Group        `json:"data_scope_groups,omitempty" gorm:"many2many:role_data_scope_groups"`           // 自定义数据范围可访问的用户组成员
+	CreatedAt            time.Time      `json:"created_at"`
+	UpdatedAt            time.Time      `json:"updated_at"`
+	DeletedAt            gorm.DeletedAt `json:"-" gorm:"index"`
+	DeletedKey           uint           `json:"-" gorm:"not null;default:0;uniqueIndex:idx_roles_tenant_name_deleted,priority:3"` // 未删除时为0，软删除时为ID，使已删除的角色不再占用角色名
+	Version              int            `json:"version" gorm:"not null;default:1"`                                                // 每次更新加1，用于乐观锁
 }
 
 type Menu struct {
 	ID        int            `json:"id" gorm:"primarykey"`
+	TenantID  uint           `json:"tenant_id" gorm:"not null;default:1;index"`
 	Name      string         `json:"name" gorm:"not null;size:50"`
 	Path      string         `json:"path" gorm:"size:100"`
 	Component string         `json:"component" gorm:"size:100"`
@@ -43,4 +70,31 @@ type Menu struct {
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	Version   int            `json:"version" gorm:"not null;default:1"` // 每次更新加1，用于乐观锁
+}
+
+// bumpVersion 在更新语句中把版本号加1。项目中对这些表的更新都使用 map 或单列更新；
+// 关联的 Replace/Clear 会以结构体更新所有者，只修改关联表，不需要加版本号
+func bumpVersion(tx *gorm.DB) {
+	if _, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		tx.Statement.SetColumn("version", gorm.Expr("version + 1"))
+	}
+}
+
+// BeforeUpdate 每次更新用户时版本号加1
+func (u *User) BeforeUpdate(tx *gorm.DB) error {
+	bumpVersion(tx)
+	return nil
+}
+
+// BeforeUpdate 每次更新角色时版本号加1
+func (r *Role) BeforeUpdate(tx *gorm.DB) error {
+	bumpVersion(tx)
+	return nil
+}
+
+// BeforeUpdate 每次更新菜单时版本号加1
+func (m *Menu) BeforeUpdate(tx *gorm.DB) error {
+	bumpVersion(tx)
+	return nil
 }
@@ -0,0 +1,108 @@
+package model
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// 自定义字段类型
+const (
+	UserFieldString  = "string"
+	UserFieldNumber  = "number"
+	UserFieldBoolean = "boolean"
+	UserFieldDate    = "date" // 格式为 2006-01-02
+	UserFieldEnum    = "enum" // 取值必须是 options 之一
+)
+
+// 自定义字段可见性
+const (
+	UserFieldPublic    = "public"    // 可以查看用户的人都能看到
+	UserFieldSensitive = "sensitive" // 需要 user:sensitive 权限才能查看和修改，导出时脱敏
+)
+
+// UserFieldKeyPattern 自定义字段键名的格式，键名会用于JSON路径，不能包含其他字符
+var UserFieldKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,49}$`)
+
+// IsValidUserFieldType 判断自定义字段类型是否有效
+func IsValidUserFieldType(fieldType string) bool {
+	switch fieldType {
+	case UserFieldString, UserFieldNumber, UserFieldBoolean, UserFieldDate, UserFieldEnum:
+		return true
+	}
+	return false
+}
+
+// IsValidUserFieldVisibility 判断自定义字段可见性是否有效
+func IsValidUserFieldVisibility(visibility string) bool {
+	return visibility == UserFieldPublic || visibility == UserFieldSensitive
+}
+
+// UserField 管理员定义的用户自定义字段（如工号、电话、职位），值保存在 users.attributes 中
+type UserField struct {
+	ID         int       `json:"id" gorm:"primarykey"`
+	TenantID   uint      `json:"tenant_id" gorm:"not null;default:1;uniqueIndex:idx_user_fields_tenant_key,priority:1"`
+	Key        string    `json:"key" gorm:"not null;size:50;uniqueIndex:idx_user_fields_tenant_key,priority:2"` // 创建后不能修改
+	Name       string    `json:"name" gorm:"not null;size:100"`
+	Type       string    `json:"type" gorm:"not null;size:20"` // 创建后不能修改
+	Required   bool      `json:"required" gorm:"not null;default:false"`
+	Visibility string    `json:"visibility" gorm:"not null;size:20;default:public"`
+	MaxLength  int       `json:"max_length" gorm:"not null;default:0"` // 字符串最大长度，0表示不限制
+	Pattern    string    `json:"pattern" gorm:"size:255"`              // 字符串需要匹配的正则表达式
+	Min        *float64  `json:"min"`                                  // 数字的最小值
+	Max        *float64  `json:"max"`                                  // 数字的最大值
+	Options    Strings   `json:"options" gorm:"type:text"`             // 枚举的可选值
+	Sort       int       `json:"sort" gorm:"not null;default:0"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Strings 以JSON数组保存的字符串列表
+type Strings []string
+
+func (s Strings) Value() (driver.Value, error) {
+	if s == nil {
+		return "[]", nil
+	}
+	data, err := json.Marshal(s)
+	return string(data), err
+}
+
+func (s *Strings) Scan(value interface{}) error {
+	return scanJSON(value, s)
+}
+
+// Attributes 用户自定义字段的值，以JSON对象保存，键为 UserField.Key
+type Attributes map[string]interface{}
+
+func (a Attributes) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(a)
+	return string(data), err
+}
+
+func (a *Attributes) Scan(value interface{}) error {
+	return scanJSON(value, a)
+}
+
+func scanJSON(value interface{}, dest interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		if len(v) == 0 {
+			return nil
+		}
+		return json.Unmarshal(v, dest)
+	case string:
+		if v == "" {
+			return nil
+		}
+		return json.Unmarshal([]byte(v), dest)
+	}
+	return fmt.Errorf("无法解析JSON字段: %T", value)
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+)
+
+// ErrSelfApproval 提交人不能审批自己的变更请求
+var ErrSelfApproval = errors.New("不能审批自己提交的变更请求")
+
+// ErrReviewForbidden 审批人没有 change_request:review 权限，处理器应返回403
+var ErrReviewForbidden = errors.New("没有审批变更请求的权限")
+
+// PermissionChangeRequestReview 审批变更请求的权限编码
+const PermissionChangeRequestReview = "change_request:review"
+
+// ApprovalRequiredError 变更需要审批，已提交变更请求，处理器应返回202和变更请求
+type ApprovalRequiredError struct {
+	Request *model.ChangeRequest
+}
+
+func (e *ApprovalRequiredError) Error() string {
+	return "变更需要审批，已提交变更请求"
+}
+
+type changeReasonKey struct{}
+
+type approvedKey struct{}
+
+// WithChangeReason 把变更原因写入上下文，变更需要审批时作为变更请求的原因
+func WithChangeReason(ctx context.Context, reason string) context.Context {
+	return context.WithValue(ctx, changeReasonKey{}, reason)
+}
+
+// withApproved 标记正在执行审批通过的变更，执行时不再重复提交审批
+func withApproved(ctx context.Context) context.Context {
+	return context.WithValue(ctx, approvedKey{}, true)
+}
+
+// SetApprovalActions 设置需要审批的变更类型，未知类型（如 none）会被忽略
+func (s *UserService) SetApprovalActions(actions []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.approvalActions = make(map[string]bool)
+	for _, action := range actions {
+		action = strings.TrimSpace(action)
+		if model.IsValidChangeType(action) && model.ApprovalAction(action) == action {
+			s.approvalActions[action] = true
+		}
+	}
+}
+
+// RequiresApproval 判断变更类型是否需要审批，按 model.ApprovalAction 对应的审批开关判断
+func (s *UserService) RequiresApproval(changeType string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.approvalActions[model.ApprovalAction(changeType)]
+}
+
+// needsApproval 判断变更是否需要提交审批：正在执行审批通过的变更时不需要。
+// 会获取读锁，需在 s.mu.Lock 之前调用
+func (s *UserService) needsApproval(ctx context.Context, changeType string) bool {
+	if approved, _ := ctx.Value(approvedKey{}).(bool); approved {
+		return false
+	}
+	return s.RequiresApproval(changeType)
+}
+
+// submitForApproval 以上下文中的变更原因提交变更请求，成功时返回 ApprovalRequiredError
+func (s *UserService) submitForApproval(ctx context.Context, operatorID int, changeType string, targetID int, payload interface{}) error {
+	reason, _ := ctx.Value(changeReasonKey{}).(string)
+	request, err := s.SubmitChangeRequest(ctx, operatorID, changeType, targetID, payload, reason)
+	if err != nil {
+		return err
+	}
+	return &ApprovalRequiredError{Request: request}
+}
+
+// SubmitChangeRequest 提交变更请求，审批通过后才会执行
+func (s *UserService) SubmitChangeRequest(ctx context.Context, operatorID int, changeType string, targetID int, payload interface{}, reason string) (*model.ChangeRequest, error) {
+	if !model.IsValidChangeType(changeType) {
+		return nil, fmt.Errorf("不支持的变更类型: %s", changeType)
+	}
+
+	// 提交时先校验目标存在且在操作人的数据范围内
+	switch changeType {
+	case model.ChangeRoleAssign, model.ChangeUserDelete, model.ChangeRoleGrant:
+		if _, err := s.GetUser(ctx, operatorID, targetID); err != nil {
+			return nil, err
+		}
+	case model.ChangeRolePermissions, model.ChangeRoleMenus, model.ChangeRoleParent, model.ChangeRoleDelete:
+		var role model.Role
+		if err := s.db.WithContext(ctx).First(&role, targetID).Error; err != nil {
+			return nil, err
+		}
+	case model.ChangeGroupMembers, model.ChangeGroupRoles:
+		if err := s.db.WithContext(ctx).First(&model.Group{}, targetID).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	var pending int64
+	err := s.db.WithContext(ctx).Model(&model.ChangeRequest{}).
+		Where("type = ? AND target_id = ? AND status = ?", changeType, targetID, model.ChangeStatusPending).
+		Count(&pending).Error
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		return nil, fmt.Errorf("%w: 该对象已有待审批的同类变更请求", ErrConflict)
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	request := &model.ChangeRequest{
+		Type:        changeType,
+		TargetID:    targetID,
+		Payload:     string(data),
+		Reason:      reason,
+		Status:      model.ChangeStatusPending,
+		RequestedBy: uint(operatorID),
+	}
+	if err := s.db.WithContext(ctx).Create(request).Error; err != nil {
+		return nil, err
+	}
+
+	s.logChangeRequest(request, uint(operatorID))
+	return request, nil
+}
+
+// GetChangeRequests 获取变更请求列表，变更内容中隐藏密码和操作人没有权限查看的敏感字段
+func (s *UserService) GetChangeRequests(ctx context.Context, operatorID int, q *listquery.Query) (*listquery.Result[model.ChangeRequest], error) {
+	result, err := listquery.Find[model.ChangeRequest](s.db.WithContext(ctx), q)
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]*model.ChangeRequest, len(result.List))
+	for i := range result.List {
+		requests[i] = &result.List[i]
+	}
+	if err := s.redactChangeRequests(ctx, operatorID, requests...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetChangeRequest 获取变更请求详情，变更内容的处理同 GetChangeRequests
+func (s *UserService) GetChangeRequest(ctx context.Context, operatorID, id int) (*model.ChangeRequest, error) {
+	var request model.ChangeRequest
+	if err := s.db.WithContext(ctx).First(&request, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.redactChangeRequests(ctx, operatorID, &request); err != nil {
+		return nil, err
+	}
+	return &request, nil
+}
+
+func (s *UserService) redactChangeRequests(ctx context.Context, operatorID int, requests ...*model.ChangeRequest) error {
+	redactor, err := s.attributeRedactor(ctx, operatorID)
+	if err != nil {
+		return err
+	}
+	return redactor.changeRequests(requests...)
+}
+
+// ApproveChangeRequest 审批通过并执行变更，执行失败时请求标记为 failed。
+// 返回的变更内容的处理同 GetChangeRequests
+func (s *UserService) ApproveChangeRequest(ctx context.Context, reviewerID, id int, comment string) (*model.ChangeRequest, error) {
+	request, err := s.reviewChangeRequest(ctx, reviewerID, id, model.ChangeStatusApproved, comment)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyChangeRequest(ctx, request); err != nil {
+		request.Status = model.ChangeStatusFailed
+		request.Error = err.Error()
+		updates := map[string]interface{}{"status": request.Status, "error": request.Error}
+		if updateErr := s.db.WithContext(ctx).Model(request).Updates(updates).Error; updateErr != nil {
+			fmt.Printf("Failed to mark change request %d as failed: %v\n", request.ID, updateErr)
+		}
+		s.logChangeRequest(request, uint(reviewerID))
+		if redactErr := s.redactChangeRequests(ctx, reviewerID, request); redactErr != nil {
+			return nil, redactErr
+		}
+		return request, fmt.Errorf("执行变更失败: %w", err)
+	}
+
+	if err := s.redactChangeRequests(ctx, reviewerID, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// RejectChangeRequest 驳回变更请求，返回的变更内容的处理同 GetChangeRequests
+func (s *UserService) RejectChangeRequest(ctx context.Context, reviewerID, id int, comment string) (*model.ChangeRequest, error) {
+	request, err := s.reviewChangeRequest(ctx, reviewerID, id, model.ChangeStatusRejected, comment)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.redactChangeRequests(ctx, reviewerID, request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+// reviewChangeRequest 条件更新请求状态，同一请求被并发审批时只有一个会成功。
+// 审批人需要 change_request:review 权限，且不能是提交人
+func (s *UserService) reviewChangeRequest(ctx context.Context, reviewerID, id int, status, comment string) (*model.ChangeRequest, error) {
+	permissions, err := s.GetUserPermissions(ctx, uint(reviewerID))
+	if err != nil {
+		return nil, err
+	}
+	if !permissions.HasPermission(PermissionChangeRequestReview) {
+		return nil, ErrReviewForbidden
+	}
+
+	// 执行变更需要原始的变更内容，不经过 GetChangeRequest 的处理
+	request := &model.ChangeRequest{}
+	if err := s.db.WithContext(ctx).First(request, id).Error; err != nil {
+		return nil, err
+	}
+	if request.RequestedBy == uint(reviewerID) {
+		return nil, ErrSelfApproval
+	}
+	if request.Status != model.ChangeStatusPending {
+		return nil, fmt.Errorf("%w: 变更请求已处理", ErrConflict)
+	}
+
+	now := time.Now()
+	reviewedBy := uint(reviewerID)
+	result := s.db.WithContext(ctx).Model(&model.ChangeRequest{}).
+		Where("id = ? AND status = ?", id, model.ChangeStatusPending).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"reviewed_by":    reviewedBy,
+			"review_comment": comment,
+			"reviewed_at":    now,
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: 变更请求已处理", ErrConflict)
+	}
+
+	request.Status = status
+	request.ReviewedBy = &reviewedBy
+	request.ReviewComment = comment
+	request.ReviewedAt = &now
+
+	s.logChangeRequest(request, reviewedBy)
+	return request, nil
+}
+
+// applyChangeRequest 以提交人的身份执行变更，数据范围按提交人计算
+func (s *UserService) applyChangeRequest(ctx context.Context, request *model.ChangeRequest) error {
+	ctx = withApproved(ctx)
+	operatorID := int(request.RequestedBy)
+	switch request.Type {
+	case model.ChangeRoleAssign:
+		update, err := DecodeUserUpdate([]byte(request.Payload))
+		if err != nil {
+			return err
+		}
+		// 只执行角色修改，忽略旧的变更请求中可能带有的其他字段
+		_, err = s.UpdateUser(ctx, operatorID, request.TargetID, &UserUpdate{RoleID: update.RoleID}, 0)
+		return err
+	case model.ChangeRolePermissions:
+		var payload struct {
+			PermissionIDs []int `json:"permission_ids"`
+		}
+		if err := json.Unmarshal([]byte(request.Payload), &payload); err != nil {
+			return err
+		}
+		return s.SetRolePermissions(ctx, operatorID, request.TargetID, payload.PermissionIDs)
+	case model.ChangeRoleMenus:
+		var payload struct {
+			MenuIDs []int `json:"menu_ids"`
+		}
+		if err := json.Unmarshal([]byte(request.Payload), &payload); err != nil {
+			return err
+		}
+		return s.SetRoleMenus(ctx, operatorID, request.TargetID, payload.MenuIDs)
+	case model.ChangeRoleParent:
+		update, err := DecodeRoleUpdate([]byte(request.Payload))
+		if err != nil {
+			return err
+		}
+		_, err = s.UpdateRole(ctx, operatorID, request.TargetID, update, 0)
+		return err
+	case model.ChangeRoleGrant:
+		var grant model.RoleGrant
+		if err := json.Unmarshal([]byte(request.Payload), &grant); err != nil {
+			return err
+		}
+		grant.UserID = uint(request.TargetID)
+		return s.CreateRoleGrant(ctx, operatorID, &grant)
+	case model.ChangeGroupMembers:
+		var payload struct {
+			UserIDs []uint `json:"user_ids"`
+		}
+		if err := json.Unmarshal([]byte(request.Payload), &payload); err != nil {
+			return err
+		}
+		return s.AddGroupMembers(ctx, operatorID, request.TargetID, payload.UserIDs)
+	case model.ChangeGroupRoles:
+		var payload struct {
+			RoleIDs []int `json:"role_ids"`
+		}
+		if err := json.Unmarshal([]byte(request.Payload), &payload); err != nil {
+			return err
+		}
+		return s.SetGroupRoles(ctx, operatorID, request.TargetID, payload.RoleIDs)
+	case model.ChangeUserDelete:
+		return s.DeleteUser(ctx, operatorID, request.TargetID, 0)
+	case model.ChangeRoleDelete:
+		var payload struct {
+			ReassignTo int `json:"reassign_to"`
+		}
+		if err := json.Unmarshal([]byte(request.Payload), &payload); err != nil {
+			return err
+		}
+		return s.DeleteRole(ctx, operatorID, uint(request.TargetID), RoleDeleteReassign, payload.ReassignTo, 0)
+	default:
+		return fmt.Errorf("不支持的变更类型: %s", request.Type)
+	}
+}
+
+func (s *UserService) logChangeRequest(request *model.ChangeRequest, operatorID uint) {
+	// 记录变更请求事件到Kafka
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogChangeRequest(request.ID, request.Type, request.TargetID, request.Status, operatorID); err != nil {
+			fmt.Printf("Failed to log change request to Kafka: %v\n", err)
+		}
+	}
+}
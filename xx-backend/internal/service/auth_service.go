@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"xx-backend/internal/model"
 
@@ -42,8 +43,8 @@ type LoginResponse struct {
 func (s *AuthService) Login(req *LoginRequest, c *gin.Context) (*LoginResponse, error) {
 	var user model.User
 
-	// 查询用户
-	if err := s.db.Preload("Role").Where("username = ?", req.Username).First(&user).Error; err != nil {
+	// 查询用户（租户由中间件写入请求上下文）
+	if err := s.db.WithContext(c.Request.Context()).Preload("Role").Where("username = ?", req.Username).First(&user).Error; err != nil {
 		return nil, fmt.Errorf("用户不存在")
 	}
 
@@ -53,12 +54,15 @@ func (s *AuthService) Login(req *LoginRequest, c *gin.Context) (*LoginResponse,
 	}
 
 	// 检查用户状态
+	if user.Status == model.UserStatusPending {
+		return nil, fmt.Errorf("用户尚未接受邀请")
+	}
 	if user.Status != 1 {
 		return nil, fmt.Errorf("用户已被禁用")
 	}
 
 	// 生成JWT token
-	token, err := s.generateToken(int(user.ID))
+	token, err := s.generateToken(int(user.ID), user.TenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -70,8 +74,23 @@ func (s *AuthService) Login(req *LoginRequest, c *gin.Context) (*LoginResponse,
 		return nil, err
 	}
 
-	// 记录登录事件到Kafka
+	// 记录最近登录时间，用于按未登录天数自动禁用（不计入变更历史）
+	if err := s.db.WithContext(c.Request.Context()).Exec("UPDATE users SET last_login_at = ? WHERE id = ?", time.Now(), user.ID).Error; err != nil {
+		fmt.Printf("Failed to update last login time: %v\n", err)
+	}
+
+	// 记录登录历史，用于个人数据导出（不计入变更历史）
 	clientIP := s.getClientIP(c)
+	userAgent := c.Request.UserAgent()
+	if utf8.RuneCountInString(userAgent) > 255 {
+		userAgent = string([]rune(userAgent)[:255])
+	}
+	record := model.LoginRecord{UserID: user.ID, IP: clientIP, UserAgent: userAgent}
+	if err := s.db.WithContext(c.Request.Context()).Create(&record).Error; err != nil {
+		fmt.Printf("Failed to record user login: %v\n", err)
+	}
+
+	// 记录登录事件到Kafka
 	if s.kafkaService != nil {
 		if err := s.kafkaService.LogUserLogin(user.ID, user.Username, clientIP); err != nil {
 			// 记录Kafka错误但不影响登录流程
@@ -103,36 +122,44 @@ func (s *AuthService) Logout(userID int, username string) error {
 	return nil
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (int, error) {
+// ValidateToken 校验token，返回用户ID和签发时所属的租户ID
+func (s *AuthService) ValidateToken(tokenString string) (int, uint, error) {
 	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
 		return []byte("your-secret-key"), nil
 	})
 
 	if err != nil {
-		return 0, err
+		return 0, 0, err
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		userID := int(claims["user_id"].(float64))
 
+		// 旧token没有租户信息，视为默认租户
+		tenantID := model.DefaultTenantID
+		if value, ok := claims["tenant_id"].(float64); ok {
+			tenantID = uint(value)
+		}
+
 		// 检查Redis中是否存在token
 		ctx := context.Background()
 		exists, err := s.redis.Exists(ctx, fmt.Sprintf("token:%d", userID)).Result()
 		if err != nil || exists == 0 {
-			return 0, fmt.Errorf("token已过期")
+			return 0, 0, fmt.Errorf("token已过期")
 		}
 
-		return userID, nil
+		return userID, tenantID, nil
 	}
 
-	return 0, fmt.Errorf("无效的token")
+	return 0, 0, fmt.Errorf("无效的token")
 }
 
-func (s *AuthService) generateToken(userID int) (string, error) {
+func (s *AuthService) generateToken(userID int, tenantID uint) (string, error) {
 	claims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-		"iat":     time.Now().Unix(),
+		"user_id":   userID,
+		"tenant_id": tenantID,
+		"exp":       time.Now().Add(24 * time.Hour).Unix(),
+		"iat":       time.Now().Unix(),
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
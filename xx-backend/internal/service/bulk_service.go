@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"xx-backend/internal/model"
+)
+
+// 批量操作类型
+const (
+	BulkEnable        = "enable"
+	BulkDisable       = "disable"
+	BulkDelete        = "delete"
+	BulkAssignRole    = "assign-role"
+	BulkResetPassword = "reset-password"
+)
+
+// MaxBulkUsers 单次批量操作的最大用户数
+const MaxBulkUsers = 1000
+
+// BulkRequest 批量操作请求
+type BulkRequest struct {
+	Action      string `json:"action"`
+	UserIDs     []int  `json:"user_ids"`
+	RoleID      int    `json:"role_id,omitempty"` // assign-role 时必填
+	Password    string `json:"-"`                 // reset-password 时必填，需满足密码策略
+	Reason      string `json:"reason,omitempty"`  // 需要审批时作为变更原因
+	Concurrency int    `json:"concurrency"`       // 为0或超过上限时使用上限
+}
+
+// BulkSummary 批量操作结果统计
+type BulkSummary struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+	Submitted int `json:"submitted"`
+	Cancelled int `json:"cancelled"`
+}
+
+// BulkResult 批量操作任务的执行结果，保存在任务的 result 中
+type BulkResult struct {
+	Summary BulkSummary   `json:"summary"`
+	Items   []BatchResult `json:"items"`
+}
+
+// SetBulkMaxWorkers 设置批量操作的最大并发数
+func (s *UserService) SetBulkMaxWorkers(workers int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.bulkMaxWorkers = workers
+}
+
+func (s *UserService) bulkWorkers(requested int) int {
+	s.mu.RLock()
+	limit := s.bulkMaxWorkers
+	s.mu.RUnlock()
+	if limit <= 0 {
+		limit = 1
+	}
+	if requested <= 0 || requested > limit {
+		return limit
+	}
+	return requested
+}
+
+// validate 校验批量操作参数，并去除重复的用户ID
+func (r *BulkRequest) validate() error {
+	switch r.Action {
+	case BulkEnable, BulkDisable, BulkDelete:
+	case BulkAssignRole:
+		if r.RoleID <= 0 {
+			return fmt.Errorf("必须指定角色")
+		}
+	case BulkResetPassword:
+		if err := validatePassword(r.Password); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的批量操作: %s", r.Action)
+	}
+
+	r.UserIDs = uniqueInts(r.UserIDs)
+	if len(r.UserIDs) == 0 {
+		return fmt.Errorf("必须指定用户")
+	}
+	if len(r.UserIDs) > MaxBulkUsers {
+		return fmt.Errorf("单次最多操作 %d 个用户", MaxBulkUsers)
+	}
+	return nil
+}
+
+// StartBulkJob 以后台任务批量操作用户，每个用户的处理结果保存在任务结果中。
+// 修改角色和删除用户需要审批时，为每个用户提交变更请求
+func (s *UserService) StartBulkJob(ctx context.Context, operatorID int, req *BulkRequest) (*model.Job, error) {
+	if err := req.validate(); err != nil {
+		return nil, err
+	}
+	// 与更新单个用户需要相同的字段权限
+	gated := make(map[string]string)
+	switch req.Action {
+	case BulkEnable, BulkDisable:
+		gated["status"] = PermissionUserStatus
+	case BulkAssignRole:
+		gated["role_id"] = PermissionUserRole
+	case BulkResetPassword:
+		gated["password"] = PermissionUserPassword
+	}
+	if err := s.forbiddenFields(ctx, operatorID, gated); err != nil {
+		return nil, err
+	}
+	if req.Action == BulkAssignRole {
+		var role model.Role
+		if err := s.db.WithContext(ctx).First(&role, req.RoleID).Error; err != nil {
+			return nil, fmt.Errorf("角色不存在")
+		}
+	}
+
+	processor, err := s.bulkProcessor(operatorID, req)
+	if err != nil {
+		return nil, err
+	}
+	workers := s.bulkWorkers(req.Concurrency)
+
+	return s.startJob(ctx, operatorID, model.JobUserBulk, req, func(ctx context.Context, job *model.Job, progress func(processed, total int)) error {
+		total := len(req.UserIDs)
+		progress(0, total)
+
+		var mu sync.Mutex
+		processed := 0
+		results, err := s.BatchProcessUsers(ctx, operatorID, req.UserIDs, workers, processor, func(BatchResult) {
+			mu.Lock()
+			processed++
+			current := processed
+			mu.Unlock()
+			progress(current, total)
+		})
+		if err != nil {
+			return err
+		}
+
+		result := BulkResult{Items: results}
+		for _, item := range results {
+			switch item.Status {
+			case BatchItemSucceeded:
+				result.Summary.Succeeded++
+			case BatchItemFailed:
+				result.Summary.Failed++
+			case BatchItemSubmitted:
+				result.Summary.Submitted++
+			case BatchItemCancelled:
+				result.Summary.Cancelled++
+			}
+		}
+		data, err := json.Marshal(result)
+		if err != nil {
+			return err
+		}
+		job.Result = string(data)
+
+		// 取消时保留已处理项的结果，任务状态记为已取消
+		return ctx.Err()
+	})
+}
+
+// bulkProcessor 根据操作类型生成处理单个用户的函数，每个用户的校验与更新单个用户相同（checkUserChange）
+func (s *UserService) bulkProcessor(operatorID int, req *BulkRequest) (BatchProcessor, error) {
+	switch req.Action {
+	case BulkEnable, BulkDisable:
+		status := 1
+		if req.Action == BulkDisable {
+			status = 0
+		}
+		return func(ctx context.Context, user *model.User, result *BatchResult) error {
+			if err := checkUserChange(operatorID, user, "status"); err != nil {
+				return err
+			}
+			updates := map[string]interface{}{"status": status}
+			if status == model.UserStatusActive && user.Status != model.UserStatusActive {
+				updates["enabled_at"] = time.Now()
+			}
+			if err := s.updateUserFields(ctx, user, updates); err != nil {
+				return err
+			}
+			if status == 0 {
+				s.revokeSession(ctx, user.ID)
+			}
+			return nil
+		}, nil
+
+	case BulkAssignRole:
+		return func(ctx context.Context, user *model.User, result *BatchResult) error {
+			if err := checkUserChange(operatorID, user, "role_id"); err != nil {
+				return err
+			}
+			updates := map[string]interface{}{"role_id": req.RoleID}
+			if s.RequiresApproval(model.ChangeRoleAssign) {
+				return s.submitBulkChange(ctx, operatorID, model.ChangeRoleAssign, user, updates, req.Reason, result)
+			}
+			if err := s.updateUserFields(ctx, user, updates); err != nil {
+				return err
+			}
+			s.roleCache.invalidateUser(user.ID)
+			return nil
+		}, nil
+
+	case BulkResetPassword:
+		hash := md5.Sum([]byte(req.Password))
+		password := hex.EncodeToString(hash[:])
+		return func(ctx context.Context, user *model.User, result *BatchResult) error {
+			if err := checkUserChange(operatorID, user, "password"); err != nil {
+				return err
+			}
+			if err := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", user.ID).Update("password", password).Error; err != nil {
+				return err
+			}
+			// 重置密码后需要重新登录，事件中不记录密码
+			s.revokeSession(ctx, user.ID)
+			s.logUserUpdate(user, map[string]interface{}{"password": "reset"})
+			return nil
+		}, nil
+
+	case BulkDelete:
+		return func(ctx context.Context, user *model.User, result *BatchResult) error {
+			if int(user.ID) == operatorID {
+				return fmt.Errorf("不能删除自己")
+			}
+			if s.RequiresApproval(model.ChangeUserDelete) {
+				return s.submitBulkChange(ctx, operatorID, model.ChangeUserDelete, user, nil, req.Reason, result)
+			}
+			if err := softDelete(s.db.WithContext(ctx), &model.User{}, user.ID, 0); err != nil {
+				return err
+			}
+			s.revokeSession(ctx, user.ID)
+			s.logUserDelete(user)
+			return nil
+		}, nil
+	}
+	return nil, fmt.Errorf("不支持的批量操作: %s", req.Action)
+}
+
+// submitBulkChange 为需要审批的批量操作项提交变更请求
+func (s *UserService) submitBulkChange(ctx context.Context, operatorID int, changeType string, user *model.User, payload interface{}, reason string, result *BatchResult) error {
+	if strings.TrimSpace(reason) == "" {
+		reason = "批量操作"
+	}
+	request, err := s.SubmitChangeRequest(ctx, operatorID, changeType, int(user.ID), payload, reason)
+	if err != nil {
+		return err
+	}
+	result.Status = BatchItemSubmitted
+	result.ChangeRequestID = request.ID
+	return nil
+}
+
+// updateUserFields 更新用户字段并记录更新事件
+func (s *UserService) updateUserFields(ctx context.Context, user *model.User, updates map[string]interface{}) error {
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("id = ?", user.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	s.logUserUpdate(user, updates)
+	return nil
+}
+
+// logUserUpdate 记录用户更新事件到Kafka
+func (s *UserService) logUserUpdate(user *model.User, updates map[string]interface{}) {
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogUserUpdate(user.ID, user.Username, updates); err != nil {
+			// 记录Kafka错误但不影响批量操作
+			fmt.Printf("Failed to log user update to Kafka: %v\n", err)
+		}
+	}
+}
+
+// revokeSession 删除用户的登录token，使其重新登录
+func (s *UserService) revokeSession(ctx context.Context, userID uint) {
+	if s.redis == nil {
+		return
+	}
+	if err := s.redis.Del(ctx, fmt.Sprintf("token:%d", userID)).Err(); err != nil {
+		fmt.Printf("Failed to revoke session of user %d: %v\n", userID, err)
+	}
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"xx-backend/internal/model"
+)
+
+func TestBulkProcessorPreconditions(t *testing.T) {
+	erasedAt := time.Now()
+	self := &model.User{ID: 1, Status: model.UserStatusActive}
+	pending := &model.User{ID: 2, Status: model.UserStatusPending}
+	erased := &model.User{ID: 3, Status: model.UserStatusActive, ErasedAt: &erasedAt}
+
+	tests := []struct {
+		action  string
+		user    *model.User
+		wantErr error
+	}{
+		{action: BulkDisable, user: self, wantErr: ErrFieldForbidden},
+		{action: BulkDisable, user: pending, wantErr: ErrConflict},
+		{action: BulkDisable, user: erased, wantErr: ErrConflict},
+		{action: BulkAssignRole, user: self, wantErr: ErrFieldForbidden},
+		{action: BulkAssignRole, user: erased, wantErr: ErrConflict},
+		{action: BulkResetPassword, user: self, wantErr: ErrFieldForbidden},
+		{action: BulkResetPassword, user: pending, wantErr: ErrConflict},
+		{action: BulkResetPassword, user: erased, wantErr: ErrConflict},
+	}
+	s := NewUserService(nil, nil, nil)
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			processor, err := s.bulkProcessor(1, &BulkRequest{Action: tt.action, RoleID: 2, Password: "abcd1234"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = processor(context.Background(), tt.user, &BatchResult{})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("user %d: error = %v, want %v", tt.user.ID, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckUserChange(t *testing.T) {
+	erasedAt := time.Now()
+	tests := []struct {
+		name    string
+		user    model.User
+		fields  []string
+		wantErr error
+	}{
+		{name: "other user", user: model.User{ID: 2}, fields: []string{"role_id", "status", "password"}},
+		{name: "own nickname", user: model.User{ID: 1}, fields: []string{"nickname", "attributes"}},
+		{name: "own role", user: model.User{ID: 1}, fields: []string{"nickname", "role_id"}, wantErr: ErrFieldForbidden},
+		{name: "own password", user: model.User{ID: 1}, fields: []string{"password"}, wantErr: ErrFieldForbidden},
+		{name: "pending role", user: model.User{ID: 2, Status: model.UserStatusPending}, fields: []string{"role_id"}},
+		{name: "pending status", user: model.User{ID: 2, Status: model.UserStatusPending}, fields: []string{"status"}, wantErr: ErrConflict},
+		{name: "erased", user: model.User{ID: 2, ErasedAt: &erasedAt}, fields: []string{"nickname"}, wantErr: ErrConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkUserChange(1, &tt.user, tt.fields...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkUserChange() = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
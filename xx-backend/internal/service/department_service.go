@@ -0,0 +1,344 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+)
+
+// ErrDepartmentCycle 部门上下级关系出现循环
+var ErrDepartmentCycle = fmt.Errorf("%w: 部门上下级关系不能形成循环", ErrConflict)
+
+// dataScope 操作人可访问的用户数据范围
+type dataScope struct {
+	all           bool
+	userID        uint
+	departmentIDs []int
+	groupIDs      []int  // 范围内的用户组
+	memberIDs     []uint // 这些组（包括子组）的成员
+}
+
+// apply 作为GORM Scope使用，对用户表追加行级过滤条件
+func (d *dataScope) apply(db *gorm.DB) *gorm.DB {
+	if d.all {
+		return db
+	}
+	conditions := []string{"users.id = ?"}
+	args := []interface{}{d.userID}
+	if len(d.departmentIDs) > 0 {
+		conditions = append(conditions, "users.department_id IN ?")
+		args = append(args, d.departmentIDs)
+	}
+	if len(d.memberIDs) > 0 {
+		conditions = append(conditions, "users.id IN ?")
+		args = append(args, d.memberIDs)
+	}
+	return db.Where(strings.Join(conditions, " OR "), args...)
+}
+
+// allowsDepartment 判断是否可以把用户分配到指定部门
+func (d *dataScope) allowsDepartment(departmentID *int) bool {
+	if d.all {
+		return true
+	}
+	if departmentID == nil {
+		return false
+	}
+	for _, id := range d.departmentIDs {
+		if id == *departmentID {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDataScope 根据操作人角色的数据范围计算可访问的部门
+func (s *UserService) resolveDataScope(ctx context.Context, operatorID int) (*dataScope, error) {
+	// 操作人可能是切换到其他租户的平台超级管理员，这里按主键跨租户读取
+	var operator model.User
+	if err := s.db.WithContext(tenant.WithoutTenant(ctx)).Preload("Role.DataScopeDepartments").Preload("Role.DataScopeGroups").First(&operator, operatorID).Error; err != nil {
+		return nil, fmt.Errorf("获取操作人信息失败: %w", err)
+	}
+
+	scope := &dataScope{userID: operator.ID}
+	if current, ok := tenant.FromContext(ctx); ok && current != operator.TenantID {
+		scope.all = true
+		return scope, nil
+	}
+
+	switch operator.Role.DataScope {
+	case model.DataScopeAll, "":
+		scope.all = true
+	case model.DataScopeDept:
+		if operator.DepartmentID != nil {
+			scope.departmentIDs = []int{*operator.DepartmentID}
+		}
+	case model.DataScopeDeptAndChildren:
+		if operator.DepartmentID != nil {
+			descendants, err := s.departmentDescendants(ctx, *operator.DepartmentID)
+			if err != nil {
+				return nil, err
+			}
+			scope.departmentIDs = append([]int{*operator.DepartmentID}, descendants...)
+		}
+	case model.DataScopeCustom:
+		for _, d := range operator.Role.DataScopeDepartments {
+			scope.departmentIDs = append(scope.departmentIDs, d.ID)
+		}
+		for _, g := range operator.Role.DataScopeGroups {
+			scope.groupIDs = append(scope.groupIDs, g.ID)
+		}
+	case model.DataScopeGroup:
+		groupIDs, err := s.userGroupIDs(ctx, operator.ID)
+		if err != nil {
+			return nil, err
+		}
+		scope.groupIDs = groupIDs
+	case model.DataScopeSelf:
+		// 仅本人
+	default:
+		return nil, fmt.Errorf("未知的数据范围: %s", operator.Role.DataScope)
+	}
+
+	if len(scope.groupIDs) > 0 {
+		memberIDs, err := s.groupMemberIDs(ctx, scope.groupIDs)
+		if err != nil {
+			return nil, err
+		}
+		scope.memberIDs = memberIDs
+	}
+	return scope, nil
+}
+
+// collectDescendants 根据父子关系表广度优先收集所有子孙节点
+func collectDescendants(children map[int][]int, root int) []int {
+	var result []int
+	visited := map[int]bool{root: true}
+	queue := []int{root}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, child := range children[current] {
+			if !visited[child] {
+				visited[child] = true
+				result = append(result, child)
+				queue = append(queue, child)
+			}
+		}
+	}
+	return result
+}
+
+// departmentDescendants 获取部门的所有下级部门ID
+func (s *UserService) departmentDescendants(ctx context.Context, departmentID int) ([]int, error) {
+	var departments []model.Department
+	if err := s.db.WithContext(ctx).Select("id", "parent_id").Find(&departments).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for _, d := range departments {
+		if d.ParentID != nil {
+			children[*d.ParentID] = append(children[*d.ParentID], d.ID)
+		}
+	}
+	return collectDescendants(children, departmentID), nil
+}
+
+// checkDepartmentParent 校验上级部门存在且不会形成循环
+func (s *UserService) checkDepartmentParent(ctx context.Context, departmentID int, parentID int) error {
+	if departmentID != 0 && parentID == departmentID {
+		return ErrDepartmentCycle
+	}
+
+	var parent model.Department
+	if err := s.db.WithContext(ctx).First(&parent, parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FieldErrors{"parent_id": "上级部门不存在"}
+		}
+		return err
+	}
+
+	if departmentID == 0 {
+		return nil
+	}
+	descendants, err := s.departmentDescendants(ctx, departmentID)
+	if err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == parentID {
+			return ErrDepartmentCycle
+		}
+	}
+	return nil
+}
+
+// GetDepartments 获取部门列表
+func (s *UserService) GetDepartments(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Department], error) {
+	return listquery.Find[model.Department](s.db.WithContext(ctx), q)
+}
+
+// CreateDepartment 创建部门
+func (s *UserService) CreateDepartment(ctx context.Context, department *model.Department) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if department.ParentID != nil {
+		if err := s.checkDepartmentParent(ctx, 0, *department.ParentID); err != nil {
+			return err
+		}
+	}
+
+	return s.db.WithContext(ctx).Create(department).Error
+}
+
+// DepartmentUpdate 部门的更新内容，未出现的字段不修改
+type DepartmentUpdate struct {
+	Name     Optional[string] `json:"name"`
+	ParentID Optional[int]    `json:"parent_id"` // null 表示移动到顶层
+	Sort     Optional[int]    `json:"sort"`
+	Status   Optional[int]    `json:"status"`
+}
+
+// DecodeDepartmentUpdate 解析部门的合并补丁
+func DecodeDepartmentUpdate(data []byte) (*DepartmentUpdate, error) {
+	var update DepartmentUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// UpdateDepartment 更新部门
+func (s *UserService) UpdateDepartment(ctx context.Context, id int, update *DepartmentUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.db.WithContext(ctx).First(&model.Department{}, id).Error; err != nil {
+		return err
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	stringField(errs, columns, "name", update.Name, 50, true)
+	statusField(errs, columns, "status", update.Status)
+	if update.Sort.Set {
+		if update.Sort.Value == nil {
+			errs["sort"] = "不能为空"
+		} else {
+			columns["sort"] = *update.Sort.Value
+		}
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+	if update.ParentID.Set {
+		if update.ParentID.Value != nil {
+			if err := s.checkDepartmentParent(ctx, id, *update.ParentID.Value); err != nil {
+				return err
+			}
+		}
+		columns["parent_id"] = update.ParentID.Value
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	return s.db.WithContext(ctx).Model(&model.Department{}).Where("id = ?", id).Updates(columns).Error
+}
+
+// DeleteDepartment 删除部门（存在下级部门或成员时不允许删除）
+func (s *UserService) DeleteDepartment(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Department{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 部门存在下级部门，不能删除", ErrConflict)
+	}
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("department_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 部门存在成员，不能删除", ErrConflict)
+	}
+
+	return s.db.WithContext(ctx).Delete(&model.Department{}, id).Error
+}
+
+// SetRoleDataScope 设置角色的数据范围，自定义范围时需要同时指定部门或用户组。需要 role:data_scope 权限
+func (s *UserService) SetRoleDataScope(ctx context.Context, operatorID, roleID int, scope string, departmentIDs, groupIDs []int) error {
+	if err := s.forbiddenFields(ctx, operatorID, map[string]string{"data_scope": PermissionRoleDataScope}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !model.IsValidDataScope(scope) {
+		return FieldErrors{"data_scope": fmt.Sprintf("无效的数据范围: %s", scope)}
+	}
+
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, roleID).Error; err != nil {
+		return err
+	}
+
+	departments, groups, err := s.findDataScopeTargets(ctx, scope, departmentIDs, groupIDs)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&role).Update("data_scope", scope).Error; err != nil {
+			return err
+		}
+		return replaceDataScopeTargets(tx, &role, departments, groups)
+	})
+}
+
+// findDataScopeTargets 查询自定义数据范围的部门和用户组，只能使用当前租户中存在的部门和用户组；
+// 其他数据范围不使用部门和用户组，返回空列表
+func (s *UserService) findDataScopeTargets(ctx context.Context, scope string, departmentIDs, groupIDs []int) ([]model.Department, []model.Group, error) {
+	var departments []model.Department
+	var groups []model.Group
+	if scope != model.DataScopeCustom {
+		return departments, groups, nil
+	}
+	if len(departmentIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&departments, departmentIDs).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(departments) != len(uniqueInts(departmentIDs)) {
+			return nil, nil, FieldErrors{"department_ids": "部分部门不存在"}
+		}
+	}
+	if len(groupIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&groups, groupIDs).Error; err != nil {
+			return nil, nil, err
+		}
+		if len(groups) != len(uniqueInts(groupIDs)) {
+			return nil, nil, FieldErrors{"group_ids": "部分用户组不存在"}
+		}
+	}
+	return departments, groups, nil
+}
+
+// replaceDataScopeTargets 替换角色的自定义数据范围，只写关联表，不修改部门和用户组本身
+func replaceDataScopeTargets(tx *gorm.DB, role *model.Role, departments []model.Department, groups []model.Group) error {
+	if err := tx.Model(role).Omit("DataScopeDepartments.*").Association("DataScopeDepartments").Replace(&departments); err != nil {
+		return err
+	}
+	return tx.Model(role).Omit("DataScopeGroups.*").Association("DataScopeGroups").Replace(&groups)
+}
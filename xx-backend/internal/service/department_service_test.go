@@ -0,0 +1,32 @@
+package service
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestCollectDescendants(t *testing.T) {
+	children := map[int][]int{
+		1: {2, 3},
+		2: {4},
+		3: {4, 5},
+		5: {1}, // 环不会导致死循环
+	}
+	tests := []struct {
+		root int
+		want []int
+	}{
+		{root: 1, want: []int{2, 3, 4, 5}},
+		{root: 3, want: []int{1, 2, 4, 5}},
+		{root: 4, want: nil},
+		{root: 9, want: nil},
+	}
+	for _, tt := range tests {
+		got := collectDescendants(children, tt.root)
+		sort.Ints(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("collectDescendants(%d) = %v, want %v", tt.root, got, tt.want)
+		}
+	}
+}
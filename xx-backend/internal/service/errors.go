@@ -0,0 +1,9 @@
+package service
+
+import "errors"
+
+// ErrConflict 操作与现有数据冲突（仍被引用、形成循环等），处理器应返回409
+var ErrConflict = errors.New("数据冲突")
+
+// ErrPreconditionFailed 数据已被其他请求修改（版本号不匹配），处理器应返回412
+var ErrPreconditionFailed = errors.New("数据已被修改，请刷新后重试")
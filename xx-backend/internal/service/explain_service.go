@@ -0,0 +1,394 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+)
+
+// MethodActions HTTP方法与策略操作的对应关系
+var MethodActions = map[string]string{
+	http.MethodGet:    "read",
+	http.MethodPost:   "create",
+	http.MethodPut:    "update",
+	http.MethodPatch:  "update",
+	http.MethodDelete: "delete",
+}
+
+// routeResources 路由前缀与策略资源名的对应关系，需与 main.go 中的路由组保持一致
+var routeResources = map[string]string{
+	"users":            "user",
+	"groups":           "group",
+	"notifications":    "notification",
+	"invitations":      "invitation",
+	"lifecycle-policy": "lifecycle_policy",
+	"user-fields":      "user_field",
+	"roles":            "role",
+	"departments":      "department",
+	"permissions":      "permission",
+	"menus":            "menu",
+	"policies":         "policy",
+	"change-requests":  "change_request",
+	"jobs":             "job",
+	"recycle-bin":      "recycle_bin",
+	"rbac":             "rbac",
+}
+
+// 角色来源
+const (
+	RoleSourcePrimary   = "primary"   // 用户的主角色
+	RoleSourceInherited = "inherited" // 从父角色继承
+	RoleSourceGrant     = "grant"     // 限时授权
+	RoleSourceGroup     = "group"     // 用户组分配的角色
+)
+
+// ExplainRequest 授权解释请求，permission 和 route（或 object、action）至少指定一个
+type ExplainRequest struct {
+	UserID     int    `json:"user_id" binding:"required"`
+	Permission string `json:"permission"` // 权限编码
+	Route      string `json:"route"`      // 如 "DELETE /api/users/5"
+	Object     string `json:"object"`     // 资源名，指定 route 时由路由推断
+	Action     string `json:"action"`     // 操作，指定 route 时由HTTP方法推断
+	Resource   string `json:"resource"`   // 资源ID，可选
+}
+
+// RoleTrace 用户拥有的角色及其来源
+type RoleTrace struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Source      string   `json:"source"`
+	Via         string   `json:"via,omitempty"`         // 继承自哪个角色或来自哪个授权
+	Permissions []string `json:"permissions,omitempty"` // 角色直接拥有的权限编码
+}
+
+// GrantTrace 用户的限时授权
+type GrantTrace struct {
+	ID        int       `json:"id"`
+	RoleID    int       `json:"role_id"`
+	StartsAt  time.Time `json:"starts_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Active    bool      `json:"active"`
+}
+
+// DataScopeTrace 用户的数据范围（由主角色决定）
+type DataScopeTrace struct {
+	Scope         string `json:"scope"`
+	All           bool   `json:"all"`
+	DepartmentIDs []int  `json:"department_ids"`
+	GroupIDs      []int  `json:"group_ids"`                 // 范围内的用户组，其成员（包括子组成员）都在范围内
+	TargetInScope *bool  `json:"target_in_scope,omitempty"` // 资源为用户时，目标用户是否在范围内
+}
+
+// Explanation 授权决策及其依据
+type Explanation struct {
+	Decision   string          `json:"decision"`
+	Reasons    []string        `json:"reasons"` // 按判断顺序列出的决策依据
+	UserID     int             `json:"user_id"`
+	Username   string          `json:"username"`
+	TenantID   uint            `json:"tenant_id"`
+	Permission string          `json:"permission,omitempty"`
+	Object     string          `json:"object,omitempty"`
+	Action     string          `json:"action,omitempty"`
+	Resource   string          `json:"resource,omitempty"`
+	Roles      []RoleTrace     `json:"roles"`
+	Grants     []GrantTrace    `json:"grants"`
+	DataScope  *DataScopeTrace `json:"data_scope,omitempty"`
+	Policy     *PolicyDecision `json:"policy,omitempty"`
+}
+
+// parseRoute 从 "METHOD /api/<resource>/<id>/..." 中解析资源名、操作和资源ID
+func parseRoute(route string) (object, action, resource string, err error) {
+	parts := strings.Fields(route)
+	if len(parts) != 2 {
+		return "", "", "", fmt.Errorf("路由格式应为 \"METHOD /api/...\"")
+	}
+
+	action, ok := MethodActions[strings.ToUpper(parts[0])]
+	if !ok {
+		return "", "", "", fmt.Errorf("不支持的HTTP方法: %s", parts[0])
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(parts[1], "/api"), "/"), "/")
+	object, ok = routeResources[segments[0]]
+	if !ok {
+		return "", "", "", fmt.Errorf("未知的路由: %s", parts[1])
+	}
+	if len(segments) > 1 {
+		resource = segments[1]
+	}
+	return object, action, resource, nil
+}
+
+// Explain 计算授权决策并给出决策链：角色（含继承和限时授权）、数据范围和策略
+func (s *PolicyService) Explain(ctx context.Context, req *ExplainRequest, env map[string]interface{}) (*Explanation, error) {
+	if req.Route != "" {
+		object, action, resource, err := parseRoute(req.Route)
+		if err != nil {
+			return nil, err
+		}
+		req.Object, req.Action = object, action
+		if req.Resource == "" {
+			req.Resource = resource
+		}
+	}
+	if req.Permission == "" && (req.Object == "" || req.Action == "") {
+		return nil, fmt.Errorf("必须指定权限编码或路由")
+	}
+
+	subject, err := s.SubjectAttributes(ctx, req.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	explanation := &Explanation{
+		Decision:   DecisionAllow,
+		Reasons:    []string{},
+		UserID:     req.UserID,
+		Username:   fmt.Sprint(subject["username"]),
+		TenantID:   subject["tenant_id"].(uint),
+		Permission: req.Permission,
+		Object:     req.Object,
+		Action:     req.Action,
+		Resource:   req.Resource,
+	}
+	deny := func(reason string) {
+		explanation.Decision = DecisionDeny
+		explanation.Reasons = append(explanation.Reasons, reason)
+	}
+	allow := func(reason string) {
+		explanation.Reasons = append(explanation.Reasons, reason)
+	}
+
+	if err := s.traceRoles(ctx, explanation); err != nil {
+		return nil, err
+	}
+
+	if req.Permission != "" {
+		var sources []string
+		for _, role := range explanation.Roles {
+			for _, code := range role.Permissions {
+				if code == req.Permission {
+					sources = append(sources, role.Name)
+				}
+			}
+		}
+		if len(sources) == 0 {
+			deny(fmt.Sprintf("没有任何角色拥有权限 %s", req.Permission))
+		} else {
+			allow(fmt.Sprintf("权限 %s 由角色 %s 提供", req.Permission, strings.Join(sources, "、")))
+		}
+	}
+
+	if req.Object != "" && req.Action != "" {
+		tenantID, _ := tenant.FromContext(ctx)
+		explanation.Policy = s.Evaluate(&AuthzRequest{
+			TenantID:    tenantID,
+			Subject:     subject,
+			Object:      req.Object,
+			ObjectAttrs: ObjectAttributes(req.Resource),
+			Action:      req.Action,
+			Env:         env,
+		})
+		explainPolicy(explanation.Policy, s.Decide(explanation.Policy), allow, deny)
+
+		if err := s.traceDataScope(ctx, explanation); err != nil {
+			return nil, err
+		}
+		if scope := explanation.DataScope; scope.TargetInScope != nil {
+			if *scope.TargetInScope {
+				allow(fmt.Sprintf("目标用户在数据范围（%s）内", scope.Scope))
+			} else {
+				deny(fmt.Sprintf("目标用户超出数据范围（%s）", scope.Scope))
+			}
+		}
+	}
+
+	return explanation, nil
+}
+
+// explainPolicy 把策略引擎的决策转换为决策依据，effective 为 Decide 给出的最终决策
+func explainPolicy(decision *PolicyDecision, effective string, allow, deny func(string)) {
+	describe := func(p model.Policy) string {
+		return fmt.Sprintf("策略 #%d（%s）", p.ID, p.Name)
+	}
+
+	switch decision.Decision {
+	case DecisionNotApplicable:
+		if effective == DecisionAllow {
+			allow("没有适用的策略，默认放行")
+		} else {
+			deny("没有适用的策略，默认拒绝")
+		}
+	case DecisionAllow:
+		for _, m := range decision.Matches {
+			if m.Satisfied && m.Policy.Effect == model.PolicyEffectAllow {
+				allow(describe(m.Policy) + " 允许访问")
+			}
+		}
+	case DecisionDeny:
+		denied := false
+		for _, m := range decision.Matches {
+			if m.Satisfied && m.Policy.Effect == model.PolicyEffectDeny {
+				deny(describe(m.Policy) + " 拒绝访问")
+				denied = true
+			}
+		}
+		if !denied {
+			names := make([]string, 0, len(decision.Matches))
+			for _, m := range decision.Matches {
+				names = append(names, describe(m.Policy))
+			}
+			deny("存在适用的策略但条件均不满足：" + strings.Join(names, "、"))
+		}
+	}
+}
+
+// traceRoles 收集用户的主角色、继承的角色、限时授权角色和用户组的角色，以及各角色直接拥有的权限
+func (s *PolicyService) traceRoles(ctx context.Context, explanation *Explanation) error {
+	// 用户可能属于其他租户（平台超级管理员），按主键跨租户读取
+	ctx = tenant.WithoutTenant(ctx)
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, explanation.UserID).Error; err != nil {
+		return err
+	}
+
+	var grants []model.RoleGrant
+	if err := s.db.WithContext(ctx).Where("user_id = ? AND revoked_at IS NULL", user.ID).Order("id").Find(&grants).Error; err != nil {
+		return err
+	}
+
+	explanation.Roles = []RoleTrace{}
+	explanation.Grants = []GrantTrace{}
+	seen := make(map[int]bool)
+	addChain := func(roleID int, source, via string) error {
+		ep, err := s.userService.GetEffectivePermissions(ctx, roleID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 角色已被删除
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		chain := append([]int{roleID}, ep.Ancestors...)
+		for i, id := range chain {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			trace := RoleTrace{ID: id, Name: ep.Roles[i], Source: source, Via: via}
+			if i > 0 {
+				trace.Source = RoleSourceInherited
+				trace.Via = ep.Roles[i-1]
+			}
+			explanation.Roles = append(explanation.Roles, trace)
+		}
+		return nil
+	}
+
+	if user.RoleID != 0 {
+		if err := addChain(user.RoleID, RoleSourcePrimary, ""); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	for _, g := range grants {
+		active := g.ActiveAt(now)
+		explanation.Grants = append(explanation.Grants, GrantTrace{
+			ID:        g.ID,
+			RoleID:    g.RoleID,
+			StartsAt:  g.StartsAt,
+			ExpiresAt: g.ExpiresAt,
+			Active:    active,
+		})
+		if active {
+			if err := addChain(g.RoleID, RoleSourceGrant, fmt.Sprintf("限时授权 #%d", g.ID)); err != nil {
+				return err
+			}
+		}
+	}
+
+	groupRoles, err := s.userService.userGroupRoles(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	for _, gr := range groupRoles {
+		if err := addChain(gr.RoleID, RoleSourceGroup, "用户组 "+gr.GroupName); err != nil {
+			return err
+		}
+	}
+
+	if len(explanation.Roles) == 0 {
+		return nil
+	}
+	ids := make([]int, 0, len(explanation.Roles))
+	for _, r := range explanation.Roles {
+		ids = append(ids, r.ID)
+	}
+	var roles []model.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Find(&roles, ids).Error; err != nil {
+		return err
+	}
+	codes := make(map[int][]string, len(roles))
+	for _, r := range roles {
+		for _, p := range r.Permissions {
+			codes[r.ID] = append(codes[r.ID], p.Code)
+		}
+	}
+	for i := range explanation.Roles {
+		explanation.Roles[i].Permissions = codes[explanation.Roles[i].ID]
+	}
+	return nil
+}
+
+// traceDataScope 计算用户的数据范围，资源为用户且指定了ID时判断目标用户是否在范围内
+func (s *PolicyService) traceDataScope(ctx context.Context, explanation *Explanation) error {
+	var user model.User
+	if err := s.db.WithContext(tenant.WithoutTenant(ctx)).Preload("Role").First(&user, explanation.UserID).Error; err != nil {
+		return err
+	}
+
+	scope, err := s.userService.resolveDataScope(ctx, explanation.UserID)
+	if err != nil {
+		return err
+	}
+
+	trace := &DataScopeTrace{
+		Scope:         user.Role.DataScope,
+		All:           scope.all,
+		DepartmentIDs: scope.departmentIDs,
+		GroupIDs:      scope.groupIDs,
+	}
+	if trace.Scope == "" {
+		trace.Scope = model.DataScopeAll
+	}
+	if trace.DepartmentIDs == nil {
+		trace.DepartmentIDs = []int{}
+	}
+	if trace.GroupIDs == nil {
+		trace.GroupIDs = []int{}
+	}
+
+	if explanation.Object == "user" && explanation.Resource != "" {
+		var count int64
+		err := s.db.WithContext(ctx).Model(&model.User{}).Scopes(scope.apply).
+			Where("users.id = ?", explanation.Resource).Count(&count).Error
+		if err != nil {
+			return err
+		}
+		inScope := count > 0
+		trace.TargetInScope = &inScope
+	}
+
+	explanation.DataScope = trace
+	return nil
+}
@@ -0,0 +1,429 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// 导出格式
+const (
+	ExportFormatCSV   = "csv"
+	ExportFormatXLSX  = "xlsx"
+	ExportFormatJSONL = "jsonl"
+)
+
+// PermissionUserSensitive 查看用户敏感字段的权限编码，没有该权限时导出的敏感字段会被脱敏
+const PermissionUserSensitive = "user:sensitive"
+
+// exportBatchSize 导出时每次从数据库读取的行数
+const exportBatchSize = 500
+
+// exportColumn 可导出的列
+type exportColumn struct {
+	header    string
+	sensitive bool // 没有 PermissionUserSensitive 权限时脱敏
+	value     func(u *model.User) interface{}
+}
+
+var userExportColumns = map[string]exportColumn{
+	"id":       {header: "ID", value: func(u *model.User) interface{} { return u.ID }},
+	"username": {header: "用户名", value: func(u *model.User) interface{} { return u.Username }},
+	"nickname": {header: "昵称", value: func(u *model.User) interface{} { return u.Nickname }},
+	"email":    {header: "邮箱", sensitive: true, value: func(u *model.User) interface{} { return u.Email }},
+	"status":   {header: "状态", value: func(u *model.User) interface{} { return u.Status }},
+	"role":     {header: "角色", value: func(u *model.User) interface{} { return u.Role.Name }},
+	"department": {header: "部门", value: func(u *model.User) interface{} {
+		if u.Department == nil {
+			return ""
+		}
+		return u.Department.Name
+	}},
+	"last_login_at": {header: "最近登录时间", value: func(u *model.User) interface{} { return optionalTime(u.LastLoginAt) }},
+	"deactivate_at": {header: "计划停用时间", value: func(u *model.User) interface{} { return optionalTime(u.DeactivateAt) }},
+	"created_at":    {header: "创建时间", value: func(u *model.User) interface{} { return u.CreatedAt }},
+	"updated_at":    {header: "更新时间", value: func(u *model.User) interface{} { return u.UpdatedAt }},
+}
+
+// DefaultUserExportColumns 未指定 columns 时导出的列，另外会导出全部自定义字段
+var DefaultUserExportColumns = []string{"id", "username", "nickname", "email", "status", "role", "department", "created_at"}
+
+// UserExportOptions 用户导出选项，过滤和排序与用户列表相同
+type UserExportOptions struct {
+	Format  string           `json:"format"`
+	Columns []string         `json:"columns"`
+	Filter  string           `json:"filter"` // 原始查询参数，仅用于记录
+	Query   *listquery.Query `json:"-"`
+
+	columns []exportColumn // 与 Columns 一一对应
+}
+
+// attributeExportColumn 自定义字段的导出列，列名为 attr.<key>，表头为字段名称
+func attributeExportColumn(field model.UserField) exportColumn {
+	key := field.Key
+	return exportColumn{
+		header:    field.Name,
+		sensitive: field.Visibility == model.UserFieldSensitive,
+		value: func(u *model.User) interface{} {
+			if value, ok := u.Attributes[key]; ok {
+				return value
+			}
+			return ""
+		},
+	}
+}
+
+// ParseUserExportOptions 校验导出格式和列，columns 为逗号分隔的列名，自定义字段的列名为 attr.<key>
+func (s *UserService) ParseUserExportOptions(ctx context.Context, format, columns string, q *listquery.Query) (*UserExportOptions, error) {
+	if format == "" {
+		format = ExportFormatCSV
+	}
+	switch format {
+	case ExportFormatCSV, ExportFormatXLSX, ExportFormatJSONL:
+	default:
+		return nil, fmt.Errorf("%w: 不支持的导出格式 %s", listquery.ErrInvalidQuery, format)
+	}
+
+	fields, err := s.GetUserFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	available := make(map[string]exportColumn, len(userExportColumns)+len(fields))
+	for name, column := range userExportColumns {
+		available[name] = column
+	}
+	defaults := append([]string(nil), DefaultUserExportColumns...)
+	for _, field := range fields {
+		available[attributeFilterPrefix+field.Key] = attributeExportColumn(field)
+		defaults = append(defaults, attributeFilterPrefix+field.Key)
+	}
+
+	opts := &UserExportOptions{Format: format, Query: q}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(columns, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if _, ok := available[name]; !ok {
+			return nil, fmt.Errorf("%w: 不支持导出的列 %s", listquery.ErrInvalidQuery, name)
+		}
+		if !seen[name] {
+			seen[name] = true
+			opts.Columns = append(opts.Columns, name)
+		}
+	}
+	if len(opts.Columns) == 0 {
+		opts.Columns = defaults
+	}
+	for _, name := range opts.Columns {
+		opts.columns = append(opts.columns, available[name])
+	}
+	return opts, nil
+}
+
+// ExportContentType 导出格式对应的 Content-Type
+func ExportContentType(format string) string {
+	switch format {
+	case ExportFormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case ExportFormatJSONL:
+		return "application/x-ndjson; charset=utf-8"
+	default:
+		return "text/csv; charset=utf-8"
+	}
+}
+
+// SetExportOptions 设置导出文件目录和同步导出的行数上限，超过上限的导出转为后台任务
+func (s *UserService) SetExportOptions(dir string, syncLimit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.exportDir = dir
+	s.exportSyncLimit = syncLimit
+}
+
+// ShouldExportInBackground 判断导出是否需要转为后台任务（匹配的用户数超过同步导出上限）
+func (s *UserService) ShouldExportInBackground(ctx context.Context, operatorID int, q *listquery.Query) (bool, error) {
+	s.mu.RLock()
+	limit := s.exportSyncLimit
+	s.mu.RUnlock()
+	if limit <= 0 {
+		return false, nil
+	}
+
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return false, err
+	}
+	var total int64
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Scopes(scope.apply, q.Scope).Count(&total).Error; err != nil {
+		return false, err
+	}
+	return total > int64(limit), nil
+}
+
+// ExportUsers 按用户列表的过滤和排序条件导出操作人数据范围内的用户，
+// 使用游标分批读取并写入 w，不会一次性加载全部数据
+func (s *UserService) ExportUsers(ctx context.Context, operatorID int, opts *UserExportOptions, w io.Writer, progress func(processed, total int)) error {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return err
+	}
+	permissions, err := s.GetUserPermissions(ctx, uint(operatorID))
+	if err != nil {
+		return err
+	}
+	unmasked := permissions.HasPermission(PermissionUserSensitive)
+
+	headers := make([]string, len(opts.columns))
+	for i, column := range opts.columns {
+		headers[i] = column.header
+	}
+	writer, err := newExportWriter(opts.Format, w, opts.Columns, headers)
+	if err != nil {
+		return err
+	}
+
+	if err := s.writeUsers(ctx, scope, opts, unmasked, writer, progress); err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
+}
+
+func (s *UserService) writeUsers(ctx context.Context, scope *dataScope, opts *UserExportOptions, unmasked bool, writer exportWriter, progress func(processed, total int)) error {
+	// 复制查询条件，改为按批次的游标分页，并加载角色和部门名称
+	q := *opts.Query
+	q.Fields = nil
+	q.Page = 1
+	q.PageSize = exportBatchSize
+	q.Cursor = ""
+
+	processed, total := 0, 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result, err := listquery.Find[model.User](s.db.WithContext(ctx).Scopes(scope.apply), &q)
+		if err != nil {
+			return err
+		}
+		if result.Total != nil {
+			total = int(*result.Total)
+		}
+
+		for i := range result.List {
+			values := make([]interface{}, len(opts.Columns))
+			for j, column := range opts.columns {
+				values[j] = column.value(&result.List[i])
+				if column.sensitive && !unmasked {
+					values[j] = maskValue(fmt.Sprint(values[j]))
+				}
+			}
+			if err := writer.WriteRow(values); err != nil {
+				return err
+			}
+		}
+
+		processed += len(result.List)
+		if progress != nil {
+			progress(processed, total)
+		}
+		if result.NextCursor == "" {
+			break
+		}
+		q.Cursor = result.NextCursor
+	}
+	return nil
+}
+
+// StartUserExportJob 以后台任务导出用户，完成后可以下载生成的文件
+func (s *UserService) StartUserExportJob(ctx context.Context, operatorID int, opts *UserExportOptions) (*model.Job, error) {
+	s.mu.RLock()
+	dir := s.exportDir
+	s.mu.RUnlock()
+	if dir == "" {
+		return nil, fmt.Errorf("未配置导出文件目录")
+	}
+
+	return s.startJob(ctx, operatorID, model.JobUserExport, opts, func(ctx context.Context, job *model.Job, progress func(processed, total int)) error {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, fmt.Sprintf("%s_%d.%s", job.Type, job.ID, opts.Format))
+		file, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+
+		if err := s.ExportUsers(ctx, operatorID, opts, file, progress); err != nil {
+			file.Close()
+			os.Remove(path)
+			return err
+		}
+		if err := file.Close(); err != nil {
+			os.Remove(path)
+			return err
+		}
+
+		job.FilePath = path
+		job.FileName = fmt.Sprintf("users_%s.%s", time.Now().Format("20060102150405"), opts.Format)
+		return nil
+	})
+}
+
+// maskValue 脱敏：邮箱保留首字符和域名，其他值只保留首尾字符
+func maskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	if at := strings.LastIndex(value, "@"); at > 0 {
+		first, _ := utf8.DecodeRuneInString(value)
+		return string(first) + "***" + value[at:]
+	}
+	runes := []rune(value)
+	if len(runes) <= 2 {
+		return string(runes[0]) + "*"
+	}
+	return string(runes[0]) + "***" + string(runes[len(runes)-1])
+}
+
+// exportWriter 按格式逐行写出导出数据
+type exportWriter interface {
+	WriteRow(values []interface{}) error
+	Close() error
+}
+
+func newExportWriter(format string, w io.Writer, columns, headers []string) (exportWriter, error) {
+	switch format {
+	case ExportFormatCSV:
+		// 写入BOM，Excel打开时才能正确识别UTF-8
+		if _, err := w.Write([]byte("\xef\xbb\xbf")); err != nil {
+			return nil, err
+		}
+		cw := &csvExportWriter{w: csv.NewWriter(w)}
+		if err := cw.w.Write(headers); err != nil {
+			return nil, err
+		}
+		return cw, nil
+	case ExportFormatJSONL:
+		return &jsonlExportWriter{enc: json.NewEncoder(w), columns: columns}, nil
+	case ExportFormatXLSX:
+		f := excelize.NewFile()
+		sw, err := f.NewStreamWriter("Sheet1")
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		xw := &xlsxExportWriter{file: f, stream: sw, w: w}
+		row := make([]interface{}, len(headers))
+		for i, h := range headers {
+			row[i] = h
+		}
+		if err := xw.WriteRow(row); err != nil {
+			f.Close()
+			return nil, err
+		}
+		return xw, nil
+	default:
+		return nil, fmt.Errorf("不支持的导出格式 %s", format)
+	}
+}
+
+// formatCell 表格格式中时间统一输出为本地时间
+func formatCell(value interface{}) string {
+	if t, ok := value.(time.Time); ok {
+		return t.Format("2006-01-02 15:04:05")
+	}
+	return fmt.Sprint(value)
+}
+
+// optionalTime 可为空的时间列，为空时导出空字符串
+func optionalTime(t *time.Time) interface{} {
+	if t == nil {
+		return ""
+	}
+	return *t
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvExportWriter) WriteRow(values []interface{}) error {
+	record := make([]string, len(values))
+	for i, v := range values {
+		record[i] = formatCell(v)
+	}
+	return c.w.Write(record)
+}
+
+func (c *csvExportWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type jsonlExportWriter struct {
+	enc     *json.Encoder
+	columns []string
+}
+
+func (j *jsonlExportWriter) WriteRow(values []interface{}) error {
+	row := make(map[string]interface{}, len(values))
+	for i, v := range values {
+		row[j.columns[i]] = v
+	}
+	return j.enc.Encode(row)
+}
+
+func (j *jsonlExportWriter) Close() error {
+	return nil
+}
+
+// xlsxExportWriter 使用excelize的流式写入，数据行暂存在临时文件中，Close 时写出完整文件
+type xlsxExportWriter struct {
+	file   *excelize.File
+	stream *excelize.StreamWriter
+	w      io.Writer
+	row    int
+}
+
+func (x *xlsxExportWriter) WriteRow(values []interface{}) error {
+	x.row++
+	cell, err := excelize.CoordinatesToCellName(1, x.row)
+	if err != nil {
+		return err
+	}
+	row := make([]interface{}, len(values))
+	for i, v := range values {
+		switch v.(type) {
+		case string, time.Time:
+			row[i] = formatCell(v)
+		default:
+			row[i] = v
+		}
+	}
+	return x.stream.SetRow(cell, row)
+}
+
+func (x *xlsxExportWriter) Close() error {
+	defer x.file.Close()
+	if err := x.stream.Flush(); err != nil {
+		return err
+	}
+	return x.file.Write(x.w)
+}
@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+)
+
+// ErrSelfGrant 操作人不能给自己限时授予角色
+var ErrSelfGrant = errors.New("不能给自己授予角色")
+
+// userPermissionTTL 用户有效权限缓存的最长有效期，其他实例撤销授权后最多延迟这么久生效
+const userPermissionTTL = time.Minute
+
+// GetUserPermissions 获取用户的有效权限：主角色、当前生效的限时授权角色和用户组的角色（均包含继承的权限）
+func (s *UserService) GetUserPermissions(ctx context.Context, userID uint) (*EffectivePermissions, error) {
+	now := time.Now()
+	if ep, ok := s.roleCache.getUser(userID, now); ok {
+		return ep, nil
+	}
+	generation := s.roleCache.currentGeneration()
+
+	// 用户ID来自token或管理员指定，按主键跨租户读取（平台超级管理员可能切换了租户）
+	ctx = tenant.WithoutTenant(ctx)
+
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var grants []model.RoleGrant
+	err := s.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, now).
+		Find(&grants).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// 缓存在下一个授权生效或到期的时间点失效
+	expiresAt := now.Add(userPermissionTTL)
+	roleIDs := []int{user.RoleID}
+	for _, g := range grants {
+		switch {
+		case g.ActiveAt(now):
+			roleIDs = append(roleIDs, g.RoleID)
+			if g.ExpiresAt.Before(expiresAt) {
+				expiresAt = g.ExpiresAt
+			}
+		case g.StartsAt.After(now) && g.StartsAt.Before(expiresAt):
+			expiresAt = g.StartsAt
+		}
+	}
+
+	// 通过用户组继承的角色
+	groupRoles, err := s.userGroupRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, gr := range groupRoles {
+		roleIDs = append(roleIDs, gr.RoleID)
+	}
+
+	result := &EffectivePermissions{
+		RoleID:      user.RoleID,
+		Ancestors:   []int{},
+		Roles:       []string{},
+		Permissions: []model.Permission{},
+		Menus:       []model.Menu{},
+	}
+	for i, roleID := range roleIDs {
+		ep, err := s.GetEffectivePermissions(ctx, roleID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// 角色已被删除
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			result.Ancestors = ep.Ancestors
+		}
+		result.Roles = mergeStrings(result.Roles, ep.Roles)
+		result.Permissions = mergePermissions(result.Permissions, ep.Permissions)
+		result.Menus = mergeMenus(result.Menus, ep.Menus)
+	}
+	sort.Slice(result.Menus, func(i, j int) bool { return result.Menus[i].Sort < result.Menus[j].Sort })
+
+	s.roleCache.setUserIfFresh(generation, userID, result, expiresAt)
+	return result, nil
+}
+
+func mergeStrings(own, other []string) []string {
+	seen := make(map[string]bool, len(own)+len(other))
+	result := make([]string, 0, len(own)+len(other))
+	for _, list := range [][]string{own, other} {
+		for _, v := range list {
+			if !seen[v] {
+				seen[v] = true
+				result = append(result, v)
+			}
+		}
+	}
+	return result
+}
+
+// GetRoleGrants 获取用户的限时角色授权记录
+func (s *UserService) GetRoleGrants(ctx context.Context, operatorID int, userID uint) ([]model.RoleGrant, error) {
+	if _, err := s.GetUser(ctx, operatorID, int(userID)); err != nil {
+		return nil, err
+	}
+
+	var grants []model.RoleGrant
+	if err := s.db.WithContext(ctx).Preload("Role").Where("user_id = ?", userID).Order("id DESC").Find(&grants).Error; err != nil {
+		return nil, err
+	}
+	return grants, nil
+}
+
+// CreateRoleGrant 限时授予用户角色，需要 user:role 权限，不能给自己授权；按分配角色决定是否需要审批。
+// 需要审批时校验后提交变更请求，返回 ApprovalRequiredError，审批通过时再校验一次有效期
+func (s *UserService) CreateRoleGrant(ctx context.Context, operatorID int, grant *model.RoleGrant) error {
+	if int(grant.UserID) == operatorID {
+		return ErrSelfGrant
+	}
+	if err := s.forbiddenFields(ctx, operatorID, map[string]string{"role_id": PermissionUserRole}); err != nil {
+		return err
+	}
+	user, err := s.GetUser(ctx, operatorID, int(grant.UserID))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if strings.TrimSpace(grant.Reason) == "" {
+		return fmt.Errorf("必须填写授权原因")
+	}
+	if grant.StartsAt.IsZero() {
+		grant.StartsAt = now
+	}
+	if !grant.ExpiresAt.After(grant.StartsAt) || !grant.ExpiresAt.After(now) {
+		return fmt.Errorf("到期时间必须晚于开始时间和当前时间")
+	}
+
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, grant.RoleID).Error; err != nil {
+		return fmt.Errorf("角色不存在")
+	}
+	if role.ID == user.RoleID {
+		return fmt.Errorf("用户已拥有该角色")
+	}
+	if s.needsApproval(ctx, model.ChangeRoleGrant) {
+		payload := map[string]interface{}{
+			"role_id":    grant.RoleID,
+			"starts_at":  grant.StartsAt,
+			"expires_at": grant.ExpiresAt,
+			"reason":     grant.Reason,
+		}
+		return s.submitForApproval(ctx, operatorID, model.ChangeRoleGrant, int(grant.UserID), payload)
+	}
+
+	grant.ID = 0
+	grant.GrantedBy = uint(operatorID)
+	grant.RevokedAt = nil
+	grant.RevokedBy = nil
+	if err := s.db.WithContext(ctx).Omit("Role").Create(grant).Error; err != nil {
+		return err
+	}
+	grant.Role = role
+
+	s.roleCache.invalidateUser(grant.UserID)
+
+	// 记录授权事件到Kafka
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogRoleGrant(grant.ID, grant.UserID, grant.RoleID, grant.ExpiresAt, grant.Reason); err != nil {
+			fmt.Printf("Failed to log role grant to Kafka: %v\n", err)
+		}
+	}
+
+	return nil
+}
+
+// RevokeRoleGrant 手动撤销限时角色授权
+func (s *UserService) RevokeRoleGrant(ctx context.Context, operatorID int, userID uint, grantID int, reason string) error {
+	if _, err := s.GetUser(ctx, operatorID, int(userID)); err != nil {
+		return err
+	}
+
+	var grant model.RoleGrant
+	if err := s.db.WithContext(ctx).Where("user_id = ?", userID).First(&grant, grantID).Error; err != nil {
+		return err
+	}
+
+	revokedBy := uint(operatorID)
+	revoked, err := s.revokeGrant(ctx, &grant, &revokedBy, reason)
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return fmt.Errorf("%w: 授权已被撤销", ErrConflict)
+	}
+	return nil
+}
+
+// revokeGrant 条件更新撤销授权，多个实例同时撤销时只有一个会成功并发送事件
+func (s *UserService) revokeGrant(ctx context.Context, grant *model.RoleGrant, revokedBy *uint, reason string) (bool, error) {
+	now := time.Now()
+	result := s.db.WithContext(ctx).Model(&model.RoleGrant{}).
+		Where("id = ? AND revoked_at IS NULL", grant.ID).
+		Updates(map[string]interface{}{
+			"revoked_at":    now,
+			"revoked_by":    revokedBy,
+			"revoke_reason": reason,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	s.roleCache.invalidateUser(grant.UserID)
+
+	// 记录撤销事件到Kafka
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogRoleRevoke(grant.ID, grant.UserID, grant.RoleID, reason); err != nil {
+			fmt.Printf("Failed to log role revoke to Kafka: %v\n", err)
+		}
+	}
+	return true, nil
+}
+
+// ExpireRoleGrants 撤销所有已到期的限时授权，返回撤销的数量
+func (s *UserService) ExpireRoleGrants(ctx context.Context) (int, error) {
+	ctx = tenant.WithoutTenant(ctx)
+
+	var grants []model.RoleGrant
+	if err := s.db.WithContext(ctx).Where("revoked_at IS NULL AND expires_at <= ?", time.Now()).Find(&grants).Error; err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for i := range grants {
+		revoked, err := s.revokeGrant(ctx, &grants[i], nil, "expired")
+		if err != nil {
+			return count, err
+		}
+		if revoked {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// StartRoleGrantExpiryJob 启动后台任务，定期撤销到期的限时授权
+func (s *UserService) StartRoleGrantExpiryJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				count, err := s.ExpireRoleGrants(ctx)
+				if err != nil {
+					log.Printf("Failed to expire role grants: %v", err)
+					continue
+				}
+				if count > 0 {
+					log.Printf("Revoked %d expired role grants", count)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,18 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"xx-backend/internal/model"
+)
+
+func TestCreateRoleGrantSelf(t *testing.T) {
+	s := NewUserService(nil, nil, nil)
+	grant := &model.RoleGrant{UserID: 7, RoleID: 1, Reason: "值班", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := s.CreateRoleGrant(context.Background(), 7, grant); !errors.Is(err, ErrSelfGrant) {
+		t.Errorf("CreateRoleGrant() error = %v, want ErrSelfGrant", err)
+	}
+}
@@ -0,0 +1,456 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+
+	"gorm.io/gorm"
+)
+
+// ErrGroupCycle 用户组上下级关系出现循环
+var ErrGroupCycle = fmt.Errorf("%w: 用户组上下级关系不能形成循环", ErrConflict)
+
+// maxGroupMembersPerRequest 单次添加或移除的成员数上限
+const maxGroupMembersPerRequest = 1000
+
+// groupRole 用户通过某个用户组获得的角色
+type groupRole struct {
+	GroupID   int
+	GroupName string
+	RoleID    int
+}
+
+// GetGroups 获取用户组列表
+func (s *UserService) GetGroups(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Group], error) {
+	return listquery.Find[model.Group](s.db.WithContext(ctx), q)
+}
+
+// GetGroup 获取用户组详情（包含分配的角色）
+func (s *UserService) GetGroup(ctx context.Context, id int) (*model.Group, error) {
+	var group model.Group
+	if err := s.db.WithContext(ctx).Preload("Roles").First(&group, id).Error; err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// CreateGroup 创建用户组，组名在租户内唯一。成员和角色通过单独的接口设置
+func (s *UserService) CreateGroup(ctx context.Context, group *model.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group.ID = 0
+	group.Name = strings.TrimSpace(group.Name)
+	errs := FieldErrors{}
+	switch {
+	case group.Name == "":
+		errs["name"] = "不能为空"
+	case utf8.RuneCountInString(group.Name) > 50:
+		errs["name"] = "长度不能超过 50"
+	}
+	if utf8.RuneCountInString(group.Description) > 255 {
+		errs["description"] = "长度不能超过 255"
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+	if group.ParentID != nil {
+		if err := s.checkGroupParent(ctx, 0, *group.ParentID); err != nil {
+			return err
+		}
+	}
+	if err := s.checkGroupName(ctx, 0, group.Name); err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Omit("Members", "Roles").Create(group).Error
+}
+
+// GroupUpdate 用户组的更新内容，未出现的字段不修改
+type GroupUpdate struct {
+	Name        Optional[string] `json:"name"`
+	Description Optional[string] `json:"description"`
+	ParentID    Optional[int]    `json:"parent_id"` // null 表示移动到顶层
+}
+
+// DecodeGroupUpdate 解析用户组的合并补丁
+func DecodeGroupUpdate(data []byte) (*GroupUpdate, error) {
+	var update GroupUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// UpdateGroup 更新用户组，修改上级组会改变成员继承的角色，需要清空权限缓存
+func (s *UserService) UpdateGroup(ctx context.Context, id int, update *GroupUpdate) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.db.WithContext(ctx).First(&model.Group{}, id).Error; err != nil {
+		return err
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	stringField(errs, columns, "name", update.Name, 50, true)
+	stringField(errs, columns, "description", update.Description, 255, false)
+	if err := errs.err(); err != nil {
+		return err
+	}
+	if update.ParentID.Set {
+		if update.ParentID.Value != nil {
+			if err := s.checkGroupParent(ctx, id, *update.ParentID.Value); err != nil {
+				return err
+			}
+		}
+		columns["parent_id"] = update.ParentID.Value
+	}
+	if name, ok := columns["name"].(string); ok {
+		if err := s.checkGroupName(ctx, id, name); err != nil {
+			return err
+		}
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&model.Group{}).Where("id = ?", id).Updates(columns).Error; err != nil {
+		return err
+	}
+	if _, ok := columns["parent_id"]; ok {
+		s.roleCache.invalidateAll()
+	}
+	return nil
+}
+
+// DeleteGroup 删除用户组（存在子组时不允许删除），同时移除成员、角色和数据范围中对该组的引用
+func (s *UserService) DeleteGroup(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.db.WithContext(ctx).First(&model.Group{}, id).Error; err != nil {
+		return err
+	}
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Group{}).Where("parent_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 存在子组，不能删除", ErrConflict)
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, table := range []string{"group_members", "group_roles", "role_data_scope_groups"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE group_id = ?", id).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Delete(&model.Group{}, id).Error
+	})
+	if err != nil {
+		return err
+	}
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+// checkGroupName 组名在租户内唯一
+func (s *UserService) checkGroupName(ctx context.Context, id int, name string) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Group{}).Where("name = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 组名已被其他用户组使用", ErrConflict)
+	}
+	return nil
+}
+
+// checkGroupParent 校验上级组存在且不会形成循环
+func (s *UserService) checkGroupParent(ctx context.Context, groupID, parentID int) error {
+	if groupID != 0 && parentID == groupID {
+		return ErrGroupCycle
+	}
+	if err := s.db.WithContext(ctx).First(&model.Group{}, parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FieldErrors{"parent_id": "上级组不存在"}
+		}
+		return err
+	}
+	if groupID == 0 {
+		return nil
+	}
+	children, err := s.groupChildren(ctx)
+	if err != nil {
+		return err
+	}
+	for _, id := range collectDescendants(children, groupID) {
+		if id == parentID {
+			return ErrGroupCycle
+		}
+	}
+	return nil
+}
+
+// groupChildren 加载当前租户的组层级（父组到子组）
+func (s *UserService) groupChildren(ctx context.Context) (map[int][]int, error) {
+	var groups []model.Group
+	if err := s.db.WithContext(ctx).Select("id", "parent_id").Find(&groups).Error; err != nil {
+		return nil, err
+	}
+	children := make(map[int][]int)
+	for _, g := range groups {
+		if g.ParentID != nil {
+			children[*g.ParentID] = append(children[*g.ParentID], g.ID)
+		}
+	}
+	return children, nil
+}
+
+// withDescendantGroups 返回指定的组及其所有子孙组
+func (s *UserService) withDescendantGroups(ctx context.Context, groupIDs []int) ([]int, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+	children, err := s.groupChildren(ctx)
+	if err != nil {
+		return nil, err
+	}
+	result := append([]int(nil), groupIDs...)
+	for _, id := range groupIDs {
+		result = append(result, collectDescendants(children, id)...)
+	}
+	return uniqueInts(result), nil
+}
+
+// groupMemberIDs 获取组（包括子组）的全部成员ID
+func (s *UserService) groupMemberIDs(ctx context.Context, groupIDs []int) ([]uint, error) {
+	ids, err := s.withDescendantGroups(ctx, groupIDs)
+	if err != nil || len(ids) == 0 {
+		return nil, err
+	}
+	var userIDs []uint
+	err = s.db.WithContext(ctx).Table("group_members").Distinct("user_id").
+		Where("group_id IN ?", ids).Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// userGroupIDs 获取用户直接所在的组
+func (s *UserService) userGroupIDs(ctx context.Context, userID uint) ([]int, error) {
+	var groupIDs []int
+	err := s.db.WithContext(ctx).Table("group_members").Where("user_id = ?", userID).Pluck("group_id", &groupIDs).Error
+	return groupIDs, err
+}
+
+// userGroupRoles 获取用户通过用户组继承的角色：用户直接所在的组及其所有上级组分配的角色
+func (s *UserService) userGroupRoles(ctx context.Context, userID uint) ([]groupRole, error) {
+	direct, err := s.userGroupIDs(ctx, userID)
+	if err != nil || len(direct) == 0 {
+		return nil, err
+	}
+	// 按用户所在租户的组层级计算，ctx 可能不带租户（平台超级管理员）
+	var groups []model.Group
+	if err := s.db.WithContext(ctx).Select("id", "tenant_id").Find(&groups, direct).Error; err != nil {
+		return nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil
+	}
+	var all []model.Group
+	if err := s.db.WithContext(ctx).Select("id", "name", "parent_id").Where("tenant_id = ?", groups[0].TenantID).Find(&all).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]model.Group, len(all))
+	for _, g := range all {
+		byID[g.ID] = g
+	}
+
+	// 沿上级链向上收集，已访问过的组不再处理（也避免数据异常时出现死循环）
+	seen := make(map[int]bool)
+	var ids []int
+	for _, id := range direct {
+		current, ok := byID[id]
+		for ok && !seen[current.ID] {
+			seen[current.ID] = true
+			ids = append(ids, current.ID)
+			if current.ParentID == nil {
+				break
+			}
+			current, ok = byID[*current.ParentID]
+		}
+	}
+
+	var rows []struct {
+		GroupID int
+		RoleID  int
+	}
+	if err := s.db.WithContext(ctx).Table("group_roles").Select("group_id", "role_id").Where("group_id IN ?", ids).Order("group_id, role_id").Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	result := make([]groupRole, len(rows))
+	for i, row := range rows {
+		result[i] = groupRole{GroupID: row.GroupID, GroupName: byID[row.GroupID].Name, RoleID: row.RoleID}
+	}
+	return result, nil
+}
+
+// GetGroupMembers 获取用户组中操作人数据范围内的成员，recursive 时包括所有子组的成员
+func (s *UserService) GetGroupMembers(ctx context.Context, operatorID, id int, recursive bool, q *listquery.Query) (*listquery.Result[model.User], error) {
+	if err := s.db.WithContext(ctx).First(&model.Group{}, id).Error; err != nil {
+		return nil, err
+	}
+	groupIDs := []int{id}
+	if recursive {
+		var err error
+		if groupIDs, err = s.withDescendantGroups(ctx, groupIDs); err != nil {
+			return nil, err
+		}
+	}
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	members := s.db.Table("group_members").Select("user_id").Where("group_id IN ?", groupIDs)
+	result, err := listquery.Find[model.User](s.db.WithContext(ctx).Scopes(scope.apply).Where("users.id IN (?)", members), q)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*model.User, len(result.List))
+	for i := range result.List {
+		users[i] = &result.List[i]
+	}
+	if err := s.hideSensitiveAttributes(ctx, operatorID, users...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// scopedUsers 加载操作人数据范围内的用户，有不存在或超出范围的用户时返回错误
+func (s *UserService) scopedUsers(ctx context.Context, operatorID int, userIDs []uint) ([]model.User, error) {
+	if len(userIDs) == 0 {
+		return nil, FieldErrors{"user_ids": "不能为空"}
+	}
+	if len(userIDs) > maxGroupMembersPerRequest {
+		return nil, FieldErrors{"user_ids": fmt.Sprintf("单次最多 %d 个用户", maxGroupMembersPerRequest)}
+	}
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	var users []model.User
+	if err := s.db.WithContext(ctx).Scopes(scope.apply).Where("users.id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if len(users) != len(uniqueUints(userIDs)) {
+		return nil, fmt.Errorf("%w: 部分用户不存在或不在数据范围内", ErrOutOfDataScope)
+	}
+	return users, nil
+}
+
+// AddGroupMembers 把用户加入用户组（只能添加数据范围内的用户），已是成员的用户忽略。
+// 成员继承组的角色，需要 user:role 权限，按分配角色决定是否需要审批
+func (s *UserService) AddGroupMembers(ctx context.Context, operatorID, id int, userIDs []uint) error {
+	approval := s.needsApproval(ctx, model.ChangeGroupMembers)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var group model.Group
+	if err := s.db.WithContext(ctx).First(&group, id).Error; err != nil {
+		return err
+	}
+	users, err := s.scopedUsers(ctx, operatorID, userIDs)
+	if err != nil {
+		return err
+	}
+	if err := s.forbiddenFields(ctx, operatorID, map[string]string{"user_ids": PermissionUserRole}); err != nil {
+		return err
+	}
+	if approval {
+		return s.submitForApproval(ctx, operatorID, model.ChangeGroupMembers, id, map[string][]uint{"user_ids": uniqueUints(userIDs)})
+	}
+	if err := s.db.WithContext(ctx).Model(&group).Omit("Members.*").Association("Members").Append(&users); err != nil {
+		return err
+	}
+	for _, user := range users {
+		s.roleCache.invalidateUser(user.ID)
+	}
+	return nil
+}
+
+// RemoveGroupMembers 把用户移出用户组（只能移除数据范围内的用户）
+func (s *UserService) RemoveGroupMembers(ctx context.Context, operatorID, id int, userIDs []uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var group model.Group
+	if err := s.db.WithContext(ctx).First(&group, id).Error; err != nil {
+		return err
+	}
+	users, err := s.scopedUsers(ctx, operatorID, userIDs)
+	if err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Model(&group).Association("Members").Delete(&users); err != nil {
+		return err
+	}
+	for _, user := range users {
+		s.roleCache.invalidateUser(user.ID)
+	}
+	return nil
+}
+
+// SetGroupRoles 设置分配给用户组的角色，组及其子组的全部成员继承这些角色。
+// 需要 user:role 权限，按分配角色决定是否需要审批
+func (s *UserService) SetGroupRoles(ctx context.Context, operatorID, id int, roleIDs []int) error {
+	approval := s.needsApproval(ctx, model.ChangeGroupRoles)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var group model.Group
+	if err := s.db.WithContext(ctx).First(&group, id).Error; err != nil {
+		return err
+	}
+
+	var roles []model.Role
+	if len(roleIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&roles, roleIDs).Error; err != nil {
+			return err
+		}
+		if len(roles) != len(uniqueInts(roleIDs)) {
+			return FieldErrors{"role_ids": "部分角色不存在"}
+		}
+	}
+	if err := s.forbiddenFields(ctx, operatorID, map[string]string{"role_ids": PermissionUserRole}); err != nil {
+		return err
+	}
+	if approval {
+		return s.submitForApproval(ctx, operatorID, model.ChangeGroupRoles, id, map[string][]int{"role_ids": uniqueInts(roleIDs)})
+	}
+
+	if err := s.db.WithContext(ctx).Model(&group).Omit("Roles.*").Association("Roles").Replace(&roles); err != nil {
+		return err
+	}
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+func uniqueUints(values []uint) []uint {
+	seen := make(map[uint]bool, len(values))
+	result := make([]uint, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
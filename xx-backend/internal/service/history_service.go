@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/listquery"
+)
+
+// GetUserHistory 获取操作人数据范围内用户的变更历史，已删除的用户也可以查询。
+// 操作人没有 user:sensitive 权限时快照和差异中不包含敏感的自定义字段
+func (s *UserService) GetUserHistory(ctx context.Context, operatorID, id int, q *listquery.Query) (*listquery.Result[history.Entry], error) {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Unscoped().Scopes(scope.apply).First(&model.User{}, id).Error; err != nil {
+		return nil, err
+	}
+	result, err := s.entityHistory(ctx, "users", id, q)
+	if err != nil {
+		return nil, err
+	}
+	redactor, err := s.attributeRedactor(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if err := redactor.historyEntries(result.List); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetRoleHistory 获取角色的变更历史
+func (s *UserService) GetRoleHistory(ctx context.Context, id int, q *listquery.Query) (*listquery.Result[history.Entry], error) {
+	if err := s.db.WithContext(ctx).Unscoped().First(&model.Role{}, id).Error; err != nil {
+		return nil, err
+	}
+	return s.entityHistory(ctx, "roles", id, q)
+}
+
+// GetMenuHistory 获取菜单的变更历史
+func (s *UserService) GetMenuHistory(ctx context.Context, id int, q *listquery.Query) (*listquery.Result[history.Entry], error) {
+	if err := s.db.WithContext(ctx).Unscoped().First(&model.Menu{}, id).Error; err != nil {
+		return nil, err
+	}
+	return s.entityHistory(ctx, "menus", id, q)
+}
+
+func (s *UserService) entityHistory(ctx context.Context, entityType string, id int, q *listquery.Query) (*listquery.Result[history.Entry], error) {
+	db := s.db.WithContext(ctx).Where("entity_type = ? AND entity_id = ?", entityType, id)
+	return listquery.Find[history.Entry](db, q)
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/listquery"
+
+	"gorm.io/gorm"
+)
+
+func TestGetUserHistorySensitiveAttributes(t *testing.T) {
+	entries := []history.Entry{
+		{
+			ID:        1,
+			Operation: history.OperationUpdate,
+			Before:    `{"attributes":{"emp_no":"A1","id_card":"110"},"id":7,"nickname":"a"}`,
+			After:     `{"attributes":{"emp_no":"A1","id_card":"120"},"id":7,"nickname":"b"}`,
+			Diff:      `{"attributes":{"before":{"emp_no":"A1","id_card":"110"},"after":{"emp_no":"A1","id_card":"120"}},"nickname":{"before":"a","after":"b"}}`,
+		},
+		{
+			ID:        2,
+			Operation: history.OperationUpdate,
+			Before:    `{"attributes":null,"id":7}`,
+			After:     `{"attributes":{"id_card":"110"},"id":7}`,
+			Diff:      `{"attributes":{"before":null,"after":{"id_card":"110"}}}`,
+		},
+	}
+	db := fakeTables(t, map[string]func(tx *gorm.DB){
+		"users": func(tx *gorm.DB) {
+			if user, ok := tx.Statement.Dest.(*model.User); ok {
+				user.ID = 7
+				tx.RowsAffected = 1
+			}
+		},
+		"user_fields": sensitiveFields("id_card"),
+		"change_histories": func(tx *gorm.DB) {
+			switch dest := tx.Statement.Dest.(type) {
+			case *int64:
+				*dest = int64(len(entries))
+			case *[]history.Entry:
+				*dest = append(*dest, entries...)
+				tx.RowsAffected = int64(len(entries))
+			}
+		},
+	})
+
+	tests := []struct {
+		name        string
+		permissions []string
+		want        []history.Entry
+	}{
+		{
+			name: "without user:sensitive",
+			want: []history.Entry{
+				{
+					Before: `{"attributes":{"emp_no":"A1"},"id":7,"nickname":"a"}`,
+					After:  `{"attributes":{"emp_no":"A1"},"id":7,"nickname":"b"}`,
+					Diff:   `{"nickname":{"before":"a","after":"b"}}`,
+				},
+				{
+					Before: `{"attributes":null,"id":7}`,
+					After:  `{"attributes":{},"id":7}`,
+					Diff:   `{"attributes":{"before":null,"after":{}}}`,
+				},
+			},
+		},
+		{name: "with user:sensitive", permissions: []string{PermissionUserSensitive}, want: entries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewUserService(db, nil, nil)
+			grantPermissions(s, 1, tt.permissions...)
+			q, err := listquery.Parse(url.Values{}, ChangeHistoryListSchema)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			result, err := s.GetUserHistory(context.Background(), 1, 7, q)
+			if err != nil {
+				t.Fatalf("GetUserHistory() error = %v", err)
+			}
+			if len(result.List) != len(tt.want) {
+				t.Fatalf("entries = %d, want %d", len(result.List), len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := result.List[i]
+				if got.Before != want.Before || got.After != want.After || got.Diff != want.Diff {
+					t.Errorf("entry %d = %s | %s | %s\nwant      %s | %s | %s", i, got.Before, got.After, got.Diff, want.Before, want.After, want.Diff)
+				}
+			}
+		})
+	}
+}
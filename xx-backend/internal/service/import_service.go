@@ -0,0 +1,591 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"xx-backend/internal/model"
+
+	"github.com/xuri/excelize/v2"
+	"gorm.io/gorm"
+)
+
+const (
+	// MaxImportRows 单次导入的最大行数
+	MaxImportRows = 5000
+	// importBatchSize 每个事务提交的用户数
+	importBatchSize = 100
+	// minPasswordLength 导入用户的密码最小长度
+	minPasswordLength = 8
+)
+
+// importColumns 导入文件支持的列，表头可以使用英文或中文列名
+var importColumns = map[string]string{
+	"username":   "username",
+	"用户名":        "username",
+	"password":   "password",
+	"密码":         "password",
+	"email":      "email",
+	"邮箱":         "email",
+	"nickname":   "nickname",
+	"昵称":         "nickname",
+	"role":       "role",
+	"角色":         "role",
+	"department": "department",
+	"部门":         "department",
+}
+
+// ImportRow 导入文件中的一行用户数据
+type ImportRow struct {
+	Line       int    `json:"line"` // 文件中的行号（表头为第1行）
+	Username   string `json:"username"`
+	Password   string `json:"-"`
+	Email      string `json:"email"`
+	Nickname   string `json:"nickname,omitempty"`
+	Role       string `json:"role,omitempty"`       // 角色名称，为空时使用普通用户角色
+	Department string `json:"department,omitempty"` // 部门名称，可为空
+	// Attributes 其他列的值，键为表头，表头为自定义字段的 key、attr.<key> 或字段名称时导入到该字段
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// ImportRowResult 单行的校验和导入结果
+type ImportRowResult struct {
+	ImportRow
+	UserID          uint     `json:"user_id,omitempty"`
+	ChangeRequestID int      `json:"change_request_id,omitempty"` // 角色需要审批时提交的变更请求
+	Errors          []string `json:"errors,omitempty"`
+
+	attributes model.Attributes // 校验后的自定义字段值
+}
+
+// ImportReport 导入报告
+type ImportReport struct {
+	DryRun    bool              `json:"dry_run"`
+	Total     int               `json:"total"`
+	Valid     int               `json:"valid"`
+	Invalid   int               `json:"invalid"`
+	Created   int               `json:"created"`
+	Submitted int               `json:"submitted"` // 以普通用户角色创建、角色等待审批的用户数
+	Rows      []ImportRowResult `json:"rows"`
+}
+
+// ParseUserImport 按文件扩展名解析CSV或XLSX格式的用户导入文件，第一行必须是表头
+func ParseUserImport(filename string, r io.Reader) ([]ImportRow, error) {
+	var records [][]string
+	var lines []int // CSV 中每条记录的行号，csv.Reader 会跳过空行
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		// 兼容Excel导出的带BOM的UTF-8文件
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("解析CSV文件失败: %w", err)
+			}
+			line, _ := reader.FieldPos(0)
+			records = append(records, record)
+			lines = append(lines, line)
+		}
+	case ".xlsx":
+		f, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("解析XLSX文件失败: %w", err)
+		}
+		defer f.Close()
+		sheets := f.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("XLSX文件没有工作表")
+		}
+		records, err = f.GetRows(sheets[0])
+		if err != nil {
+			return nil, fmt.Errorf("解析XLSX文件失败: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("不支持的文件类型，仅支持 .csv 和 .xlsx")
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("导入文件为空")
+	}
+
+	columns := make(map[string]int)
+	extra := make(map[string]int) // 其他列，可能是自定义字段
+	for i, name := range records[0] {
+		name = strings.TrimSpace(name)
+		key, ok := importColumns[strings.ToLower(name)]
+		if !ok {
+			if name == "" {
+				continue
+			}
+			if _, exists := extra[name]; exists {
+				return nil, fmt.Errorf("表头列 %s 重复", name)
+			}
+			extra[name] = i
+			continue
+		}
+		if _, exists := columns[key]; exists {
+			return nil, fmt.Errorf("表头列 %s 重复", key)
+		}
+		columns[key] = i
+	}
+	for _, required := range []string{"username", "password", "email"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("表头缺少必需的列: %s", required)
+		}
+	}
+
+	cell := func(record []string, key string) string {
+		i, ok := columns[key]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return strings.TrimSpace(record[i])
+	}
+
+	var rows []ImportRow
+	for i, record := range records[1:] {
+		if isBlankRecord(record) {
+			continue
+		}
+		line := i + 2
+		if lines != nil {
+			line = lines[i+1]
+		}
+		row := ImportRow{
+			Line:       line,
+			Username:   cell(record, "username"),
+			Password:   cell(record, "password"),
+			Email:      cell(record, "email"),
+			Nickname:   cell(record, "nickname"),
+			Role:       cell(record, "role"),
+			Department: cell(record, "department"),
+		}
+		for name, j := range extra {
+			if j < len(record) && strings.TrimSpace(record[j]) != "" {
+				if row.Attributes == nil {
+					row.Attributes = make(map[string]string)
+				}
+				row.Attributes[name] = strings.TrimSpace(record[j])
+			}
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("导入文件没有数据行")
+	}
+	if len(rows) > MaxImportRows {
+		return nil, fmt.Errorf("导入文件超过 %d 行", MaxImportRows)
+	}
+	return rows, nil
+}
+
+func isBlankRecord(record []string) bool {
+	for _, v := range record {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// validatePassword 密码策略：至少8位，同时包含字母和数字
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength {
+		return fmt.Errorf("密码长度不能少于 %d 位", minPasswordLength)
+	}
+	var hasLetter, hasDigit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLetter(r):
+			hasLetter = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		}
+	}
+	if !hasLetter || !hasDigit {
+		return fmt.Errorf("密码必须同时包含字母和数字")
+	}
+	return nil
+}
+
+func validateEmail(email string) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return fmt.Errorf("邮箱格式错误")
+	}
+	return nil
+}
+
+// ImportUsers 批量导入用户：先校验全部行并生成报告，预演模式到此为止；
+// 否则按批次在事务中创建校验通过的行，并为每个创建的用户发送注册事件。
+// 普通用户以外的角色需要 user:role 权限；分配角色需要审批时这些用户先以普通用户角色创建，
+// 再为每个用户提交修改角色的变更请求
+func (s *UserService) ImportUsers(ctx context.Context, operatorID int, rows []ImportRow, dryRun bool) (*ImportReport, error) {
+	approval := s.needsApproval(ctx, model.ChangeRoleAssign)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, departments, err := s.importLookups(ctx, rows)
+	if err != nil {
+		return nil, err
+	}
+	results, err := s.validateImportRows(ctx, scope, rows, roles, departments)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateImportAttributes(ctx, operatorID, results); err != nil {
+		return nil, err
+	}
+	_, hasDefaultRole := roles[""]
+	if err := s.validateImportRoles(ctx, operatorID, results, approval && !hasDefaultRole); err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: dryRun, Total: len(rows), Rows: results}
+	var pending []int // 校验通过的行在 results 中的下标
+	for i := range results {
+		if len(results[i].Errors) == 0 {
+			pending = append(pending, i)
+		}
+	}
+	report.Valid = len(pending)
+	report.Invalid = report.Total - report.Valid
+	if dryRun || len(pending) == 0 {
+		return report, nil
+	}
+
+	for start := 0; start < len(pending); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batch := pending[start:end]
+
+		users := make([]model.User, len(batch))
+		pendingRoles := make([]int, len(batch)) // 需要审批的角色，0表示直接分配
+		for j, i := range batch {
+			row := results[i].ImportRow
+			hash := md5.Sum([]byte(row.Password))
+			users[j] = model.User{
+				Username:   row.Username,
+				Password:   hex.EncodeToString(hash[:]),
+				Email:      row.Email,
+				Nickname:   row.Nickname,
+				Status:     1,
+				RoleID:     roles[row.Role].ID,
+				Attributes: results[i].attributes,
+			}
+			if approval && !isDefaultImportRole(row.Role) {
+				pendingRoles[j] = users[j].RoleID
+				users[j].RoleID = roles[""].ID
+			}
+			if department, ok := departments[row.Department]; ok {
+				users[j].DepartmentID = &department.ID
+			}
+		}
+
+		err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return tx.Omit("Role", "Department").Create(&users).Error
+		})
+		if err != nil {
+			// 整批回滚，继续提交后续批次
+			for _, i := range batch {
+				results[i].Errors = append(results[i].Errors, fmt.Sprintf("创建失败: %v", err))
+			}
+			continue
+		}
+
+		for j, i := range batch {
+			results[i].UserID = users[j].ID
+			report.Created++
+
+			// 记录用户注册事件到Kafka
+			if s.kafkaService != nil {
+				if err := s.kafkaService.LogUserRegister(users[j].ID, users[j].Username, users[j].Email); err != nil {
+					// 记录Kafka错误但不影响导入流程
+					fmt.Printf("Failed to log user register to Kafka: %v\n", err)
+				}
+			}
+
+			if pendingRoles[j] == 0 {
+				continue
+			}
+			err := s.submitForApproval(ctx, operatorID, model.ChangeRoleAssign, int(users[j].ID), map[string]int{"role_id": pendingRoles[j]})
+			var submitted *ApprovalRequiredError
+			if errors.As(err, &submitted) {
+				results[i].ChangeRequestID = submitted.Request.ID
+				report.Submitted++
+			} else if err != nil {
+				results[i].Errors = append(results[i].Errors, fmt.Sprintf("已以普通用户角色创建，提交角色变更请求失败: %v", err))
+			}
+		}
+	}
+
+	return report, nil
+}
+
+// isDefaultImportRole 导入文件中的角色是否为普通用户角色（为空时使用普通用户角色）
+func isDefaultImportRole(name string) bool {
+	return name == "" || name == defaultRoleName
+}
+
+// validateImportRoles 分配普通用户以外的角色需要 user:role 权限，没有权限时这些行校验失败。
+// noDefaultRole 为 true 时（需要审批但普通用户角色不存在）这些行无法先以普通用户角色创建，同样校验失败
+func (s *UserService) validateImportRoles(ctx context.Context, operatorID int, results []ImportRowResult, noDefaultRole bool) error {
+	privileged := false
+	for i := range results {
+		if !isDefaultImportRole(results[i].Role) {
+			privileged = true
+			if noDefaultRole {
+				results[i].Errors = append(results[i].Errors, "分配角色需要审批，但默认角色不存在")
+			}
+		}
+	}
+	if !privileged {
+		return nil
+	}
+	permissions, err := s.GetUserPermissions(ctx, uint(operatorID))
+	if err != nil {
+		return err
+	}
+	if permissions.HasPermission(PermissionUserRole) {
+		return nil
+	}
+	for i := range results {
+		if !isDefaultImportRole(results[i].Role) {
+			results[i].Errors = append(results[i].Errors, fmt.Sprintf("%s: 分配角色 %s 需要 %s 权限", ErrFieldForbidden.Error(), results[i].Role, PermissionUserRole))
+		}
+	}
+	return nil
+}
+
+// importLookups 按名称加载导入文件引用的角色和部门，空角色名对应普通用户角色
+func (s *UserService) importLookups(ctx context.Context, rows []ImportRow) (map[string]model.Role, map[string]model.Department, error) {
+	roleNames := map[string]bool{defaultRoleName: true}
+	departmentNames := make(map[string]bool)
+	for _, row := range rows {
+		if row.Role != "" {
+			roleNames[row.Role] = true
+		}
+		if row.Department != "" {
+			departmentNames[row.Department] = true
+		}
+	}
+
+	var roleList []model.Role
+	if err := s.db.WithContext(ctx).Where("name IN ?", mapKeys(roleNames)).Find(&roleList).Error; err != nil {
+		return nil, nil, err
+	}
+	roles := make(map[string]model.Role, len(roleList)+1)
+	for _, r := range roleList {
+		roles[r.Name] = r
+	}
+	if r, ok := roles[defaultRoleName]; ok {
+		roles[""] = r
+	}
+
+	departments := make(map[string]model.Department)
+	if len(departmentNames) > 0 {
+		var departmentList []model.Department
+		if err := s.db.WithContext(ctx).Where("name IN ?", mapKeys(departmentNames)).Find(&departmentList).Error; err != nil {
+			return nil, nil, err
+		}
+		for _, d := range departmentList {
+			if _, exists := departments[d.Name]; exists {
+				// 重名部门无法通过名称确定，标记为歧义
+				departments[d.Name] = model.Department{}
+				continue
+			}
+			departments[d.Name] = d
+		}
+	}
+	return roles, departments, nil
+}
+
+// validateImportRows 逐行校验：必填项、格式、密码策略、文件内及数据库中的重复、角色和部门是否存在
+func (s *UserService) validateImportRows(ctx context.Context, scope *dataScope, rows []ImportRow,
+	roles map[string]model.Role, departments map[string]model.Department) ([]ImportRowResult, error) {
+	usernames := make([]string, 0, len(rows))
+	emails := make([]string, 0, len(rows))
+	for _, row := range rows {
+		if row.Username != "" {
+			usernames = append(usernames, row.Username)
+		}
+		if row.Email != "" {
+			emails = append(emails, row.Email)
+		}
+	}
+
+	existingUsernames := make(map[string]bool)
+	existingEmails := make(map[string]bool)
+	var existing []model.User
+	err := s.db.WithContext(ctx).Select("username", "email").
+		Where("username IN ? OR email IN ?", usernames, emails).
+		Find(&existing).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range existing {
+		existingUsernames[u.Username] = true
+		existingEmails[u.Email] = true
+	}
+
+	seenUsernames := make(map[string]int)
+	seenEmails := make(map[string]int)
+	results := make([]ImportRowResult, len(rows))
+	for i, row := range rows {
+		result := ImportRowResult{ImportRow: row}
+		addError := func(format string, args ...interface{}) {
+			result.Errors = append(result.Errors, fmt.Sprintf(format, args...))
+		}
+
+		switch {
+		case row.Username == "":
+			addError("用户名不能为空")
+		case len(row.Username) > 50:
+			addError("用户名不能超过50个字符")
+		case existingUsernames[row.Username]:
+			addError("用户名已存在")
+		case seenUsernames[row.Username] > 0:
+			addError("用户名与第 %d 行重复", seenUsernames[row.Username])
+		default:
+			seenUsernames[row.Username] = row.Line
+		}
+
+		if err := validatePassword(row.Password); err != nil {
+			addError("%s", err.Error())
+		}
+
+		switch {
+		case row.Email == "":
+			addError("邮箱不能为空")
+		case validateEmail(row.Email) != nil:
+			addError("邮箱格式错误")
+		case existingEmails[row.Email]:
+			addError("邮箱已存在")
+		case seenEmails[row.Email] > 0:
+			addError("邮箱与第 %d 行重复", seenEmails[row.Email])
+		default:
+			seenEmails[row.Email] = row.Line
+		}
+
+		if len(row.Nickname) > 50 {
+			addError("昵称不能超过50个字符")
+		}
+
+		if _, ok := roles[row.Role]; !ok {
+			if row.Role == "" {
+				addError("默认角色不存在")
+			} else {
+				addError("角色不存在: %s", row.Role)
+			}
+		}
+
+		var departmentID *int
+		if row.Department != "" {
+			department, ok := departments[row.Department]
+			switch {
+			case !ok:
+				addError("部门不存在: %s", row.Department)
+			case department.ID == 0:
+				addError("存在多个名为 %s 的部门", row.Department)
+			default:
+				departmentID = &department.ID
+			}
+		}
+		if (row.Department == "" || departmentID != nil) && !scope.allowsDepartment(departmentID) {
+			addError("%s: 不能把用户分配到该部门", ErrOutOfDataScope.Error())
+		}
+
+		results[i] = result
+	}
+	return results, nil
+}
+
+// validateImportAttributes 把其他列的值按自定义字段转换并校验，检查必填字段；
+// 表头与自定义字段都不匹配的列被忽略。没有 user:sensitive 权限时不能导入敏感字段
+func (s *UserService) validateImportAttributes(ctx context.Context, operatorID int, results []ImportRowResult) error {
+	fields, err := s.GetUserFields(ctx)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return nil
+	}
+	permissions, err := s.GetUserPermissions(ctx, uint(operatorID))
+	if err != nil {
+		return err
+	}
+	unmasked := permissions.HasPermission(PermissionUserSensitive)
+
+	byHeader := make(map[string]*model.UserField, len(fields)*3)
+	for i := range fields {
+		field := &fields[i]
+		byHeader[field.Name] = field
+		byHeader[field.Key] = field
+		byHeader[attributeFilterPrefix+field.Key] = field
+	}
+
+	for i := range results {
+		result := &results[i]
+		attributes := make(model.Attributes)
+		provided := make(map[string]bool)
+		for header, text := range result.Attributes {
+			field, ok := byHeader[header]
+			if !ok {
+				continue
+			}
+			provided[field.Key] = true
+			if field.Visibility == model.UserFieldSensitive && !unmasked {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s: %s", ErrFieldForbidden.Error(), field.Name))
+				continue
+			}
+			value, err := parseUserFieldText(field, text)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s%s", field.Name, err.Error()))
+				continue
+			}
+			attributes[field.Key] = value
+		}
+		for _, field := range fields {
+			if field.Required && !provided[field.Key] {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s不能为空", field.Name))
+			}
+		}
+		result.attributes = attributes
+	}
+	return nil
+}
+
+func mapKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestValidatePassword(t *testing.T) {
+	tests := []struct {
+		password string
+		wantErr  bool
+	}{
+		{"abcd1234", false},
+		{"密码密码密码1a", false},
+		{"abc123", true},
+		{"abcdefgh", true},
+		{"12345678", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			if err := validatePassword(tt.password); (err != nil) != tt.wantErr {
+				t.Errorf("validatePassword(%q) = %v, wantErr %v", tt.password, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		email   string
+		wantErr bool
+	}{
+		{"alice@example.com", false},
+		{"a.b+c@example.co", false},
+		{"", true},
+		{"alice", true},
+		{"Alice <alice@example.com>", true},
+		{" alice@example.com", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.email, func(t *testing.T) {
+			if err := validateEmail(tt.email); (err != nil) != tt.wantErr {
+				t.Errorf("validateEmail(%q) = %v, wantErr %v", tt.email, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseUserImport(t *testing.T) {
+	tests := []struct {
+		name     string
+		filename string
+		content  string
+		want     []ImportRow
+		wantErr  string
+	}{
+		{
+			name:     "english headers",
+			filename: "users.csv",
+			content:  "username,password,email,role\nalice,abcd1234,alice@example.com,admin\n",
+			want: []ImportRow{
+				{Line: 2, Username: "alice", Password: "abcd1234", Email: "alice@example.com", Role: "admin"},
+			},
+		},
+		{
+			name:     "chinese headers with BOM and blank rows",
+			filename: "USERS.CSV",
+			content:  "\xef\xbb\xbf用户名,密码,邮箱,部门\n\n bob , abcd1234 ,bob@example.com,研发部\n,,,\n",
+			want: []ImportRow{
+				{Line: 3, Username: "bob", Password: "abcd1234", Email: "bob@example.com", Department: "研发部"},
+			},
+		},
+		{
+			name:     "extra columns become attributes",
+			filename: "users.csv",
+			content:  "Username,Password,Email,工号,level\nc,abcd1234,c@example.com,E01,\n",
+			want: []ImportRow{
+				{Line: 2, Username: "c", Password: "abcd1234", Email: "c@example.com", Attributes: map[string]string{"工号": "E01"}},
+			},
+		},
+		{
+			name:     "short rows",
+			filename: "users.csv",
+			content:  "username,password,email,nickname\nd,abcd1234\n",
+			want: []ImportRow{
+				{Line: 2, Username: "d", Password: "abcd1234"},
+			},
+		},
+		{name: "unsupported type", filename: "users.txt", content: "username", wantErr: "不支持的文件类型"},
+		{name: "empty file", filename: "users.csv", content: "", wantErr: "导入文件为空"},
+		{name: "missing column", filename: "users.csv", content: "username,password\na,b\n", wantErr: "缺少必需的列: email"},
+		{name: "duplicate column", filename: "users.csv", content: "username,用户名,password,email\n", wantErr: "表头列 username 重复"},
+		{name: "duplicate extra column", filename: "users.csv", content: "username,password,email,x,x\n", wantErr: "表头列 x 重复"},
+		{name: "no data rows", filename: "users.csv", content: "username,password,email\n,,\n", wantErr: "没有数据行"},
+		{name: "malformed csv", filename: "users.csv", content: "username,password,email\n\"a,b,c\n", wantErr: "解析CSV文件失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := ParseUserImport(tt.filename, strings.NewReader(tt.content))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows = %+v\nwant   %+v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUserImportXLSX(t *testing.T) {
+	f := excelize.NewFile()
+	defer f.Close()
+	sheet := f.GetSheetName(0)
+	for i, values := range [][]interface{}{
+		{"用户名", "密码", "邮箱", "昵称"},
+		{"alice", "abcd1234", "alice@example.com", "爱丽丝"},
+	} {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow(sheet, cell, &values); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var buf bytes.Buffer
+	if err := f.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := ParseUserImport("users.xlsx", &buf)
+	if err != nil {
+		t.Fatalf("error = %v", err)
+	}
+	want := []ImportRow{{Line: 2, Username: "alice", Password: "abcd1234", Email: "alice@example.com", Nickname: "爱丽丝"}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %+v, want %+v", rows, want)
+	}
+}
+
+func TestIsDefaultImportRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{"", true},
+		{defaultRoleName, true},
+		{"admin", false},
+	}
+	for _, tt := range tests {
+		if got := isDefaultImportRole(tt.role); got != tt.want {
+			t.Errorf("isDefaultImportRole(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
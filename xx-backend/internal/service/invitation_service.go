@@ -0,0 +1,607 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// ErrInvalidInvitation 邀请链接无效、已过期、已被撤销或已被接受，处理器应返回400
+var ErrInvalidInvitation = errors.New("邀请链接无效")
+
+// NotificationInvitation 邀请通知的类别
+const NotificationInvitation = "invitation"
+
+// invitationTokenPurpose 邀请token的用途，避免与登录token混用
+const invitationTokenPurpose = "invitation"
+
+// defaultInviteTTL 未配置时邀请链接的有效期
+const defaultInviteTTL = 72 * time.Hour
+
+// InvitationRequest 邀请新用户的请求，密码和个人资料由受邀人接受邀请时设置
+type InvitationRequest struct {
+	Username     string     `json:"username"`
+	Email        string     `json:"email"`
+	Nickname     string     `json:"nickname"`
+	RoleID       int        `json:"role_id"`
+	DepartmentID *int       `json:"department_id"`
+	GroupIDs     []int      `json:"group_ids"`     // 激活前就加入的用户组
+	DeactivateAt *time.Time `json:"deactivate_at"` // 计划停用时间（如外包人员合同到期）
+}
+
+// InvitationInfo 受邀人打开邀请链接时看到的信息，以及需要填写的自定义字段
+type InvitationInfo struct {
+	Email     string            `json:"email"`
+	Username  string            `json:"username"`
+	Nickname  string            `json:"nickname"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	Fields    []model.UserField `json:"fields"`
+}
+
+// AcceptInvitationRequest 接受邀请的请求
+type AcceptInvitationRequest struct {
+	Token      string                 `json:"token"`
+	Password   string                 `json:"password"`
+	Nickname   string                 `json:"nickname"`
+	Avatar     string                 `json:"avatar"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// SetInviteOptions 设置邀请链接的页面地址、签名密钥和有效期
+func (s *UserService) SetInviteOptions(pageURL, secret string, ttl time.Duration) {
+	s.inviteURL = pageURL
+	s.inviteSecret = []byte(secret)
+	s.inviteTTL = ttl
+}
+
+// GetInvitations 获取邀请列表，超过有效期的邀请先标记为已过期
+func (s *UserService) GetInvitations(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Invitation], error) {
+	if err := s.expireInvitations(ctx); err != nil {
+		return nil, err
+	}
+	return listquery.Find[model.Invitation](s.db.WithContext(ctx), q)
+}
+
+// GetInvitation 获取邀请详情
+func (s *UserService) GetInvitation(ctx context.Context, id int) (*model.Invitation, error) {
+	if err := s.expireInvitations(ctx); err != nil {
+		return nil, err
+	}
+	var invitation model.Invitation
+	if err := s.db.WithContext(ctx).First(&invitation, id).Error; err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// CreateInvitation 创建待激活的用户并发送邀请链接。分配普通用户以外的角色和用户组需要 user:role 权限，
+// 部门需要在操作人的数据范围内。发送失败不影响创建，原因记录在 send_error 中，可以重新发送。
+// 分配角色需要审批时先以普通用户角色邀请，再提交修改角色的变更请求，同时返回邀请和 ApprovalRequiredError
+func (s *UserService) CreateInvitation(ctx context.Context, operatorID int, req *InvitationRequest) (*model.Invitation, error) {
+	approval := s.needsApproval(ctx, model.ChangeRoleAssign)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Email = strings.TrimSpace(req.Email)
+	errs := FieldErrors{}
+	switch {
+	case req.Username == "":
+		errs["username"] = "不能为空"
+	case utf8.RuneCountInString(req.Username) > 50:
+		errs["username"] = "长度不能超过 50"
+	}
+	switch {
+	case req.Email == "":
+		errs["email"] = "不能为空"
+	case utf8.RuneCountInString(req.Email) > 100:
+		errs["email"] = "长度不能超过 100"
+	default:
+		if err := validateEmail(req.Email); err != nil {
+			errs["email"] = err.Error()
+		}
+	}
+	if utf8.RuneCountInString(req.Nickname) > 50 {
+		errs["nickname"] = "长度不能超过 50"
+	}
+	if req.RoleID <= 0 {
+		errs["role_id"] = "不能为空"
+	} else if err := s.db.WithContext(ctx).First(&model.Role{}, req.RoleID).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		errs["role_id"] = "角色不存在"
+	}
+	if req.DepartmentID != nil {
+		if err := s.db.WithContext(ctx).First(&model.Department{}, *req.DepartmentID).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+			errs["department_id"] = "部门不存在"
+		}
+	}
+	var groups []model.Group
+	if len(req.GroupIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&groups, req.GroupIDs).Error; err != nil {
+			return nil, err
+		}
+		if len(groups) != len(uniqueInts(req.GroupIDs)) {
+			errs["group_ids"] = "部分用户组不存在"
+		} else if approval {
+			// 加入用户组需要审批，无法随邀请一起提交，用户创建后再通过用户组接口添加
+			errs["group_ids"] = "加入用户组需要审批，请在邀请后通过用户组成员接口添加"
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	gated := make(map[string]string)
+	if len(groups) > 0 {
+		gated["group_ids"] = PermissionUserRole
+	}
+	if req.DeactivateAt != nil {
+		gated["deactivate_at"] = PermissionUserStatus
+	}
+	if err := s.forbiddenFields(ctx, operatorID, gated); err != nil {
+		return nil, err
+	}
+	roleID := req.RoleID
+	pendingRoleID, err := s.initialRole(ctx, operatorID, &roleID, approval)
+	if err != nil {
+		return nil, err
+	}
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if !scope.allowsDepartment(req.DepartmentID) {
+		return nil, fmt.Errorf("%w: 不能把用户分配到该部门", ErrOutOfDataScope)
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("username = ?", req.Username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 用户名已存在", ErrConflict)
+	}
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("email = ?", req.Email).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, fmt.Errorf("%w: 邮箱已被使用", ErrConflict)
+	}
+
+	nonce, err := newInvitationNonce()
+	if err != nil {
+		return nil, err
+	}
+	user := model.User{
+		Username:     req.Username,
+		Email:        req.Email,
+		Nickname:     req.Nickname,
+		Status:       model.UserStatusPending,
+		RoleID:       roleID,
+		DepartmentID: req.DepartmentID,
+		DeactivateAt: req.DeactivateAt,
+	}
+	invitation := model.Invitation{
+		Email:      req.Email,
+		Status:     model.InvitationPending,
+		TokenNonce: nonce,
+		ExpiresAt:  time.Now().Add(s.invitationTTL()),
+		InvitedBy:  uint(operatorID),
+	}
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		invitation.UserID = user.ID
+		if err := tx.Create(&invitation).Error; err != nil {
+			return err
+		}
+		for i := range groups {
+			if err := tx.Model(&groups[i]).Omit("Members.*").Association("Members").Append(&user); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logInvitation(&invitation, "invite", uint(operatorID))
+	// 发送失败已记录在邀请中，管理员可以重新发送
+	_ = s.sendInvitation(ctx, &invitation, &user, uint(operatorID))
+
+	if pendingRoleID != 0 {
+		return &invitation, s.submitForApproval(ctx, operatorID, model.ChangeRoleAssign, int(user.ID), map[string]int{"role_id": pendingRoleID})
+	}
+	return &invitation, nil
+}
+
+// ResendInvitation 重新发送待接受或已过期的邀请：更换token并重新计算有效期，之前发送的链接失效
+func (s *UserService) ResendInvitation(ctx context.Context, operatorID, id int) (*model.Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.expireInvitations(ctx); err != nil {
+		return nil, err
+	}
+	var invitation model.Invitation
+	if err := s.db.WithContext(ctx).First(&invitation, id).Error; err != nil {
+		return nil, err
+	}
+	if invitation.Status != model.InvitationPending && invitation.Status != model.InvitationExpired {
+		return nil, fmt.Errorf("%w: 邀请已被接受或撤销", ErrConflict)
+	}
+	var user model.User
+	if err := s.db.WithContext(ctx).First(&user, invitation.UserID).Error; err != nil {
+		return nil, err
+	}
+
+	nonce, err := newInvitationNonce()
+	if err != nil {
+		return nil, err
+	}
+	invitation.Status = model.InvitationPending
+	invitation.TokenNonce = nonce
+	invitation.ExpiresAt = time.Now().Add(s.invitationTTL())
+	invitation.Email = user.Email
+	err = s.db.WithContext(ctx).Model(&model.Invitation{}).Where("id = ?", invitation.ID).Updates(map[string]interface{}{
+		"status":      invitation.Status,
+		"token_nonce": invitation.TokenNonce,
+		"expires_at":  invitation.ExpiresAt,
+		"email":       invitation.Email,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	s.logInvitation(&invitation, "resend", uint(operatorID))
+	if err := s.sendInvitation(ctx, &invitation, &user, uint(operatorID)); err != nil {
+		return nil, err
+	}
+	return &invitation, nil
+}
+
+// RevokeInvitation 撤销待接受或已过期的邀请，同时删除待激活的用户，释放用户名和邮箱
+func (s *UserService) RevokeInvitation(ctx context.Context, operatorID, id int) (*model.Invitation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var invitation model.Invitation
+	if err := s.db.WithContext(ctx).First(&invitation, id).Error; err != nil {
+		return nil, err
+	}
+	if invitation.Status != model.InvitationPending && invitation.Status != model.InvitationExpired {
+		return nil, fmt.Errorf("%w: 邀请已被接受或撤销", ErrConflict)
+	}
+
+	now := time.Now()
+	revokedBy := uint(operatorID)
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&invitation).
+			Where("status IN ?", []string{model.InvitationPending, model.InvitationExpired}).
+			Updates(map[string]interface{}{
+				"status":     model.InvitationRevoked,
+				"revoked_at": now,
+				"revoked_by": revokedBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: 邀请已被接受或撤销", ErrConflict)
+		}
+		return deletePendingUser(tx, invitation.UserID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.roleCache.invalidateUser(invitation.UserID)
+
+	s.logInvitation(&invitation, "revoke", revokedBy)
+	return &invitation, nil
+}
+
+// deletePendingUser 永久删除尚未激活的用户及其用户组成员关系和限时授权
+func deletePendingUser(tx *gorm.DB, userID uint) error {
+	var user model.User
+	if err := tx.Where("status = ?", model.UserStatusPending).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := tx.Where("user_id = ?", userID).Delete(&model.RoleGrant{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Exec("DELETE FROM group_members WHERE user_id = ?", userID).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Delete(&user).Error
+}
+
+// GetInvitationInfo 根据邀请链接中的token获取邀请信息，供受邀人填写资料
+func (s *UserService) GetInvitationInfo(ctx context.Context, token string) (*InvitationInfo, error) {
+	ctx, invitation, user, err := s.resolveInvitation(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := s.GetUserFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &InvitationInfo{
+		Email:     user.Email,
+		Username:  user.Username,
+		Nickname:  user.Nickname,
+		ExpiresAt: invitation.ExpiresAt,
+		Fields:    fields,
+	}, nil
+}
+
+// AcceptInvitation 受邀人设置密码和个人资料并激活账号，变更历史的操作人为受邀人本人
+func (s *UserService) AcceptInvitation(ctx context.Context, req *AcceptInvitationRequest) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ctx, invitation, user, err := s.resolveInvitation(ctx, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	ctx = history.WithActor(ctx, user.ID)
+
+	errs := FieldErrors{}
+	if err := validatePassword(req.Password); err != nil {
+		errs["password"] = err.Error()
+	}
+	nickname := strings.TrimSpace(req.Nickname)
+	if nickname == "" {
+		nickname = user.Nickname
+	}
+	if utf8.RuneCountInString(nickname) > 50 {
+		errs["nickname"] = "长度不能超过 50"
+	}
+	if utf8.RuneCountInString(req.Avatar) > 255 {
+		errs["avatar"] = "长度不能超过 255"
+	}
+	fields, err := s.GetUserFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// 受邀人填写自己的资料，敏感字段同样可以填写
+	attributes, attributeErrs, _ := mergeAttributes(fields, user.Attributes, req.Attributes)
+	for name, message := range attributeErrs {
+		errs[name] = message
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	hash := md5.Sum([]byte(req.Password))
+	now := time.Now()
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Invitation{}).
+			Where("id = ? AND status = ? AND token_nonce = ?", invitation.ID, model.InvitationPending, invitation.TokenNonce).
+			Updates(map[string]interface{}{
+				"status":      model.InvitationAccepted,
+				"accepted_at": now,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("%w: 邀请已被处理", ErrInvalidInvitation)
+		}
+		return tx.Model(&model.User{}).Where("id = ? AND status = ?", user.ID, model.UserStatusPending).Updates(map[string]interface{}{
+			"password":   hex.EncodeToString(hash[:]),
+			"nickname":   nickname,
+			"avatar":     req.Avatar,
+			"attributes": attributes,
+			"status":     model.UserStatusActive,
+			"enabled_at": now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	s.roleCache.invalidateUser(user.ID)
+
+	s.logInvitation(invitation, "accept", user.ID)
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogUserRegister(user.ID, user.Username, user.Email); err != nil {
+			// 记录Kafka错误但不影响激活流程
+			fmt.Printf("Failed to log user register to Kafka: %v\n", err)
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Preload("Role").First(user, user.ID).Error; err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// resolveInvitation 校验邀请token，返回切换到邀请所属租户的上下文、邀请和待激活的用户
+func (s *UserService) resolveInvitation(ctx context.Context, token string) (context.Context, *model.Invitation, *model.User, error) {
+	invitationID, tenantID, nonce, err := s.parseInvitationToken(token)
+	if err != nil {
+		return ctx, nil, nil, err
+	}
+
+	var t model.Tenant
+	if err := s.db.WithContext(ctx).First(&t, tenantID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx, nil, nil, ErrInvalidInvitation
+		}
+		return ctx, nil, nil, err
+	}
+	if t.Status != 1 {
+		return ctx, nil, nil, fmt.Errorf("%w: 租户已被禁用", ErrInvalidInvitation)
+	}
+	ctx = tenant.WithTenant(ctx, tenantID)
+
+	var invitation model.Invitation
+	if err := s.db.WithContext(ctx).First(&invitation, invitationID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx, nil, nil, ErrInvalidInvitation
+		}
+		return ctx, nil, nil, err
+	}
+	switch {
+	case invitation.TokenNonce != nonce:
+		return ctx, nil, nil, fmt.Errorf("%w: 邀请已重新发送，请使用最新的链接", ErrInvalidInvitation)
+	case invitation.Status == model.InvitationAccepted:
+		return ctx, nil, nil, fmt.Errorf("%w: 邀请已被接受", ErrInvalidInvitation)
+	case invitation.Status == model.InvitationRevoked:
+		return ctx, nil, nil, fmt.Errorf("%w: 邀请已被撤销", ErrInvalidInvitation)
+	case invitation.Status == model.InvitationExpired || !time.Now().Before(invitation.ExpiresAt):
+		return ctx, nil, nil, fmt.Errorf("%w: 邀请已过期", ErrInvalidInvitation)
+	}
+
+	var user model.User
+	if err := s.db.WithContext(ctx).Where("status = ?", model.UserStatusPending).First(&user, invitation.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ctx, nil, nil, fmt.Errorf("%w: 用户已被删除或已激活", ErrInvalidInvitation)
+		}
+		return ctx, nil, nil, err
+	}
+	return ctx, &invitation, &user, nil
+}
+
+// expireInvitations 把超过有效期仍未接受的邀请标记为已过期
+func (s *UserService) expireInvitations(ctx context.Context) error {
+	return s.db.WithContext(ctx).Model(&model.Invitation{}).
+		Where("status = ? AND expires_at <= ?", model.InvitationPending, time.Now()).
+		Update("status", model.InvitationExpired).Error
+}
+
+// sendInvitation 生成邀请链接并通过通知发送，记录发送次数和结果
+func (s *UserService) sendInvitation(ctx context.Context, invitation *model.Invitation, user *model.User, operatorID uint) error {
+	link, err := s.invitationLink(ctx, invitation)
+	if err == nil {
+		content := fmt.Sprintf("%s，您好：您已被邀请加入系统，请在 %s 前打开以下链接设置密码并完善资料：%s",
+			user.Username, invitation.ExpiresAt.Format("2006-01-02 15:04"), link)
+		err = s.notify(NotificationInvitation, "邀请您加入", content, []model.User{*user}, operatorID)
+	}
+
+	updates := map[string]interface{}{"send_error": ""}
+	if err != nil {
+		message := err.Error()
+		if utf8.RuneCountInString(message) > 255 {
+			message = string([]rune(message)[:255])
+		}
+		updates["send_error"] = message
+	} else {
+		now := time.Now()
+		updates["sent_count"] = gorm.Expr("sent_count + 1")
+		updates["last_sent_at"] = now
+	}
+	if updateErr := s.db.WithContext(ctx).Model(&model.Invitation{}).Where("id = ?", invitation.ID).Updates(updates).Error; updateErr != nil {
+		return updateErr
+	}
+	if reloadErr := s.db.WithContext(ctx).First(invitation, invitation.ID).Error; reloadErr != nil {
+		return reloadErr
+	}
+	return err
+}
+
+// invitationLink 生成带签名token的邀请链接
+func (s *UserService) invitationLink(ctx context.Context, invitation *model.Invitation) (string, error) {
+	tenantID, _ := tenant.FromContext(ctx)
+	if invitation.TenantID != 0 {
+		tenantID = invitation.TenantID
+	}
+	claims := jwt.MapClaims{
+		"purpose":       invitationTokenPurpose,
+		"invitation_id": invitation.ID,
+		"tenant_id":     tenantID,
+		"nonce":         invitation.TokenNonce,
+		"exp":           invitation.ExpiresAt.Unix(),
+		"iat":           time.Now().Unix(),
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.inviteSecret)
+	if err != nil {
+		return "", err
+	}
+
+	link, err := url.Parse(s.inviteURL)
+	if err != nil {
+		return "", fmt.Errorf("邀请链接地址配置错误: %v", err)
+	}
+	query := link.Query()
+	query.Set("token", token)
+	link.RawQuery = query.Encode()
+	return link.String(), nil
+}
+
+// parseInvitationToken 校验邀请token的签名和有效期，返回邀请ID、租户ID和nonce
+func (s *UserService) parseInvitationToken(tokenString string) (int, uint, string, error) {
+	if tokenString == "" {
+		return 0, 0, "", ErrInvalidInvitation
+	}
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return s.inviteSecret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return 0, 0, "", fmt.Errorf("%w: 邀请已过期", ErrInvalidInvitation)
+		}
+		return 0, 0, "", ErrInvalidInvitation
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != invitationTokenPurpose {
+		return 0, 0, "", ErrInvalidInvitation
+	}
+	invitationID, ok1 := claims["invitation_id"].(float64)
+	tenantID, ok2 := claims["tenant_id"].(float64)
+	nonce, ok3 := claims["nonce"].(string)
+	if !ok1 || !ok2 || !ok3 {
+		return 0, 0, "", ErrInvalidInvitation
+	}
+	return int(invitationID), uint(tenantID), nonce, nil
+}
+
+func (s *UserService) invitationTTL() time.Duration {
+	if s.inviteTTL > 0 {
+		return s.inviteTTL
+	}
+	return defaultInviteTTL
+}
+
+func newInvitationNonce() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (s *UserService) logInvitation(invitation *model.Invitation, action string, operatorID uint) {
+	// 记录邀请事件到Kafka
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogInvitation(invitation.ID, invitation.UserID, invitation.Email, action, operatorID); err != nil {
+			fmt.Printf("Failed to log invitation to Kafka: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/tenant"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newInviteService(secret string) *UserService {
+	s := NewUserService(nil, nil, nil)
+	s.SetInviteOptions("https://example.com/invite?lang=zh", secret, 0)
+	return s
+}
+
+func signInviteClaims(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestInvitationLink(t *testing.T) {
+	s := newInviteService("secret")
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		invitation model.Invitation
+		wantTenant uint
+	}{
+		{
+			name:       "tenant from invitation",
+			ctx:        tenant.WithTenant(context.Background(), 3),
+			invitation: model.Invitation{ID: 5, TenantID: 2, TokenNonce: "n1", ExpiresAt: time.Now().Add(time.Hour)},
+			wantTenant: 2,
+		},
+		{
+			name:       "tenant from context",
+			ctx:        tenant.WithTenant(context.Background(), 3),
+			invitation: model.Invitation{ID: 6, TokenNonce: "n2", ExpiresAt: time.Now().Add(time.Hour)},
+			wantTenant: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, err := s.invitationLink(tt.ctx, &tt.invitation)
+			if err != nil {
+				t.Fatalf("invitationLink() error = %v", err)
+			}
+			parsed, err := url.Parse(link)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(link, "https://example.com/invite?") || parsed.Query().Get("lang") != "zh" {
+				t.Errorf("link = %s, want page URL with original query", link)
+			}
+			id, tenantID, nonce, err := s.parseInvitationToken(parsed.Query().Get("token"))
+			if err != nil {
+				t.Fatalf("parseInvitationToken() error = %v", err)
+			}
+			if id != tt.invitation.ID || tenantID != tt.wantTenant || nonce != tt.invitation.TokenNonce {
+				t.Errorf("parsed = %d, %d, %q, want %d, %d, %q", id, tenantID, nonce, tt.invitation.ID, tt.wantTenant, tt.invitation.TokenNonce)
+			}
+		})
+	}
+}
+
+func TestParseInvitationToken(t *testing.T) {
+	s := newInviteService("secret")
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"purpose":       invitationTokenPurpose,
+			"invitation_id": 5,
+			"tenant_id":     1,
+			"nonce":         "n1",
+			"exp":           time.Now().Add(time.Hour).Unix(),
+		}
+	}
+	with := func(key string, value interface{}) jwt.MapClaims {
+		claims := valid()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name        string
+		token       string
+		wantErr     bool
+		wantExpired bool
+	}{
+		{name: "valid", token: signInviteClaims(t, "secret", valid())},
+		{name: "empty", token: "", wantErr: true},
+		{name: "garbage", token: "not-a-token", wantErr: true},
+		{name: "wrong secret", token: signInviteClaims(t, "other", valid()), wantErr: true},
+		{name: "expired", token: signInviteClaims(t, "secret", with("exp", time.Now().Add(-time.Minute).Unix())), wantErr: true, wantExpired: true},
+		{name: "login token", token: signInviteClaims(t, "secret", with("purpose", nil)), wantErr: true},
+		{name: "wrong purpose", token: signInviteClaims(t, "secret", with("purpose", "reset")), wantErr: true},
+		{name: "missing nonce", token: signInviteClaims(t, "secret", with("nonce", nil)), wantErr: true},
+		{name: "invalid id", token: signInviteClaims(t, "secret", with("invitation_id", "5")), wantErr: true},
+		{
+			name: "other algorithm",
+			token: func() string {
+				tok, _ := jwt.NewWithClaims(jwt.SigningMethodHS512, valid()).SignedString([]byte("secret"))
+				return tok
+			}(),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, tenantID, nonce, err := s.parseInvitationToken(tt.token)
+			if !tt.wantErr {
+				if err != nil || id != 5 || tenantID != 1 || nonce != "n1" {
+					t.Errorf("parseInvitationToken() = %d, %d, %q, %v", id, tenantID, nonce, err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidInvitation) {
+				t.Fatalf("error = %v, want ErrInvalidInvitation", err)
+			}
+			if expired := strings.Contains(err.Error(), "邀请已过期"); expired != tt.wantExpired {
+				t.Errorf("error = %v, wantExpired %v", err, tt.wantExpired)
+			}
+		})
+	}
+}
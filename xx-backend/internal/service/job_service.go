@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
+)
+
+// jobRunner 任务的执行逻辑，通过 progress 汇报进度；生成文件时写入 job.FileName 和 job.FilePath，
+// 执行结果写入 job.Result。任务被取消时 ctx 会被取消
+type jobRunner func(ctx context.Context, job *model.Job, progress func(processed, total int)) error
+
+const (
+	// jobProgressInterval 进度写入数据库的最小间隔
+	jobProgressInterval = 500 * time.Millisecond
+	// jobCancelPollInterval 执行中的任务检查取消请求的间隔，取消请求可能由其他实例处理
+	jobCancelPollInterval = time.Second
+)
+
+// startJob 创建后台任务并异步执行。任务沿用请求的租户，但不受请求结束的影响
+func (s *UserService) startJob(ctx context.Context, operatorID int, jobType string, params interface{}, run jobRunner) (*model.Job, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &model.Job{
+		Type:      jobType,
+		Status:    model.JobStatusPending,
+		Params:    string(data),
+		CreatedBy: uint(operatorID),
+	}
+	if err := s.db.WithContext(ctx).Create(job).Error; err != nil {
+		return nil, err
+	}
+
+	jobCtx := context.Background()
+	if tenantID, ok := tenant.FromContext(ctx); ok {
+		jobCtx = tenant.WithTenant(jobCtx, tenantID)
+	}
+	if actorID, ok := history.ActorFromContext(ctx); ok {
+		jobCtx = history.WithActor(jobCtx, actorID)
+	}
+	snapshot := *job
+	go s.runJob(jobCtx, &snapshot, run)
+
+	return job, nil
+}
+
+func (s *UserService) runJob(ctx context.Context, job *model.Job, run jobRunner) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.watchJobCancel(runCtx, job.ID, cancel)
+
+	startedAt := time.Now()
+	job.Status = model.JobStatusRunning
+	job.StartedAt = &startedAt
+	s.updateJob(ctx, job.ID, map[string]interface{}{"status": job.Status, "started_at": startedAt})
+
+	// 进度可能由多个协程汇报，按时间间隔节流写入
+	var mu sync.Mutex
+	var lastSaved time.Time
+	progress := func(processed, total int) {
+		mu.Lock()
+		defer mu.Unlock()
+		job.Processed, job.Total = processed, total
+		if time.Since(lastSaved) < jobProgressInterval && processed < total {
+			return
+		}
+		lastSaved = time.Now()
+		s.updateJob(ctx, job.ID, map[string]interface{}{"processed": processed, "total": total})
+	}
+
+	err := func() (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("任务异常终止: %v", r)
+			}
+		}()
+		return run(runCtx, job, progress)
+	}()
+
+	mu.Lock()
+	defer mu.Unlock()
+	finishedAt := time.Now()
+	updates := map[string]interface{}{
+		"status":      model.JobStatusSucceeded,
+		"processed":   job.Processed,
+		"total":       job.Total,
+		"result":      job.Result,
+		"file_name":   job.FileName,
+		"file_path":   job.FilePath,
+		"finished_at": finishedAt,
+	}
+	switch {
+	case err != nil && errors.Is(err, context.Canceled) && runCtx.Err() != nil:
+		updates["status"] = model.JobStatusCancelled
+	case err != nil:
+		updates["status"] = model.JobStatusFailed
+		updates["error"] = err.Error()
+		log.Printf("Job %d (%s) failed: %v", job.ID, job.Type, err)
+	}
+	s.updateJob(ctx, job.ID, updates)
+}
+
+// watchJobCancel 定期检查任务是否被请求取消
+func (s *UserService) watchJobCancel(ctx context.Context, id int, cancel context.CancelFunc) {
+	ticker := time.NewTicker(jobCancelPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			var job model.Job
+			if err := s.db.WithContext(ctx).Select("id", "cancelling").First(&job, id).Error; err != nil {
+				continue
+			}
+			if job.Cancelling {
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// CancelJob 请求取消自己创建的未结束任务，执行中的任务会在处理完当前项后停止
+func (s *UserService) CancelJob(ctx context.Context, operatorID, id int) (*model.Job, error) {
+	job, err := s.GetJob(ctx, operatorID, id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := s.db.WithContext(ctx).Model(&model.Job{}).
+		Where("id = ? AND status IN ?", id, []string{model.JobStatusPending, model.JobStatusRunning}).
+		Update("cancelling", true)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 && !job.Cancelling {
+		return nil, fmt.Errorf("%w: 任务已结束", ErrConflict)
+	}
+
+	job.Cancelling = true
+	return job, nil
+}
+
+func (s *UserService) updateJob(ctx context.Context, id int, updates map[string]interface{}) {
+	if err := s.db.WithContext(ctx).Model(&model.Job{}).Where("id = ?", id).Updates(updates).Error; err != nil {
+		log.Printf("Failed to update job %d: %v", id, err)
+	}
+}
+
+// GetJobs 获取操作人创建的后台任务列表
+func (s *UserService) GetJobs(ctx context.Context, operatorID int, q *listquery.Query) (*listquery.Result[model.Job], error) {
+	return listquery.Find[model.Job](s.db.WithContext(ctx).Where("created_by = ?", operatorID), q)
+}
+
+// GetJob 获取后台任务详情，只能查看自己创建的任务
+func (s *UserService) GetJob(ctx context.Context, operatorID, id int) (*model.Job, error) {
+	var job model.Job
+	if err := s.db.WithContext(ctx).Where("created_by = ?", operatorID).First(&job, id).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// GetJobFile 获取任务生成的文件，任务未完成或文件已被清理时返回冲突
+func (s *UserService) GetJobFile(ctx context.Context, operatorID, id int) (*model.Job, error) {
+	job, err := s.GetJob(ctx, operatorID, id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status != model.JobStatusSucceeded {
+		return nil, fmt.Errorf("%w: 任务尚未成功完成", ErrConflict)
+	}
+	if job.FilePath == "" {
+		return nil, fmt.Errorf("%w: 任务文件不存在或已过期", ErrConflict)
+	}
+	if _, err := os.Stat(job.FilePath); err != nil {
+		return nil, fmt.Errorf("%w: 任务文件不存在或已过期", ErrConflict)
+	}
+	return job, nil
+}
+
+// CleanupJobFiles 删除结束时间早于 retention 的任务文件，返回删除的数量
+func (s *UserService) CleanupJobFiles(ctx context.Context, retention time.Duration) (int, error) {
+	ctx = tenant.WithoutTenant(ctx)
+
+	var jobs []model.Job
+	err := s.db.WithContext(ctx).
+		Where("file_path <> '' AND finished_at < ?", time.Now().Add(-retention)).
+		Find(&jobs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, job := range jobs {
+		if err := os.Remove(job.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to remove job file %s: %v", job.FilePath, err)
+			continue
+		}
+		s.updateJob(ctx, job.ID, map[string]interface{}{"file_path": ""})
+		count++
+	}
+	return count, nil
+}
+
+// StartJobCleanupJob 启动后台任务，定期清理过期的任务文件
+func (s *UserService) StartJobCleanupJob(ctx context.Context, interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				count, err := s.CleanupJobFiles(ctx, retention)
+				if err != nil {
+					log.Printf("Failed to clean up job files: %v", err)
+					continue
+				}
+				if count > 0 {
+					log.Printf("Removed %d expired job files", count)
+				}
+			}
+		}
+	}()
+}
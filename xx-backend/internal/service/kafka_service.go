@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"log"
+	"time"
 
 	"xx-backend/pkg/kafka"
 )
@@ -64,6 +65,102 @@ func (ks *KafkaService) LogUserUpdate(userID uint, username string, fields map[s
 	return ks.client.SendUserEvent("user_update", data)
 }
 
+// LogUserErasure 发布用户个人数据已删除的墓碑事件，下游消费者收到后应删除各自保存的该用户个人数据。
+// 事件中只包含标识，不包含个人数据
+func (ks *KafkaService) LogUserErasure(userID, tenantID, operatorID uint, reason string) error {
+	data := map[string]interface{}{
+		"user_id":     userID,
+		"tenant_id":   tenantID,
+		"action":      "erase",
+		"operator_id": operatorID,
+		"reason":      reason,
+	}
+
+	return ks.client.SendUserEvent("user_erased", data)
+}
+
+// LogRoleGrant 记录限时角色授权事件
+func (ks *KafkaService) LogRoleGrant(grantID int, userID uint, roleID int, expiresAt time.Time, reason string) error {
+	data := map[string]interface{}{
+		"grant_id":   grantID,
+		"user_id":    userID,
+		"role_id":    roleID,
+		"expires_at": expiresAt,
+		"reason":     reason,
+		"action":     "grant",
+	}
+
+	return ks.client.SendUserEvent("role_grant", data)
+}
+
+// LogRoleRevoke 记录限时角色撤销事件（到期自动撤销或手动撤销）
+func (ks *KafkaService) LogRoleRevoke(grantID int, userID uint, roleID int, reason string) error {
+	data := map[string]interface{}{
+		"grant_id": grantID,
+		"user_id":  userID,
+		"role_id":  roleID,
+		"reason":   reason,
+		"action":   "revoke",
+	}
+
+	return ks.client.SendUserEvent("role_revoke", data)
+}
+
+// LogChangeRequest 记录变更请求的提交和审批事件
+func (ks *KafkaService) LogChangeRequest(requestID int, changeType string, targetID int, status string, operatorID uint) error {
+	data := map[string]interface{}{
+		"request_id":  requestID,
+		"type":        changeType,
+		"target_id":   targetID,
+		"status":      status,
+		"operator_id": operatorID,
+		"action":      "change_request",
+	}
+
+	return ks.client.SendUserEvent("change_request", data)
+}
+
+// LogRecycleBin 记录回收站的恢复和永久删除事件，自动清理时 operatorID 为0
+func (ks *KafkaService) LogRecycleBin(kind string, id int, action string, operatorID uint) error {
+	data := map[string]interface{}{
+		"type":        kind,
+		"target_id":   id,
+		"operation":   action,
+		"operator_id": operatorID,
+		"action":      "recycle_bin",
+	}
+
+	return ks.client.SendUserEvent("recycle_bin", data)
+}
+
+// LogInvitation 记录邀请事件（invite、resend、revoke、accept）
+func (ks *KafkaService) LogInvitation(invitationID int, userID uint, email string, action string, operatorID uint) error {
+	data := map[string]interface{}{
+		"invitation_id": invitationID,
+		"user_id":       userID,
+		"email":         email,
+		"operation":     action,
+		"operator_id":   operatorID,
+		"action":        "invitation",
+	}
+
+	return ks.client.SendUserEvent("invitation", data)
+}
+
+// SendNotification 发布通知事件，由下游消费者按收件人发送邮件、站内信等
+func (ks *KafkaService) SendNotification(category, title, content string, recipients []NotificationRecipient, operatorID uint) error {
+	data := map[string]interface{}{
+		"category":    category,
+		"title":       title,
+		"content":     content,
+		"recipients":  recipients,
+		"operator_id": operatorID,
+		"action":      "notification",
+	}
+
+	return ks.client.SendUserEvent("notification", data)
+}
+
 // LogSystemError 记录系统错误
 func (ks *KafkaService) LogSystemError(service string, error string, details map[string]interface{}) error {
 	data := map[string]interface{}{
@@ -104,6 +201,8 @@ func (ks *KafkaService) StartUserEventConsumer(ctx context.Context) {
 				return ks.handleUserRegister(message)
 			case "user_update":
 				return ks.handleUserUpdate(message)
+			case "user_erased":
+				return ks.handleUserErased(message)
 			default:
 				log.Printf("Unknown user event type: %s", message.Type)
 				return nil
@@ -172,6 +271,14 @@ func (ks *KafkaService) handleUserUpdate(message kafka.Message) error {
 	return nil
 }
 
+// 处理用户个人数据删除事件
+func (ks *KafkaService) handleUserErased(message kafka.Message) error {
+	// 这里可以添加具体的业务逻辑
+	// 例如：删除缓存、统计等数据中该用户的个人数据
+	log.Printf("Handling user erased event: %+v", message.Data)
+	return nil
+}
+
 // 处理系统错误
 func (ks *KafkaService) handleSystemError(message kafka.Message) error {
 	// 这里可以添加具体的业务逻辑
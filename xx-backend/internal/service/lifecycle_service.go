@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+)
+
+// NotificationLifecycle 账号即将被自动禁用的提醒通知类别
+const NotificationLifecycle = "lifecycle"
+
+// 生命周期策略的取值上限
+const (
+	maxInactiveDays = 3650
+	maxWarningDays  = 365
+)
+
+// LifecyclePolicyRequest 设置生命周期策略的请求
+type LifecyclePolicyRequest struct {
+	InactiveDays  int   `json:"inactive_days"`
+	WarningDays   int   `json:"warning_days"`
+	ExemptRoleIDs []int `json:"exempt_role_ids"`
+}
+
+// LifecycleResult 一次生命周期检查的结果
+type LifecycleResult struct {
+	Disabled int `json:"disabled"` // 自动禁用的用户数
+	Warned   int `json:"warned"`   // 发送提醒的用户数
+}
+
+// GetLifecyclePolicy 获取当前租户的生命周期策略，未设置时返回默认策略（不按未登录天数禁用）
+func (s *UserService) GetLifecyclePolicy(ctx context.Context) (*model.LifecyclePolicy, error) {
+	var policy model.LifecyclePolicy
+	if err := s.db.WithContext(ctx).Preload("ExemptRoles").First(&policy).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, err
+		}
+		return &model.LifecyclePolicy{WarningDays: model.DefaultLifecycleWarningDays, ExemptRoles: []model.Role{}}, nil
+	}
+	return &policy, nil
+}
+
+// SetLifecyclePolicy 设置当前租户的生命周期策略
+func (s *UserService) SetLifecyclePolicy(ctx context.Context, req *LifecyclePolicyRequest) (*model.LifecyclePolicy, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	errs := FieldErrors{}
+	if req.InactiveDays < 0 || req.InactiveDays > maxInactiveDays {
+		errs["inactive_days"] = fmt.Sprintf("取值范围为 0-%d", maxInactiveDays)
+	}
+	switch {
+	case req.WarningDays < 0 || req.WarningDays > maxWarningDays:
+		errs["warning_days"] = fmt.Sprintf("取值范围为 0-%d", maxWarningDays)
+	case req.InactiveDays > 0 && req.WarningDays >= req.InactiveDays:
+		errs["warning_days"] = "必须小于 inactive_days"
+	}
+	var roles []model.Role
+	if len(req.ExemptRoleIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&roles, req.ExemptRoleIDs).Error; err != nil {
+			return nil, err
+		}
+		if len(roles) != len(uniqueInts(req.ExemptRoleIDs)) {
+			errs["exempt_role_ids"] = "部分角色不存在"
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	var policy model.LifecyclePolicy
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.First(&policy).Error
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			policy = model.LifecyclePolicy{InactiveDays: req.InactiveDays, WarningDays: req.WarningDays}
+			if err := tx.Omit("ExemptRoles").Create(&policy).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		default:
+			err := tx.Model(&model.LifecyclePolicy{}).Where("id = ?", policy.ID).Updates(map[string]interface{}{
+				"inactive_days": req.InactiveDays,
+				"warning_days":  req.WarningDays,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Model(&policy).Omit("ExemptRoles.*").Association("ExemptRoles").Replace(&roles)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.GetLifecyclePolicy(ctx)
+}
+
+// RunLifecycle 对所有正常租户执行生命周期检查：禁用到达计划停用时间或长期未登录的用户，
+// 并提醒即将被禁用的用户。自动操作在上下文中不带操作人，变更历史的操作人记为系统（0）
+func (s *UserService) RunLifecycle(ctx context.Context) (*LifecycleResult, error) {
+	var tenantIDs []uint
+	if err := s.db.WithContext(tenant.WithoutTenant(ctx)).Model(&model.Tenant{}).Where("status = 1").Pluck("id", &tenantIDs).Error; err != nil {
+		return nil, err
+	}
+
+	// 某个租户出错时继续检查其他租户，返回第一个错误
+	result := &LifecycleResult{}
+	var firstErr error
+	for _, tenantID := range tenantIDs {
+		if err := s.runTenantLifecycle(tenant.WithTenant(ctx, tenantID), time.Now(), result); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("租户 %d: %w", tenantID, err)
+		}
+	}
+	return result, firstErr
+}
+
+func (s *UserService) runTenantLifecycle(ctx context.Context, now time.Time, result *LifecycleResult) error {
+	policy, err := s.GetLifecyclePolicy(ctx)
+	if err != nil {
+		return err
+	}
+	warningWindow := time.Duration(policy.WarningDays) * 24 * time.Hour
+
+	// 计划停用：到期的禁用，即将到期的提醒
+	var scheduled []model.User
+	err = s.db.WithContext(ctx).
+		Where("status = ? AND deactivate_at IS NOT NULL AND deactivate_at <= ?", model.UserStatusActive, now.Add(warningWindow)).
+		Find(&scheduled).Error
+	if err != nil {
+		return err
+	}
+	for i := range scheduled {
+		user := &scheduled[i]
+		if !user.DeactivateAt.After(now) {
+			// 清除计划停用时间，重新启用后不会再次被禁用
+			disabled, err := s.disableByLifecycle(ctx, user, model.LifecycleDeactivation, map[string]interface{}{"deactivate_at": nil})
+			if err != nil {
+				return err
+			}
+			if disabled {
+				result.Disabled++
+			}
+			continue
+		}
+		warned, err := s.warnLifecycle(ctx, user, model.LifecycleDeactivation, *user.DeactivateAt)
+		if err != nil {
+			return err
+		}
+		if warned {
+			result.Warned++
+		}
+	}
+
+	if policy.InactiveDays <= 0 {
+		return nil
+	}
+
+	// 长期未登录：从最近登录、重新启用和创建中最晚的时间算起
+	inactiveFor := time.Duration(policy.InactiveDays) * 24 * time.Hour
+	threshold := now.Add(-inactiveFor + warningWindow)
+	query := s.db.WithContext(ctx).
+		Where("status = ?", model.UserStatusActive).
+		Where("created_at <= ? AND (last_login_at IS NULL OR last_login_at <= ?) AND (enabled_at IS NULL OR enabled_at <= ?)", threshold, threshold, threshold)
+	if len(policy.ExemptRoles) > 0 {
+		exempt := make([]int, len(policy.ExemptRoles))
+		for i, role := range policy.ExemptRoles {
+			exempt[i] = role.ID
+		}
+		query = query.Where("role_id NOT IN ?", exempt)
+	}
+	var inactive []model.User
+	if err := query.Find(&inactive).Error; err != nil {
+		return err
+	}
+	for i := range inactive {
+		user := &inactive[i]
+		due := lastActiveAt(user).Add(inactiveFor)
+		if !due.After(now) {
+			disabled, err := s.disableByLifecycle(ctx, user, model.LifecycleInactivity, nil)
+			if err != nil {
+				return err
+			}
+			if disabled {
+				result.Disabled++
+			}
+			continue
+		}
+		warned, err := s.warnLifecycle(ctx, user, model.LifecycleInactivity, due)
+		if err != nil {
+			return err
+		}
+		if warned {
+			result.Warned++
+		}
+	}
+	return nil
+}
+
+// lastActiveAt 用户最近一次活跃的时间：最近登录、重新启用和创建中最晚的时间
+func lastActiveAt(user *model.User) time.Time {
+	last := user.CreatedAt
+	for _, t := range []*time.Time{user.LastLoginAt, user.EnabledAt} {
+		if t != nil && t.After(last) {
+			last = *t
+		}
+	}
+	return last
+}
+
+// disableByLifecycle 自动禁用用户并使其重新登录。只更新仍为正常状态的用户，多个实例同时执行时只有一个生效
+func (s *UserService) disableByLifecycle(ctx context.Context, user *model.User, kind string, extra map[string]interface{}) (bool, error) {
+	updates := map[string]interface{}{"status": model.UserStatusDisabled}
+	for column, value := range extra {
+		updates[column] = value
+	}
+	result := s.db.WithContext(ctx).Model(&model.User{}).
+		Where("id = ? AND status = ?", user.ID, model.UserStatusActive).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	s.revokeSession(ctx, user.ID)
+	updates["reason"] = kind
+	s.logUserUpdate(user, updates)
+	return true, nil
+}
+
+// warnLifecycle 提醒用户账号将被自动禁用。先记录提醒再发送，唯一索引保证多个实例同时执行时
+// 同一到期时间只提醒一次；发送失败时删除记录，下次检查时重试
+func (s *UserService) warnLifecycle(ctx context.Context, user *model.User, kind string, due time.Time) (bool, error) {
+	if s.kafkaService == nil {
+		return false, nil
+	}
+
+	due = due.Truncate(time.Second)
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.LifecycleNotice{}).
+		Where("user_id = ? AND kind = ? AND due_at = ?", user.ID, kind, due).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	notice := model.LifecycleNotice{UserID: user.ID, Kind: kind, DueAt: due}
+	if err := s.db.WithContext(ctx).Create(&notice).Error; err != nil {
+		return false, err
+	}
+
+	var content string
+	switch kind {
+	case model.LifecycleDeactivation:
+		content = fmt.Sprintf("%s，您好：您的账号计划于 %s 停用，届时将无法登录。如需延期请联系管理员。",
+			user.Username, due.Format("2006-01-02 15:04"))
+	default:
+		content = fmt.Sprintf("%s，您好：您的账号长期未登录，如果在 %s 前仍未登录，账号将被自动禁用。",
+			user.Username, due.Format("2006-01-02 15:04"))
+	}
+	if err := s.notify(NotificationLifecycle, "账号即将被禁用", content, []model.User{*user}, 0); err != nil {
+		log.Printf("Failed to send lifecycle warning to user %d: %v", user.ID, err)
+		if err := s.db.WithContext(ctx).Delete(&notice).Error; err != nil {
+			return false, err
+		}
+		return false, nil
+	}
+	return true, nil
+}
+
+// StartLifecycleJob 启动后台任务，定期执行账号生命周期检查
+func (s *UserService) StartLifecycleJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				result, err := s.RunLifecycle(ctx)
+				if err != nil {
+					log.Printf("Failed to run account lifecycle: %v", err)
+				}
+				if result != nil && (result.Disabled > 0 || result.Warned > 0) {
+					log.Printf("Account lifecycle disabled %d users and warned %d users", result.Disabled, result.Warned)
+				}
+			}
+		}
+	}()
+}
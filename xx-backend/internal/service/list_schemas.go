@@ -0,0 +1,252 @@
+package service
+
+import "xx-backend/pkg/listquery"
+
+// 各列表接口允许过滤、排序和返回的字段，新增列表接口时在这里声明
+
+var UserListSchema = &listquery.Schema{
+	Table: "users",
+	Fields: map[string]listquery.Field{
+		"id":            {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":     {Column: "tenant_id", Type: listquery.Int},
+		"username":      {Column: "username", Type: listquery.String, Filter: true, Sort: true},
+		"email":         {Column: "email", Type: listquery.String, Filter: true, Sort: true},
+		"nickname":      {Column: "nickname", Type: listquery.String, Filter: true, Sort: true},
+		"avatar":        {Column: "avatar", Type: listquery.String},
+		"status":        {Column: "status", Type: listquery.Int, Filter: true, Sort: true},
+		"role_id":       {Column: "role_id", Type: listquery.Int, Filter: true, Sort: true},
+		"department_id": {Column: "department_id", Type: listquery.Int, Filter: true, Nullable: true},
+		"last_login_at": {Column: "last_login_at", Type: listquery.Time, Filter: true, Nullable: true},
+		"enabled_at":    {Column: "enabled_at", Type: listquery.Time, Filter: true, Nullable: true},
+		"deactivate_at": {Column: "deactivate_at", Type: listquery.Time, Filter: true, Nullable: true},
+		"created_at":    {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":    {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+		"role":          {Column: "role_id", Preload: "Role"},
+		"department":    {Column: "department_id", Preload: "Department"},
+	},
+	Search: []string{"username", "nickname"},
+}
+
+var RoleListSchema = &listquery.Schema{
+	Table: "roles",
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":   {Column: "tenant_id", Type: listquery.Int},
+		"name":        {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"description": {Column: "description", Type: listquery.String, Filter: true},
+		"status":      {Column: "status", Type: listquery.Int, Filter: true, Sort: true},
+		"parent_id":   {Column: "parent_id", Type: listquery.Int, Filter: true, Nullable: true},
+		"data_scope":  {Column: "data_scope", Type: listquery.String, Filter: true},
+		"created_at":  {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":  {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search: []string{"name", "description"},
+}
+
+var MenuListSchema = &listquery.Schema{
+	Table: "menus",
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":  {Column: "tenant_id", Type: listquery.Int},
+		"name":       {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"path":       {Column: "path", Type: listquery.String, Filter: true, Sort: true},
+		"component":  {Column: "component", Type: listquery.String, Filter: true},
+		"icon":       {Column: "icon", Type: listquery.String},
+		"sort":       {Column: "sort", Type: listquery.Int, Filter: true, Sort: true},
+		"parent_id":  {Column: "parent_id", Type: listquery.Int, Filter: true, Nullable: true},
+		"status":     {Column: "status", Type: listquery.Int, Filter: true, Sort: true},
+		"created_at": {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at": {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"name", "path"},
+	DefaultSort: "sort",
+	MaxPageSize: 1000, // 菜单树通常需要一次取完
+}
+
+var DepartmentListSchema = &listquery.Schema{
+	Table: "departments",
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":  {Column: "tenant_id", Type: listquery.Int},
+		"name":       {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"parent_id":  {Column: "parent_id", Type: listquery.Int, Filter: true, Nullable: true},
+		"sort":       {Column: "sort", Type: listquery.Int, Filter: true, Sort: true},
+		"status":     {Column: "status", Type: listquery.Int, Filter: true, Sort: true},
+		"created_at": {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at": {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"name"},
+	DefaultSort: "sort",
+	MaxPageSize: 1000, // 部门树通常需要一次取完
+}
+
+var GroupListSchema = &listquery.Schema{
+	Table: "groups",
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":   {Column: "tenant_id", Type: listquery.Int},
+		"name":        {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"description": {Column: "description", Type: listquery.String, Filter: true},
+		"parent_id":   {Column: "parent_id", Type: listquery.Int, Filter: true, Nullable: true},
+		"created_at":  {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":  {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"name", "description"},
+	DefaultSort: "name",
+	MaxPageSize: 1000, // 用户组树通常需要一次取完
+}
+
+var InvitationListSchema = &listquery.Schema{
+	Table: "invitations",
+	Fields: map[string]listquery.Field{
+		"id":           {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":    {Column: "tenant_id", Type: listquery.Int},
+		"user_id":      {Column: "user_id", Type: listquery.Int, Filter: true},
+		"email":        {Column: "email", Type: listquery.String, Filter: true, Sort: true},
+		"status":       {Column: "status", Type: listquery.String, Filter: true, Sort: true},
+		"expires_at":   {Column: "expires_at", Type: listquery.Time, Filter: true, Sort: true},
+		"sent_count":   {Column: "sent_count", Type: listquery.Int},
+		"last_sent_at": {Column: "last_sent_at", Type: listquery.Time, Filter: true, Nullable: true},
+		"send_error":   {Column: "send_error", Type: listquery.String},
+		"invited_by":   {Column: "invited_by", Type: listquery.Int, Filter: true},
+		"accepted_at":  {Column: "accepted_at", Type: listquery.Time, Filter: true, Nullable: true},
+		"revoked_at":   {Column: "revoked_at", Type: listquery.Time, Filter: true, Nullable: true},
+		"revoked_by":   {Column: "revoked_by", Type: listquery.Int, Filter: true, Nullable: true},
+		"created_at":   {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":   {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"email"},
+	DefaultSort: "-id",
+}
+
+var PermissionListSchema = &listquery.Schema{
+	Table: "permissions",
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":   {Column: "tenant_id", Type: listquery.Int},
+		"code":        {Column: "code", Type: listquery.String, Filter: true, Sort: true},
+		"name":        {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"description": {Column: "description", Type: listquery.String, Filter: true},
+		"created_at":  {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":  {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"code", "name"},
+	DefaultSort: "code",
+	MaxPageSize: 1000,
+}
+
+var PolicyListSchema = &listquery.Schema{
+	Table: "policies",
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":   {Column: "tenant_id", Type: listquery.Int},
+		"name":        {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"subject":     {Column: "subject", Type: listquery.String, Filter: true, Sort: true},
+		"object":      {Column: "object", Type: listquery.String, Filter: true, Sort: true},
+		"action":      {Column: "action", Type: listquery.String, Filter: true, Sort: true},
+		"condition":   {Column: "condition", Type: listquery.String},
+		"effect":      {Column: "effect", Type: listquery.String, Filter: true, Sort: true},
+		"priority":    {Column: "priority", Type: listquery.Int, Filter: true, Sort: true},
+		"status":      {Column: "status", Type: listquery.Int, Filter: true, Sort: true},
+		"description": {Column: "description", Type: listquery.String},
+		"created_at":  {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":  {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"name", "description"},
+	DefaultSort: "-priority",
+}
+
+var ChangeRequestListSchema = &listquery.Schema{
+	Table: "change_requests",
+	Fields: map[string]listquery.Field{
+		"id":             {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":      {Column: "tenant_id", Type: listquery.Int},
+		"type":           {Column: "type", Type: listquery.String, Filter: true, Sort: true},
+		"target_id":      {Column: "target_id", Type: listquery.Int, Filter: true},
+		"payload":        {Column: "payload", Type: listquery.String},
+		"reason":         {Column: "reason", Type: listquery.String},
+		"status":         {Column: "status", Type: listquery.String, Filter: true, Sort: true},
+		"requested_by":   {Column: "requested_by", Type: listquery.Int, Filter: true},
+		"reviewed_by":    {Column: "reviewed_by", Type: listquery.Int, Filter: true, Nullable: true},
+		"review_comment": {Column: "review_comment", Type: listquery.String},
+		"reviewed_at":    {Column: "reviewed_at", Type: listquery.Time, Filter: true},
+		"error":          {Column: "error", Type: listquery.String},
+		"created_at":     {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":     {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search:      []string{"reason"},
+	DefaultSort: "-id",
+}
+
+var TenantListSchema = &listquery.Schema{
+	Table: "tenants",
+	Fields: map[string]listquery.Field{
+		"id":         {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"code":       {Column: "code", Type: listquery.String, Filter: true, Sort: true},
+		"name":       {Column: "name", Type: listquery.String, Filter: true, Sort: true},
+		"status":     {Column: "status", Type: listquery.Int, Filter: true, Sort: true},
+		"created_at": {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at": {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	Search: []string{"code", "name"},
+}
+
+var JobListSchema = &listquery.Schema{
+	Table: "jobs",
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":   {Column: "tenant_id", Type: listquery.Int},
+		"type":        {Column: "type", Type: listquery.String, Filter: true, Sort: true},
+		"status":      {Column: "status", Type: listquery.String, Filter: true, Sort: true},
+		"params":      {Column: "params", Type: listquery.String},
+		"total":       {Column: "total", Type: listquery.Int},
+		"processed":   {Column: "processed", Type: listquery.Int},
+		"file_name":   {Column: "file_name", Type: listquery.String},
+		"error":       {Column: "error", Type: listquery.String},
+		"created_by":  {Column: "created_by", Type: listquery.Int},
+		"started_at":  {Column: "started_at", Type: listquery.Time},
+		"finished_at": {Column: "finished_at", Type: listquery.Time, Filter: true},
+		"created_at":  {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+		"updated_at":  {Column: "updated_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	DefaultSort: "-id",
+}
+
+var DeletedUserListSchema = deletedSchema(UserListSchema)
+
+var DeletedRoleListSchema = deletedSchema(RoleListSchema)
+
+var DeletedMenuListSchema = deletedSchema(MenuListSchema)
+
+// deletedSchema 回收站列表在原列表字段的基础上增加删除时间，默认按删除时间倒序
+func deletedSchema(base *listquery.Schema) *listquery.Schema {
+	fields := make(map[string]listquery.Field, len(base.Fields)+1)
+	for name, field := range base.Fields {
+		fields[name] = field
+	}
+	fields["deleted_at"] = listquery.Field{Column: "deleted_at", Type: listquery.Time, Filter: true, Sort: true}
+
+	return &listquery.Schema{
+		Table:       base.Table,
+		Fields:      fields,
+		Search:      base.Search,
+		DefaultSort: "-deleted_at",
+	}
+}
+
+var ChangeHistoryListSchema = &listquery.Schema{
+	Table: "change_histories",
+	Fields: map[string]listquery.Field{
+		"id":          {Column: "id", Type: listquery.Int, Filter: true, Sort: true},
+		"tenant_id":   {Column: "tenant_id", Type: listquery.Int},
+		"entity_type": {Column: "entity_type", Type: listquery.String},
+		"entity_id":   {Column: "entity_id", Type: listquery.Int},
+		"operation":   {Column: "operation", Type: listquery.String, Filter: true},
+		"actor_id":    {Column: "actor_id", Type: listquery.Int, Filter: true},
+		"before":      {Column: "before", Type: listquery.String},
+		"after":       {Column: "after", Type: listquery.String},
+		"diff":        {Column: "diff", Type: listquery.String},
+		"created_at":  {Column: "created_at", Type: listquery.Time, Filter: true, Sort: true},
+	},
+	DefaultSort: "-id",
+}
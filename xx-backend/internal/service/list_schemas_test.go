@@ -0,0 +1,44 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+
+	"xx-backend/pkg/listquery"
+)
+
+func TestListSchemas(t *testing.T) {
+	schemas := map[string]*listquery.Schema{
+		"users":           UserListSchema,
+		"roles":           RoleListSchema,
+		"menus":           MenuListSchema,
+		"departments":     DepartmentListSchema,
+		"groups":          GroupListSchema,
+		"invitations":     InvitationListSchema,
+		"permissions":     PermissionListSchema,
+		"policies":        PolicyListSchema,
+		"change_requests": ChangeRequestListSchema,
+		"tenants":         TenantListSchema,
+		"jobs":            JobListSchema,
+		"deleted_users":   DeletedUserListSchema,
+		"deleted_roles":   DeletedRoleListSchema,
+		"deleted_menus":   DeletedMenuListSchema,
+		"change_history":  ChangeHistoryListSchema,
+	}
+	for name, schema := range schemas {
+		t.Run(name, func(t *testing.T) {
+			// 游标比较无法处理 NULL，可为空的字段不能排序
+			for field, f := range schema.Fields {
+				if f.Sort && f.Nullable {
+					t.Errorf("field %s is both sortable and nullable", field)
+				}
+			}
+			if _, ok := schema.Fields["id"]; !ok {
+				t.Error("schema has no id field for the keyset tie-breaker")
+			}
+			if _, err := listquery.Parse(url.Values{}, schema); err != nil {
+				t.Errorf("default query: %v", err)
+			}
+		})
+	}
+}
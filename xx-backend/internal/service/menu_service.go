@@ -0,0 +1,243 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"xx-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// ErrMenuCycle 菜单上下级关系出现循环
+var ErrMenuCycle = fmt.Errorf("%w: 菜单不能移动到自身或其子菜单下", ErrConflict)
+
+// 删除菜单时对子菜单的处理策略
+const (
+	MenuDeleteBlock    = "block"    // 存在子菜单时拒绝删除（默认）
+	MenuDeleteCascade  = "cascade"  // 连同所有子孙菜单一起删除
+	MenuDeleteReparent = "reparent" // 子菜单上移到被删除菜单的父菜单下
+)
+
+// 删除角色时对关联用户和子角色的处理策略
+const (
+	RoleDeleteBlock    = "block"    // 仍有用户、子角色、用户组或限时授权引用时拒绝删除（默认）
+	RoleDeleteReassign = "reassign" // 用户和用户组改为指定角色，子角色改为继承被删除角色的父角色，限时授权被撤销
+)
+
+// roleDeletedRevokeReason 删除角色时撤销限时授权记录的原因
+const roleDeletedRevokeReason = "role deleted"
+
+// menuDescendants 获取菜单的所有子孙菜单ID
+func (s *UserService) menuDescendants(ctx context.Context, db *gorm.DB, menuID int) ([]int, error) {
+	var menus []model.Menu
+	if err := db.WithContext(ctx).Select("id", "parent_id").Find(&menus).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for _, m := range menus {
+		if m.ParentID != nil {
+			children[*m.ParentID] = append(children[*m.ParentID], m.ID)
+		}
+	}
+	return collectDescendants(children, menuID), nil
+}
+
+// checkMenuParent 校验父菜单存在，且不是菜单自身或其子孙菜单
+func (s *UserService) checkMenuParent(ctx context.Context, db *gorm.DB, menuID int, parentID int) error {
+	if menuID != 0 && parentID == menuID {
+		return ErrMenuCycle
+	}
+
+	var parent model.Menu
+	if err := db.WithContext(ctx).First(&parent, parentID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("父菜单不存在")
+		}
+		return err
+	}
+
+	if menuID == 0 {
+		return nil
+	}
+	descendants, err := s.menuDescendants(ctx, db, menuID)
+	if err != nil {
+		return err
+	}
+	for _, id := range descendants {
+		if id == parentID {
+			return ErrMenuCycle
+		}
+	}
+	return nil
+}
+
+// MenuMoveRequest 移动菜单：把菜单移动到新父菜单下的指定位置
+type MenuMoveRequest struct {
+	ID       int  `json:"id"`
+	ParentID *int `json:"parent_id"` // 为空表示移动到顶级
+	Position int  `json:"position"`  // 在新父菜单下的位置，从0开始，超出范围时放到最后
+}
+
+// MenuTreeNode 批量排序时的菜单树节点，节点在数组中的顺序即排序
+type MenuTreeNode struct {
+	ID       int            `json:"id"`
+	Children []MenuTreeNode `json:"children"`
+}
+
+// siblingMenus 获取同一父菜单下的菜单（按当前排序）
+func siblingMenus(tx *gorm.DB, parentID *int, excludeID int) ([]model.Menu, error) {
+	query := tx.Model(&model.Menu{}).Where("id <> ?", excludeID)
+	if parentID == nil {
+		query = query.Where("parent_id IS NULL")
+	} else {
+		query = query.Where("parent_id = ?", *parentID)
+	}
+
+	var menus []model.Menu
+	if err := query.Order("sort, id").Find(&menus).Error; err != nil {
+		return nil, err
+	}
+	return menus, nil
+}
+
+// resequenceMenus 按数组顺序重新计算排序值（从1开始），只更新发生变化的菜单
+func resequenceMenus(tx *gorm.DB, menus []model.Menu) error {
+	for i, m := range menus {
+		if m.Sort == i+1 {
+			continue
+		}
+		if err := tx.Model(&model.Menu{}).Where("id = ?", m.ID).Update("sort", i+1).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sameParent(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return *a == *b
+}
+
+// MoveMenu 在一个事务中移动菜单，并重新计算新旧父菜单下所有兄弟菜单的排序
+func (s *UserService) MoveMenu(ctx context.Context, req MenuMoveRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var menu model.Menu
+		if err := tx.First(&menu, req.ID).Error; err != nil {
+			return err
+		}
+		if req.ParentID != nil {
+			if err := s.checkMenuParent(ctx, tx, menu.ID, *req.ParentID); err != nil {
+				return err
+			}
+		}
+
+		siblings, err := siblingMenus(tx, req.ParentID, menu.ID)
+		if err != nil {
+			return err
+		}
+
+		position := req.Position
+		if position < 0 || position > len(siblings) {
+			position = len(siblings)
+		}
+
+		ordered := make([]model.Menu, 0, len(siblings)+1)
+		ordered = append(ordered, siblings[:position]...)
+		ordered = append(ordered, model.Menu{ID: menu.ID, Sort: -1})
+		ordered = append(ordered, siblings[position:]...)
+
+		if err := tx.Model(&model.Menu{}).Where("id = ?", menu.ID).Update("parent_id", req.ParentID).Error; err != nil {
+			return err
+		}
+		if err := resequenceMenus(tx, ordered); err != nil {
+			return err
+		}
+
+		// 从原父菜单移出时，原兄弟菜单的排序需要补齐空位
+		if !sameParent(menu.ParentID, req.ParentID) {
+			oldSiblings, err := siblingMenus(tx, menu.ParentID, menu.ID)
+			if err != nil {
+				return err
+			}
+			if err := resequenceMenus(tx, oldSiblings); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+// ReorderMenus 按完整的菜单树批量调整父子关系和排序，必须包含当前租户的全部菜单
+func (s *UserService) ReorderMenus(ctx context.Context, tree []MenuTreeNode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	type placement struct {
+		parentID *int
+		sort     int
+	}
+	placements := make(map[int]placement)
+
+	var walk func(nodes []MenuTreeNode, parentID *int) error
+	walk = func(nodes []MenuTreeNode, parentID *int) error {
+		for i, node := range nodes {
+			if _, exists := placements[node.ID]; exists {
+				return fmt.Errorf("菜单 %d 在排序数据中重复出现", node.ID)
+			}
+			placements[node.ID] = placement{parentID: parentID, sort: i + 1}
+			id := node.ID
+			if err := walk(node.Children, &id); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(tree, nil); err != nil {
+		return err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var menus []model.Menu
+		if err := tx.Select("id", "parent_id", "sort").Find(&menus).Error; err != nil {
+			return err
+		}
+		if len(menus) != len(placements) {
+			return fmt.Errorf("排序数据必须包含全部 %d 个菜单", len(menus))
+		}
+
+		for _, m := range menus {
+			p, ok := placements[m.ID]
+			if !ok {
+				return fmt.Errorf("排序数据缺少菜单 %d", m.ID)
+			}
+			if sameParent(m.ParentID, p.parentID) && m.Sort == p.sort {
+				continue
+			}
+			updates := map[string]interface{}{"parent_id": p.parentID, "sort": p.sort}
+			if err := tx.Model(&model.Menu{}).Where("id = ?", m.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.roleCache.invalidateAll()
+	return nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+)
+
+// ErrNotificationUnavailable 没有可用的消息服务（未连接Kafka），处理器应返回503
+var ErrNotificationUnavailable = errors.New("消息服务未启用")
+
+// 通知类别
+const (
+	NotificationManual = "manual" // 管理员手动发送
+)
+
+// notificationBatchSize 每条通知事件最多包含的收件人数，收件人更多时拆分为多条事件
+const notificationBatchSize = 500
+
+// NotificationRecipient 通知的收件人
+type NotificationRecipient struct {
+	UserID   uint   `json:"user_id"`
+	Username string `json:"username"`
+	Email    string `json:"email"`
+}
+
+// NotificationRequest 发送通知的请求，收件人为指定的用户和用户组（包括子组）的成员
+type NotificationRequest struct {
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	UserIDs  []uint `json:"user_ids"`
+	GroupIDs []int  `json:"group_ids"`
+}
+
+// NotificationResult 发送结果
+type NotificationResult struct {
+	Recipients int `json:"recipients"` // 实际收件人数（去重，只包含数据范围内的正常用户）
+}
+
+// SendNotification 向用户和用户组成员发送通知。只发送给操作人数据范围内状态正常的用户，
+// 通知作为事件发布到Kafka，由下游消费者投递
+func (s *UserService) SendNotification(ctx context.Context, operatorID int, req *NotificationRequest) (*NotificationResult, error) {
+	errs := FieldErrors{}
+	req.Title = strings.TrimSpace(req.Title)
+	switch {
+	case req.Title == "":
+		errs["title"] = "不能为空"
+	case utf8.RuneCountInString(req.Title) > 100:
+		errs["title"] = "长度不能超过 100"
+	}
+	if utf8.RuneCountInString(req.Content) > 5000 {
+		errs["content"] = "长度不能超过 5000"
+	}
+	if len(req.UserIDs) == 0 && len(req.GroupIDs) == 0 {
+		errs["user_ids"] = "至少指定一个用户或用户组"
+	}
+	if len(req.GroupIDs) > 0 {
+		var count int64
+		if err := s.db.WithContext(ctx).Model(&model.Group{}).Where("id IN ?", req.GroupIDs).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if int(count) != len(uniqueInts(req.GroupIDs)) {
+			errs["group_ids"] = "部分用户组不存在"
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	if s.kafkaService == nil {
+		return nil, ErrNotificationUnavailable
+	}
+
+	userIDs := append([]uint(nil), req.UserIDs...)
+	memberIDs, err := s.groupMemberIDs(ctx, req.GroupIDs)
+	if err != nil {
+		return nil, err
+	}
+	userIDs = uniqueUints(append(userIDs, memberIDs...))
+
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	var users []model.User
+	if err := s.db.WithContext(ctx).Scopes(scope.apply).Where("users.id IN ? AND users.status = 1", userIDs).Order("users.id").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	if err := s.notify(NotificationManual, req.Title, req.Content, users, uint(operatorID)); err != nil {
+		return nil, err
+	}
+	return &NotificationResult{Recipients: len(users)}, nil
+}
+
+// notify 把通知按批次发布到Kafka，operatorID 为0表示系统发送
+func (s *UserService) notify(category, title, content string, users []model.User, operatorID uint) error {
+	if s.kafkaService == nil {
+		return ErrNotificationUnavailable
+	}
+	for start := 0; start < len(users); start += notificationBatchSize {
+		end := start + notificationBatchSize
+		if end > len(users) {
+			end = len(users)
+		}
+		recipients := make([]NotificationRecipient, 0, end-start)
+		for _, user := range users[start:end] {
+			recipients = append(recipients, NotificationRecipient{UserID: user.ID, Username: user.Username, Email: user.Email})
+		}
+		if err := s.kafkaService.SendNotification(category, title, content, recipients, operatorID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
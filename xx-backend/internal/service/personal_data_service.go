@@ -0,0 +1,284 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+
+	"gorm.io/gorm"
+)
+
+// 个人数据相关的权限编码
+const (
+	PermissionUserPersonalData = "user:personal_data" // 导出其他用户的个人数据
+	PermissionUserErase        = "user:erase"         // 删除（匿名化）用户的个人数据
+)
+
+// ErrErasureUnavailable 消息服务未启用，无法发布删除事件通知下游，处理器应返回503
+var ErrErasureUnavailable = errors.New("消息服务未启用，无法通知下游删除个人数据")
+
+// 删除个人数据时清除的用户和邀请字段，变更历史中的这些字段同样被替换
+var (
+	erasedUserColumns       = []string{"username", "email", "nickname", "avatar", "attributes", "password", "last_login_at", "deactivate_at"}
+	erasedInvitationColumns = []string{"email"}
+)
+
+// personalDataBatchSize 导出变更历史时每批读取的条数
+const personalDataBatchSize = 500
+
+// EraseRequest 删除个人数据的请求
+type EraseRequest struct {
+	Reason string `json:"reason"` // 必填，如数据主体请求的编号
+}
+
+// PersonalDataManifest 个人数据归档的说明文件
+type PersonalDataManifest struct {
+	UserID      uint      `json:"user_id"`
+	TenantID    uint      `json:"tenant_id"`
+	GeneratedAt time.Time `json:"generated_at"`
+	GeneratedBy uint      `json:"generated_by"`
+	Files       []string  `json:"files"`
+	Notes       []string  `json:"notes"`
+}
+
+// PreparePersonalDataExport 校验权限并返回要导出个人数据的用户（包括已删除的用户）。
+// 用户可以导出自己的数据，导出其他用户需要 user:personal_data 权限且用户在操作人的数据范围内
+func (s *UserService) PreparePersonalDataExport(ctx context.Context, operatorID, id int) (*model.User, error) {
+	query := s.db.WithContext(ctx).Unscoped()
+	if id != operatorID {
+		if err := s.forbiddenFields(ctx, operatorID, map[string]string{"personal_data": PermissionUserPersonalData}); err != nil {
+			return nil, err
+		}
+		scope, err := s.resolveDataScope(ctx, operatorID)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Scopes(scope.apply)
+	}
+
+	var user model.User
+	if err := query.Preload("Role", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Preload("Department", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// WritePersonalData 把用户的个人数据写成 zip 归档：资料、用户组、登录历史、限时授权、邀请、
+// 变更请求、生命周期提醒，以及记录该用户或由该用户操作的变更历史（JSON Lines，分批读取）
+func (s *UserService) WritePersonalData(ctx context.Context, operatorID int, user *model.User, w io.Writer) error {
+	db := s.db.WithContext(ctx)
+	archive := zip.NewWriter(w)
+
+	manifest := PersonalDataManifest{
+		UserID:      user.ID,
+		TenantID:    user.TenantID,
+		GeneratedAt: time.Now(),
+		GeneratedBy: uint(operatorID),
+		Notes: []string{
+			"audit_entries.jsonl 包含该用户资料的变更记录和该用户作为操作人的变更记录",
+			"发送到消息队列的事件不在本服务保存，由各下游系统分别提供",
+		},
+	}
+
+	var groups []model.Group
+	if err := db.Unscoped().Where("id IN (?)", db.Table("group_members").Select("group_id").Where("user_id = ?", user.ID)).
+		Find(&groups).Error; err != nil {
+		return err
+	}
+	var logins []model.LoginRecord
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&logins).Error; err != nil {
+		return err
+	}
+	var grants []model.RoleGrant
+	if err := db.Preload("Role", func(db *gorm.DB) *gorm.DB { return db.Unscoped() }).
+		Where("user_id = ? OR granted_by = ? OR revoked_by = ?", user.ID, user.ID, user.ID).Order("id").Find(&grants).Error; err != nil {
+		return err
+	}
+	var invitations []model.Invitation
+	if err := db.Where("user_id = ? OR invited_by = ? OR revoked_by = ?", user.ID, user.ID, user.ID).Order("id").Find(&invitations).Error; err != nil {
+		return err
+	}
+	var changes []model.ChangeRequest
+	if err := db.Where("requested_by = ? OR reviewed_by = ? OR (target_id = ? AND type IN ?)",
+		user.ID, user.ID, user.ID, []string{model.ChangeRoleAssign, model.ChangeUserDelete}).
+		Order("id").Find(&changes).Error; err != nil {
+		return err
+	}
+	// 导出包含全部自定义字段，只隐藏旧的变更请求中可能记录的密码
+	for i := range changes {
+		if err := (&attributeRedactor{}).changeRequests(&changes[i]); err != nil {
+			return err
+		}
+	}
+	var notices []model.LifecycleNotice
+	if err := db.Where("user_id = ?", user.ID).Order("id").Find(&notices).Error; err != nil {
+		return err
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", user},
+		{"groups.json", groups},
+		{"login_history.json", logins},
+		{"role_grants.json", grants},
+		{"invitations.json", invitations},
+		{"change_requests.json", changes},
+		{"lifecycle_notices.json", notices},
+	}
+	for _, file := range files {
+		manifest.Files = append(manifest.Files, file.name)
+	}
+	manifest.Files = append(manifest.Files, "audit_entries.jsonl")
+
+	if err := writeArchiveJSON(archive, "manifest.json", manifest); err != nil {
+		return err
+	}
+	for _, file := range files {
+		if err := writeArchiveJSON(archive, file.name, file.data); err != nil {
+			return err
+		}
+	}
+
+	entries, err := archive.Create("audit_entries.jsonl")
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(entries)
+	var batch []history.Entry
+	err = db.Where("(entity_type = ? AND entity_id = ?) OR actor_id = ?", "users", user.ID, user.ID).
+		FindInBatches(&batch, personalDataBatchSize, func(tx *gorm.DB, n int) error {
+			for i := range batch {
+				if err := encoder.Encode(&batch[i]); err != nil {
+					return err
+				}
+			}
+			return ctx.Err()
+		}).Error
+	if err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func writeArchiveJSON(archive *zip.Writer, name string, data interface{}) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(data)
+}
+
+// EraseUser 删除（匿名化）用户的个人数据，需要 user:erase 权限。用户记录、角色、部门和用户组关系保留，
+// 用户名、邮箱等个人信息被替换或清空，登录历史被删除，邀请中的邮箱和变更历史中的个人信息被替换为 [erased]。
+// 提交后发布墓碑事件，下游消费者据此删除各自保存的数据。消息服务未启用时不执行删除；
+// 对已删除个人数据的用户再次执行时只重新发布墓碑事件
+func (s *UserService) EraseUser(ctx context.Context, operatorID, id int, req *EraseRequest) (*model.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.forbiddenFields(ctx, operatorID, map[string]string{"erase": PermissionUserErase}); err != nil {
+		return nil, err
+	}
+	reason := strings.TrimSpace(req.Reason)
+	switch {
+	case reason == "":
+		return nil, FieldErrors{"reason": "不能为空"}
+	case utf8.RuneCountInString(reason) > 255:
+		return nil, FieldErrors{"reason": "长度不能超过255"}
+	}
+	if id == operatorID {
+		return nil, fmt.Errorf("%w: 不能删除自己的个人数据", ErrConflict)
+	}
+	if s.kafkaService == nil {
+		return nil, ErrErasureUnavailable
+	}
+
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	var user model.User
+	if err := s.db.WithContext(ctx).Unscoped().Scopes(scope.apply).First(&user, id).Error; err != nil {
+		return nil, err
+	}
+
+	if user.ErasedAt == nil {
+		now := time.Now()
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			err := tx.Unscoped().Model(&model.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+				"username":      fmt.Sprintf("erased_%d", user.ID),
+				"email":         fmt.Sprintf("erased_%d@erased.invalid", user.ID),
+				"nickname":      "",
+				"avatar":        "",
+				"attributes":    model.Attributes{},
+				"password":      "",
+				"status":        model.UserStatusDisabled,
+				"last_login_at": nil,
+				"deactivate_at": nil,
+				"erased_at":     now,
+			}).Error
+			if err != nil {
+				return err
+			}
+			if err := tx.Where("user_id = ?", user.ID).Delete(&model.LoginRecord{}).Error; err != nil {
+				return err
+			}
+
+			// 未接受的邀请一并撤销，邀请链接随之失效
+			var invitationIDs []int
+			if err := tx.Model(&model.Invitation{}).Where("user_id = ?", user.ID).Pluck("id", &invitationIDs).Error; err != nil {
+				return err
+			}
+			if len(invitationIDs) > 0 {
+				err := tx.Model(&model.Invitation{}).Where("id IN ? AND status = ?", invitationIDs, model.InvitationPending).
+					Updates(map[string]interface{}{"status": model.InvitationRevoked, "revoked_at": now, "revoked_by": operatorID}).Error
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(&model.Invitation{}).Where("id IN ?", invitationIDs).
+					Update("email", fmt.Sprintf("erased_%d@erased.invalid", user.ID)).Error; err != nil {
+					return err
+				}
+			}
+
+			// 在更新之后执行，同时处理本次更新产生的变更记录
+			if err := history.Erase(tx, "users", []int{int(user.ID)}, erasedUserColumns...); err != nil {
+				return err
+			}
+			return history.Erase(tx, "invitations", invitationIDs, erasedInvitationColumns...)
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		s.revokeSession(ctx, user.ID)
+		s.roleCache.invalidateUser(user.ID)
+	}
+
+	// 墓碑事件发布失败时返回错误，重新执行即可补发
+	if err := s.kafkaService.LogUserErasure(user.ID, user.TenantID, uint(operatorID), reason); err != nil {
+		return nil, fmt.Errorf("发布删除事件失败: %w", err)
+	}
+
+	var erased model.User
+	if err := s.db.WithContext(ctx).Unscoped().Preload("Role").Preload("Department").First(&erased, user.ID).Error; err != nil {
+		return nil, err
+	}
+	return &erased, nil
+}
@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+	"github.com/go-redis/redis/v8"
+	"gorm.io/gorm"
+)
+
+// policyReloadChannel 策略变更通知频道，多实例通过它同步热加载策略
+const policyReloadChannel = "policy:reload"
+
+// 授权决策结果
+const (
+	DecisionAllow         = "allow"
+	DecisionDeny          = "deny"
+	DecisionNotApplicable = "not_applicable" // 没有适用的策略，交由其他授权机制决定
+)
+
+// AuthzRequest 授权请求，包含主体、资源、操作和环境属性
+type AuthzRequest struct {
+	TenantID    uint                   `json:"tenant_id"`
+	Subject     map[string]interface{} `json:"subject"`
+	Object      string                 `json:"object"`
+	ObjectAttrs map[string]interface{} `json:"object_attrs"`
+	Action      string                 `json:"action"`
+	Env         map[string]interface{} `json:"env"`
+}
+
+// PolicyMatch 适用于本次请求的策略及其条件求值结果
+type PolicyMatch struct {
+	Policy    model.Policy `json:"policy"`
+	Satisfied bool         `json:"satisfied"`
+	Error     string       `json:"error,omitempty"`
+}
+
+// PolicyDecision 策略引擎的决策结果
+type PolicyDecision struct {
+	Decision string        `json:"decision"`
+	Matches  []PolicyMatch `json:"matches"`
+}
+
+type compiledPolicy struct {
+	policy  model.Policy
+	program *vm.Program // 条件为空时为nil，表示总是满足
+}
+
+type PolicyService struct {
+	db          *gorm.DB
+	redis       *redis.Client
+	userService *UserService
+	mu          sync.RWMutex
+	policies    map[uint][]compiledPolicy // 按租户分组
+
+	defaultDecision string // 没有适用策略时的决策
+}
+
+func NewPolicyService(db *gorm.DB, redis *redis.Client, userService *UserService) *PolicyService {
+	return &PolicyService{
+		db:          db,
+		redis:       redis,
+		userService: userService,
+		policies:    make(map[uint][]compiledPolicy),
+
+		defaultDecision: DecisionDeny,
+	}
+}
+
+// SetDefaultDecision 设置没有适用策略时的决策，只能为 allow 或 deny
+func (s *PolicyService) SetDefaultDecision(decision string) error {
+	decision = strings.ToLower(strings.TrimSpace(decision))
+	if decision != DecisionAllow && decision != DecisionDeny {
+		return fmt.Errorf("默认决策只能为 %s 或 %s: %q", DecisionAllow, DecisionDeny, decision)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.defaultDecision = decision
+	return nil
+}
+
+// Decide 把策略引擎的决策转换为最终的 allow 或 deny：没有适用策略时使用默认决策
+func (s *PolicyService) Decide(decision *PolicyDecision) string {
+	if decision.Decision != DecisionNotApplicable {
+		return decision.Decision
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.defaultDecision
+}
+
+// cidrFunction 条件表达式中的 cidr(ip, network) 函数
+var cidrFunction = expr.Function("cidr", func(params ...interface{}) (interface{}, error) {
+	ip, _ := params[0].(string)
+	network, _ := params[1].(string)
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return false, err
+	}
+	parsed := net.ParseIP(ip)
+	return parsed != nil && ipNet.Contains(parsed), nil
+}, new(func(string, string) bool))
+
+// compileCondition 编译策略条件表达式
+func compileCondition(condition string) (*vm.Program, error) {
+	if strings.TrimSpace(condition) == "" {
+		return nil, nil
+	}
+	return expr.Compile(condition, expr.AsBool(), expr.AllowUndefinedVariables(), cidrFunction)
+}
+
+// Load 从数据库加载全部租户的策略
+func (s *PolicyService) Load(ctx context.Context) error {
+	var policies []model.Policy
+	err := s.db.WithContext(tenant.WithoutTenant(ctx)).
+		Where("status = ?", 1).
+		Order("priority DESC, id").
+		Find(&policies).Error
+	if err != nil {
+		return err
+	}
+
+	compiled := make(map[uint][]compiledPolicy)
+	for _, p := range policies {
+		program, err := compileCondition(p.Condition)
+		if err != nil {
+			log.Printf("Skip invalid policy %d: %v", p.ID, err)
+			continue
+		}
+		compiled[p.TenantID] = append(compiled[p.TenantID], compiledPolicy{policy: p, program: program})
+	}
+
+	s.mu.Lock()
+	s.policies = compiled
+	s.mu.Unlock()
+
+	log.Printf("Loaded %d policies", len(policies))
+	return nil
+}
+
+// StartWatcher 订阅Redis中的策略变更通知，收到后重新加载策略
+func (s *PolicyService) StartWatcher(ctx context.Context) {
+	pubsub := s.redis.Subscribe(ctx, policyReloadChannel)
+	go func() {
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case _, ok := <-ch:
+				if !ok {
+					return
+				}
+				if err := s.Load(ctx); err != nil {
+					log.Printf("Failed to reload policies: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// notifyReload 重新加载本实例的策略，并通知其他实例
+func (s *PolicyService) notifyReload(ctx context.Context) {
+	if err := s.Load(ctx); err != nil {
+		log.Printf("Failed to reload policies: %v", err)
+	}
+	if err := s.redis.Publish(ctx, policyReloadChannel, time.Now().Unix()).Err(); err != nil {
+		log.Printf("Failed to publish policy reload: %v", err)
+	}
+}
+
+// Evaluate 计算授权决策：满足条件的拒绝策略优先；其次是满足条件的允许策略；
+// 存在适用策略但条件都不满足时拒绝；没有适用策略时返回 DecisionNotApplicable
+func (s *PolicyService) Evaluate(req *AuthzRequest) *PolicyDecision {
+	s.mu.RLock()
+	policies := s.policies[req.TenantID]
+	s.mu.RUnlock()
+
+	objectAttrs := make(map[string]interface{}, len(req.ObjectAttrs)+1)
+	for k, v := range req.ObjectAttrs {
+		objectAttrs[k] = v
+	}
+	objectAttrs["type"] = req.Object
+
+	env := map[string]interface{}{
+		"sub": req.Subject,
+		"obj": objectAttrs,
+		"env": req.Env,
+	}
+
+	decision := &PolicyDecision{Decision: DecisionNotApplicable, Matches: []PolicyMatch{}}
+	allowed, denied := false, false
+	for _, cp := range policies {
+		if !matchSubject(cp.policy.Subject, req.Subject) ||
+			!matchPattern(cp.policy.Object, req.Object) ||
+			!matchPattern(cp.policy.Action, req.Action) {
+			continue
+		}
+
+		match := PolicyMatch{Policy: cp.policy, Satisfied: true}
+		if cp.program != nil {
+			out, err := expr.Run(cp.program, env)
+			if err != nil {
+				match.Satisfied = false
+				match.Error = err.Error()
+			} else {
+				match.Satisfied, _ = out.(bool)
+			}
+		}
+		decision.Matches = append(decision.Matches, match)
+
+		if match.Satisfied {
+			if cp.policy.Effect == model.PolicyEffectDeny {
+				denied = true
+			} else {
+				allowed = true
+			}
+		}
+	}
+
+	switch {
+	case denied:
+		decision.Decision = DecisionDeny
+	case allowed:
+		decision.Decision = DecisionAllow
+	case len(decision.Matches) > 0:
+		decision.Decision = DecisionDeny
+	}
+	return decision
+}
+
+func matchPattern(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+func matchSubject(pattern string, subject map[string]interface{}) bool {
+	if pattern == "*" {
+		return true
+	}
+	if strings.HasPrefix(pattern, "user:") {
+		return strings.TrimPrefix(pattern, "user:") == fmt.Sprint(subject["id"])
+	}
+	roles, _ := subject["roles"].([]string)
+	for _, role := range roles {
+		if role == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// SubjectAttributes 获取用户的主体属性
+func (s *PolicyService) SubjectAttributes(ctx context.Context, userID int) (map[string]interface{}, error) {
+	// 用户ID来自token或管理员指定，按主键跨租户读取（平台超级管理员可能切换了租户）
+	ctx = tenant.WithoutTenant(ctx)
+
+	var user model.User
+	if err := s.db.WithContext(ctx).Preload("Role").First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	// 角色包含主角色、当前生效的限时授权角色及它们的祖先角色
+	permissions, err := s.userService.GetUserPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	roles := permissions.Roles
+
+	subject := map[string]interface{}{
+		"id":        int(user.ID),
+		"username":  user.Username,
+		"tenant_id": user.TenantID,
+		"role":      user.Role.Name,
+		"roles":     roles,
+		"status":    user.Status,
+	}
+	if user.DepartmentID != nil {
+		subject["department_id"] = *user.DepartmentID
+	}
+	return subject, nil
+}
+
+// ObjectAttributes 根据路径参数构造资源属性，数字ID会转换为整数便于比较
+func ObjectAttributes(id string) map[string]interface{} {
+	attrs := map[string]interface{}{}
+	if id == "" {
+		return attrs
+	}
+	if n, err := strconv.Atoi(id); err == nil {
+		attrs["id"] = n
+	} else {
+		attrs["id"] = id
+	}
+	return attrs
+}
+
+// EnvironmentAttributes 构造环境属性
+func EnvironmentAttributes(ip string, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		"ip":      ip,
+		"time":    now.Format(time.RFC3339),
+		"hour":    now.Hour(),
+		"weekday": int(now.Weekday()),
+	}
+}
+
+func validatePolicy(effect, condition string) error {
+	if effect != model.PolicyEffectAllow && effect != model.PolicyEffectDeny {
+		return fmt.Errorf("无效的策略效果: %s", effect)
+	}
+	if _, err := compileCondition(condition); err != nil {
+		return fmt.Errorf("策略条件表达式错误: %w", err)
+	}
+	return nil
+}
+
+// GetPolicies 获取策略列表
+func (s *PolicyService) GetPolicies(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Policy], error) {
+	return listquery.Find[model.Policy](s.db.WithContext(ctx), q)
+}
+
+// CreatePolicy 创建策略
+func (s *PolicyService) CreatePolicy(ctx context.Context, policy *model.Policy) error {
+	if policy.Effect == "" {
+		policy.Effect = model.PolicyEffectAllow
+	}
+	if err := validatePolicy(policy.Effect, policy.Condition); err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Create(policy).Error; err != nil {
+		return err
+	}
+
+	s.notifyReload(ctx)
+	return nil
+}
+
+// PolicyUpdate 策略的更新内容，未出现的字段不修改
+type PolicyUpdate struct {
+	Name        Optional[string] `json:"name"`
+	Subject     Optional[string] `json:"subject"`
+	Object      Optional[string] `json:"object"`
+	Action      Optional[string] `json:"action"`
+	Condition   Optional[string] `json:"condition"` // null 或空表示无条件
+	Effect      Optional[string] `json:"effect"`    // 只能为 allow 或 deny
+	Priority    Optional[int]    `json:"priority"`
+	Status      Optional[int]    `json:"status"`
+	Description Optional[string] `json:"description"`
+}
+
+// DecodePolicyUpdate 解析策略的合并补丁
+func DecodePolicyUpdate(data []byte) (*PolicyUpdate, error) {
+	var update PolicyUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// UpdatePolicy 更新策略，effect 只能为 allow 或 deny，条件表达式必须能编译
+func (s *PolicyService) UpdatePolicy(ctx context.Context, id int, update *PolicyUpdate) error {
+	var policy model.Policy
+	if err := s.db.WithContext(ctx).First(&policy, id).Error; err != nil {
+		return err
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	stringField(errs, columns, "name", update.Name, 100, true)
+	stringField(errs, columns, "subject", update.Subject, 100, true)
+	stringField(errs, columns, "object", update.Object, 100, true)
+	stringField(errs, columns, "action", update.Action, 50, true)
+	stringField(errs, columns, "description", update.Description, 255, false)
+	statusField(errs, columns, "status", update.Status)
+	if update.Priority.Set {
+		if update.Priority.Value == nil {
+			errs["priority"] = "不能为空"
+		} else {
+			columns["priority"] = *update.Priority.Value
+		}
+	}
+	if update.Effect.Set {
+		if update.Effect.Value == nil || (*update.Effect.Value != model.PolicyEffectAllow && *update.Effect.Value != model.PolicyEffectDeny) {
+			errs["effect"] = "只能为 allow 或 deny"
+		} else {
+			columns["effect"] = *update.Effect.Value
+		}
+	}
+	if update.Condition.Set {
+		condition := ""
+		if update.Condition.Value != nil {
+			condition = *update.Condition.Value
+		}
+		if _, err := compileCondition(condition); err != nil {
+			errs["condition"] = fmt.Sprintf("条件表达式错误: %v", err)
+		} else {
+			columns["condition"] = condition
+		}
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&policy).Updates(columns).Error; err != nil {
+		return err
+	}
+
+	s.notifyReload(ctx)
+	return nil
+}
+
+// DeletePolicy 删除策略
+func (s *PolicyService) DeletePolicy(ctx context.Context, id int) error {
+	if err := s.db.WithContext(ctx).Delete(&model.Policy{}, id).Error; err != nil {
+		return err
+	}
+
+	s.notifyReload(ctx)
+	return nil
+}
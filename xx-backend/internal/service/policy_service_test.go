@@ -0,0 +1,218 @@
+package service
+
+import (
+	"testing"
+
+	"xx-backend/internal/model"
+)
+
+func TestMatchPattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"*", "users", true},
+		{"users", "users", true},
+		{"users", "roles", false},
+		{"user*", "users", true},
+		{"user*", "user", true},
+		{"users*", "user", false},
+		{"", "", true},
+		{"", "users", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+"/"+tt.value, func(t *testing.T) {
+			if got := matchPattern(tt.pattern, tt.value); got != tt.want {
+				t.Errorf("matchPattern(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchSubject(t *testing.T) {
+	subject := map[string]interface{}{"id": 7, "roles": []string{"admin", "auditor"}}
+	tests := []struct {
+		pattern string
+		want    bool
+	}{
+		{"*", true},
+		{"user:7", true},
+		{"user:8", false},
+		{"admin", true},
+		{"auditor", true},
+		{"guest", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			if got := matchSubject(tt.pattern, subject); got != tt.want {
+				t.Errorf("matchSubject(%q) = %v, want %v", tt.pattern, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompileCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{condition: "", wantNil: true},
+		{condition: "   ", wantNil: true},
+		{condition: `sub.department == obj.department`},
+		{condition: `cidr(env.ip, "10.0.0.0/8")`},
+		{condition: `1 + 1`, wantErr: true},
+		{condition: `sub.id ==`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			program, err := compileCondition(tt.condition)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("compileCondition() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && (program == nil) != tt.wantNil {
+				t.Errorf("program = %v, wantNil %v", program, tt.wantNil)
+			}
+		})
+	}
+}
+
+func newTestPolicy(t *testing.T, id int, subject, object, action, effect, condition string) compiledPolicy {
+	t.Helper()
+	program, err := compileCondition(condition)
+	if err != nil {
+		t.Fatalf("compile %q: %v", condition, err)
+	}
+	return compiledPolicy{
+		policy: model.Policy{
+			ID: id, TenantID: 1, Subject: subject, Object: object, Action: action,
+			Effect: effect, Condition: condition,
+		},
+		program: program,
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	s := NewPolicyService(nil, nil, nil)
+	s.policies[1] = []compiledPolicy{
+		newTestPolicy(t, 1, "*", "documents", "read", model.PolicyEffectAllow, `obj.owner == sub.id`),
+		newTestPolicy(t, 2, "auditor", "documents", "*", model.PolicyEffectAllow, ""),
+		newTestPolicy(t, 3, "*", "documents", "*", model.PolicyEffectDeny, `obj.classified == true`),
+		newTestPolicy(t, 4, "*", "reports", "export", model.PolicyEffectAllow, `cidr(env.ip, "10.0.0.0/8")`),
+		newTestPolicy(t, 5, "user:9", "reports", "*", model.PolicyEffectDeny, ""),
+	}
+
+	tests := []struct {
+		name    string
+		req     AuthzRequest
+		want    string
+		matches int
+	}{
+		{
+			name: "condition satisfied",
+			req: AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 7}, Object: "documents", Action: "read",
+				ObjectAttrs: map[string]interface{}{"owner": 7}},
+			want:    DecisionAllow,
+			matches: 2,
+		},
+		{
+			name: "applicable but not satisfied",
+			req: AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 7}, Object: "documents", Action: "read",
+				ObjectAttrs: map[string]interface{}{"owner": 8}},
+			want:    DecisionDeny,
+			matches: 2,
+		},
+		{
+			name: "deny overrides allow",
+			req: AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 7, "roles": []string{"auditor"}}, Object: "documents", Action: "delete",
+				ObjectAttrs: map[string]interface{}{"classified": true}},
+			want:    DecisionDeny,
+			matches: 2,
+		},
+		{
+			name: "role based allow",
+			req: AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 7, "roles": []string{"auditor"}}, Object: "documents", Action: "delete",
+				ObjectAttrs: map[string]interface{}{"classified": false}},
+			want:    DecisionAllow,
+			matches: 2,
+		},
+		{
+			name: "environment condition",
+			req: AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 7}, Object: "reports", Action: "export",
+				Env: map[string]interface{}{"ip": "10.1.2.3"}},
+			want:    DecisionAllow,
+			matches: 1,
+		},
+		{
+			name: "user deny",
+			req: AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 9}, Object: "reports", Action: "export",
+				Env: map[string]interface{}{"ip": "10.1.2.3"}},
+			want:    DecisionDeny,
+			matches: 2,
+		},
+		{
+			name:    "no applicable policy",
+			req:     AuthzRequest{TenantID: 1, Subject: map[string]interface{}{"id": 7}, Object: "users", Action: "read"},
+			want:    DecisionNotApplicable,
+			matches: 0,
+		},
+		{
+			name:    "other tenant",
+			req:     AuthzRequest{TenantID: 2, Subject: map[string]interface{}{"id": 7}, Object: "documents", Action: "read"},
+			want:    DecisionNotApplicable,
+			matches: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := s.Evaluate(&tt.req)
+			if decision.Decision != tt.want {
+				t.Errorf("Decision = %s, want %s", decision.Decision, tt.want)
+			}
+			if len(decision.Matches) != tt.matches {
+				t.Errorf("len(Matches) = %d, want %d", len(decision.Matches), tt.matches)
+			}
+		})
+	}
+}
+
+func TestDecide(t *testing.T) {
+	s := &PolicyService{defaultDecision: DecisionDeny}
+	if err := s.SetDefaultDecision("maybe"); err == nil {
+		t.Error("SetDefaultDecision(maybe) should fail")
+	}
+
+	tests := []struct {
+		defaultDecision string
+		decision        string
+		want            string
+	}{
+		{"", DecisionNotApplicable, DecisionDeny},
+		{"deny", DecisionNotApplicable, DecisionDeny},
+		{" Allow ", DecisionNotApplicable, DecisionAllow},
+		{"allow", DecisionDeny, DecisionDeny},
+		{"deny", DecisionAllow, DecisionAllow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.defaultDecision+"/"+tt.decision, func(t *testing.T) {
+			s := NewPolicyService(nil, nil, nil)
+			if tt.defaultDecision != "" {
+				if err := s.SetDefaultDecision(tt.defaultDecision); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if got := s.Decide(&PolicyDecision{Decision: tt.decision}); got != tt.want {
+				t.Errorf("Decide(%s) = %s, want %s", tt.decision, got, tt.want)
+			}
+
+			// 解释接口的决策与中间件一致
+			decision := DecisionAllow
+			explainPolicy(&PolicyDecision{Decision: tt.decision}, s.Decide(&PolicyDecision{Decision: tt.decision}),
+				func(string) {}, func(string) { decision = DecisionDeny })
+			if decision != tt.want {
+				t.Errorf("explainPolicy(%s) = %s, want %s", tt.decision, decision, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,655 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"xx-backend/internal/model"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+)
+
+// RBACManifest 声明式RBAC配置，可以用YAML或JSON描述，用于在git中管理角色、菜单和权限
+type RBACManifest struct {
+	Permissions []ManifestPermission `json:"permissions" yaml:"permissions"`
+	Menus       []ManifestMenu       `json:"menus" yaml:"menus"`
+	Roles       []ManifestRole       `json:"roles" yaml:"roles"`
+}
+
+// ManifestPermission 权限，以 code 作为唯一标识
+type ManifestPermission struct {
+	Code        string `json:"code" yaml:"code"`
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// ManifestMenu 菜单，以 path 作为唯一标识，children 为子菜单
+type ManifestMenu struct {
+	Name      string         `json:"name" yaml:"name"`
+	Path      string         `json:"path" yaml:"path"`
+	Component string         `json:"component,omitempty" yaml:"component,omitempty"`
+	Icon      string         `json:"icon,omitempty" yaml:"icon,omitempty"`
+	Sort      int            `json:"sort,omitempty" yaml:"sort,omitempty"`
+	Status    *int           `json:"status,omitempty" yaml:"status,omitempty"` // 默认为1
+	Children  []ManifestMenu `json:"children,omitempty" yaml:"children,omitempty"`
+}
+
+// ManifestRole 角色，以 name 作为唯一标识，权限和菜单分别通过 code 和 path 引用
+type ManifestRole struct {
+	Name        string   `json:"name" yaml:"name"`
+	Description string   `json:"description,omitempty" yaml:"description,omitempty"`
+	Parent      string   `json:"parent,omitempty" yaml:"parent,omitempty"`
+	Status      *int     `json:"status,omitempty" yaml:"status,omitempty"`         // 默认为1
+	DataScope   string   `json:"data_scope,omitempty" yaml:"data_scope,omitempty"` // 默认为 all
+	Permissions []string `json:"permissions,omitempty" yaml:"permissions,omitempty"`
+	Menus       []string `json:"menus,omitempty" yaml:"menus,omitempty"`
+}
+
+// SyncOptions 同步选项
+type SyncOptions struct {
+	DryRun bool // 只计算差异，不修改数据库
+	Prune  bool // 删除配置中不存在的权限、菜单和角色
+	Deploy bool // 部署时按 RBAC_MANIFEST 同步，不受审批开关限制
+}
+
+// ErrRBACSyncRequiresApproval 修改角色权限需要审批时不能通过接口同步RBAC配置
+var ErrRBACSyncRequiresApproval = fmt.Errorf("%w: 修改角色权限需要审批，RBAC配置只能在部署时通过 RBAC_MANIFEST 同步", ErrConflict)
+
+// SyncChange 同步产生的一项变更
+type SyncChange struct {
+	Kind   string `json:"kind"`   // permission / menu / role
+	Action string `json:"action"` // create / update / delete
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SyncResult 同步结果
+type SyncResult struct {
+	DryRun  bool         `json:"dry_run"`
+	Changes []SyncChange `json:"changes"`
+}
+
+// errDryRun 预演模式下用于回滚事务
+var errDryRun = errors.New("dry run")
+
+// flatMenu 展开后的菜单，父菜单总是排在子菜单之前
+type flatMenu struct {
+	ManifestMenu
+	parent string
+}
+
+func flattenMenus(menus []ManifestMenu, parent string, out []flatMenu) []flatMenu {
+	for _, m := range menus {
+		out = append(out, flatMenu{ManifestMenu: m, parent: parent})
+		out = flattenMenus(m.Children, m.Path, out)
+	}
+	return out
+}
+
+// ParseRBACManifest 解析YAML或JSON格式的RBAC配置并校验引用关系
+func ParseRBACManifest(data []byte) (*RBACManifest, error) {
+	var manifest RBACManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("解析RBAC配置失败: %w", err)
+	}
+	if err := manifest.validate(); err != nil {
+		return nil, err
+	}
+	return &manifest, nil
+}
+
+func (m *RBACManifest) validate() error {
+	permissions := make(map[string]bool)
+	for _, p := range m.Permissions {
+		if p.Code == "" || p.Name == "" {
+			return fmt.Errorf("权限必须指定 code 和 name")
+		}
+		if permissions[p.Code] {
+			return fmt.Errorf("权限 %s 重复", p.Code)
+		}
+		permissions[p.Code] = true
+	}
+
+	menus := make(map[string]bool)
+	for _, menu := range flattenMenus(m.Menus, "", nil) {
+		if menu.Path == "" || menu.Name == "" {
+			return fmt.Errorf("菜单必须指定 path 和 name")
+		}
+		if menus[menu.Path] {
+			return fmt.Errorf("菜单 %s 重复", menu.Path)
+		}
+		menus[menu.Path] = true
+	}
+
+	parents := make(map[string]string)
+	for _, r := range m.Roles {
+		if r.Name == "" {
+			return fmt.Errorf("角色必须指定 name")
+		}
+		if _, ok := parents[r.Name]; ok {
+			return fmt.Errorf("角色 %s 重复", r.Name)
+		}
+		parents[r.Name] = r.Parent
+		if r.DataScope != "" && !model.IsValidDataScope(r.DataScope) {
+			return fmt.Errorf("角色 %s 的数据范围无效: %s", r.Name, r.DataScope)
+		}
+		for _, code := range r.Permissions {
+			if !permissions[code] {
+				return fmt.Errorf("角色 %s 引用了不存在的权限 %s", r.Name, code)
+			}
+		}
+		for _, path := range r.Menus {
+			if !menus[path] {
+				return fmt.Errorf("角色 %s 引用了不存在的菜单 %s", r.Name, path)
+			}
+		}
+	}
+
+	for name, parent := range parents {
+		if parent == "" {
+			continue
+		}
+		if _, ok := parents[parent]; !ok {
+			return fmt.Errorf("角色 %s 的父角色 %s 不存在", name, parent)
+		}
+		visited := map[string]bool{name: true}
+		for current := parent; current != ""; current = parents[current] {
+			if visited[current] {
+				return fmt.Errorf("角色 %s: %w", name, ErrRoleCycle)
+			}
+			visited[current] = true
+		}
+	}
+	return nil
+}
+
+// fieldDiff 比较字段并收集需要更新的列和差异描述
+type fieldDiff struct {
+	updates map[string]interface{}
+	details []string
+}
+
+func newFieldDiff() *fieldDiff {
+	return &fieldDiff{updates: make(map[string]interface{})}
+}
+
+func (d *fieldDiff) compare(column string, old, new interface{}) {
+	if reflect.DeepEqual(old, new) {
+		return
+	}
+	d.updates[column] = new
+	d.details = append(d.details, fmt.Sprintf("%s: %v -> %v", column, old, new))
+}
+
+func (d *fieldDiff) detail() string {
+	return strings.Join(d.details, ", ")
+}
+
+func statusOrDefault(status *int) int {
+	if status == nil {
+		return 1
+	}
+	return *status
+}
+
+// rbacReconciler 在一个事务中把数据库调整为与配置一致
+type rbacReconciler struct {
+	tx            *gorm.DB
+	prune         bool
+	result        *SyncResult
+	permissionIDs map[string]int
+	menuIDs       map[string]int
+}
+
+func (r *rbacReconciler) record(kind, action, name, detail string) {
+	r.result.Changes = append(r.result.Changes, SyncChange{Kind: kind, Action: action, Name: name, Detail: detail})
+}
+
+// SyncRBAC 按声明式配置同步当前租户的权限、菜单和角色，预演模式下在事务中执行后回滚。
+// 同步会直接修改角色的权限、菜单和父角色，无法拆分为变更请求，开启 role_permissions 审批时
+// 只允许部署时同步（opts.Deploy）和预演
+func (s *UserService) SyncRBAC(ctx context.Context, manifest *RBACManifest, opts SyncOptions) (*SyncResult, error) {
+	if !opts.DryRun && !opts.Deploy && s.needsApproval(ctx, model.ChangeRolePermissions) {
+		return nil, ErrRBACSyncRequiresApproval
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := &SyncResult{DryRun: opts.DryRun, Changes: []SyncChange{}}
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		r := &rbacReconciler{
+			tx:            tx,
+			prune:         opts.Prune,
+			result:        result,
+			permissionIDs: make(map[string]int),
+			menuIDs:       make(map[string]int),
+		}
+		if err := r.syncPermissions(manifest.Permissions); err != nil {
+			return err
+		}
+		if err := r.syncMenus(flattenMenus(manifest.Menus, "", nil)); err != nil {
+			return err
+		}
+		if err := r.syncRoles(manifest.Roles); err != nil {
+			return err
+		}
+		if opts.DryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return nil, err
+	}
+
+	if !opts.DryRun && len(result.Changes) > 0 {
+		s.roleCache.invalidateAll()
+	}
+	return result, nil
+}
+
+func (r *rbacReconciler) syncPermissions(permissions []ManifestPermission) error {
+	var existing []model.Permission
+	if err := r.tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	byCode := make(map[string]model.Permission, len(existing))
+	for _, p := range existing {
+		byCode[p.Code] = p
+	}
+
+	for _, p := range permissions {
+		current, ok := byCode[p.Code]
+		if !ok {
+			permission := model.Permission{Code: p.Code, Name: p.Name, Description: p.Description}
+			if err := r.tx.Create(&permission).Error; err != nil {
+				return err
+			}
+			r.permissionIDs[p.Code] = permission.ID
+			r.record("permission", "create", p.Code, "")
+			continue
+		}
+
+		r.permissionIDs[p.Code] = current.ID
+		diff := newFieldDiff()
+		diff.compare("name", current.Name, p.Name)
+		diff.compare("description", current.Description, p.Description)
+		if len(diff.updates) > 0 {
+			if err := r.tx.Model(&current).Updates(diff.updates).Error; err != nil {
+				return err
+			}
+			r.record("permission", "update", p.Code, diff.detail())
+		}
+	}
+
+	if !r.prune {
+		return nil
+	}
+	for _, p := range existing {
+		if _, ok := r.permissionIDs[p.Code]; ok {
+			continue
+		}
+		if err := r.tx.Exec("DELETE FROM role_permissions WHERE permission_id = ?", p.ID).Error; err != nil {
+			return err
+		}
+		if err := r.tx.Delete(&model.Permission{}, p.ID).Error; err != nil {
+			return err
+		}
+		r.record("permission", "delete", p.Code, "")
+	}
+	return nil
+}
+
+func (r *rbacReconciler) syncMenus(menus []flatMenu) error {
+	var existing []model.Menu
+	if err := r.tx.Find(&existing).Error; err != nil {
+		return err
+	}
+	byPath := make(map[string]model.Menu, len(existing))
+	paths := make(map[int]string, len(existing))
+	for _, m := range existing {
+		paths[m.ID] = m.Path
+		if m.Path != "" {
+			byPath[m.Path] = m
+		}
+	}
+
+	for _, m := range menus {
+		var parentID *int
+		if m.parent != "" {
+			id := r.menuIDs[m.parent]
+			parentID = &id
+		}
+
+		current, ok := byPath[m.Path]
+		if !ok {
+			menu := model.Menu{
+				Name:      m.Name,
+				Path:      m.Path,
+				Component: m.Component,
+				Icon:      m.Icon,
+				Sort:      m.Sort,
+				ParentID:  parentID,
+				Status:    statusOrDefault(m.Status),
+			}
+			if err := r.tx.Create(&menu).Error; err != nil {
+				return err
+			}
+			r.menuIDs[m.Path] = menu.ID
+			r.record("menu", "create", m.Path, "")
+			continue
+		}
+
+		r.menuIDs[m.Path] = current.ID
+		diff := newFieldDiff()
+		diff.compare("name", current.Name, m.Name)
+		diff.compare("component", current.Component, m.Component)
+		diff.compare("icon", current.Icon, m.Icon)
+		diff.compare("sort", current.Sort, m.Sort)
+		diff.compare("status", current.Status, statusOrDefault(m.Status))
+		currentParent := ""
+		if current.ParentID != nil {
+			currentParent = paths[*current.ParentID]
+		}
+		if currentParent != m.parent {
+			diff.updates["parent_id"] = parentID
+			diff.details = append(diff.details, fmt.Sprintf("parent: %q -> %q", currentParent, m.parent))
+		}
+		if len(diff.updates) > 0 {
+			if err := r.tx.Model(&current).Updates(diff.updates).Error; err != nil {
+				return err
+			}
+			r.record("menu", "update", m.Path, diff.detail())
+		}
+	}
+
+	if !r.prune {
+		return nil
+	}
+	// 没有 path 的菜单不受配置管理，不会被删除
+	var pruned []int
+	for _, m := range existing {
+		if _, ok := r.menuIDs[m.Path]; m.Path == "" || ok {
+			continue
+		}
+		pruned = append(pruned, m.ID)
+		r.record("menu", "delete", m.Path, "")
+	}
+	if len(pruned) == 0 {
+		return nil
+	}
+	if err := r.tx.Exec("DELETE FROM role_menus WHERE menu_id IN ?", pruned).Error; err != nil {
+		return err
+	}
+	if err := r.tx.Model(&model.Menu{}).Where("parent_id IN ? AND id NOT IN ?", pruned, pruned).Update("parent_id", nil).Error; err != nil {
+		return err
+	}
+	return r.tx.Delete(&model.Menu{}, pruned).Error
+}
+
+func (r *rbacReconciler) syncRoles(roles []ManifestRole) error {
+	var existing []model.Role
+	if err := r.tx.Preload("Permissions").Preload("Menus").Find(&existing).Error; err != nil {
+		return err
+	}
+	byName := make(map[string]*model.Role, len(existing))
+	names := make(map[int]string, len(existing))
+	for i := range existing {
+		byName[existing[i].Name] = &existing[i]
+		names[existing[i].ID] = existing[i].Name
+	}
+
+	// 第一遍创建或更新角色本身，第二遍再设置父角色和绑定关系
+	managed := make(map[string]*model.Role, len(roles))
+	for _, item := range roles {
+		dataScope := item.DataScope
+		if dataScope == "" {
+			dataScope = model.DataScopeAll
+		}
+
+		current, ok := byName[item.Name]
+		if !ok {
+			role := &model.Role{
+				Name:        item.Name,
+				Description: item.Description,
+				Status:      statusOrDefault(item.Status),
+				DataScope:   dataScope,
+			}
+			if err := r.tx.Omit("Permissions", "Menus").Create(role).Error; err != nil {
+				return err
+			}
+			managed[item.Name] = role
+			names[role.ID] = role.Name
+			r.record("role", "create", item.Name, "")
+			continue
+		}
+
+		managed[item.Name] = current
+		diff := newFieldDiff()
+		diff.compare("description", current.Description, item.Description)
+		diff.compare("status", current.Status, statusOrDefault(item.Status))
+		diff.compare("data_scope", current.DataScope, dataScope)
+		if len(diff.updates) > 0 {
+			if err := r.tx.Model(&model.Role{}).Where("id = ?", current.ID).Updates(diff.updates).Error; err != nil {
+				return err
+			}
+			r.record("role", "update", item.Name, diff.detail())
+		}
+	}
+
+	for _, item := range roles {
+		role := managed[item.Name]
+		diff := newFieldDiff()
+
+		currentParent := ""
+		if role.ParentID != nil {
+			currentParent = names[*role.ParentID]
+		}
+		if currentParent != item.Parent {
+			var parentID *int
+			if item.Parent != "" {
+				id := managed[item.Parent].ID
+				parentID = &id
+			}
+			if err := r.tx.Model(&model.Role{}).Where("id = ?", role.ID).Update("parent_id", parentID).Error; err != nil {
+				return err
+			}
+			diff.details = append(diff.details, fmt.Sprintf("parent: %q -> %q", currentParent, item.Parent))
+		}
+
+		currentCodes := make([]string, 0, len(role.Permissions))
+		for _, p := range role.Permissions {
+			currentCodes = append(currentCodes, p.Code)
+		}
+		if !sameStrings(currentCodes, item.Permissions) {
+			ids := make([]int, 0, len(item.Permissions))
+			for _, code := range item.Permissions {
+				ids = append(ids, r.permissionIDs[code])
+			}
+			var permissions []model.Permission
+			if len(ids) > 0 {
+				if err := r.tx.Find(&permissions, ids).Error; err != nil {
+					return err
+				}
+			}
+			if err := r.tx.Model(role).Association("Permissions").Replace(permissions); err != nil {
+				return err
+			}
+			diff.details = append(diff.details, fmt.Sprintf("permissions: %v -> %v", sortedStrings(currentCodes), sortedStrings(item.Permissions)))
+		}
+
+		currentPaths := make([]string, 0, len(role.Menus))
+		for _, m := range role.Menus {
+			currentPaths = append(currentPaths, m.Path)
+		}
+		if !sameStrings(currentPaths, item.Menus) {
+			ids := make([]int, 0, len(item.Menus))
+			for _, path := range item.Menus {
+				ids = append(ids, r.menuIDs[path])
+			}
+			var menus []model.Menu
+			if len(ids) > 0 {
+				if err := r.tx.Find(&menus, ids).Error; err != nil {
+					return err
+				}
+			}
+			if err := r.tx.Model(role).Association("Menus").Replace(menus); err != nil {
+				return err
+			}
+			diff.details = append(diff.details, fmt.Sprintf("menus: %v -> %v", sortedStrings(currentPaths), sortedStrings(item.Menus)))
+		}
+
+		if len(diff.details) > 0 {
+			r.record("role", "update", item.Name, diff.detail())
+		}
+	}
+
+	if !r.prune {
+		return nil
+	}
+	var pruned []int
+	for _, role := range existing {
+		if _, ok := managed[role.Name]; !ok {
+			pruned = append(pruned, role.ID)
+		}
+	}
+	for _, role := range existing {
+		if _, ok := managed[role.Name]; ok {
+			continue
+		}
+		// 与删除角色相同的引用检查，同时删除的子角色不计入
+		refs, err := findRoleReferences(r.tx, role.ID, pruned...)
+		if err != nil {
+			return err
+		}
+		if refs.inUse() {
+			return fmt.Errorf("%w: 角色 %s 仍被%s引用，不能删除", ErrConflict, role.Name, refs)
+		}
+		for _, association := range []string{"Permissions", "Menus", "DataScopeDepartments", "DataScopeGroups"} {
+			if err := r.tx.Model(&role).Association(association).Clear(); err != nil {
+				return err
+			}
+		}
+		if err := softDelete(r.tx, &model.Role{}, role.ID, 0); err != nil {
+			return err
+		}
+		r.record("role", "delete", role.Name, "")
+	}
+	return nil
+}
+
+func sortedStrings(values []string) []string {
+	result := append([]string{}, values...)
+	sort.Strings(result)
+	return result
+}
+
+func sameStrings(a, b []string) bool {
+	return reflect.DeepEqual(sortedStrings(uniqueStrings(a)), sortedStrings(uniqueStrings(b)))
+}
+
+func uniqueStrings(values []string) []string {
+	return mergeStrings(nil, values)
+}
+
+// ExportRBAC 导出当前租户的权限、菜单和角色，格式与 SyncRBAC 使用的配置一致
+func (s *UserService) ExportRBAC(ctx context.Context) (*RBACManifest, error) {
+	manifest := &RBACManifest{
+		Permissions: []ManifestPermission{},
+		Menus:       []ManifestMenu{},
+		Roles:       []ManifestRole{},
+	}
+
+	var permissions []model.Permission
+	if err := s.db.WithContext(ctx).Order("code").Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range permissions {
+		manifest.Permissions = append(manifest.Permissions, ManifestPermission{
+			Code:        p.Code,
+			Name:        p.Name,
+			Description: p.Description,
+		})
+	}
+
+	var menus []model.Menu
+	if err := s.db.WithContext(ctx).Order("sort, id").Find(&menus).Error; err != nil {
+		return nil, err
+	}
+	children := make(map[int][]model.Menu)
+	var roots []model.Menu
+	exists := make(map[int]bool, len(menus))
+	for _, m := range menus {
+		exists[m.ID] = true
+	}
+	for _, m := range menus {
+		if m.ParentID != nil && exists[*m.ParentID] {
+			children[*m.ParentID] = append(children[*m.ParentID], m)
+		} else {
+			roots = append(roots, m)
+		}
+	}
+	var build func(list []model.Menu) []ManifestMenu
+	build = func(list []model.Menu) []ManifestMenu {
+		result := make([]ManifestMenu, 0, len(list))
+		for _, m := range list {
+			item := ManifestMenu{
+				Name:      m.Name,
+				Path:      m.Path,
+				Component: m.Component,
+				Icon:      m.Icon,
+				Sort:      m.Sort,
+				Children:  build(children[m.ID]),
+			}
+			if m.Status != 1 {
+				status := m.Status
+				item.Status = &status
+			}
+			result = append(result, item)
+		}
+		return result
+	}
+	manifest.Menus = build(roots)
+
+	var roles []model.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Preload("Menus").Order("id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[int]string, len(roles))
+	for _, r := range roles {
+		names[r.ID] = r.Name
+	}
+	for _, r := range roles {
+		item := ManifestRole{
+			Name:        r.Name,
+			Description: r.Description,
+		}
+		if r.DataScope != model.DataScopeAll {
+			item.DataScope = r.DataScope
+		}
+		if r.ParentID != nil {
+			item.Parent = names[*r.ParentID]
+		}
+		if r.Status != 1 {
+			status := r.Status
+			item.Status = &status
+		}
+		for _, p := range r.Permissions {
+			item.Permissions = append(item.Permissions, p.Code)
+		}
+		for _, m := range r.Menus {
+			item.Menus = append(item.Menus, m.Path)
+		}
+		sort.Strings(item.Permissions)
+		sort.Strings(item.Menus)
+		manifest.Roles = append(manifest.Roles, item)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,358 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+)
+
+// 回收站支持的资源类型
+const (
+	RecycleUsers = "users"
+	RecycleRoles = "roles"
+	RecycleMenus = "menus"
+)
+
+// DeletedUser 回收站中的用户，deleted_at 为删除时间
+type DeletedUser struct {
+	model.User
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (DeletedUser) TableName() string { return "users" }
+
+// DeletedRole 回收站中的角色
+type DeletedRole struct {
+	model.Role
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (DeletedRole) TableName() string { return "roles" }
+
+// DeletedMenu 回收站中的菜单
+type DeletedMenu struct {
+	model.Menu
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+func (DeletedMenu) TableName() string { return "menus" }
+
+// softDelete 软删除记录，同时把 deleted_key 设为记录ID，使其不再占用唯一索引（用于用户和角色）。
+// version 不为0时只删除该版本的记录
+func softDelete(tx *gorm.DB, value interface{}, id interface{}, version int) error {
+	return updateVersioned(tx, value, id, version, map[string]interface{}{
+		"deleted_at":  time.Now(),
+		"deleted_key": gorm.Expr("id"),
+	})
+}
+
+// deleted 只查询已软删除的记录
+func deleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where("deleted_at IS NOT NULL")
+}
+
+// GetDeletedUsers 获取回收站中操作人数据范围内的用户
+func (s *UserService) GetDeletedUsers(ctx context.Context, operatorID int, q *listquery.Query) (*listquery.Result[DeletedUser], error) {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	result, err := listquery.Find[DeletedUser](s.db.WithContext(ctx).Scopes(deleted, scope.apply), q)
+	if err != nil {
+		return nil, err
+	}
+	users := make([]*model.User, len(result.List))
+	for i := range result.List {
+		users[i] = &result.List[i].User
+	}
+	if err := s.hideSensitiveAttributes(ctx, operatorID, users...); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// GetDeletedRoles 获取回收站中的角色
+func (s *UserService) GetDeletedRoles(ctx context.Context, q *listquery.Query) (*listquery.Result[DeletedRole], error) {
+	return listquery.Find[DeletedRole](s.db.WithContext(ctx).Scopes(deleted), q)
+}
+
+// GetDeletedMenus 获取回收站中的菜单
+func (s *UserService) GetDeletedMenus(ctx context.Context, q *listquery.Query) (*listquery.Result[DeletedMenu], error) {
+	return listquery.Find[DeletedMenu](s.db.WithContext(ctx).Scopes(deleted), q)
+}
+
+// RestoreRecord 从回收站恢复记录。用户名、邮箱或角色名已被占用，或依赖的角色、部门、上级菜单已被删除时返回冲突
+func (s *UserService) RestoreRecord(ctx context.Context, operatorID int, kind string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	switch kind {
+	case RecycleUsers:
+		err = s.restoreUser(ctx, operatorID, id)
+	case RecycleRoles:
+		err = s.restoreRole(ctx, id)
+	case RecycleMenus:
+		err = s.restoreMenu(ctx, id)
+	default:
+		return fmt.Errorf("不支持的回收站类型: %s", kind)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.logRecycleBin(kind, id, "restore", uint(operatorID))
+	return nil
+}
+
+func (s *UserService) restoreUser(ctx context.Context, operatorID, id int) error {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return err
+	}
+
+	var user model.User
+	if err := s.db.WithContext(ctx).Scopes(deleted, scope.apply).First(&user, id).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	query := s.db.WithContext(ctx).Model(&model.User{}).Where("username = ?", user.Username)
+	if user.Email != "" {
+		query = query.Or("email = ?", user.Email)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 用户名或邮箱已被其他用户使用", ErrConflict)
+	}
+
+	if err := s.db.WithContext(ctx).First(&model.Role{}, user.RoleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: 用户的角色已被删除，请先恢复角色", ErrConflict)
+		}
+		return err
+	}
+	if user.DepartmentID != nil {
+		if err := s.db.WithContext(ctx).First(&model.Department{}, *user.DepartmentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 用户所在的部门已被删除", ErrConflict)
+			}
+			return err
+		}
+	}
+
+	if err := s.undelete(ctx, &model.User{}, id); err != nil {
+		return err
+	}
+	s.roleCache.invalidateUser(user.ID)
+	return nil
+}
+
+func (s *UserService) restoreRole(ctx context.Context, id int) error {
+	var role model.Role
+	if err := s.db.WithContext(ctx).Scopes(deleted).First(&role, id).Error; err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Role{}).Where("name = ?", role.Name).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 角色名已被其他角色使用", ErrConflict)
+	}
+	if role.ParentID != nil {
+		if err := s.db.WithContext(ctx).First(&model.Role{}, *role.ParentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 父角色已被删除，请先恢复父角色", ErrConflict)
+			}
+			return err
+		}
+	}
+
+	if err := s.undelete(ctx, &model.Role{}, id); err != nil {
+		return err
+	}
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+func (s *UserService) restoreMenu(ctx context.Context, id int) error {
+	var menu model.Menu
+	if err := s.db.WithContext(ctx).Scopes(deleted).First(&menu, id).Error; err != nil {
+		return err
+	}
+
+	if menu.ParentID != nil {
+		if err := s.db.WithContext(ctx).First(&model.Menu{}, *menu.ParentID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return fmt.Errorf("%w: 上级菜单已被删除，请先恢复上级菜单", ErrConflict)
+			}
+			return err
+		}
+	}
+
+	if err := s.db.WithContext(ctx).Unscoped().Model(&model.Menu{}).Where("id = ?", id).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+// undelete 恢复用户或角色，清除 deleted_at 和 deleted_key
+func (s *UserService) undelete(ctx context.Context, value interface{}, id int) error {
+	return s.db.WithContext(ctx).Unscoped().Model(value).Where("id = ?", id).Updates(map[string]interface{}{
+		"deleted_at":  nil,
+		"deleted_key": 0,
+	}).Error
+}
+
+// PurgeRecord 从回收站永久删除记录
+func (s *UserService) PurgeRecord(ctx context.Context, operatorID int, kind string, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db := s.db.WithContext(ctx).Scopes(deleted)
+	switch kind {
+	case RecycleUsers:
+		scope, err := s.resolveDataScope(ctx, operatorID)
+		if err != nil {
+			return err
+		}
+		db = db.Scopes(scope.apply)
+		if err := db.First(&model.User{}, id).Error; err != nil {
+			return err
+		}
+	case RecycleRoles:
+		if err := db.First(&model.Role{}, id).Error; err != nil {
+			return err
+		}
+	case RecycleMenus:
+		if err := db.First(&model.Menu{}, id).Error; err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("不支持的回收站类型: %s", kind)
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return purge(tx, kind, []int{id})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.logRecycleBin(kind, id, "purge", uint(operatorID))
+	return nil
+}
+
+// purge 永久删除已软删除的记录及其关联数据
+func purge(tx *gorm.DB, kind string, ids []int) error {
+	switch kind {
+	case RecycleUsers:
+		if err := tx.Where("user_id IN ?", ids).Delete(&model.RoleGrant{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM group_members WHERE user_id IN ?", ids).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id IN ?", ids).Delete(&model.LoginRecord{}).Error; err != nil {
+			return err
+		}
+		return tx.Scopes(deleted).Delete(&model.User{}, ids).Error
+	case RecycleRoles:
+		for _, table := range []string{"role_permissions", "role_menus", "role_data_scope_departments", "role_data_scope_groups", "group_roles", "lifecycle_policy_exempt_roles"} {
+			if err := tx.Exec("DELETE FROM "+table+" WHERE role_id IN ?", ids).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Scopes(deleted).Delete(&model.Role{}, ids).Error
+	case RecycleMenus:
+		if err := tx.Exec("DELETE FROM role_menus WHERE menu_id IN ?", ids).Error; err != nil {
+			return err
+		}
+		return tx.Scopes(deleted).Delete(&model.Menu{}, ids).Error
+	}
+	return fmt.Errorf("不支持的回收站类型: %s", kind)
+}
+
+// PurgeExpiredRecords 永久删除所有租户中删除时间早于 retention 的用户、角色和菜单，返回删除的数量
+func (s *UserService) PurgeExpiredRecords(ctx context.Context, retention time.Duration) (int, error) {
+	ctx = tenant.WithoutTenant(ctx)
+	cutoff := time.Now().Add(-retention)
+
+	total := 0
+	for _, item := range []struct {
+		kind  string
+		model interface{}
+	}{
+		{RecycleUsers, &model.User{}},
+		{RecycleRoles, &model.Role{}},
+		{RecycleMenus, &model.Menu{}},
+	} {
+		var ids []int
+		err := s.db.WithContext(ctx).Unscoped().Model(item.model).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+			Pluck("id", &ids).Error
+		if err != nil {
+			return total, err
+		}
+		if len(ids) == 0 {
+			continue
+		}
+
+		err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+			return purge(tx, item.kind, ids)
+		})
+		if err != nil {
+			return total, err
+		}
+		for _, id := range ids {
+			s.logRecycleBin(item.kind, id, "purge", 0)
+		}
+		total += len(ids)
+	}
+	return total, nil
+}
+
+// StartRecycleBinPurgeJob 启动后台任务，定期永久删除回收站中超过保留期的记录
+func (s *UserService) StartRecycleBinPurgeJob(ctx context.Context, interval, retention time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				count, err := s.PurgeExpiredRecords(ctx, retention)
+				if err != nil {
+					log.Printf("Failed to purge recycle bin: %v", err)
+					continue
+				}
+				if count > 0 {
+					log.Printf("Purged %d expired records from recycle bin", count)
+				}
+			}
+		}
+	}()
+}
+
+func (s *UserService) logRecycleBin(kind string, id int, action string, operatorID uint) {
+	// 记录回收站事件到Kafka
+	if s.kafkaService != nil {
+		if err := s.kafkaService.LogRecycleBin(kind, id, action, operatorID); err != nil {
+			fmt.Printf("Failed to log recycle bin to Kafka: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+
+	"gorm.io/gorm"
+)
+
+// ErrRoleCycle 角色继承关系出现循环
+var ErrRoleCycle = fmt.Errorf("%w: 角色继承关系不能形成循环", ErrConflict)
+
+// EffectivePermissions 角色的有效权限（包含从父角色继承的权限和菜单）
+type EffectivePermissions struct {
+	RoleID      int                `json:"role_id"`
+	Ancestors   []int              `json:"ancestors"` // 从直接父角色到根角色
+	Roles       []string           `json:"roles"`     // 角色自身及所有祖先角色的名称
+	Permissions []model.Permission `json:"permissions"`
+	Menus       []model.Menu       `json:"menus"`
+}
+
+// HasPermission 判断是否拥有指定权限
+func (e *EffectivePermissions) HasPermission(code string) bool {
+	for _, p := range e.Permissions {
+		if p.Code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// roleCache 角色有效权限缓存，父角色变更时需要连同所有子孙角色一起失效。
+// 同时缓存用户的有效权限（主角色加限时授权），任何角色变更都会清空用户缓存。
+type roleCache struct {
+	mu         sync.RWMutex
+	generation uint64
+	entries    map[int]*EffectivePermissions
+	users      map[uint]userPermissionEntry
+}
+
+type userPermissionEntry struct {
+	permissions *EffectivePermissions
+	expiresAt   time.Time // 限时授权生效或到期时缓存必须重新计算
+}
+
+func newRoleCache() *roleCache {
+	return &roleCache{
+		entries: make(map[int]*EffectivePermissions),
+		users:   make(map[uint]userPermissionEntry),
+	}
+}
+
+func (c *roleCache) getUser(userID uint, now time.Time) (*EffectivePermissions, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	entry, ok := c.users[userID]
+	if !ok || !now.Before(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.permissions, true
+}
+
+func (c *roleCache) setUserIfFresh(generation uint64, userID uint, ep *EffectivePermissions, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.users[userID] = userPermissionEntry{permissions: ep, expiresAt: expiresAt}
+	}
+}
+
+func (c *roleCache) invalidateUser(userID uint) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	delete(c.users, userID)
+}
+
+func (c *roleCache) get(roleID int) (*EffectivePermissions, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	ep, ok := c.entries[roleID]
+	return ep, ok
+}
+
+func (c *roleCache) currentGeneration() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.generation
+}
+
+// setIfFresh 仅当计算期间没有发生失效时才写入缓存，避免写入过期数据
+func (c *roleCache) setIfFresh(generation uint64, roleID int, ep *EffectivePermissions) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generation == generation {
+		c.entries[roleID] = ep
+	}
+}
+
+func (c *roleCache) invalidate(roleIDs ...int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, id := range roleIDs {
+		delete(c.entries, id)
+	}
+	c.users = make(map[uint]userPermissionEntry)
+}
+
+func (c *roleCache) invalidateAll() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	c.entries = make(map[int]*EffectivePermissions)
+	c.users = make(map[uint]userPermissionEntry)
+}
+
+// GetEffectivePermissions 获取角色的有效权限（带缓存）
+func (s *UserService) GetEffectivePermissions(ctx context.Context, roleID int) (*EffectivePermissions, error) {
+	return s.resolvePermissions(ctx, roleID, s.roleCache.currentGeneration(), make(map[int]bool))
+}
+
+func (s *UserService) resolvePermissions(ctx context.Context, roleID int, generation uint64, visiting map[int]bool) (*EffectivePermissions, error) {
+	if ep, ok := s.roleCache.get(roleID); ok {
+		return ep, nil
+	}
+	if visiting[roleID] {
+		return nil, ErrRoleCycle
+	}
+	visiting[roleID] = true
+
+	var role model.Role
+	if err := s.db.WithContext(ctx).Preload("Permissions").Preload("Menus").First(&role, roleID).Error; err != nil {
+		return nil, err
+	}
+
+	ep := &EffectivePermissions{
+		RoleID:      role.ID,
+		Ancestors:   []int{},
+		Roles:       []string{role.Name},
+		Permissions: role.Permissions,
+		Menus:       role.Menus,
+	}
+
+	if role.ParentID != nil {
+		parent, err := s.resolvePermissions(ctx, *role.ParentID, generation, visiting)
+		switch {
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// 父角色已被删除，视为没有父角色
+		case err != nil:
+			return nil, err
+		default:
+			ep.Ancestors = append([]int{*role.ParentID}, parent.Ancestors...)
+			ep.Roles = append(ep.Roles, parent.Roles...)
+			ep.Permissions = mergePermissions(ep.Permissions, parent.Permissions)
+			ep.Menus = mergeMenus(ep.Menus, parent.Menus)
+		}
+	}
+
+	sort.Slice(ep.Menus, func(i, j int) bool { return ep.Menus[i].Sort < ep.Menus[j].Sort })
+
+	s.roleCache.setIfFresh(generation, roleID, ep)
+	return ep, nil
+}
+
+func mergePermissions(own, inherited []model.Permission) []model.Permission {
+	result := make([]model.Permission, 0, len(own)+len(inherited))
+	seen := make(map[int]bool)
+	for _, list := range [][]model.Permission{own, inherited} {
+		for _, p := range list {
+			if !seen[p.ID] {
+				seen[p.ID] = true
+				result = append(result, p)
+			}
+		}
+	}
+	return result
+}
+
+func mergeMenus(own, inherited []model.Menu) []model.Menu {
+	result := make([]model.Menu, 0, len(own)+len(inherited))
+	seen := make(map[int]bool)
+	for _, list := range [][]model.Menu{own, inherited} {
+		for _, m := range list {
+			if !seen[m.ID] {
+				seen[m.ID] = true
+				result = append(result, m)
+			}
+		}
+	}
+	return result
+}
+
+// roleDescendants 获取角色的所有子孙角色ID
+func (s *UserService) roleDescendants(ctx context.Context, roleID int) ([]int, error) {
+	var roles []model.Role
+	if err := s.db.WithContext(ctx).Select("id", "parent_id").Find(&roles).Error; err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]int)
+	for _, r := range roles {
+		if r.ParentID != nil {
+			children[*r.ParentID] = append(children[*r.ParentID], r.ID)
+		}
+	}
+
+	return collectDescendants(children, roleID), nil
+}
+
+// invalidateRoleTree 使角色及其所有子孙角色的权限缓存失效
+func (s *UserService) invalidateRoleTree(ctx context.Context, roleID int) {
+	descendants, err := s.roleDescendants(ctx, roleID)
+	if err != nil {
+		// 无法确定子孙角色时清空全部缓存
+		s.roleCache.invalidateAll()
+		return
+	}
+	s.roleCache.invalidate(append(descendants, roleID)...)
+}
+
+// checkRoleParent 校验父角色存在且不会形成循环
+func (s *UserService) checkRoleParent(ctx context.Context, roleID int, parentID int) error {
+	if roleID != 0 && parentID == roleID {
+		return ErrRoleCycle
+	}
+
+	visited := make(map[int]bool)
+	current := parentID
+	for {
+		if visited[current] {
+			return ErrRoleCycle
+		}
+		visited[current] = true
+
+		var role model.Role
+		if err := s.db.WithContext(ctx).Select("id", "parent_id").First(&role, current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) && current == parentID {
+				return fmt.Errorf("父角色不存在")
+			}
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			return err
+		}
+		if role.ParentID == nil {
+			return nil
+		}
+		if roleID != 0 && *role.ParentID == roleID {
+			return ErrRoleCycle
+		}
+		current = *role.ParentID
+	}
+}
+
+// SetRolePermissions 设置角色直接拥有的权限，需要审批时校验后提交变更请求，返回 ApprovalRequiredError
+func (s *UserService) SetRolePermissions(ctx context.Context, operatorID, roleID int, permissionIDs []int) error {
+	approval := s.needsApproval(ctx, model.ChangeRolePermissions)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, roleID).Error; err != nil {
+		return err
+	}
+
+	var permissions []model.Permission
+	if len(permissionIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&permissions, permissionIDs).Error; err != nil {
+			return err
+		}
+		if len(permissions) != len(uniqueInts(permissionIDs)) {
+			return FieldErrors{"permission_ids": "部分权限不存在"}
+		}
+	}
+	if approval {
+		payload := map[string][]int{"permission_ids": permissionIDs}
+		return s.submitForApproval(ctx, operatorID, model.ChangeRolePermissions, roleID, payload)
+	}
+
+	if err := s.db.WithContext(ctx).Model(&role).Association("Permissions").Replace(&permissions); err != nil {
+		return err
+	}
+
+	s.invalidateRoleTree(ctx, roleID)
+	return nil
+}
+
+// SetRoleMenus 设置角色直接拥有的菜单，菜单随角色继承，按修改角色权限决定是否需要审批。
+// 需要审批时校验后提交变更请求，返回 ApprovalRequiredError
+func (s *UserService) SetRoleMenus(ctx context.Context, operatorID, roleID int, menuIDs []int) error {
+	approval := s.needsApproval(ctx, model.ChangeRoleMenus)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, roleID).Error; err != nil {
+		return err
+	}
+
+	var menus []model.Menu
+	if len(menuIDs) > 0 {
+		if err := s.db.WithContext(ctx).Find(&menus, menuIDs).Error; err != nil {
+			return err
+		}
+		if len(menus) != len(uniqueInts(menuIDs)) {
+			return FieldErrors{"menu_ids": "部分菜单不存在"}
+		}
+	}
+	if approval {
+		payload := map[string][]int{"menu_ids": menuIDs}
+		return s.submitForApproval(ctx, operatorID, model.ChangeRoleMenus, roleID, payload)
+	}
+
+	if err := s.db.WithContext(ctx).Model(&role).Association("Menus").Replace(&menus); err != nil {
+		return err
+	}
+
+	s.invalidateRoleTree(ctx, roleID)
+	return nil
+}
+
+// GetPermissions 获取权限列表
+func (s *UserService) GetPermissions(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Permission], error) {
+	return listquery.Find[model.Permission](s.db.WithContext(ctx), q)
+}
+
+// CreatePermission 创建权限
+func (s *UserService) CreatePermission(ctx context.Context, permission *model.Permission) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.db.WithContext(ctx).Create(permission).Error
+}
+
+// DeletePermission 删除权限
+func (s *UserService) DeletePermission(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var permission model.Permission
+	if err := s.db.WithContext(ctx).First(&permission, id).Error; err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Exec("DELETE FROM role_permissions WHERE permission_id = ?", id).Error; err != nil {
+		return err
+	}
+	if err := s.db.WithContext(ctx).Delete(&permission).Error; err != nil {
+		return err
+	}
+
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+func uniqueInts(values []int) []int {
+	seen := make(map[int]bool, len(values))
+	result := make([]int, 0, len(values))
+	for _, v := range values {
+		if !seen[v] {
+			seen[v] = true
+			result = append(result, v)
+		}
+	}
+	return result
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"xx-backend/internal/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+)
+
+// fakeRoles 用内存中的角色替换查询回调，按主键返回 id 和 parent_id
+func fakeRoles(t *testing.T, parents map[int]*int) *gorm.DB {
+	t.Helper()
+	db := dryRunDB(t)
+	err := db.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+		role, ok := tx.Statement.Dest.(*model.Role)
+		if !ok {
+			tx.AddError(errors.New("unexpected query"))
+			return
+		}
+		callbacks.BuildQuerySQL(tx)
+		var id int
+		for _, v := range tx.Statement.Vars {
+			if n, ok := v.(int); ok {
+				id = n
+				break
+			}
+		}
+		parent, exists := parents[id]
+		if !exists {
+			tx.AddError(gorm.ErrRecordNotFound)
+			return
+		}
+		role.ID, role.ParentID = id, parent
+		tx.RowsAffected = 1
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestCheckRoleParent(t *testing.T) {
+	id := func(n int) *int { return &n }
+	// 1 <- 2 <- 3，4 的父角色 99 已被删除
+	parents := map[int]*int{1: nil, 2: id(1), 3: id(2), 4: id(99)}
+	s := NewUserService(fakeRoles(t, parents), nil, nil)
+
+	tests := []struct {
+		name     string
+		roleID   int
+		parentID int
+		wantErr  error
+		wantMsg  string
+	}{
+		{name: "new role", roleID: 0, parentID: 3},
+		{name: "valid parent", roleID: 1, parentID: 4},
+		{name: "self parent", roleID: 2, parentID: 2, wantErr: ErrRoleCycle},
+		{name: "direct cycle", roleID: 1, parentID: 2, wantErr: ErrRoleCycle},
+		{name: "indirect cycle", roleID: 1, parentID: 3, wantErr: ErrRoleCycle},
+		{name: "parent not found", roleID: 1, parentID: 50, wantMsg: "父角色不存在"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.checkRoleParent(context.Background(), tt.roleID, tt.parentID)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) || !errors.Is(err, ErrConflict) {
+					t.Errorf("error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.wantMsg != "":
+				if err == nil || err.Error() != tt.wantMsg {
+					t.Errorf("error = %v, want %q", err, tt.wantMsg)
+				}
+			case err != nil:
+				t.Errorf("error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,669 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/tenant"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/analyzer/custom"
+	"github.com/blevesearch/bleve/v2/analysis/lang/cjk"
+	"github.com/blevesearch/bleve/v2/analysis/token/lowercase"
+	bleveregexp "github.com/blevesearch/bleve/v2/analysis/tokenizer/regexp"
+	"github.com/blevesearch/bleve/v2/mapping"
+	"github.com/blevesearch/bleve/v2/search/highlight/highlighter/html"
+	"github.com/blevesearch/bleve/v2/search/query"
+	"gorm.io/gorm"
+)
+
+// ErrSearchDisabled 未启用全文搜索，处理器应返回503
+var ErrSearchDisabled = errors.New("未启用全文搜索")
+
+// ErrInvalidSearch 搜索参数错误，处理器应返回400
+var ErrInvalidSearch = errors.New("搜索参数错误")
+
+// searchSyncChannel 用户索引变更通知频道，其他实例收到后从数据库重新加载对应用户
+const searchSyncChannel = "search:users"
+
+// 全文搜索的字段，也是返回高亮片段的字段
+var userSearchFields = []string{"username", "nickname", "email"}
+
+// userTextPattern 按标点、符号和空白切分，连续的中日韩文字单独成词，再由 cjk_bigram 切成单字和二元组，
+// 使用户名 zhang_san01、邮箱 alice.wang@example.com 和中文昵称的片段都能匹配
+const userTextPattern = `[\p{Han}\p{Hangul}\p{Hiragana}\p{Katakana}]+|[^\s\p{P}\p{S}\p{Han}\p{Hangul}\p{Hiragana}\p{Katakana}]+`
+
+var userTextRegexp = regexp.MustCompile(userTextPattern)
+
+const (
+	searchMaxPageSize = 100
+	searchBatchSize   = 500
+)
+
+// UserSearchRequest 用户全文搜索参数
+type UserSearchRequest struct {
+	Query    string
+	Page     int
+	PageSize int
+}
+
+// UserSearchHit 一条搜索结果，highlights 为命中字段的高亮片段（命中部分用 <mark> 标记）
+type UserSearchHit struct {
+	User       model.User          `json:"user"`
+	Score      float64             `json:"score"`
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// UserSearchResult 用户全文搜索结果
+type UserSearchResult struct {
+	List     []UserSearchHit `json:"list"`
+	Total    uint64          `json:"total"`
+	Page     int             `json:"page"`
+	PageSize int             `json:"page_size"`
+}
+
+// userSearchDocument 索引中的用户文档
+type userSearchDocument struct {
+	ID           uint       `json:"id"`
+	TenantID     uint       `json:"tenant_id"`
+	Username     string     `json:"username"`
+	Nickname     string     `json:"nickname"`
+	Email        string     `json:"email"`
+	DepartmentID *int       `json:"department_id"`
+	DeletedAt    *time.Time `json:"deleted_at"`
+}
+
+func newUserSearchDocument(user *model.User) userSearchDocument {
+	return userSearchDocument{
+		ID:           user.ID,
+		TenantID:     user.TenantID,
+		Username:     user.Username,
+		Nickname:     user.Nickname,
+		Email:        user.Email,
+		DepartmentID: user.DepartmentID,
+	}
+}
+
+func (d userSearchDocument) fields() map[string]interface{} {
+	fields := map[string]interface{}{
+		"tenant_id": strconv.FormatUint(uint64(d.TenantID), 10),
+		"username":  d.Username,
+		"nickname":  d.Nickname,
+		"email":     d.Email,
+	}
+	if d.DepartmentID != nil {
+		fields["department_id"] = strconv.Itoa(*d.DepartmentID)
+	}
+	return fields
+}
+
+func searchDocID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+// userSearchIndex 用户全文索引（bleve），path 为空时只保存在内存中
+type userSearchIndex struct {
+	mu       sync.RWMutex
+	index    bleve.Index
+	path     string
+	instance string        // 本实例标识，忽略自己发出的变更通知
+	pending  map[uint]bool // 重建期间发生变更的用户，重建完成后重新加载
+	building bool
+}
+
+func newUserIndexMapping() (mapping.IndexMapping, error) {
+	im := bleve.NewIndexMapping()
+	if err := im.AddCustomTokenizer("user_text", map[string]interface{}{
+		"type":   bleveregexp.Name,
+		"regexp": userTextPattern,
+	}); err != nil {
+		return nil, err
+	}
+	if err := im.AddCustomTokenFilter("cjk_bigram_unigram", map[string]interface{}{
+		"type":           cjk.BigramName,
+		"output_unigram": true,
+	}); err != nil {
+		return nil, err
+	}
+	if err := im.AddCustomAnalyzer("user_text", map[string]interface{}{
+		"type":          custom.Name,
+		"tokenizer":     "user_text",
+		"token_filters": []string{cjk.WidthName, lowercase.Name, "cjk_bigram_unigram"},
+	}); err != nil {
+		return nil, err
+	}
+
+	doc := bleve.NewDocumentStaticMapping()
+	for _, name := range userSearchFields {
+		field := bleve.NewTextFieldMapping()
+		field.Analyzer = "user_text"
+		field.Store = true
+		field.IncludeTermVectors = true
+		doc.AddFieldMappingsAt(name, field)
+	}
+	for _, name := range []string{"tenant_id", "department_id"} {
+		field := bleve.NewKeywordFieldMapping()
+		field.Store = false
+		field.IncludeInAll = false
+		doc.AddFieldMappingsAt(name, field)
+	}
+	im.DefaultMapping = doc
+	return im, nil
+}
+
+// openUserIndex 打开或创建索引，path 为空时使用内存索引
+func openUserIndex(path string) (bleve.Index, error) {
+	if path != "" {
+		if _, err := os.Stat(path); err == nil {
+			return bleve.Open(path)
+		}
+	}
+	im, err := newUserIndexMapping()
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		return bleve.NewMemOnly(im)
+	}
+	return bleve.New(path, im)
+}
+
+func (x *userSearchIndex) current() bleve.Index {
+	x.mu.RLock()
+	defer x.mu.RUnlock()
+	return x.index
+}
+
+// EnableSearch 启用用户全文搜索：打开索引，注册GORM回调在用户变更提交后同步索引，并订阅其他实例的变更通知。
+// 索引为空（首次启动或使用内存索引）时在后台从数据库重建
+func (s *UserService) EnableSearch(ctx context.Context, path string) error {
+	index, err := openUserIndex(path)
+	if err != nil {
+		return fmt.Errorf("打开搜索索引失败: %w", err)
+	}
+	instance := make([]byte, 8)
+	if _, err := rand.Read(instance); err != nil {
+		return err
+	}
+	x := &userSearchIndex{index: index, path: path, instance: hex.EncodeToString(instance)}
+
+	cb := s.db.Callback()
+	if err := cb.Create().After("gorm:commit_or_rollback_transaction").Register("search:create", s.syncSearchIndex); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:commit_or_rollback_transaction").Register("search:update", s.syncSearchIndex); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:commit_or_rollback_transaction").Register("search:delete", s.syncSearchIndex); err != nil {
+		return err
+	}
+
+	s.search.Store(x)
+
+	s.startSearchWatcher(ctx)
+
+	count, err := index.DocCount()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		go func() {
+			total, err := s.rebuildSearchIndex(ctx, nil)
+			if err != nil {
+				log.Printf("Failed to build search index: %v", err)
+				return
+			}
+			log.Printf("Search index built with %d users", total)
+		}()
+	}
+	return nil
+}
+
+// searchIndex 返回用户索引。索引在GORM回调中使用，此时可能已持有 s.mu，因此不能加锁
+func (s *UserService) searchIndex() *userSearchIndex {
+	return s.search.Load()
+}
+
+// CloseSearch 关闭搜索索引
+func (s *UserService) CloseSearch() error {
+	x := s.searchIndex()
+	if x == nil {
+		return nil
+	}
+	return x.current().Close()
+}
+
+// syncSearchIndex 在用户的创建、更新、删除提交后按变更记录同步索引，并通知其他实例。
+// 外层事务（db.Transaction）中的语句在提交前就会同步，事务回滚时可以通过重建修复
+func (s *UserService) syncSearchIndex(db *gorm.DB) {
+	x := s.searchIndex()
+	if x == nil || db.Error != nil || db.Statement.Table != "users" {
+		return
+	}
+
+	var ids []uint
+	for _, entry := range history.Changes(db) {
+		if entry.EntityType != "users" {
+			continue
+		}
+		id := uint(entry.EntityID)
+		ids = append(ids, id)
+
+		var doc userSearchDocument
+		if entry.After != "" {
+			if err := json.Unmarshal([]byte(entry.After), &doc); err != nil {
+				log.Printf("Failed to decode user %d for search index: %v", id, err)
+				continue
+			}
+		}
+		var err error
+		if entry.After == "" || doc.DeletedAt != nil {
+			err = x.remove(id)
+		} else {
+			err = x.put(id, doc)
+		}
+		if err != nil {
+			log.Printf("Failed to update search index for user %d: %v", id, err)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	x.markPending(ids)
+	s.publishSearchSync(db.Statement.Context, x, ids)
+}
+
+func (x *userSearchIndex) put(id uint, doc userSearchDocument) error {
+	return x.current().Index(searchDocID(id), doc.fields())
+}
+
+func (x *userSearchIndex) remove(id uint) error {
+	return x.current().Delete(searchDocID(id))
+}
+
+// markPending 记录重建期间发生变更的用户
+func (x *userSearchIndex) markPending(ids []uint) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if x.pending == nil {
+		return
+	}
+	for _, id := range ids {
+		x.pending[id] = true
+	}
+}
+
+type searchSyncMessage struct {
+	Source string `json:"source"`
+	IDs    []uint `json:"ids"`
+}
+
+func (s *UserService) publishSearchSync(ctx context.Context, x *userSearchIndex, ids []uint) {
+	data, err := json.Marshal(searchSyncMessage{Source: x.instance, IDs: ids})
+	if err != nil {
+		return
+	}
+	if err := s.redis.Publish(ctx, searchSyncChannel, data).Err(); err != nil {
+		log.Printf("Failed to publish search index sync: %v", err)
+	}
+}
+
+// startSearchWatcher 订阅其他实例的用户变更通知，从数据库重新加载对应用户
+func (s *UserService) startSearchWatcher(ctx context.Context) {
+	pubsub := s.redis.Subscribe(ctx, searchSyncChannel)
+	go func() {
+		defer pubsub.Close()
+		ch := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var message searchSyncMessage
+				if err := json.Unmarshal([]byte(msg.Payload), &message); err != nil {
+					continue
+				}
+				x := s.searchIndex()
+				if x == nil || message.Source == x.instance {
+					continue
+				}
+				x.markPending(message.IDs)
+				if err := s.reloadSearchDocuments(ctx, x.current(), message.IDs); err != nil {
+					log.Printf("Failed to sync search index: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// reloadSearchDocuments 从数据库重新加载用户写入索引，已删除的用户从索引中移除
+func (s *UserService) reloadSearchDocuments(ctx context.Context, index bleve.Index, ids []uint) error {
+	var users []model.User
+	if err := s.db.WithContext(tenant.WithoutTenant(ctx)).Unscoped().Where("id IN ?", ids).Find(&users).Error; err != nil {
+		return err
+	}
+
+	batch := index.NewBatch()
+	found := make(map[uint]bool, len(users))
+	for i := range users {
+		found[users[i].ID] = true
+		if users[i].DeletedAt.Valid {
+			batch.Delete(searchDocID(users[i].ID))
+			continue
+		}
+		if err := batch.Index(searchDocID(users[i].ID), newUserSearchDocument(&users[i]).fields()); err != nil {
+			return err
+		}
+	}
+	for _, id := range ids {
+		if !found[id] {
+			batch.Delete(searchDocID(id))
+		}
+	}
+	return index.Batch(batch)
+}
+
+// StartSearchRebuildJob 创建后台任务，从数据库重建所有租户的用户索引
+func (s *UserService) StartSearchRebuildJob(ctx context.Context, operatorID int) (*model.Job, error) {
+	if s.searchIndex() == nil {
+		return nil, ErrSearchDisabled
+	}
+	return s.startJob(ctx, operatorID, model.JobSearchRebuild, struct{}{}, func(ctx context.Context, job *model.Job, progress func(processed, total int)) error {
+		_, err := s.rebuildSearchIndex(ctx, progress)
+		return err
+	})
+}
+
+// rebuildSearchIndex 在新索引中写入所有未删除的用户，完成后替换当前索引。
+// 重建期间发生变更的用户在替换后重新加载，避免被重建时读到的旧数据覆盖
+func (s *UserService) rebuildSearchIndex(ctx context.Context, progress func(processed, total int)) (int, error) {
+	x := s.searchIndex()
+	if x == nil {
+		return 0, ErrSearchDisabled
+	}
+
+	x.mu.Lock()
+	if x.building {
+		x.mu.Unlock()
+		return 0, fmt.Errorf("%w: 索引正在重建", ErrConflict)
+	}
+	x.building = true
+	x.pending = make(map[uint]bool)
+	x.mu.Unlock()
+
+	fresh, freshPath, err := x.build(ctx, s.db, progress)
+
+	x.mu.Lock()
+	pending := x.pending
+	x.pending = nil
+	x.building = false
+	if err != nil {
+		x.mu.Unlock()
+		if fresh != nil {
+			fresh.Close()
+		}
+		if freshPath != "" {
+			os.RemoveAll(freshPath)
+		}
+		return 0, err
+	}
+	old := x.index
+	old.Close()
+	if x.path != "" {
+		// 磁盘索引：关闭后用新目录替换旧目录再重新打开
+		fresh.Close()
+		if err := os.RemoveAll(x.path); err == nil {
+			err = os.Rename(freshPath, x.path)
+		}
+		if err == nil {
+			fresh, err = bleve.Open(x.path)
+		}
+		if err != nil {
+			// 替换失败时保留新索引所在目录继续使用
+			if fresh, err = bleve.Open(freshPath); err != nil {
+				x.mu.Unlock()
+				return 0, err
+			}
+		}
+	}
+	x.index = fresh
+	x.mu.Unlock()
+
+	ids := make([]uint, 0, len(pending))
+	for id := range pending {
+		ids = append(ids, id)
+	}
+	if len(ids) > 0 {
+		if err := s.reloadSearchDocuments(ctx, fresh, ids); err != nil {
+			return 0, err
+		}
+	}
+
+	count, err := fresh.DocCount()
+	return int(count), err
+}
+
+// build 创建新索引并按批写入所有租户未删除的用户
+func (x *userSearchIndex) build(ctx context.Context, db *gorm.DB, progress func(processed, total int)) (bleve.Index, string, error) {
+	path := ""
+	if x.path != "" {
+		path = fmt.Sprintf("%s.rebuild-%d", x.path, time.Now().UnixNano())
+	}
+	im, err := newUserIndexMapping()
+	if err != nil {
+		return nil, "", err
+	}
+	var index bleve.Index
+	if path == "" {
+		index, err = bleve.NewMemOnly(im)
+	} else {
+		index, err = bleve.New(path, im)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	db = db.WithContext(tenant.WithoutTenant(ctx))
+	var total int64
+	if err := db.Model(&model.User{}).Count(&total).Error; err != nil {
+		return index, path, err
+	}
+	if progress != nil {
+		progress(0, int(total))
+	}
+
+	processed := 0
+	var users []model.User
+	err = db.FindInBatches(&users, searchBatchSize, func(tx *gorm.DB, _ int) error {
+		batch := index.NewBatch()
+		for i := range users {
+			if err := batch.Index(searchDocID(users[i].ID), newUserSearchDocument(&users[i]).fields()); err != nil {
+				return err
+			}
+		}
+		if err := index.Batch(batch); err != nil {
+			return err
+		}
+		processed += len(users)
+		if progress != nil {
+			progress(processed, int(total))
+		}
+		return ctx.Err()
+	}).Error
+	return index, path, err
+}
+
+// SearchUsers 在操作人所在租户和数据范围内全文搜索用户，支持前缀、模糊（按编辑距离）匹配和中文片段，
+// 结果按相关度排序并返回高亮片段
+func (s *UserService) SearchUsers(ctx context.Context, operatorID int, req *UserSearchRequest) (*UserSearchResult, error) {
+	x := s.searchIndex()
+	if x == nil {
+		return nil, ErrSearchDisabled
+	}
+
+	text := strings.TrimSpace(req.Query)
+	if text == "" {
+		return nil, fmt.Errorf("%w: 搜索关键字不能为空", ErrInvalidSearch)
+	}
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.PageSize < 1 {
+		req.PageSize = 20
+	}
+	if req.PageSize > searchMaxPageSize {
+		return nil, fmt.Errorf("%w: 每页最多 %d 条", ErrInvalidSearch, searchMaxPageSize)
+	}
+
+	tenantID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, tenant.ErrMissingTenant
+	}
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bleve.NewTermQuery(strconv.FormatUint(uint64(tenantID), 10))
+	filter.SetField("tenant_id")
+	must := []query.Query{filter, userTextQuery(text)}
+	if !scope.all {
+		ids := []string{searchDocID(scope.userID)}
+		for _, id := range scope.memberIDs {
+			ids = append(ids, searchDocID(id))
+		}
+		visible := []query.Query{bleve.NewDocIDQuery(ids)}
+		for _, id := range scope.departmentIDs {
+			department := bleve.NewTermQuery(strconv.Itoa(id))
+			department.SetField("department_id")
+			visible = append(visible, department)
+		}
+		must = append(must, bleve.NewDisjunctionQuery(visible...))
+	}
+
+	search := bleve.NewSearchRequestOptions(bleve.NewConjunctionQuery(must...), req.PageSize, (req.Page-1)*req.PageSize, false)
+	search.Highlight = bleve.NewHighlightWithStyle(html.Name)
+	search.Highlight.Fields = userSearchFields
+	found, err := x.current().SearchInContext(ctx, search)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]uint, 0, len(found.Hits))
+	for _, hit := range found.Hits {
+		if id, err := strconv.ParseUint(hit.ID, 10, 64); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	// 以数据库中的数据为准，索引尚未同步的已删除用户不会返回
+	users := make(map[uint]model.User, len(ids))
+	if len(ids) > 0 {
+		var list []model.User
+		if err := s.db.WithContext(ctx).Scopes(scope.apply).Preload("Role").Preload("Department").Where("users.id IN ?", ids).Find(&list).Error; err != nil {
+			return nil, err
+		}
+		for i := range list {
+			if err := s.hideSensitiveAttributes(ctx, operatorID, &list[i]); err != nil {
+				return nil, err
+			}
+			users[list[i].ID] = list[i]
+		}
+	}
+
+	result := &UserSearchResult{List: make([]UserSearchHit, 0, len(ids)), Total: found.Total, Page: req.Page, PageSize: req.PageSize}
+	for _, hit := range found.Hits {
+		id, _ := strconv.ParseUint(hit.ID, 10, 64)
+		user, ok := users[uint(id)]
+		if !ok {
+			continue
+		}
+		result.List = append(result.List, UserSearchHit{User: user, Score: hit.Score, Highlights: highlighted(hit.Fragments)})
+	}
+	return result, nil
+}
+
+// highlighted 只保留包含命中内容的高亮片段
+func highlighted(fragments map[string][]string) map[string][]string {
+	result := make(map[string][]string)
+	for field, items := range fragments {
+		for _, item := range items {
+			if strings.Contains(item, "<mark>") {
+				result[field] = append(result[field], item)
+			}
+		}
+	}
+	return result
+}
+
+// userTextQuery 构造搜索条件：整个关键字在任一字段完整匹配得分最高；
+// 否则关键字中的每个词都需要在某个字段中按前缀或编辑距离匹配
+func userTextQuery(text string) query.Query {
+	var exact []query.Query
+	for _, field := range userSearchFields {
+		match := bleve.NewMatchQuery(text)
+		match.SetField(field)
+		match.SetOperator(query.MatchQueryOperatorAnd)
+		match.SetBoost(3)
+		exact = append(exact, match)
+	}
+
+	var words []query.Query
+	for _, word := range userTextRegexp.FindAllString(strings.ToLower(text), -1) {
+		var alternatives []query.Query
+		for _, field := range userSearchFields {
+			prefix := bleve.NewPrefixQuery(word)
+			prefix.SetField(field)
+			prefix.SetBoost(2)
+			alternatives = append(alternatives, prefix)
+
+			// 中文按单字和二元组索引，只对其他文字做模糊匹配
+			if fuzziness := searchFuzziness(word); fuzziness > 0 {
+				fuzzy := bleve.NewFuzzyQuery(word)
+				fuzzy.SetField(field)
+				fuzzy.SetFuzziness(fuzziness)
+				alternatives = append(alternatives, fuzzy)
+			}
+		}
+		words = append(words, bleve.NewDisjunctionQuery(alternatives...))
+	}
+
+	if len(words) == 0 {
+		return bleve.NewDisjunctionQuery(exact...)
+	}
+	return bleve.NewDisjunctionQuery(bleve.NewDisjunctionQuery(exact...), bleve.NewConjunctionQuery(words...))
+}
+
+// searchFuzziness 按词长决定允许的编辑距离，过短的词和中日韩文字不做模糊匹配
+func searchFuzziness(word string) int {
+	if cjkRegexp.MatchString(word) {
+		return 0
+	}
+	switch n := utf8.RuneCountInString(word); {
+	case n < 4:
+		return 0
+	case n < 8:
+		return 1
+	default:
+		return 2
+	}
+}
+
+var cjkRegexp = regexp.MustCompile(`[\p{Han}\p{Hangul}\p{Hiragana}\p{Katakana}]`)
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"xx-backend/internal/model"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/callbacks"
+	"gorm.io/gorm/logger"
+)
+
+// dryRunDB 只生成SQL不连接数据库
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test:test@tcp(127.0.0.1:3306)/test?parseTime=true", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	return db
+}
+
+// fakeTables 用按表名注册的函数替换查询回调，由函数填充 tx.Statement.Dest 并设置 RowsAffected，
+// 没有注册的表返回空结果
+func fakeTables(t *testing.T, tables map[string]func(tx *gorm.DB)) *gorm.DB {
+	t.Helper()
+	db := dryRunDB(t)
+	err := db.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+		callbacks.BuildQuerySQL(tx)
+		if fill, ok := tables[tx.Statement.Table]; ok {
+			fill(tx)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// grantPermissions 把操作人的有效权限写入缓存，不再查询角色
+func grantPermissions(s *UserService, operatorID uint, codes ...string) {
+	ep := &EffectivePermissions{}
+	for _, code := range codes {
+		ep.Permissions = append(ep.Permissions, model.Permission{Code: code})
+	}
+	s.roleCache.setUserIfFresh(s.roleCache.currentGeneration(), operatorID, ep, time.Now().Add(time.Hour))
+}
+
+// sensitiveFields 返回敏感自定义字段的 user_fields 查询
+func sensitiveFields(keys ...string) func(tx *gorm.DB) {
+	return func(tx *gorm.DB) {
+		if dest, ok := tx.Statement.Dest.(*[]string); ok {
+			*dest = append(*dest, keys...)
+			tx.RowsAffected = int64(len(keys))
+		}
+	}
+}
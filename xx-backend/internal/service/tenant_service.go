@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+
+	"gorm.io/gorm"
+)
+
+type TenantService struct {
+	db *gorm.DB
+}
+
+func NewTenantService(db *gorm.DB) *TenantService {
+	return &TenantService{
+		db: db,
+	}
+}
+
+// EnsureDefaultTenant 确保默认租户存在，已有数据默认属于该租户
+func (s *TenantService) EnsureDefaultTenant(ctx context.Context) error {
+	t := model.Tenant{ID: model.DefaultTenantID, Code: "default", Name: "默认租户", Status: 1}
+	return s.db.WithContext(ctx).Where("id = ?", model.DefaultTenantID).FirstOrCreate(&t).Error
+}
+
+// GetTenants 获取租户列表
+func (s *TenantService) GetTenants(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Tenant], error) {
+	return listquery.Find[model.Tenant](s.db.WithContext(ctx), q)
+}
+
+// CreateTenant 创建租户
+func (s *TenantService) CreateTenant(ctx context.Context, t *model.Tenant) error {
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.Tenant{}).Where("code = ?", t.Code).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("租户编码已存在")
+	}
+	return s.db.WithContext(ctx).Create(t).Error
+}
+
+// UpdateTenant 更新租户
+func (s *TenantService) UpdateTenant(ctx context.Context, id uint, updates map[string]interface{}) error {
+	if id == model.DefaultTenantID {
+		if status, ok := updates["status"]; ok && status != float64(1) {
+			return fmt.Errorf("不能禁用默认租户")
+		}
+	}
+	return s.db.WithContext(ctx).Model(&model.Tenant{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// DeleteTenant 删除租户（租户下仍有用户时不允许删除）
+func (s *TenantService) DeleteTenant(ctx context.Context, id uint) error {
+	if id == model.DefaultTenantID {
+		return fmt.Errorf("不能删除默认租户")
+	}
+
+	var t model.Tenant
+	if err := s.db.WithContext(ctx).First(&t, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("租户不存在")
+		}
+		return err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Raw("SELECT COUNT(*) FROM users WHERE tenant_id = ? AND deleted_at IS NULL", id).Scan(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("租户下仍有用户，不能删除")
+	}
+
+	return s.db.WithContext(ctx).Delete(&t).Error
+}
@@ -0,0 +1,556 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+// 修改部分字段需要的权限，没有权限时整个更新被拒绝
+const (
+	PermissionUserRole      = "user:role"       // 修改用户角色
+	PermissionUserStatus    = "user:status"     // 启用、禁用用户
+	PermissionUserPassword  = "user:password"   // 重置用户密码
+	PermissionRoleDataScope = "role:data_scope" // 修改角色的数据范围
+)
+
+// ErrInvalidPatch 更新内容包含不支持的字段或字段值无效，处理器应返回422
+var ErrInvalidPatch = errors.New("更新内容无效")
+
+// ErrFieldForbidden 没有修改某些字段的权限，处理器应返回403
+var ErrFieldForbidden = errors.New("没有修改字段的权限")
+
+// FieldErrors 更新内容的字段错误，键为字段名
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	names := make([]string, 0, len(e))
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = name + ": " + e[name]
+	}
+	return ErrInvalidPatch.Error() + ": " + strings.Join(parts, "; ")
+}
+
+func (e FieldErrors) Unwrap() error { return ErrInvalidPatch }
+
+func (e FieldErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Optional 合并补丁中的字段：Set 表示请求中出现了该字段，Value 为 nil 表示值为 null
+type Optional[T any] struct {
+	Set   bool
+	Value *T
+}
+
+func (o *Optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	o.Value = nil
+	if string(data) == "null" {
+		return nil
+	}
+	var value T
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	o.Value = &value
+	return nil
+}
+
+// decodeMergePatch 按 JSON Merge Patch（RFC 7396）把请求体解析到 dst 的 Optional 字段，
+// 请求体不是合法JSON时原样返回解析错误，其他问题（不支持的字段、类型错误）返回 FieldErrors
+func decodeMergePatch(data []byte, dst interface{}) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return err
+		}
+		return FieldErrors{"$": "请求体必须是JSON对象"}
+	}
+	if members == nil {
+		return FieldErrors{"$": "请求体必须是JSON对象"}
+	}
+
+	v := reflect.ValueOf(dst).Elem()
+	fields := make(map[string]int, v.NumField())
+	for i := 0; i < v.NumField(); i++ {
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		fields[name] = i
+	}
+
+	errs := FieldErrors{}
+	for name, raw := range members {
+		i, ok := fields[name]
+		if !ok {
+			errs[name] = "不支持的字段"
+			continue
+		}
+		if err := json.Unmarshal(raw, v.Field(i).Addr().Interface()); err != nil {
+			errs[name] = "类型错误"
+		}
+	}
+	return errs.err()
+}
+
+// encodeMergePatch 把 src 中出现的 Optional 字段编码为合并补丁，与 decodeMergePatch 相反（用于提交审批）
+func encodeMergePatch(src interface{}) (json.RawMessage, error) {
+	v := reflect.ValueOf(src).Elem()
+	members := make(map[string]interface{})
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Field(i)
+		if !field.FieldByName("Set").Bool() {
+			continue
+		}
+		name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+		members[name] = field.FieldByName("Value").Interface()
+	}
+	return json.Marshal(members)
+}
+
+// setFields 返回 src 中出现的 Optional 字段的名称
+func setFields(src interface{}) []string {
+	v := reflect.ValueOf(src).Elem()
+	var names []string
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).FieldByName("Set").Bool() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// stringField 校验字符串字段并写入 columns。required 时不能为 null 或空，否则 null 清空字段
+func stringField(errs FieldErrors, columns map[string]interface{}, name string, o Optional[string], maxLength int, required bool) {
+	if !o.Set {
+		return
+	}
+	value := ""
+	if o.Value != nil {
+		value = strings.TrimSpace(*o.Value)
+	}
+	switch {
+	case required && value == "":
+		errs[name] = "不能为空"
+	case utf8.RuneCountInString(value) > maxLength:
+		errs[name] = fmt.Sprintf("长度不能超过 %d", maxLength)
+	default:
+		columns[name] = value
+	}
+}
+
+// statusField 校验状态字段，只能为0或1
+func statusField(errs FieldErrors, columns map[string]interface{}, name string, o Optional[int]) {
+	if !o.Set {
+		return
+	}
+	if o.Value == nil || (*o.Value != 0 && *o.Value != 1) {
+		errs[name] = "只能为0或1"
+		return
+	}
+	columns[name] = *o.Value
+}
+
+// forbiddenFields 返回操作人没有权限修改的字段
+func (s *UserService) forbiddenFields(ctx context.Context, operatorID int, gated map[string]string) error {
+	if len(gated) == 0 {
+		return nil
+	}
+	permissions, err := s.GetUserPermissions(ctx, uint(operatorID))
+	if err != nil {
+		return err
+	}
+
+	var forbidden []string
+	for field, code := range gated {
+		if !permissions.HasPermission(code) {
+			forbidden = append(forbidden, field)
+		}
+	}
+	if len(forbidden) > 0 {
+		sort.Strings(forbidden)
+		return fmt.Errorf("%w: %s", ErrFieldForbidden, strings.Join(forbidden, ", "))
+	}
+	return nil
+}
+
+// checkVersion 校验记录的当前版本号，version 为0表示不检查
+func checkVersion(current, version int) error {
+	if version > 0 && current != version {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// updateVersioned 更新记录，version 不为0时只在版本号一致时更新（条件更新，避免覆盖并发修改），
+// 没有更新到记录时返回 ErrPreconditionFailed。版本号由模型的 BeforeUpdate 加1
+func updateVersioned(db *gorm.DB, value interface{}, id interface{}, version int, columns map[string]interface{}) error {
+	if version > 0 {
+		db = db.Where("version = ?", version)
+	}
+	result := db.Model(value).Where("id = ?", id).Updates(columns)
+	if result.Error != nil {
+		return result.Error
+	}
+	if version > 0 && result.RowsAffected == 0 {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// currentVersion 读取记录更新后的版本号
+func (s *UserService) currentVersion(ctx context.Context, value interface{}, id int) (int, error) {
+	var versions []int
+	if err := s.db.WithContext(ctx).Model(value).Where("id = ?", id).Pluck("version", &versions).Error; err != nil {
+		return 0, err
+	}
+	if len(versions) == 0 {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return versions[0], nil
+}
+
+// UserUpdate 用户的更新内容，未出现的字段不修改。用户名不能修改
+type UserUpdate struct {
+	Email        Optional[string]    `json:"email"`
+	Nickname     Optional[string]    `json:"nickname"`
+	Avatar       Optional[string]    `json:"avatar"`
+	Status       Optional[int]       `json:"status"`        // 需要 user:status 权限
+	RoleID       Optional[int]       `json:"role_id"`       // 需要 user:role 权限，可能需要审批
+	DepartmentID Optional[int]       `json:"department_id"` // null 表示移出部门
+	Password     Optional[string]    `json:"password"`      // 需要 user:password 权限
+	DeactivateAt Optional[time.Time] `json:"deactivate_at"` // 计划停用时间，null 表示取消，需要 user:status 权限
+	// Attributes 自定义字段的合并补丁，值为 null 的字段被移除；修改敏感字段需要 user:sensitive 权限
+	Attributes Optional[map[string]interface{}] `json:"attributes"`
+}
+
+// DecodeUserUpdate 解析用户的合并补丁
+func DecodeUserUpdate(data []byte) (*UserUpdate, error) {
+	var update UserUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// selfProtectedFields 操作人不能修改自己的这些字段，避免提升自己的权限或把自己锁在系统外
+var selfProtectedFields = map[string]bool{"role_id": true, "status": true, "deactivate_at": true, "password": true}
+
+// checkUserChange 修改单个用户前的校验，更新用户和批量操作共用：不能修改自己的角色、状态和密码，
+// 待激活的用户不能修改状态和密码，已删除个人数据的用户不能修改。fields 为要修改的字段
+func checkUserChange(operatorID int, user *model.User, fields ...string) error {
+	for _, field := range fields {
+		if int(user.ID) == operatorID && selfProtectedFields[field] {
+			return fmt.Errorf("%w: 不能修改自己的 %s", ErrFieldForbidden, field)
+		}
+		if user.Status == model.UserStatusPending && (field == "status" || field == "password") {
+			return fmt.Errorf("%w: 用户尚未接受邀请，不能修改状态和密码", ErrConflict)
+		}
+	}
+	if user.ErasedAt != nil {
+		return fmt.Errorf("%w: 用户的个人数据已删除，不能修改", ErrConflict)
+	}
+	return nil
+}
+
+// prepareUserUpdate 校验用户更新内容，返回目标用户和要更新的列
+func (s *UserService) prepareUserUpdate(ctx context.Context, operatorID, id int, update *UserUpdate, version int) (*model.User, map[string]interface{}, error) {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var user model.User
+	if err := s.db.WithContext(ctx).Scopes(scope.apply).First(&user, id).Error; err != nil {
+		return nil, nil, err
+	}
+	if err := checkVersion(user.Version, version); err != nil {
+		return nil, nil, err
+	}
+
+	gated := make(map[string]string)
+	if update.RoleID.Set {
+		gated["role_id"] = PermissionUserRole
+	}
+	if update.Status.Set {
+		gated["status"] = PermissionUserStatus
+	}
+	if update.DeactivateAt.Set {
+		gated["deactivate_at"] = PermissionUserStatus
+	}
+	if update.Password.Set {
+		gated["password"] = PermissionUserPassword
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	if update.Attributes.Set {
+		fields, err := s.GetUserFields(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		patch := make(map[string]interface{})
+		if update.Attributes.Value != nil {
+			patch = *update.Attributes.Value
+		} else {
+			for key := range user.Attributes {
+				patch[key] = nil
+			}
+		}
+		attributes, attributeErrs, sensitive := mergeAttributes(fields, user.Attributes, patch)
+		for name, message := range attributeErrs {
+			errs[name] = message
+		}
+		for _, name := range sensitive {
+			gated[name] = PermissionUserSensitive
+		}
+		if len(attributeErrs) == 0 {
+			columns["attributes"] = attributes
+		}
+	}
+	if err := s.forbiddenFields(ctx, operatorID, gated); err != nil {
+		return nil, nil, err
+	}
+	if err := checkUserChange(operatorID, &user, setFields(update)...); err != nil {
+		return nil, nil, err
+	}
+
+	stringField(errs, columns, "email", update.Email, 100, true)
+	stringField(errs, columns, "nickname", update.Nickname, 50, false)
+	stringField(errs, columns, "avatar", update.Avatar, 255, false)
+	statusField(errs, columns, "status", update.Status)
+	if status, ok := columns["status"]; ok && status == model.UserStatusActive && user.Status != model.UserStatusActive {
+		// 重新启用后重新计算未登录天数
+		columns["enabled_at"] = time.Now()
+	}
+	if update.DeactivateAt.Set {
+		columns["deactivate_at"] = update.DeactivateAt.Value
+	}
+
+	if email, ok := columns["email"].(string); ok {
+		if err := validateEmail(email); err != nil {
+			errs["email"] = err.Error()
+			delete(columns, "email")
+		}
+	}
+	if update.Password.Set {
+		if update.Password.Value == nil {
+			errs["password"] = "不能为空"
+		} else if err := validatePassword(*update.Password.Value); err != nil {
+			errs["password"] = err.Error()
+		} else {
+			hash := md5.Sum([]byte(*update.Password.Value))
+			columns["password"] = hex.EncodeToString(hash[:])
+		}
+	}
+	if update.RoleID.Set {
+		if update.RoleID.Value == nil {
+			errs["role_id"] = "不能为空"
+		} else if err := s.db.WithContext(ctx).First(&model.Role{}, *update.RoleID.Value).Error; err != nil {
+			if !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, nil, err
+			}
+			errs["role_id"] = "角色不存在"
+		} else {
+			columns["role_id"] = *update.RoleID.Value
+		}
+	}
+	if update.DepartmentID.Set {
+		departmentID := update.DepartmentID.Value
+		if departmentID != nil {
+			if err := s.db.WithContext(ctx).First(&model.Department{}, *departmentID).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, nil, err
+				}
+				errs["department_id"] = "部门不存在"
+			}
+		}
+		// 不能把用户调整到数据范围之外的部门
+		if _, invalid := errs["department_id"]; !invalid {
+			if !scope.allowsDepartment(departmentID) {
+				return nil, nil, ErrOutOfDataScope
+			}
+			columns["department_id"] = departmentID
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, nil, err
+	}
+
+	if email, ok := columns["email"].(string); ok {
+		var count int64
+		if err := s.db.WithContext(ctx).Model(&model.User{}).Where("email = ? AND id <> ?", email, id).Count(&count).Error; err != nil {
+			return nil, nil, err
+		}
+		if count > 0 {
+			return nil, nil, fmt.Errorf("%w: 邮箱已被其他用户使用", ErrConflict)
+		}
+	}
+	return &user, columns, nil
+}
+
+// RoleUpdate 角色的更新内容，未出现的字段不修改
+type RoleUpdate struct {
+	Name        Optional[string] `json:"name"`
+	Description Optional[string] `json:"description"`
+	Status      Optional[int]    `json:"status"`
+	ParentID    Optional[int]    `json:"parent_id"`  // null 表示不继承其他角色
+	DataScope   Optional[string] `json:"data_scope"` // 需要 role:data_scope 权限
+}
+
+// DecodeRoleUpdate 解析角色的合并补丁
+func DecodeRoleUpdate(data []byte) (*RoleUpdate, error) {
+	var update RoleUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+func (s *UserService) prepareRoleUpdate(ctx context.Context, operatorID, id int, update *RoleUpdate, version int) (map[string]interface{}, error) {
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	if err := checkVersion(role.Version, version); err != nil {
+		return nil, err
+	}
+
+	gated := make(map[string]string)
+	if update.DataScope.Set {
+		gated["data_scope"] = PermissionRoleDataScope
+	}
+	if err := s.forbiddenFields(ctx, operatorID, gated); err != nil {
+		return nil, err
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	stringField(errs, columns, "name", update.Name, 50, true)
+	stringField(errs, columns, "description", update.Description, 255, false)
+	statusField(errs, columns, "status", update.Status)
+
+	if update.DataScope.Set {
+		if update.DataScope.Value == nil || !model.IsValidDataScope(*update.DataScope.Value) {
+			errs["data_scope"] = "无效的数据范围"
+		} else {
+			columns["data_scope"] = *update.DataScope.Value
+		}
+	}
+	if update.ParentID.Set {
+		parentID := update.ParentID.Value
+		if parentID != nil {
+			if err := s.db.WithContext(ctx).First(&model.Role{}, *parentID).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, err
+				}
+				errs["parent_id"] = "父角色不存在"
+			} else if err := s.checkRoleParent(ctx, id, *parentID); err != nil {
+				return nil, err
+			}
+		}
+		if _, invalid := errs["parent_id"]; !invalid {
+			columns["parent_id"] = parentID
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	if name, ok := columns["name"].(string); ok {
+		var count int64
+		if err := s.db.WithContext(ctx).Model(&model.Role{}).Where("name = ? AND id <> ?", name, id).Count(&count).Error; err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, fmt.Errorf("%w: 角色名已被其他角色使用", ErrConflict)
+		}
+	}
+	return columns, nil
+}
+
+// MenuUpdate 菜单的更新内容，未出现的字段不修改
+type MenuUpdate struct {
+	Name      Optional[string] `json:"name"`
+	Path      Optional[string] `json:"path"`
+	Component Optional[string] `json:"component"`
+	Icon      Optional[string] `json:"icon"`
+	Sort      Optional[int]    `json:"sort"`
+	ParentID  Optional[int]    `json:"parent_id"` // null 表示移动到顶层
+	Status    Optional[int]    `json:"status"`
+}
+
+// DecodeMenuUpdate 解析菜单的合并补丁
+func DecodeMenuUpdate(data []byte) (*MenuUpdate, error) {
+	var update MenuUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+func (s *UserService) prepareMenuUpdate(ctx context.Context, id int, update *MenuUpdate, version int) (map[string]interface{}, error) {
+	var menu model.Menu
+	if err := s.db.WithContext(ctx).First(&menu, id).Error; err != nil {
+		return nil, err
+	}
+	if err := checkVersion(menu.Version, version); err != nil {
+		return nil, err
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	stringField(errs, columns, "name", update.Name, 50, true)
+	stringField(errs, columns, "path", update.Path, 100, false)
+	stringField(errs, columns, "component", update.Component, 100, false)
+	stringField(errs, columns, "icon", update.Icon, 50, false)
+	statusField(errs, columns, "status", update.Status)
+
+	if update.Sort.Set {
+		if update.Sort.Value == nil {
+			errs["sort"] = "不能为空"
+		} else {
+			columns["sort"] = *update.Sort.Value
+		}
+	}
+	if update.ParentID.Set {
+		parentID := update.ParentID.Value
+		if parentID != nil {
+			if err := s.db.WithContext(ctx).First(&model.Menu{}, *parentID).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					return nil, err
+				}
+				errs["parent_id"] = "父菜单不存在"
+			} else if err := s.checkMenuParent(ctx, s.db, id, *parentID); err != nil {
+				return nil, err
+			}
+		}
+		if _, invalid := errs["parent_id"]; !invalid {
+			columns["parent_id"] = parentID
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	return columns, nil
+}
@@ -0,0 +1,293 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"xx-backend/internal/model"
+
+	"gorm.io/gorm"
+)
+
+func TestDecodeMergePatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantSyntax bool
+		wantFields FieldErrors
+		check      func(t *testing.T, u *UserUpdate)
+	}{
+		{
+			name: "absent, null and value",
+			body: `{"nickname":"bob","department_id":null}`,
+			check: func(t *testing.T, u *UserUpdate) {
+				if !u.Nickname.Set || u.Nickname.Value == nil || *u.Nickname.Value != "bob" {
+					t.Errorf("Nickname = %+v", u.Nickname)
+				}
+				if !u.DepartmentID.Set || u.DepartmentID.Value != nil {
+					t.Errorf("DepartmentID = %+v, want set to null", u.DepartmentID)
+				}
+				if u.Email.Set {
+					t.Errorf("Email = %+v, want not set", u.Email)
+				}
+			},
+		},
+		{
+			name: "empty object",
+			body: `{}`,
+			check: func(t *testing.T, u *UserUpdate) {
+				if u.Nickname.Set || u.Status.Set {
+					t.Errorf("update = %+v, want nothing set", u)
+				}
+			},
+		},
+		{
+			name:       "unknown field",
+			body:       `{"username":"root","nickname":"bob"}`,
+			wantFields: FieldErrors{"username": "不支持的字段"},
+		},
+		{
+			name:       "wrong type",
+			body:       `{"status":"on"}`,
+			wantFields: FieldErrors{"status": "类型错误"},
+		},
+		{name: "syntax error", body: `{"nickname":`, wantSyntax: true},
+		{name: "array", body: `[]`, wantFields: FieldErrors{"$": "请求体必须是JSON对象"}},
+		{name: "null", body: `null`, wantFields: FieldErrors{"$": "请求体必须是JSON对象"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			update, err := DecodeUserUpdate([]byte(tt.body))
+			var syntaxErr *json.SyntaxError
+			if tt.wantSyntax {
+				if !errors.As(err, &syntaxErr) {
+					t.Fatalf("error = %v, want *json.SyntaxError", err)
+				}
+				return
+			}
+			if tt.wantFields != nil {
+				var fields FieldErrors
+				if !errors.As(err, &fields) || !errors.Is(err, ErrInvalidPatch) {
+					t.Fatalf("error = %v, want FieldErrors wrapping ErrInvalidPatch", err)
+				}
+				if len(fields) != len(tt.wantFields) {
+					t.Fatalf("fields = %v, want %v", fields, tt.wantFields)
+				}
+				for name, msg := range tt.wantFields {
+					if fields[name] != msg {
+						t.Errorf("fields[%s] = %q, want %q", name, fields[name], msg)
+					}
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("error = %v", err)
+			}
+			tt.check(t, update)
+		})
+	}
+}
+
+func TestEncodeMergePatch(t *testing.T) {
+	tests := []string{
+		`{}`,
+		`{"nickname":"bob"}`,
+		`{"department_id":null,"status":0}`,
+		`{"attributes":{"emp_no":null,"level":"P5"},"role_id":3}`,
+	}
+	for _, body := range tests {
+		t.Run(body, func(t *testing.T) {
+			update, err := DecodeUserUpdate([]byte(body))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			encoded, err := encodeMergePatch(update)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+			if string(encoded) != body {
+				t.Errorf("encodeMergePatch() = %s, want %s", encoded, body)
+			}
+		})
+	}
+}
+
+func TestFieldErrors(t *testing.T) {
+	err := FieldErrors{"status": "只能为0或1", "email": "不能为空"}
+	want := "更新内容无效: email: 不能为空; status: 只能为0或1"
+	if err.Error() != want {
+		t.Errorf("Error() = %q, want %q", err.Error(), want)
+	}
+	if (FieldErrors{}).err() != nil {
+		t.Error("empty FieldErrors should be nil error")
+	}
+}
+
+func TestStringAndStatusField(t *testing.T) {
+	str := func(s string) *string { return &s }
+	num := func(n int) *int { return &n }
+	tests := []struct {
+		name    string
+		apply   func(errs FieldErrors, columns map[string]interface{})
+		wantErr bool
+		wantCol bool
+		wantVal interface{}
+	}{
+		{
+			name: "trimmed value",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				stringField(e, c, "f", Optional[string]{Set: true, Value: str(" a ")}, 5, true)
+			},
+			wantCol: true, wantVal: "a",
+		},
+		{
+			name: "required blank",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				stringField(e, c, "f", Optional[string]{Set: true, Value: str("  ")}, 5, true)
+			},
+			wantErr: true,
+		},
+		{
+			name: "optional null clears",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				stringField(e, c, "f", Optional[string]{Set: true}, 5, false)
+			},
+			wantCol: true, wantVal: "",
+		},
+		{
+			name: "length counted in runes",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				stringField(e, c, "f", Optional[string]{Set: true, Value: str("中文名称")}, 4, true)
+			},
+			wantCol: true, wantVal: "中文名称",
+		},
+		{
+			name: "too long",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				stringField(e, c, "f", Optional[string]{Set: true, Value: str("abcdef")}, 5, false)
+			},
+			wantErr: true,
+		},
+		{
+			name:  "not set",
+			apply: func(e FieldErrors, c map[string]interface{}) { stringField(e, c, "f", Optional[string]{}, 5, true) },
+		},
+		{
+			name: "status",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				statusField(e, c, "f", Optional[int]{Set: true, Value: num(0)})
+			},
+			wantCol: true, wantVal: 0,
+		},
+		{
+			name: "status out of range",
+			apply: func(e FieldErrors, c map[string]interface{}) {
+				statusField(e, c, "f", Optional[int]{Set: true, Value: num(2)})
+			},
+			wantErr: true,
+		},
+		{
+			name:    "status null",
+			apply:   func(e FieldErrors, c map[string]interface{}) { statusField(e, c, "f", Optional[int]{Set: true}) },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs, columns := FieldErrors{}, map[string]interface{}{}
+			tt.apply(errs, columns)
+			if _, ok := errs["f"]; ok != tt.wantErr {
+				t.Errorf("errs = %v, wantErr %v", errs, tt.wantErr)
+			}
+			value, ok := columns["f"]
+			if ok != tt.wantCol || (ok && value != tt.wantVal) {
+				t.Errorf("columns = %v, want %v", columns, tt.wantVal)
+			}
+		})
+	}
+}
+
+func TestCheckVersion(t *testing.T) {
+	tests := []struct {
+		current, version int
+		wantErr          bool
+	}{
+		{current: 3, version: 0},
+		{current: 3, version: 3},
+		{current: 3, version: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := checkVersion(tt.current, tt.version); errors.Is(err, ErrPreconditionFailed) != tt.wantErr {
+			t.Errorf("checkVersion(%d, %d) = %v, wantErr %v", tt.current, tt.version, err, tt.wantErr)
+		}
+	}
+}
+
+func TestUpdateVersioned(t *testing.T) {
+	tests := []struct {
+		name         string
+		version      int
+		rowsAffected int64
+		wantErr      error
+		wantVersion  bool
+	}{
+		{name: "unconditional", version: 0, rowsAffected: 0},
+		{name: "version matches", version: 3, rowsAffected: 1, wantVersion: true},
+		{name: "version changed", version: 3, rowsAffected: 0, wantVersion: true, wantErr: ErrPreconditionFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dryRunDB(t)
+			var sql string
+			// 记录生成的SQL并模拟受影响的行数
+			err := db.Callback().Update().After("gorm:update").Register("test:capture", func(tx *gorm.DB) {
+				sql = tx.Statement.SQL.String()
+				tx.RowsAffected = tt.rowsAffected
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = updateVersioned(db, &model.Role{}, 5, tt.version, map[string]interface{}{"description": "d"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("updateVersioned() error = %v, want %v", err, tt.wantErr)
+			}
+			if !strings.HasPrefix(sql, "UPDATE `roles` SET") || !strings.Contains(sql, "id = ?") {
+				t.Fatalf("sql = %s", sql)
+			}
+			if strings.Contains(sql, "version = ?") != tt.wantVersion {
+				t.Errorf("sql = %s, want version condition %v", sql, tt.wantVersion)
+			}
+			// BeforeUpdate 把版本号加1
+			if !strings.Contains(sql, "`version`=version + 1") {
+				t.Errorf("sql = %s, want version bump", sql)
+			}
+		})
+	}
+}
+
+func TestSetFields(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{`{}`, nil},
+		{`{"role_id":2}`, []string{"role_id"}},
+		{`{"password":"abcd1234","role_id":2}`, []string{"role_id", "password"}},
+		{`{"department_id":null,"nickname":"bob"}`, []string{"nickname", "department_id"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.body, func(t *testing.T) {
+			update, err := DecodeUserUpdate([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if got := setFields(update); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("setFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,641 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/history"
+	"xx-backend/pkg/listquery"
+
+	"gorm.io/gorm"
+)
+
+// userFieldDateLayout 日期类型自定义字段的格式
+const userFieldDateLayout = "2006-01-02"
+
+// userFieldMaxOptions 枚举字段最多的可选值数量
+const userFieldMaxOptions = 100
+
+// attributeFilterPrefix 用户列表中按自定义字段过滤的参数前缀，如 attr.emp_no[like]=A1
+const attributeFilterPrefix = "attr."
+
+// GetUserFields 获取当前租户的自定义字段，按 sort 和 id 排序
+func (s *UserService) GetUserFields(ctx context.Context) ([]model.UserField, error) {
+	var fields []model.UserField
+	if err := s.db.WithContext(ctx).Order("sort, id").Find(&fields).Error; err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// GetUserField 根据ID获取自定义字段
+func (s *UserService) GetUserField(ctx context.Context, id int) (*model.UserField, error) {
+	var field model.UserField
+	if err := s.db.WithContext(ctx).First(&field, id).Error; err != nil {
+		return nil, err
+	}
+	return &field, nil
+}
+
+// CreateUserField 创建自定义字段，键名在租户内唯一
+func (s *UserService) CreateUserField(ctx context.Context, field *model.UserField) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	field.ID = 0
+	if field.Visibility == "" {
+		field.Visibility = model.UserFieldPublic
+	}
+	errs := FieldErrors{}
+	if !model.UserFieldKeyPattern.MatchString(field.Key) {
+		errs["key"] = "只能包含小写字母、数字和下划线，以字母开头，不超过50个字符"
+	}
+	if !model.IsValidUserFieldType(field.Type) {
+		errs["type"] = "无效的字段类型"
+	}
+	validateUserFieldRules(errs, field)
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	var count int64
+	if err := s.db.WithContext(ctx).Model(&model.UserField{}).Where("`key` = ?", field.Key).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return fmt.Errorf("%w: 字段 %s 已存在", ErrConflict, field.Key)
+	}
+	return s.db.WithContext(ctx).Create(field).Error
+}
+
+// UserFieldUpdate 自定义字段的更新内容，未出现的字段不修改。键名和类型不能修改
+type UserFieldUpdate struct {
+	Name       Optional[string]   `json:"name"`
+	Required   Optional[bool]     `json:"required"`
+	Visibility Optional[string]   `json:"visibility"`
+	MaxLength  Optional[int]      `json:"max_length"`
+	Pattern    Optional[string]   `json:"pattern"`
+	Min        Optional[float64]  `json:"min"` // null 表示不限制
+	Max        Optional[float64]  `json:"max"` // null 表示不限制
+	Options    Optional[[]string] `json:"options"`
+	Sort       Optional[int]      `json:"sort"`
+}
+
+// DecodeUserFieldUpdate 解析自定义字段的合并补丁
+func DecodeUserFieldUpdate(data []byte) (*UserFieldUpdate, error) {
+	var update UserFieldUpdate
+	if err := decodeMergePatch(data, &update); err != nil {
+		return nil, err
+	}
+	return &update, nil
+}
+
+// UpdateUserField 更新自定义字段的名称、校验规则和可见性。修改规则不会重新校验已有的值
+func (s *UserService) UpdateUserField(ctx context.Context, id int, update *UserFieldUpdate) (*model.UserField, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var field model.UserField
+	if err := s.db.WithContext(ctx).First(&field, id).Error; err != nil {
+		return nil, err
+	}
+
+	errs := FieldErrors{}
+	columns := make(map[string]interface{})
+	stringField(errs, columns, "name", update.Name, 100, true)
+	stringField(errs, columns, "pattern", update.Pattern, 255, false)
+	if update.Required.Set {
+		if update.Required.Value == nil {
+			errs["required"] = "不能为空"
+		} else {
+			columns["required"] = *update.Required.Value
+		}
+	}
+	if update.Visibility.Set {
+		if update.Visibility.Value == nil {
+			errs["visibility"] = "不能为空"
+		} else {
+			columns["visibility"] = *update.Visibility.Value
+		}
+	}
+	if update.MaxLength.Set {
+		maxLength := 0
+		if update.MaxLength.Value != nil {
+			maxLength = *update.MaxLength.Value
+		}
+		columns["max_length"] = maxLength
+	}
+	if update.Min.Set {
+		columns["min"] = update.Min.Value
+	}
+	if update.Max.Set {
+		columns["max"] = update.Max.Value
+	}
+	if update.Options.Set {
+		var options model.Strings
+		if update.Options.Value != nil {
+			options = *update.Options.Value
+		}
+		columns["options"] = options
+	}
+	if update.Sort.Set {
+		if update.Sort.Value == nil {
+			errs["sort"] = "不能为空"
+		} else {
+			columns["sort"] = *update.Sort.Value
+		}
+	}
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+
+	// 按修改后的定义整体校验规则
+	merged := field
+	for name, value := range columns {
+		switch name {
+		case "name":
+			merged.Name = value.(string)
+		case "pattern":
+			merged.Pattern = value.(string)
+		case "required":
+			merged.Required = value.(bool)
+		case "visibility":
+			merged.Visibility = value.(string)
+		case "max_length":
+			merged.MaxLength = value.(int)
+		case "min":
+			merged.Min = value.(*float64)
+		case "max":
+			merged.Max = value.(*float64)
+		case "options":
+			merged.Options = value.(model.Strings)
+		case "sort":
+			merged.Sort = value.(int)
+		}
+	}
+	validateUserFieldRules(errs, &merged)
+	if err := errs.err(); err != nil {
+		return nil, err
+	}
+	if len(columns) == 0 {
+		return &field, nil
+	}
+
+	if err := s.db.WithContext(ctx).Model(&model.UserField{}).Where("id = ?", id).Updates(columns).Error; err != nil {
+		return nil, err
+	}
+	return &merged, nil
+}
+
+// DeleteUserField 删除自定义字段，并从所有用户（包括回收站中的用户）的属性中移除该字段的值
+func (s *UserService) DeleteUserField(ctx context.Context, id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var field model.UserField
+	if err := s.db.WithContext(ctx).First(&field, id).Error; err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&model.UserField{}, id).Error; err != nil {
+			return err
+		}
+		path := attributePath(field.Key)
+		return tx.Unscoped().Model(&model.User{}).
+			Where("JSON_CONTAINS_PATH(attributes, 'one', ?)", path).
+			Update("attributes", gorm.Expr("JSON_REMOVE(attributes, ?)", path)).Error
+	})
+}
+
+// validateUserFieldRules 校验字段名称、可见性和与类型相关的校验规则
+func validateUserFieldRules(errs FieldErrors, field *model.UserField) {
+	field.Name = strings.TrimSpace(field.Name)
+	switch {
+	case field.Name == "":
+		errs["name"] = "不能为空"
+	case utf8.RuneCountInString(field.Name) > 100:
+		errs["name"] = "长度不能超过 100"
+	}
+	if !model.IsValidUserFieldVisibility(field.Visibility) {
+		errs["visibility"] = "只能为 public 或 sensitive"
+	}
+
+	if field.MaxLength < 0 {
+		errs["max_length"] = "不能小于0"
+	} else if field.MaxLength > 0 && field.Type != model.UserFieldString {
+		errs["max_length"] = "只有字符串字段可以限制长度"
+	}
+	if field.Pattern != "" {
+		if field.Type != model.UserFieldString {
+			errs["pattern"] = "只有字符串字段可以设置正则表达式"
+		} else if _, err := regexp.Compile(field.Pattern); err != nil {
+			errs["pattern"] = "正则表达式无效"
+		}
+	}
+	if field.Min != nil || field.Max != nil {
+		if field.Type != model.UserFieldNumber {
+			errs["min"] = "只有数字字段可以限制取值范围"
+		} else if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			errs["min"] = "不能大于 max"
+		}
+	}
+
+	if field.Type == model.UserFieldEnum {
+		seen := make(map[string]bool, len(field.Options))
+		switch {
+		case len(field.Options) == 0:
+			errs["options"] = "枚举字段至少需要一个可选值"
+		case len(field.Options) > userFieldMaxOptions:
+			errs["options"] = fmt.Sprintf("可选值不能超过 %d 个", userFieldMaxOptions)
+		}
+		for _, option := range field.Options {
+			if strings.TrimSpace(option) == "" || seen[option] {
+				errs["options"] = "可选值不能为空或重复"
+				break
+			}
+			seen[option] = true
+		}
+	} else if len(field.Options) > 0 {
+		errs["options"] = "只有枚举字段可以设置可选值"
+	}
+}
+
+// userFieldValue 按字段定义校验JSON中的值，返回要保存的值
+func userFieldValue(field *model.UserField, value interface{}) (interface{}, error) {
+	switch field.Type {
+	case model.UserFieldNumber:
+		n, ok := value.(float64)
+		if !ok || math.IsNaN(n) || math.IsInf(n, 0) {
+			return nil, fmt.Errorf("必须是数字")
+		}
+		if field.Min != nil && n < *field.Min {
+			return nil, fmt.Errorf("不能小于 %v", *field.Min)
+		}
+		if field.Max != nil && n > *field.Max {
+			return nil, fmt.Errorf("不能大于 %v", *field.Max)
+		}
+		return n, nil
+	case model.UserFieldBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return nil, fmt.Errorf("必须是布尔值")
+		}
+		return b, nil
+	}
+
+	text, ok := value.(string)
+	if !ok {
+		return nil, fmt.Errorf("必须是字符串")
+	}
+	text = strings.TrimSpace(text)
+	switch field.Type {
+	case model.UserFieldDate:
+		if _, err := time.Parse(userFieldDateLayout, text); err != nil {
+			return nil, fmt.Errorf("日期格式必须是 YYYY-MM-DD")
+		}
+	case model.UserFieldEnum:
+		for _, option := range field.Options {
+			if option == text {
+				return text, nil
+			}
+		}
+		return nil, fmt.Errorf("必须是 %s 之一", strings.Join(field.Options, ", "))
+	default:
+		if field.MaxLength > 0 && utf8.RuneCountInString(text) > field.MaxLength {
+			return nil, fmt.Errorf("长度不能超过 %d", field.MaxLength)
+		}
+		if field.Pattern != "" {
+			re, err := regexp.Compile(field.Pattern)
+			if err != nil || !re.MatchString(text) {
+				return nil, fmt.Errorf("格式不正确")
+			}
+		}
+	}
+	return text, nil
+}
+
+// parseUserFieldText 把导入文件中的文本转换为字段类型的值并校验
+func parseUserFieldText(field *model.UserField, text string) (interface{}, error) {
+	switch field.Type {
+	case model.UserFieldNumber:
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("必须是数字")
+		}
+		return userFieldValue(field, n)
+	case model.UserFieldBoolean:
+		switch strings.ToLower(text) {
+		case "true", "1", "yes", "是":
+			return true, nil
+		case "false", "0", "no", "否":
+			return false, nil
+		}
+		return nil, fmt.Errorf("必须是布尔值")
+	}
+	return userFieldValue(field, text)
+}
+
+// isEmptyAttribute 判断属性值是否为空（null 或空字符串），空值不保存
+func isEmptyAttribute(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	text, ok := value.(string)
+	return ok && strings.TrimSpace(text) == ""
+}
+
+// mergeAttributes 把 patch 合并到 current：值为空表示移除该字段，键为自定义字段的 key。
+// 返回合并后的属性、字段错误（键为 attributes.<key>）和修改到的敏感字段
+func mergeAttributes(fields []model.UserField, current model.Attributes, patch map[string]interface{}) (model.Attributes, FieldErrors, []string) {
+	defined := make(map[string]*model.UserField, len(fields))
+	for i := range fields {
+		defined[fields[i].Key] = &fields[i]
+	}
+
+	merged := make(model.Attributes, len(current)+len(patch))
+	for key, value := range current {
+		merged[key] = value
+	}
+	errs := FieldErrors{}
+	var sensitive []string
+	for key, value := range patch {
+		name := "attributes." + key
+		field, ok := defined[key]
+		if !ok {
+			errs[name] = "未定义的字段"
+			continue
+		}
+		if field.Visibility == model.UserFieldSensitive {
+			sensitive = append(sensitive, name)
+		}
+		if isEmptyAttribute(value) {
+			delete(merged, key)
+			continue
+		}
+		v, err := userFieldValue(field, value)
+		if err != nil {
+			errs[name] = err.Error()
+			continue
+		}
+		merged[key] = v
+	}
+	requiredAttributes(errs, fields, merged)
+	return merged, errs, sensitive
+}
+
+// requiredAttributes 检查必填的自定义字段是否都有值
+func requiredAttributes(errs FieldErrors, fields []model.UserField, attributes model.Attributes) {
+	for _, field := range fields {
+		if _, ok := attributes[field.Key]; field.Required && !ok {
+			name := "attributes." + field.Key
+			if _, exists := errs[name]; !exists {
+				errs[name] = "不能为空"
+			}
+		}
+	}
+}
+
+// checkSensitiveAttributes 修改敏感字段需要 user:sensitive 权限
+func (s *UserService) checkSensitiveAttributes(ctx context.Context, operatorID int, names []string) error {
+	gated := make(map[string]string, len(names))
+	for _, name := range names {
+		gated[name] = PermissionUserSensitive
+	}
+	return s.forbiddenFields(ctx, operatorID, gated)
+}
+
+// sensitiveAttributeKeys 操作人没有 user:sensitive 权限时返回需要隐藏的字段，有权限时返回nil
+func (s *UserService) sensitiveAttributeKeys(ctx context.Context, operatorID int) ([]string, error) {
+	permissions, err := s.GetUserPermissions(ctx, uint(operatorID))
+	if err != nil {
+		return nil, err
+	}
+	if permissions.HasPermission(PermissionUserSensitive) {
+		return nil, nil
+	}
+	var keys []string
+	err = s.db.WithContext(ctx).Model(&model.UserField{}).
+		Where("visibility = ?", model.UserFieldSensitive).Pluck("key", &keys).Error
+	return keys, err
+}
+
+// hideSensitiveAttributes 从返回给操作人的用户中移除没有权限查看的敏感字段
+func (s *UserService) hideSensitiveAttributes(ctx context.Context, operatorID int, users ...*model.User) error {
+	redactor, err := s.attributeRedactor(ctx, operatorID)
+	if err != nil {
+		return err
+	}
+	redactor.users(users...)
+	return nil
+}
+
+// attributeRedactor 移除操作人没有权限查看的敏感自定义字段，返回用户自定义字段的接口（用户详情和列表、
+// 用户组成员、回收站、搜索结果、变更历史、变更请求）都通过它处理
+type attributeRedactor struct {
+	hidden []string
+}
+
+// attributeRedactor 按操作人的 user:sensitive 权限创建，有权限时不移除任何字段
+func (s *UserService) attributeRedactor(ctx context.Context, operatorID int) (*attributeRedactor, error) {
+	keys, err := s.sensitiveAttributeKeys(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	return &attributeRedactor{hidden: keys}, nil
+}
+
+func (r *attributeRedactor) users(users ...*model.User) {
+	for _, user := range users {
+		for _, key := range r.hidden {
+			delete(user.Attributes, key)
+		}
+	}
+}
+
+// historyEntries 移除用户变更历史的快照和差异中的敏感字段，只有敏感字段变化时差异中不再列出 attributes
+func (r *attributeRedactor) historyEntries(entries []history.Entry) error {
+	if len(r.hidden) == 0 {
+		return nil
+	}
+	for i := range entries {
+		entry := &entries[i]
+		var err error
+		if entry.Before, err = r.snapshot(entry.Before); err != nil {
+			return err
+		}
+		if entry.After, err = r.snapshot(entry.After); err != nil {
+			return err
+		}
+		if entry.Diff, err = r.diff(entry.Diff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// snapshot 处理 {"attributes": {...}, ...} 形式的快照
+func (r *attributeRedactor) snapshot(data history.JSON) (history.JSON, error) {
+	if data == "" {
+		return data, nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return "", err
+	}
+	attributes, ok := values["attributes"]
+	if !ok {
+		return data, nil
+	}
+	redacted, err := r.rawAttributes(attributes)
+	if err != nil {
+		return "", err
+	}
+	values["attributes"] = redacted
+	encoded, err := json.Marshal(values)
+	return history.JSON(encoded), err
+}
+
+// diff 处理 {"attributes": {"before": {...}, "after": {...}}, ...} 形式的差异
+func (r *attributeRedactor) diff(data history.JSON) (history.JSON, error) {
+	if data == "" {
+		return data, nil
+	}
+	type change struct {
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}
+	var changes map[string]change
+	if err := json.Unmarshal([]byte(data), &changes); err != nil {
+		return "", err
+	}
+	c, ok := changes["attributes"]
+	if !ok {
+		return data, nil
+	}
+	var err error
+	if c.Before, err = r.rawAttributes(c.Before); err != nil {
+		return "", err
+	}
+	if c.After, err = r.rawAttributes(c.After); err != nil {
+		return "", err
+	}
+	if string(c.Before) == string(c.After) {
+		delete(changes, "attributes")
+	} else {
+		changes["attributes"] = c
+	}
+	if len(changes) == 0 {
+		return "", nil
+	}
+	encoded, err := json.Marshal(changes)
+	return history.JSON(encoded), err
+}
+
+// changeRequests 移除变更请求内容中的敏感字段，并隐藏密码。
+// 变更请求只记录需要审批的字段，旧版本提交的修改角色请求可能带有整个更新内容
+func (r *attributeRedactor) changeRequests(requests ...*model.ChangeRequest) error {
+	for _, request := range requests {
+		var payload map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(request.Payload), &payload); err != nil || payload == nil {
+			// 不是JSON对象的内容（如删除用户）不包含用户字段
+			continue
+		}
+		changed := false
+		if password, ok := payload["password"]; ok && string(password) != "null" {
+			payload["password"] = json.RawMessage(`"******"`)
+			changed = true
+		}
+		if attributes, ok := payload["attributes"]; ok && len(r.hidden) > 0 {
+			redacted, err := r.rawAttributes(attributes)
+			if err != nil {
+				return err
+			}
+			payload["attributes"] = redacted
+			changed = true
+		}
+		if changed {
+			encoded, err := json.Marshal(payload)
+			if err != nil {
+				return err
+			}
+			request.Payload = string(encoded)
+		}
+	}
+	return nil
+}
+
+// rawAttributes 移除JSON对象形式的自定义字段中的敏感字段，null 原样返回
+func (r *attributeRedactor) rawAttributes(data json.RawMessage) (json.RawMessage, error) {
+	var attributes map[string]json.RawMessage
+	if err := json.Unmarshal(data, &attributes); err != nil || attributes == nil {
+		return data, err
+	}
+	for _, key := range r.hidden {
+		delete(attributes, key)
+	}
+	return json.Marshal(attributes)
+}
+
+// attributePath 自定义字段在 users.attributes 中的JSON路径，key 已按 UserFieldKeyPattern 校验
+func attributePath(key string) string {
+	return `$."` + key + `"`
+}
+
+// UserListSchema 当前租户的用户列表字段：在 UserListSchema 的基础上返回 attributes，
+// 并可以用 attr.<key> 按自定义字段过滤。操作人没有 user:sensitive 权限时不能按敏感字段过滤
+func (s *UserService) UserListSchema(ctx context.Context, operatorID int) (*listquery.Schema, error) {
+	fields, err := s.GetUserFields(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hidden, err := s.sensitiveAttributeKeys(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	return userListSchema(fields, hidden), nil
+}
+
+func userListSchema(fields []model.UserField, hidden []string) *listquery.Schema {
+	schema := &listquery.Schema{
+		Table:       UserListSchema.Table,
+		Fields:      make(map[string]listquery.Field, len(UserListSchema.Fields)+len(fields)+1),
+		Search:      UserListSchema.Search,
+		DefaultSort: UserListSchema.DefaultSort,
+		MaxPageSize: UserListSchema.MaxPageSize,
+	}
+	for name, field := range UserListSchema.Fields {
+		schema.Fields[name] = field
+	}
+	schema.Fields["attributes"] = listquery.Field{Column: "attributes", Type: listquery.String}
+
+	skip := make(map[string]bool, len(hidden))
+	for _, key := range hidden {
+		skip[key] = true
+	}
+	for _, field := range fields {
+		if skip[field.Key] {
+			continue
+		}
+		value := fmt.Sprintf("JSON_UNQUOTE(JSON_EXTRACT(users.attributes, '%s'))", attributePath(field.Key))
+		filter := listquery.Field{Column: "attributes", Type: listquery.String, Filter: true, Nullable: true, Expression: value}
+		switch field.Type {
+		case model.UserFieldNumber:
+			filter.Type = listquery.Float
+			filter.Expression = "CAST(" + value + " AS DECIMAL(65,10))"
+		case model.UserFieldDate:
+			filter.Type = listquery.Time
+			filter.Expression = "CAST(" + value + " AS DATETIME)"
+		}
+		schema.Fields[attributeFilterPrefix+field.Key] = filter
+	}
+	return schema
+}
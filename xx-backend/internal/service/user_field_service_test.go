@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+)
+
+// fakeUserTables 用户7带有普通字段 emp_no 和敏感字段 id_card，操作人1属于租户1且数据范围为全部
+func fakeUserTables(t *testing.T, requests ...model.ChangeRequest) *gorm.DB {
+	t.Helper()
+	newUser := func() model.User {
+		return model.User{ID: 7, TenantID: 1, Username: "alice", Attributes: model.Attributes{"emp_no": "A1", "id_card": "110"}}
+	}
+	db := fakeTables(t, map[string]func(tx *gorm.DB){
+		"users": func(tx *gorm.DB) {
+			switch dest := tx.Statement.Dest.(type) {
+			case *model.User:
+				*dest = newUser()
+			case *[]model.User:
+				*dest = append(*dest, newUser())
+			case *[]DeletedUser:
+				*dest = append(*dest, DeletedUser{User: newUser()})
+			case *int64:
+				*dest = 1
+			}
+			tx.RowsAffected = 1
+		},
+		"groups": func(tx *gorm.DB) {
+			if group, ok := tx.Statement.Dest.(*model.Group); ok {
+				group.ID = 2
+				tx.RowsAffected = 1
+			}
+		},
+		"user_fields": sensitiveFields("id_card"),
+		"change_requests": func(tx *gorm.DB) {
+			switch dest := tx.Statement.Dest.(type) {
+			case *model.ChangeRequest:
+				*dest = requests[0]
+			case *[]model.ChangeRequest:
+				*dest = append(*dest, requests...)
+			case *int64:
+				*dest = int64(len(requests))
+			}
+			tx.RowsAffected = 1
+		},
+	})
+	// 审批时条件更新变更请求的状态
+	if err := db.Callback().Update().Replace("gorm:update", func(tx *gorm.DB) { tx.RowsAffected = 1 }); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func parseQuery(t *testing.T, schema *listquery.Schema) *listquery.Query {
+	t.Helper()
+	q, err := listquery.Parse(url.Values{}, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q
+}
+
+func TestSensitiveAttributesHidden(t *testing.T) {
+	endpoints := []struct {
+		name string
+		call func(t *testing.T, s *UserService, ctx context.Context) []model.Attributes
+	}{
+		{
+			name: "get user",
+			call: func(t *testing.T, s *UserService, ctx context.Context) []model.Attributes {
+				user, err := s.GetUser(ctx, 1, 7)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return []model.Attributes{user.Attributes}
+			},
+		},
+		{
+			name: "list users",
+			call: func(t *testing.T, s *UserService, ctx context.Context) []model.Attributes {
+				result, err := s.GetUsers(ctx, 1, parseQuery(t, UserListSchema))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return []model.Attributes{result.List[0].Attributes}
+			},
+		},
+		{
+			name: "group members",
+			call: func(t *testing.T, s *UserService, ctx context.Context) []model.Attributes {
+				result, err := s.GetGroupMembers(ctx, 1, 2, false, parseQuery(t, UserListSchema))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return []model.Attributes{result.List[0].Attributes}
+			},
+		},
+		{
+			name: "recycle bin",
+			call: func(t *testing.T, s *UserService, ctx context.Context) []model.Attributes {
+				result, err := s.GetDeletedUsers(ctx, 1, parseQuery(t, DeletedUserListSchema))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return []model.Attributes{result.List[0].Attributes}
+			},
+		},
+		{
+			name: "search",
+			call: func(t *testing.T, s *UserService, ctx context.Context) []model.Attributes {
+				index, err := openUserIndex("")
+				if err != nil {
+					t.Fatal(err)
+				}
+				x := &userSearchIndex{index: index}
+				if err := x.put(7, userSearchDocument{ID: 7, TenantID: 1, Username: "alice"}); err != nil {
+					t.Fatal(err)
+				}
+				s.search.Store(x)
+
+				result, err := s.SearchUsers(tenant.WithTenant(ctx, 1), 1, &UserSearchRequest{Query: "alice"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(result.List) != 1 {
+					t.Fatalf("hits = %d, want 1", len(result.List))
+				}
+				return []model.Attributes{result.List[0].User.Attributes}
+			},
+		},
+	}
+
+	for _, endpoint := range endpoints {
+		for _, sensitive := range []bool{false, true} {
+			name := endpoint.name
+			if sensitive {
+				name += " with user:sensitive"
+			}
+			t.Run(name, func(t *testing.T) {
+				s := NewUserService(fakeUserTables(t), nil, nil)
+				if sensitive {
+					grantPermissions(s, 1, PermissionUserSensitive)
+				} else {
+					grantPermissions(s, 1)
+				}
+
+				for _, attributes := range endpoint.call(t, s, context.Background()) {
+					if attributes["emp_no"] != "A1" {
+						t.Errorf("attributes = %v, want emp_no", attributes)
+					}
+					if _, ok := attributes["id_card"]; ok != sensitive {
+						t.Errorf("attributes = %v, want id_card %v", attributes, sensitive)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestChangeRequestPayloadRedacted(t *testing.T) {
+	// 旧版本提交的修改角色请求记录了整个更新内容
+	legacy := model.ChangeRequest{
+		ID:          3,
+		Type:        model.ChangeRoleAssign,
+		TargetID:    7,
+		Payload:     `{"attributes":{"emp_no":"A1","id_card":"110"},"password":"abcd1234","role_id":3}`,
+		Status:      model.ChangeStatusPending,
+		RequestedBy: 2,
+	}
+	endpoints := []struct {
+		name string
+		call func(t *testing.T, s *UserService) string
+	}{
+		{
+			name: "get change request",
+			call: func(t *testing.T, s *UserService) string {
+				request, err := s.GetChangeRequest(context.Background(), 1, 3)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return request.Payload
+			},
+		},
+		{
+			name: "list change requests",
+			call: func(t *testing.T, s *UserService) string {
+				result, err := s.GetChangeRequests(context.Background(), 1, parseQuery(t, ChangeRequestListSchema))
+				if err != nil {
+					t.Fatal(err)
+				}
+				return result.List[0].Payload
+			},
+		},
+		{
+			name: "reject change request",
+			call: func(t *testing.T, s *UserService) string {
+				request, err := s.RejectChangeRequest(context.Background(), 1, 3, "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				return request.Payload
+			},
+		},
+	}
+	tests := []struct {
+		permissions []string
+		want        string
+	}{
+		{
+			permissions: []string{PermissionChangeRequestReview},
+			want:        `{"attributes":{"emp_no":"A1"},"password":"******","role_id":3}`,
+		},
+		{
+			permissions: []string{PermissionChangeRequestReview, PermissionUserSensitive},
+			want:        `{"attributes":{"emp_no":"A1","id_card":"110"},"password":"******","role_id":3}`,
+		},
+	}
+	for _, endpoint := range endpoints {
+		for _, tt := range tests {
+			t.Run(endpoint.name, func(t *testing.T) {
+				s := NewUserService(fakeUserTables(t, legacy), nil, nil)
+				grantPermissions(s, 1, tt.permissions...)
+				if got := endpoint.call(t, s); got != tt.want {
+					t.Errorf("payload = %s, want %s", got, tt.want)
+				}
+			})
+		}
+	}
+}
@@ -1,22 +1,45 @@
 package service
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"xx-backend/internal/model"
+	"xx-backend/pkg/listquery"
+	"xx-backend/pkg/tenant"
 
 	"github.com/go-redis/redis/v8"
 	"gorm.io/gorm"
 )
 
+// ErrOutOfDataScope 目标超出操作人的数据范围
+var ErrOutOfDataScope = errors.New("超出数据权限范围")
+
+// defaultRoleName 普通用户角色，每个租户都有。自助注册的用户、导入时未指定角色的用户，
+// 以及分配角色需要审批时审批通过前的新用户使用该角色
+const defaultRoleName = "user"
+
 type UserService struct {
 	db           *gorm.DB
 	redis        *redis.Client
 	kafkaService *KafkaService
+	roleCache    *roleCache
 	mu           sync.RWMutex
+
+	approvalActions map[string]bool                 // 需要审批的变更类型
+	exportDir       string                          // 后台导出任务生成文件的目录
+	exportSyncLimit int                             // 超过该行数的导出转为后台任务，0表示不限制
+	bulkMaxWorkers  int                             // 批量操作的最大并发数
+	search          atomic.Pointer[userSearchIndex] // 用户全文索引，未启用时为nil
+	inviteURL       string                          // 邀请链接的页面地址
+	inviteSecret    []byte                          // 邀请token的签名密钥
+	inviteTTL       time.Duration                   // 邀请链接的有效期
 }
 
 func NewUserService(db *gorm.DB, redis *redis.Client, kafkaService *KafkaService) *UserService {
@@ -24,59 +47,95 @@ func NewUserService(db *gorm.DB, redis *redis.Client, kafkaService *KafkaService
 		db:           db,
 		redis:        redis,
 		kafkaService: kafkaService,
+		roleCache:    newRoleCache(),
 	}
 }
 
-// GetUsers 获取用户列表（支持分页和搜索）
-func (s *UserService) GetUsers(page, pageSize int, search string) ([]model.User, int64, error) {
-	var users []model.User
-	var total int64
-
-	query := s.db.Model(&model.User{}).Preload("Role")
-
-	if search != "" {
-		query = query.Where("username LIKE ? OR nickname LIKE ?", "%"+search+"%", "%"+search+"%")
+// GetUsers 获取用户列表（支持过滤、排序、字段选择、页码或游标分页，按操作人的数据范围过滤）
+func (s *UserService) GetUsers(ctx context.Context, operatorID int, q *listquery.Query) (*listquery.Result[model.User], error) {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
 	}
-
-	// 获取总数
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+	result, err := listquery.Find[model.User](s.db.WithContext(ctx).Scopes(scope.apply), q)
+	if err != nil {
+		return nil, err
 	}
-
-	// 分页查询
-	offset := (page - 1) * pageSize
-	if err := query.Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
-		return nil, 0, err
+	users := make([]*model.User, len(result.List))
+	for i := range result.List {
+		users[i] = &result.List[i]
 	}
-
-	return users, total, nil
+	if err := s.hideSensitiveAttributes(ctx, operatorID, users...); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
-// GetUser 根据ID获取用户
-func (s *UserService) GetUser(id int) (*model.User, error) {
+// GetUser 根据ID获取用户（按操作人的数据范围过滤）
+func (s *UserService) GetUser(ctx context.Context, operatorID, id int) (*model.User, error) {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+
 	var user model.User
-	if err := s.db.Preload("Role").First(&user, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).Scopes(scope.apply).Preload("Role").Preload("Department").First(&user, id).Error; err != nil {
+		return nil, err
+	}
+	if err := s.hideSensitiveAttributes(ctx, operatorID, &user); err != nil {
 		return nil, err
 	}
 	return &user, nil
 }
 
-// CreateUser 创建用户
-func (s *UserService) CreateUser(user *model.User) error {
+// CreateUser 创建用户，自定义字段的值按字段定义校验，设置敏感字段需要 user:sensitive 权限，
+// 设置计划停用时间需要 user:status 权限，指定普通用户以外的角色需要 user:role 权限。
+// 分配角色需要审批时先以普通用户角色创建，再提交修改角色的变更请求，返回 ApprovalRequiredError
+func (s *UserService) CreateUser(ctx context.Context, operatorID int, user *model.User) error {
+	approval := s.needsApproval(ctx, model.ChangeRoleAssign)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	fields, err := s.GetUserFields(ctx)
+	if err != nil {
+		return err
+	}
+	attributes, errs, sensitive := mergeAttributes(fields, nil, user.Attributes)
+	if err := errs.err(); err != nil {
+		return err
+	}
+	if err := s.checkSensitiveAttributes(ctx, operatorID, sensitive); err != nil {
+		return err
+	}
+	if user.DeactivateAt != nil {
+		if err := s.forbiddenFields(ctx, operatorID, map[string]string{"deactivate_at": PermissionUserStatus}); err != nil {
+			return err
+		}
+	}
+	pendingRoleID, err := s.initialRole(ctx, operatorID, &user.RoleID, approval)
+	if err != nil {
+		return err
+	}
+	// 请求体直接绑定到模型，由系统维护的字段不能由调用方指定
+	user.ID = 0
+	user.Attributes = attributes
+	user.LastLoginAt = nil
+	user.EnabledAt = nil
+	user.ErasedAt = nil
+	user.DeletedKey = 0
+	user.Version = 0
+
 	// 检查用户名是否已存在
 	var count int64
-	if err := s.db.Model(&model.User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+	if err := s.db.WithContext(ctx).Model(&model.User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
 		return err
 	}
 	if count > 0 {
 		return fmt.Errorf("用户名已存在")
 	}
 
-	err := s.db.Create(user).Error
-	if err != nil {
+	if err := s.db.WithContext(ctx).Create(user).Error; err != nil {
 		return err
 	}
 
@@ -88,53 +147,141 @@ func (s *UserService) CreateUser(user *model.User) error {
 		}
 	}
 
+	if pendingRoleID != 0 {
+		return s.submitForApproval(ctx, operatorID, model.ChangeRoleAssign, int(user.ID), map[string]int{"role_id": pendingRoleID})
+	}
 	return nil
 }
 
-// UpdateUser 更新用户
-func (s *UserService) UpdateUser(id int, updates map[string]interface{}) error {
+// initialRole 校验新用户的角色：普通用户以外的角色需要 user:role 权限。approval 为 true 时
+// 把 roleID 改为普通用户角色，返回需要审批的角色（不需要审批时返回0）
+func (s *UserService) initialRole(ctx context.Context, operatorID int, roleID *int, approval bool) (int, error) {
+	if *roleID == 0 {
+		return 0, nil
+	}
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, *roleID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, FieldErrors{"role_id": "角色不存在"}
+		}
+		return 0, err
+	}
+	if role.Name == defaultRoleName {
+		return 0, nil
+	}
+	if err := s.forbiddenFields(ctx, operatorID, map[string]string{"role_id": PermissionUserRole}); err != nil {
+		return 0, err
+	}
+	if !approval {
+		return 0, nil
+	}
+	defaultRole, err := s.defaultRole(ctx)
+	if err != nil {
+		return 0, err
+	}
+	*roleID = defaultRole.ID
+	return role.ID, nil
+}
+
+// UpdateUser 更新用户（只能更新操作人数据范围内的用户），返回更新后的版本号。
+// version 不为0时只在用户的当前版本号一致时更新，否则返回 ErrPreconditionFailed。
+// 修改角色需要审批时先校验，再只以新角色提交变更请求，返回 ApprovalRequiredError；
+// 此时不能同时修改其他字段，变更请求中不保存密码等其他内容
+func (s *UserService) UpdateUser(ctx context.Context, operatorID, id int, update *UserUpdate, version int) (int, error) {
+	if update.RoleID.Set && s.needsApproval(ctx, model.ChangeRoleAssign) {
+		user, columns, err := s.prepareUserUpdate(ctx, operatorID, id, update, version)
+		if err != nil {
+			return 0, err
+		}
+		// 角色没有变化时按普通更新处理
+		if roleID, ok := columns["role_id"].(int); ok && roleID != user.RoleID {
+			errs := FieldErrors{}
+			for _, name := range setFields(update) {
+				if name != "role_id" {
+					errs[name] = "修改角色需要审批，不能与其他字段一起修改"
+				}
+			}
+			if err := errs.err(); err != nil {
+				return 0, err
+			}
+			return 0, s.submitForApproval(ctx, operatorID, model.ChangeRoleAssign, id, map[string]int{"role_id": roleID})
+		}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	// 获取用户信息用于Kafka记录
-	var user model.User
-	if err := s.db.First(&user, id).Error; err != nil {
-		return err
+	user, columns, err := s.prepareUserUpdate(ctx, operatorID, id, update, version)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) == 0 {
+		return user.Version, nil
 	}
 
-	err := s.db.Model(&model.User{}).Where("id = ?", id).Updates(updates).Error
-	if err != nil {
-		return err
+	if err := updateVersioned(s.db.WithContext(ctx), &model.User{}, id, version, columns); err != nil {
+		return 0, err
 	}
 
-	// 记录用户更新事件到Kafka
-	if s.kafkaService != nil {
-		if err := s.kafkaService.LogUserUpdate(user.ID, user.Username, updates); err != nil {
-			// 记录Kafka错误但不影响用户更新流程
-			fmt.Printf("Failed to log user update to Kafka: %v\n", err)
-		}
+	if _, ok := columns["role_id"]; ok {
+		s.roleCache.invalidateUser(user.ID)
+	}
+	// 禁用或修改密码后需要重新登录，事件中不记录密码
+	if _, ok := columns["password"]; ok {
+		s.revokeSession(ctx, user.ID)
+		columns["password"] = "reset"
+	} else if status, ok := columns["status"]; ok && status == 0 {
+		s.revokeSession(ctx, user.ID)
 	}
 
-	return nil
+	// 记录用户更新事件到Kafka
+	s.logUserUpdate(user, columns)
+	return s.currentVersion(ctx, &model.User{}, id)
 }
 
-// DeleteUser 删除用户
-func (s *UserService) DeleteUser(id int) error {
+// DeleteUser 删除用户（只能删除操作人数据范围内的用户），version 不为0时只删除该版本的用户。
+// 需要审批时只校验版本号并提交变更请求，返回 ApprovalRequiredError
+func (s *UserService) DeleteUser(ctx context.Context, operatorID, id, version int) error {
+	if s.needsApproval(ctx, model.ChangeUserDelete) {
+		user, err := s.GetUser(ctx, operatorID, id)
+		if err != nil {
+			return err
+		}
+		if err := checkVersion(user.Version, version); err != nil {
+			return err
+		}
+		return s.submitForApproval(ctx, operatorID, model.ChangeUserDelete, id, nil)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return err
+	}
+
 	// 获取用户信息用于Kafka记录
 	var user model.User
-	if err := s.db.First(&user, id).Error; err != nil {
+	if err := s.db.WithContext(ctx).Scopes(scope.apply).First(&user, id).Error; err != nil {
 		return err
 	}
 
-	err := s.db.Delete(&model.User{}, id).Error
+	if err := checkVersion(user.Version, version); err != nil {
+		return err
+	}
+
+	err = softDelete(s.db.WithContext(ctx), &model.User{}, id, version)
 	if err != nil {
 		return err
 	}
 
-	// 记录用户删除事件到Kafka
+	s.logUserDelete(&user)
+	return nil
+}
+
+// logUserDelete 记录用户删除事件到Kafka
+func (s *UserService) logUserDelete(user *model.User) {
 	if s.kafkaService != nil {
 		data := map[string]interface{}{
 			"user_id":  user.ID,
@@ -146,14 +293,12 @@ func (s *UserService) DeleteUser(id int) error {
 			fmt.Printf("Failed to log user delete to Kafka: %v\n", err)
 		}
 	}
-
-	return nil
 }
 
-// GetProfile 获取用户资料
-func (s *UserService) GetProfile(userID int) (*model.User, error) {
+// GetProfile 获取用户资料（userID来自token，平台超级管理员切换租户后也能读取自己的资料）
+func (s *UserService) GetProfile(ctx context.Context, userID int) (*model.User, error) {
 	var user model.User
-	err := s.db.Preload("Role").First(&user, userID).Error
+	err := s.db.WithContext(tenant.WithoutTenant(ctx)).Preload("Role").First(&user, userID).Error
 	if err != nil {
 		return nil, err
 	}
@@ -161,125 +306,478 @@ func (s *UserService) GetProfile(userID int) (*model.User, error) {
 }
 
 // GetRoles 获取角色列表
-func (s *UserService) GetRoles() ([]model.Role, error) {
-	var roles []model.Role
-	if err := s.db.Find(&roles).Error; err != nil {
-		return nil, err
-	}
-	return roles, nil
+func (s *UserService) GetRoles(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Role], error) {
+	return listquery.Find[model.Role](s.db.WithContext(ctx), q)
 }
 
-// CreateRole 创建角色
-func (s *UserService) CreateRole(role *model.Role) error {
+// CreateRole 创建角色，指定数据范围时需要 role:data_scope 权限。
+// 自定义数据范围的部门和用户组只按ID关联，必须是当前租户中存在的部门和用户组
+func (s *UserService) CreateRole(ctx context.Context, operatorID int, role *model.Role) error {
+	if role.DataScope != "" || len(role.DataScopeDepartments) > 0 || len(role.DataScopeGroups) > 0 {
+		if err := s.forbiddenFields(ctx, operatorID, map[string]string{"data_scope": PermissionRoleDataScope}); err != nil {
+			return err
+		}
+	}
+	if role.DataScope != "" && !model.IsValidDataScope(role.DataScope) {
+		return FieldErrors{"data_scope": fmt.Sprintf("无效的数据范围: %s", role.DataScope)}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.db.Create(role).Error
+	if role.ParentID != nil {
+		if err := s.checkRoleParent(ctx, 0, *role.ParentID); err != nil {
+			return err
+		}
+	}
+
+	departmentIDs := make([]int, len(role.DataScopeDepartments))
+	for i, department := range role.DataScopeDepartments {
+		departmentIDs[i] = department.ID
+	}
+	groupIDs := make([]int, len(role.DataScopeGroups))
+	for i, group := range role.DataScopeGroups {
+		groupIDs[i] = group.ID
+	}
+	departments, groups, err := s.findDataScopeTargets(ctx, role.DataScope, departmentIDs, groupIDs)
+	if err != nil {
+		return err
+	}
+
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Permissions", "Menus", "DataScopeDepartments", "DataScopeGroups").Create(role).Error; err != nil {
+			return err
+		}
+		if len(departments) > 0 || len(groups) > 0 {
+			if err := replaceDataScopeTargets(tx, role, departments, groups); err != nil {
+				return err
+			}
+		}
+		role.DataScopeDepartments, role.DataScopeGroups = departments, groups
+		return nil
+	})
+}
+
+// GetRole 获取角色详情
+func (s *UserService) GetRole(ctx context.Context, id int) (*model.Role, error) {
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, id).Error; err != nil {
+		return nil, err
+	}
+	return &role, nil
 }
 
-// UpdateRole 更新角色
-func (s *UserService) UpdateRole(id uint, updates map[string]interface{}) error {
+// UpdateRole 更新角色，返回更新后的版本号。version 不为0时只在版本号一致时更新。
+// 修改父角色会改变继承的权限，需要审批时先校验，再以整个更新内容提交变更请求，返回 ApprovalRequiredError
+func (s *UserService) UpdateRole(ctx context.Context, operatorID, id int, update *RoleUpdate, version int) (int, error) {
+	if update.ParentID.Set && s.needsApproval(ctx, model.ChangeRoleParent) {
+		if _, err := s.prepareRoleUpdate(ctx, operatorID, id, update, version); err != nil {
+			return 0, err
+		}
+		payload, err := encodeMergePatch(update)
+		if err != nil {
+			return 0, err
+		}
+		return 0, s.submitForApproval(ctx, operatorID, model.ChangeRoleParent, id, payload)
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.db.Model(&model.Role{}).Where("id = ?", id).Updates(updates).Error
+	columns, err := s.prepareRoleUpdate(ctx, operatorID, id, update, version)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) > 0 {
+		if err := updateVersioned(s.db.WithContext(ctx), &model.Role{}, id, version, columns); err != nil {
+			return 0, err
+		}
+		s.invalidateRoleTree(ctx, id)
+	}
+
+	return s.currentVersion(ctx, &model.Role{}, id)
 }
 
-// DeleteRole 删除角色
-func (s *UserService) DeleteRole(id uint) error {
+// DeleteRole 删除角色，strategy 决定仍被用户、子角色、用户组或限时授权引用时的处理方式，
+// RoleDeleteReassign 时用户和用户组改为 reassignTo 角色，限时授权被撤销；version 不为0时只删除该版本的角色。
+// 转移用户和用户组相当于为他们分配角色，需要 user:role 权限，开启 role_assign 审批时提交变更请求，返回 ApprovalRequiredError
+func (s *UserService) DeleteRole(ctx context.Context, operatorID int, id uint, strategy string, reassignTo, version int) error {
+	switch strategy {
+	case RoleDeleteBlock, RoleDeleteReassign, "":
+	default:
+		return FieldErrors{"strategy": fmt.Sprintf("未知的删除策略: %s", strategy)}
+	}
+	approval := strategy == RoleDeleteReassign && s.needsApproval(ctx, model.ChangeRoleDelete)
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.db.Delete(&model.Role{}, id).Error
+	var role model.Role
+	if err := s.db.WithContext(ctx).First(&role, id).Error; err != nil {
+		return err
+	}
+	if err := checkVersion(role.Version, version); err != nil {
+		return err
+	}
+
+	reassignChecked := false
+	if strategy == RoleDeleteReassign {
+		refs, err := findRoleReferences(s.db.WithContext(ctx), role.ID)
+		if err != nil {
+			return err
+		}
+		if refs.users > 0 || refs.groups > 0 {
+			if err := checkReassignTarget(s.db.WithContext(ctx), role.ID, reassignTo, refs); err != nil {
+				return err
+			}
+			if err := s.forbiddenFields(ctx, operatorID, map[string]string{"reassign_to": PermissionUserRole}); err != nil {
+				return err
+			}
+			if approval {
+				return s.submitForApproval(ctx, operatorID, model.ChangeRoleDelete, role.ID, map[string]int{"reassign_to": reassignTo})
+			}
+			reassignChecked = true
+		}
+	}
+
+	descendants, err := s.roleDescendants(ctx, role.ID)
+	if err != nil {
+		return err
+	}
+
+	// 未撤销且未到期（包括尚未开始）的限时授权
+	var grants []model.RoleGrant
+	err = s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		refs, err := findRoleReferences(tx, role.ID)
+		if err != nil {
+			return err
+		}
+		grants = refs.grants
+
+		switch strategy {
+		case RoleDeleteBlock, "":
+			if refs.inUse() {
+				return fmt.Errorf("%w: 角色仍被%s引用", ErrConflict, refs)
+			}
+		case RoleDeleteReassign:
+			if refs.users > 0 || refs.groups > 0 {
+				// 校验权限之后又有用户或用户组使用了该角色，没有经过权限校验和审批，不能直接转移
+				if !reassignChecked {
+					return fmt.Errorf("%w: 角色的引用已变化，请重试", ErrConflict)
+				}
+				if err := checkReassignTarget(tx, role.ID, reassignTo, refs); err != nil {
+					return err
+				}
+				if err := tx.Model(&model.User{}).Where("role_id = ?", role.ID).Update("role_id", reassignTo).Error; err != nil {
+					return err
+				}
+				// 已经拥有接收角色的组只删除被删除角色，其余改为接收角色
+				if err := tx.Exec("DELETE FROM group_roles WHERE role_id = ? AND group_id IN (SELECT group_id FROM (SELECT group_id FROM group_roles WHERE role_id = ?) AS t)",
+					role.ID, reassignTo).Error; err != nil {
+					return err
+				}
+				if err := tx.Exec("UPDATE group_roles SET role_id = ? WHERE role_id = ?", reassignTo, role.ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&model.Role{}).Where("parent_id = ?", role.ID).Update("parent_id", role.ParentID).Error; err != nil {
+				return err
+			}
+			// 限时授权不转移到接收角色，直接撤销
+			if len(grants) > 0 {
+				grantIDs := make([]int, len(grants))
+				for i, grant := range grants {
+					grantIDs[i] = grant.ID
+				}
+				err := tx.Model(&model.RoleGrant{}).Where("id IN ? AND revoked_at IS NULL", grantIDs).
+					Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": roleDeletedRevokeReason}).Error
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return softDelete(tx, &model.Role{}, role.ID, version)
+	})
+	if err != nil {
+		return err
+	}
+
+	s.roleCache.invalidate(append(descendants, role.ID)...)
+
+	// 记录撤销事件到Kafka
+	if s.kafkaService != nil {
+		for _, grant := range grants {
+			if err := s.kafkaService.LogRoleRevoke(grant.ID, grant.UserID, grant.RoleID, roleDeletedRevokeReason); err != nil {
+				fmt.Printf("Failed to log role revoke to Kafka: %v\n", err)
+			}
+		}
+	}
+	return nil
 }
 
-// GetMenus 获取菜单列表
-func (s *UserService) GetMenus() ([]model.Menu, error) {
-	var menus []model.Menu
-	if err := s.db.Order("sort").Find(&menus).Error; err != nil {
+// checkReassignTarget 校验接收被删除角色的用户和用户组的角色
+func checkReassignTarget(tx *gorm.DB, roleID, reassignTo int, refs *roleReferences) error {
+	if reassignTo == 0 || reassignTo == roleID {
+		return FieldErrors{"reassign_to": fmt.Sprintf("需要指定其他角色来接收 %d 个用户和 %d 个用户组", refs.users, refs.groups)}
+	}
+	if err := tx.First(&model.Role{}, reassignTo).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return FieldErrors{"reassign_to": "接收用户的角色不存在"}
+		}
+		return err
+	}
+	return nil
+}
+
+// roleReferences 仍在引用角色的用户、子角色、用户组和未到期（包括尚未开始）的限时授权
+type roleReferences struct {
+	users    int64
+	children int64
+	groups   int64
+	grants   []model.RoleGrant
+}
+
+// findRoleReferences 统计角色的引用，excludeChildren 中的子角色不计入（如同时被删除的角色）
+func findRoleReferences(tx *gorm.DB, roleID int, excludeChildren ...int) (*roleReferences, error) {
+	refs := &roleReferences{}
+	if err := tx.Model(&model.User{}).Where("role_id = ?", roleID).Count(&refs.users).Error; err != nil {
 		return nil, err
 	}
-	return menus, nil
+	children := tx.Model(&model.Role{}).Where("parent_id = ?", roleID)
+	if len(excludeChildren) > 0 {
+		children = children.Where("id NOT IN ?", excludeChildren)
+	}
+	if err := children.Count(&refs.children).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Table("group_roles").Where("role_id = ?", roleID).Count(&refs.groups).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("role_id = ? AND revoked_at IS NULL AND expires_at > ?", roleID, time.Now()).Find(&refs.grants).Error; err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (r *roleReferences) inUse() bool {
+	return r.users > 0 || r.children > 0 || r.groups > 0 || len(r.grants) > 0
+}
+
+func (r *roleReferences) String() string {
+	return fmt.Sprintf(" %d 个用户、%d 个子角色、%d 个用户组和 %d 个限时授权", r.users, r.children, r.groups, len(r.grants))
+}
+
+// GetMenus 获取菜单列表
+func (s *UserService) GetMenus(ctx context.Context, q *listquery.Query) (*listquery.Result[model.Menu], error) {
+	return listquery.Find[model.Menu](s.db.WithContext(ctx), q)
 }
 
 // CreateMenu 创建菜单
-func (s *UserService) CreateMenu(menu *model.Menu) error {
+func (s *UserService) CreateMenu(ctx context.Context, menu *model.Menu) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.db.Create(menu).Error
+	if menu.ParentID != nil {
+		if err := s.checkMenuParent(ctx, s.db, 0, *menu.ParentID); err != nil {
+			return err
+		}
+	}
+
+	return s.db.WithContext(ctx).Create(menu).Error
+}
+
+// GetMenu 获取菜单详情
+func (s *UserService) GetMenu(ctx context.Context, id int) (*model.Menu, error) {
+	var menu model.Menu
+	if err := s.db.WithContext(ctx).First(&menu, id).Error; err != nil {
+		return nil, err
+	}
+	return &menu, nil
 }
 
-// UpdateMenu 更新菜单
-func (s *UserService) UpdateMenu(id uint, updates map[string]interface{}) error {
+// UpdateMenu 更新菜单，返回更新后的版本号。version 不为0时只在版本号一致时更新
+func (s *UserService) UpdateMenu(ctx context.Context, id int, update *MenuUpdate, version int) (int, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.db.Model(&model.Menu{}).Where("id = ?", id).Updates(updates).Error
+	columns, err := s.prepareMenuUpdate(ctx, id, update, version)
+	if err != nil {
+		return 0, err
+	}
+	if len(columns) > 0 {
+		if err := updateVersioned(s.db.WithContext(ctx), &model.Menu{}, id, version, columns); err != nil {
+			return 0, err
+		}
+		s.roleCache.invalidateAll()
+	}
+
+	return s.currentVersion(ctx, &model.Menu{}, id)
 }
 
-// DeleteMenu 删除菜单
-func (s *UserService) DeleteMenu(id uint) error {
+// DeleteMenu 删除菜单，strategy 决定存在子菜单时的处理方式，version 不为0时只删除该版本的菜单
+func (s *UserService) DeleteMenu(ctx context.Context, id uint, strategy string, version int) error {
+	switch strategy {
+	case MenuDeleteBlock, MenuDeleteCascade, MenuDeleteReparent, "":
+	default:
+		return FieldErrors{"strategy": fmt.Sprintf("未知的删除策略: %s", strategy)}
+	}
+
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	return s.db.Delete(&model.Menu{}, id).Error
+	var menu model.Menu
+	if err := s.db.WithContext(ctx).First(&menu, id).Error; err != nil {
+		return err
+	}
+	if err := checkVersion(menu.Version, version); err != nil {
+		return err
+	}
+
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var childCount int64
+		if err := tx.Model(&model.Menu{}).Where("parent_id = ?", menu.ID).Count(&childCount).Error; err != nil {
+			return err
+		}
+
+		switch strategy {
+		case MenuDeleteBlock, "":
+			if childCount > 0 {
+				return fmt.Errorf("%w: 菜单存在 %d 个子菜单", ErrConflict, childCount)
+			}
+		case MenuDeleteCascade:
+			descendants, err := s.menuDescendants(ctx, tx, menu.ID)
+			if err != nil {
+				return err
+			}
+			if len(descendants) > 0 {
+				if err := tx.Delete(&model.Menu{}, descendants).Error; err != nil {
+					return err
+				}
+			}
+		case MenuDeleteReparent:
+			if err := tx.Model(&model.Menu{}).Where("parent_id = ?", menu.ID).Update("parent_id", menu.ParentID).Error; err != nil {
+				return err
+			}
+		}
+
+		if version > 0 {
+			tx = tx.Where("version = ?", version)
+		}
+		result := tx.Delete(&menu)
+		if result.Error != nil {
+			return result.Error
+		}
+		if version > 0 && result.RowsAffected == 0 {
+			return ErrPreconditionFailed
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.roleCache.invalidateAll()
+	return nil
+}
+
+// 批量处理中单个用户的结果状态
+const (
+	BatchItemSucceeded = "succeeded"
+	BatchItemFailed    = "failed"
+	BatchItemSubmitted = "submitted" // 需要审批，已提交变更请求
+	BatchItemCancelled = "cancelled" // 任务取消时尚未处理
+)
+
+// BatchResult 批量处理中单个用户的结果
+type BatchResult struct {
+	UserID          int    `json:"user_id"`
+	Status          string `json:"status"`
+	Error           string `json:"error,omitempty"`
+	ChangeRequestID int    `json:"change_request_id,omitempty"`
 }
 
-// BatchProcessUsers 批量处理用户（多线程示例）
-func (s *UserService) BatchProcessUsers(userIDs []int, processor func(*model.User) error) error {
+// BatchProcessor 处理单个用户，可以修改 result（如标记为已提交审批），返回错误时该项记为失败
+type BatchProcessor func(ctx context.Context, user *model.User, result *BatchResult) error
+
+// BatchProcessUsers 使用工作池批量处理操作人数据范围内的用户，返回与 userIDs 一一对应的结果。
+// 每处理完一项调用 onResult（可能并发调用）；ctx 取消后尚未开始处理的项记为已取消
+func (s *UserService) BatchProcessUsers(ctx context.Context, operatorID int, userIDs []int, workers int, processor BatchProcessor, onResult func(BatchResult)) ([]BatchResult, error) {
+	scope, err := s.resolveDataScope(ctx, operatorID)
+	if err != nil {
+		return nil, err
+	}
+	if workers <= 0 {
+		workers = 1
+	}
+
+	results := make([]BatchResult, len(userIDs))
+	for i, userID := range userIDs {
+		results[i] = BatchResult{UserID: userID, Status: BatchItemCancelled}
+	}
+
 	var wg sync.WaitGroup
-	errChan := make(chan error, len(userIDs))
+	indexes := make(chan int)
 
-	// 创建工作池
-	workerCount := 5
-	userChan := make(chan int, len(userIDs))
+	// 已开始处理的用户不受取消影响，避免只完成一半
+	itemCtx := context.WithoutCancel(ctx)
 
 	// 启动工作协程
-	for i := 0; i < workerCount; i++ {
+	for i := 0; i < workers; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for userID := range userChan {
-				user, err := s.GetUser(userID)
+			for index := range indexes {
+				result := &results[index]
+				result.Status = BatchItemSucceeded
+
+				var user model.User
+				err := s.db.WithContext(itemCtx).Scopes(scope.apply).Preload("Role").First(&user, result.UserID).Error
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					err = fmt.Errorf("用户不存在或超出数据权限范围")
+				}
+				if err == nil {
+					err = processor(itemCtx, &user, result)
+				}
 				if err != nil {
-					errChan <- err
-					continue
+					result.Status = BatchItemFailed
+					result.Error = err.Error()
 				}
-				if err := processor(user); err != nil {
-					errChan <- err
+				if onResult != nil {
+					onResult(*result)
 				}
 			}
 		}()
 	}
 
-	// 发送任务
-	for _, userID := range userIDs {
-		userChan <- userID
+	// 发送任务，取消后不再分配新的用户
+dispatch:
+	for i := range userIDs {
+		select {
+		case <-ctx.Done():
+			break dispatch
+		case indexes <- i:
+		}
 	}
-	close(userChan)
+	close(indexes)
 
 	// 等待所有工作完成
 	wg.Wait()
-	close(errChan)
-
-	// 检查是否有错误
-	for err := range errChan {
-		if err != nil {
-			return err
-		}
-	}
 
-	return nil
+	return results, nil
 }
 
-func (s *UserService) Register(username, password, email string) error {
+func (s *UserService) Register(ctx context.Context, username, password, email string) error {
 	// 检查用户名是否已存在
 	var count int64
-	s.db.Model(&model.User{}).Where("username = ?", username).Count(&count)
+	s.db.WithContext(ctx).Model(&model.User{}).Where("username = ?", username).Count(&count)
 	if count > 0 {
 		return fmt.Errorf("用户名已存在")
 	}
+	role, err := s.defaultRole(ctx)
+	if err != nil {
+		return err
+	}
 	// 密码加密
 	hash := md5.Sum([]byte(password))
 	user := model.User{
@@ -287,11 +785,10 @@ func (s *UserService) Register(username, password, email string) error {
 		Password: hex.EncodeToString(hash[:]),
 		Email:    email,
 		Status:   1,
-		RoleID:   2, // 普通用户
+		RoleID:   role.ID, // 普通用户
 	}
 
-	err := s.db.Create(&user).Error
-	if err != nil {
+	if err := s.db.WithContext(ctx).Create(&user).Error; err != nil {
 		return err
 	}
 
@@ -305,3 +802,15 @@ func (s *UserService) Register(username, password, email string) error {
 
 	return nil
 }
+
+// defaultRole 获取当前租户的普通用户角色
+func (s *UserService) defaultRole(ctx context.Context) (*model.Role, error) {
+	var role model.Role
+	if err := s.db.WithContext(ctx).Where("name = ?", defaultRoleName).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("默认角色不存在")
+		}
+		return nil, err
+	}
+	return &role, nil
+}
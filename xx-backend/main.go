@@ -17,8 +17,10 @@ import (
 	"xx-backend/internal/model"
 	"xx-backend/internal/service"
 	"xx-backend/pkg/database"
+	"xx-backend/pkg/history"
 	"xx-backend/pkg/kafka"
 	"xx-backend/pkg/redis"
+	"xx-backend/pkg/tenant"
 
 	"github.com/gin-gonic/gin"
 	"google.golang.org/grpc"
@@ -33,11 +35,45 @@ func main() {
 	db := database.InitMySQL(cfg.MySQL)
 
 	// 自动迁移数据库表
-	err := db.AutoMigrate(&model.User{}, &model.Role{}, &model.Menu{})
+	err := db.AutoMigrate(&model.Tenant{}, &model.User{}, &model.Role{}, &model.Menu{}, &model.Permission{}, &model.Department{}, &model.Policy{}, &model.RoleGrant{}, &model.ChangeRequest{}, &model.Job{}, &model.UserField{}, &model.Group{}, &model.Invitation{}, &model.LifecyclePolicy{}, &model.LifecycleNotice{}, &model.LoginRecord{}, &history.Entry{})
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	// 唯一索引改为租户内唯一并包含 deleted_key，删除原来的唯一索引
+	legacyIndexes := []struct {
+		model interface{}
+		names []string
+	}{
+		{&model.User{}, []string{"idx_users_username", "idx_users_email", "username", "email", "idx_users_tenant_username", "idx_users_tenant_email"}},
+		{&model.Role{}, []string{"idx_roles_name", "name", "idx_roles_tenant_name"}},
+		{&model.Permission{}, []string{"idx_permissions_code"}},
+	}
+	for _, legacy := range legacyIndexes {
+		if err := database.DropIndexes(db, legacy.model, legacy.names...); err != nil {
+			log.Fatalf("Failed to drop legacy indexes: %v", err)
+		}
+	}
+
+	// 唯一索引包含 deleted_key，已软删除的记录不再占用用户名、邮箱和角色名
+	if err := database.BackfillDeletedKeys(db, "users", "roles"); err != nil {
+		log.Fatalf("Failed to backfill deleted keys: %v", err)
+	}
+
+	// 初始化默认租户，并开启租户隔离
+	tenantService := service.NewTenantService(db)
+	if err := tenantService.EnsureDefaultTenant(context.Background()); err != nil {
+		log.Fatalf("Failed to create default tenant: %v", err)
+	}
+	if err := tenant.RegisterCallbacks(db); err != nil {
+		log.Fatalf("Failed to register tenant callbacks: %v", err)
+	}
+
+	// 记录所有模型的变更历史（后台任务表只记录执行进度，不需要）
+	if err := history.RegisterCallbacks(db, "jobs", "login_records"); err != nil {
+		log.Fatalf("Failed to register history callbacks: %v", err)
+	}
+
 	// 初始化Redis连接
 	redisClient := redis.InitRedis(cfg.Redis)
 
@@ -75,6 +111,44 @@ func main() {
 	// 初始化服务层
 	userService := service.NewUserService(db, redisClient, kafkaService)
 	authService := service.NewAuthService(db, redisClient, kafkaService)
+	userService.SetApprovalActions(strings.Split(cfg.Approval.Actions, ","))
+	userService.SetExportOptions(cfg.Export.Dir, cfg.Export.SyncLimit)
+	userService.SetBulkMaxWorkers(cfg.Bulk.MaxWorkers)
+	userService.SetInviteOptions(cfg.Invite.URL, cfg.Invite.Secret, time.Duration(cfg.Invite.TTLHours)*time.Hour)
+
+	// 启用用户全文搜索，用户变更后同步索引
+	if err := userService.EnableSearch(context.Background(), cfg.Search.IndexPath); err != nil {
+		log.Fatalf("Failed to enable search: %v", err)
+	}
+
+	// 启动时把RBAC配置同步到默认租户（不删除配置中没有的数据）
+	if cfg.RBAC.Manifest != "" {
+		syncRBACManifest(userService, cfg.RBAC.Manifest)
+	}
+
+	// 初始化策略引擎，并订阅其他实例的策略变更
+	policyService := service.NewPolicyService(db, redisClient, userService)
+	if err := policyService.SetDefaultDecision(cfg.Authz.DefaultDecision); err != nil {
+		log.Fatalf("Invalid AUTHZ_DEFAULT_DECISION: %v", err)
+	}
+	if err := policyService.Load(context.Background()); err != nil {
+		log.Fatalf("Failed to load policies: %v", err)
+	}
+	policyService.StartWatcher(context.Background())
+
+	// 定期撤销到期的限时角色授权
+	userService.StartRoleGrantExpiryJob(context.Background(), time.Minute)
+
+	// 定期执行账号生命周期检查：禁用长期未登录和到达计划停用时间的用户，并提前提醒
+	userService.StartLifecycleJob(context.Background(), time.Hour)
+
+	// 定期清理过期的后台任务文件
+	userService.StartJobCleanupJob(context.Background(), time.Hour, time.Duration(cfg.Export.RetentionHours)*time.Hour)
+
+	// 定期永久删除回收站中超过保留天数的记录
+	if cfg.RecycleBin.RetentionDays > 0 {
+		userService.StartRecycleBinPurgeJob(context.Background(), time.Hour, time.Duration(cfg.RecycleBin.RetentionDays)*24*time.Hour)
+	}
 
 	// 初始化gRPC服务器
 	grpcServer := grpc.NewServer()
@@ -111,6 +185,7 @@ func main() {
 		c.Set("db", db)
 		c.Next()
 	})
+	r.Use(middleware.Tenant())
 
 	// 路由组
 	api := r.Group("/api")
@@ -121,38 +196,205 @@ func main() {
 			auth.POST("/login", handler.Login(authService))
 			auth.POST("/logout", middleware.AuthMiddleware(), handler.Logout(authService))
 			auth.GET("/profile", middleware.AuthMiddleware(), handler.GetProfile(userService))
+			auth.GET("/personal-data", middleware.AuthMiddleware(), handler.ExportMyPersonalData(userService))
 			auth.POST("/register", handler.Register(userService))
+			auth.GET("/invitation", handler.GetInvitationInfo(userService))
+			auth.POST("/invitation/accept", handler.AcceptInvitation(userService))
 		}
 
 		// 用户管理路由
 		users := api.Group("/users")
-		users.Use(middleware.AuthMiddleware())
+		users.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "user"))
 		{
 			users.GET("", handler.GetUsers(userService))
 			users.GET("/:id", handler.GetUser(userService))
 			users.POST("", handler.CreateUser(userService))
+			users.POST("/import", handler.ImportUsers(userService))
+			users.GET("/export", handler.ExportUsers(userService))
+			users.GET("/search", handler.SearchUsers(userService))
+			users.PUT("/bulk/:action", handler.BulkUsers(userService))
+			users.DELETE("/bulk", handler.BulkUsers(userService))
 			users.PUT("/:id", handler.UpdateUser(userService))
+			users.PATCH("/:id", handler.UpdateUser(userService))
 			users.DELETE("/:id", handler.DeleteUser(userService))
+			users.GET("/:id/history", handler.GetUserHistory(userService))
+			users.GET("/:id/personal-data", handler.ExportPersonalData(userService))
+			users.POST("/:id/erase", handler.EraseUser(userService))
+			users.GET("/:id/permissions", handler.GetUserPermissions(userService))
+			users.GET("/:id/grants", handler.GetRoleGrants(userService))
+			users.POST("/:id/grants", handler.CreateRoleGrant(userService))
+			users.DELETE("/:id/grants/:grant_id", handler.RevokeRoleGrant(userService))
+		}
+
+		// 邀请用户路由
+		invitations := api.Group("/invitations")
+		invitations.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "invitation"))
+		{
+			invitations.GET("", handler.GetInvitations(userService))
+			invitations.POST("", handler.CreateInvitation(userService))
+			invitations.GET("/:id", handler.GetInvitation(userService))
+			invitations.POST("/:id/resend", handler.ResendInvitation(userService))
+			invitations.POST("/:id/revoke", handler.RevokeInvitation(userService))
+		}
+
+		// 账号生命周期策略路由
+		lifecycle := api.Group("/lifecycle-policy")
+		lifecycle.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "lifecycle_policy"))
+		{
+			lifecycle.GET("", handler.GetLifecyclePolicy(userService))
+			lifecycle.PUT("", handler.SetLifecyclePolicy(userService))
+		}
+
+		// 用户自定义字段路由
+		userFields := api.Group("/user-fields")
+		userFields.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "user_field"))
+		{
+			userFields.GET("", handler.GetUserFields(userService))
+			userFields.POST("", handler.CreateUserField(userService))
+			userFields.GET("/:id", handler.GetUserField(userService))
+			userFields.PUT("/:id", handler.UpdateUserField(userService))
+			userFields.PATCH("/:id", handler.UpdateUserField(userService))
+			userFields.DELETE("/:id", handler.DeleteUserField(userService))
+		}
+
+		// 用户组路由
+		groups := api.Group("/groups")
+		groups.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "group"))
+		{
+			groups.GET("", handler.GetGroups(userService))
+			groups.POST("", handler.CreateGroup(userService))
+			groups.GET("/:id", handler.GetGroup(userService))
+			groups.PUT("/:id", handler.UpdateGroup(userService))
+			groups.PATCH("/:id", handler.UpdateGroup(userService))
+			groups.DELETE("/:id", handler.DeleteGroup(userService))
+			groups.GET("/:id/members", handler.GetGroupMembers(userService))
+			groups.POST("/:id/members", handler.AddGroupMembers(userService))
+			groups.DELETE("/:id/members", handler.RemoveGroupMembers(userService))
+			groups.PUT("/:id/roles", handler.SetGroupRoles(userService))
+		}
+
+		// 通知路由
+		notifications := api.Group("/notifications")
+		notifications.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "notification"))
+		{
+			notifications.POST("", handler.SendNotification(userService))
 		}
 
 		// 角色管理路由
 		roles := api.Group("/roles")
-		roles.Use(middleware.AuthMiddleware())
+		roles.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "role"))
 		{
 			roles.GET("", handler.GetRoles(userService))
 			roles.POST("", handler.CreateRole(userService))
+			roles.GET("/:id", handler.GetRole(userService))
 			roles.PUT("/:id", handler.UpdateRole(userService))
+			roles.PATCH("/:id", handler.UpdateRole(userService))
 			roles.DELETE("/:id", handler.DeleteRole(userService))
+			roles.GET("/:id/history", handler.GetRoleHistory(userService))
+			roles.GET("/:id/permissions", handler.GetRolePermissions(userService))
+			roles.PUT("/:id/permissions", handler.SetRolePermissions(userService))
+			roles.PUT("/:id/menus", handler.SetRoleMenus(userService))
+			roles.PUT("/:id/data-scope", handler.SetRoleDataScope(userService))
+		}
+
+		// 部门管理路由
+		departments := api.Group("/departments")
+		departments.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "department"))
+		{
+			departments.GET("", handler.GetDepartments(userService))
+			departments.POST("", handler.CreateDepartment(userService))
+			departments.PUT("/:id", handler.UpdateDepartment(userService))
+			departments.DELETE("/:id", handler.DeleteDepartment(userService))
+		}
+
+		// 权限管理路由
+		permissions := api.Group("/permissions")
+		permissions.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "permission"))
+		{
+			permissions.GET("", handler.GetPermissions(userService))
+			permissions.POST("", handler.CreatePermission(userService))
+			permissions.DELETE("/:id", handler.DeletePermission(userService))
 		}
 
 		// 菜单管理路由
 		menus := api.Group("/menus")
-		menus.Use(middleware.AuthMiddleware())
+		menus.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "menu"))
 		{
 			menus.GET("", handler.GetMenus(userService))
 			menus.POST("", handler.CreateMenu(userService))
+			menus.GET("/:id", handler.GetMenu(userService))
 			menus.PUT("/:id", handler.UpdateMenu(userService))
+			menus.PATCH("/:id", handler.UpdateMenu(userService))
 			menus.DELETE("/:id", handler.DeleteMenu(userService))
+			menus.GET("/:id/history", handler.GetMenuHistory(userService))
+			menus.POST("/move", handler.MoveMenu(userService))
+		}
+
+		// 访问策略路由
+		policies := api.Group("/policies")
+		policies.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "policy"))
+		{
+			policies.GET("", handler.GetPolicies(policyService))
+			policies.POST("", handler.CreatePolicy(policyService))
+			policies.PUT("/:id", handler.UpdatePolicy(policyService))
+			policies.DELETE("/:id", handler.DeletePolicy(policyService))
+			policies.POST("/evaluate", handler.EvaluatePolicy(policyService))
+			policies.POST("/explain", handler.ExplainPolicy(policyService))
+		}
+
+		// 变更审批路由
+		changeRequests := api.Group("/change-requests")
+		changeRequests.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "change_request"))
+		{
+			changeRequests.GET("", handler.GetChangeRequests(userService))
+			changeRequests.GET("/:id", handler.GetChangeRequest(userService))
+			changeRequests.POST("/:id/approve", handler.ApproveChangeRequest(userService))
+			changeRequests.POST("/:id/reject", handler.RejectChangeRequest(userService))
+		}
+
+		// 后台任务路由（只能访问自己创建的任务）
+		jobs := api.Group("/jobs")
+		jobs.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "job"))
+		{
+			jobs.GET("", handler.GetJobs(userService))
+			jobs.GET("/:id", handler.GetJob(userService))
+			jobs.GET("/:id/download", handler.DownloadJobFile(userService))
+			jobs.GET("/:id/events", handler.JobEvents(userService))
+			jobs.POST("/:id/cancel", handler.CancelJob(userService))
+		}
+
+		// 回收站路由（:type 为 users、roles 或 menus）
+		recycleBin := api.Group("/recycle-bin")
+		recycleBin.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "recycle_bin"))
+		{
+			recycleBin.GET("/:type", handler.GetRecycleBin(userService))
+			recycleBin.POST("/:type/:id/restore", handler.RestoreRecycleBin(userService))
+			recycleBin.DELETE("/:type/:id", handler.PurgeRecycleBin(userService))
+		}
+
+		// RBAC配置导入导出路由
+		rbac := api.Group("/rbac")
+		rbac.Use(middleware.AuthMiddleware(), middleware.Authorize(policyService, "rbac"))
+		{
+			rbac.GET("/export", handler.ExportRBAC(userService))
+			rbac.POST("/sync", handler.SyncRBAC(userService))
+		}
+
+		// 搜索索引管理路由（索引包含所有租户，仅平台超级管理员）
+		search := api.Group("/search")
+		search.Use(middleware.AuthMiddleware(), middleware.PlatformAdmin())
+		{
+			search.POST("/users/rebuild", handler.RebuildSearchIndex(userService))
+		}
+
+		// 租户管理路由（仅平台超级管理员）
+		tenants := api.Group("/tenants")
+		tenants.Use(middleware.AuthMiddleware(), middleware.PlatformAdmin())
+		{
+			tenants.GET("", handler.GetTenants(tenantService))
+			tenants.POST("", handler.CreateTenant(tenantService))
+			tenants.PUT("/:id", handler.UpdateTenant(tenantService))
+			tenants.DELETE("/:id", handler.DeleteTenant(tenantService))
 		}
 
 		// Kafka管理路由
@@ -196,6 +438,11 @@ func main() {
 	// 关闭gRPC服务器
 	grpcServer.GracefulStop()
 
+	// 关闭搜索索引
+	if err := userService.CloseSearch(); err != nil {
+		log.Printf("Error closing search index: %v", err)
+	}
+
 	// 关闭Kafka连接
 	if kafkaService != nil {
 		if err := kafkaService.Close(); err != nil {
@@ -205,3 +452,22 @@ func main() {
 
 	log.Println("Server exiting")
 }
+
+// syncRBACManifest 读取RBAC配置文件并同步到默认租户
+func syncRBACManifest(userService *service.UserService, path string) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Failed to read RBAC manifest: %v", err)
+	}
+	manifest, err := service.ParseRBACManifest(data)
+	if err != nil {
+		log.Fatalf("Invalid RBAC manifest: %v", err)
+	}
+
+	ctx := tenant.WithTenant(context.Background(), model.DefaultTenantID)
+	result, err := userService.SyncRBAC(ctx, manifest, service.SyncOptions{Deploy: true})
+	if err != nil {
+		log.Fatalf("Failed to sync RBAC manifest: %v", err)
+	}
+	log.Printf("RBAC manifest synced with %d changes", len(result.Changes))
+}
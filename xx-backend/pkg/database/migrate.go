@@ -0,0 +1,36 @@
+package database
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+)
+
+// DropIndexes 删除已经废弃的索引（AutoMigrate 只会新增索引，不会删除旧索引）
+func DropIndexes(db *gorm.DB, model interface{}, names ...string) error {
+	migrator := db.Migrator()
+	for _, name := range names {
+		if !migrator.HasIndex(model, name) {
+			continue
+		}
+		if err := migrator.DropIndex(model, name); err != nil {
+			return err
+		}
+		log.Printf("Dropped legacy index %s", name)
+	}
+	return nil
+}
+
+// BackfillDeletedKeys 为已软删除但 deleted_key 仍为0的记录补写 deleted_key，使其不再占用唯一索引
+func BackfillDeletedKeys(db *gorm.DB, tables ...string) error {
+	for _, table := range tables {
+		result := db.Exec("UPDATE " + table + " SET deleted_key = id WHERE deleted_at IS NOT NULL AND deleted_key = 0")
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			log.Printf("Backfilled deleted_key of %d rows in %s", result.RowsAffected, table)
+		}
+	}
+	return nil
+}
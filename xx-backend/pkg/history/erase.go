@@ -0,0 +1,109 @@
+package history
+
+import (
+	"encoding/json"
+
+	"gorm.io/gorm"
+)
+
+// erased 删除个人数据后替换快照和差异中对应字段的值
+const erased = "[erased]"
+
+// Erase 把指定记录变更历史中的字段值替换为 [erased]（用于删除个人数据），变更记录本身和其他字段保留。
+// 需要在与删除数据相同的事务中、数据更新之后调用，以便同时处理本次更新产生的记录
+func Erase(db *gorm.DB, entityType string, entityIDs []int, columns ...string) error {
+	if len(entityIDs) == 0 || len(columns) == 0 {
+		return nil
+	}
+	erase := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		erase[column] = true
+	}
+
+	var entries []Entry
+	err := db.Where("entity_type = ? AND entity_id IN ?", entityType, entityIDs).
+		FindInBatches(&entries, 500, func(tx *gorm.DB, batch int) error {
+			for i := range entries {
+				entry := &entries[i]
+				before, err := eraseSnapshot(entry.Before, erase)
+				if err != nil {
+					return err
+				}
+				after, err := eraseSnapshot(entry.After, erase)
+				if err != nil {
+					return err
+				}
+				changes, err := eraseDiff(entry.Diff, erase)
+				if err != nil {
+					return err
+				}
+				if before == entry.Before && after == entry.After && changes == entry.Diff {
+					continue
+				}
+				err = db.Session(&gorm.Session{NewDB: true}).Model(&Entry{}).Where("id = ?", entry.ID).
+					Updates(map[string]interface{}{"before": before, "after": after, "diff": changes}).Error
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}).Error
+	return err
+}
+
+func eraseSnapshot(data JSON, erase map[string]bool) (JSON, error) {
+	if data == "" {
+		return data, nil
+	}
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &values); err != nil {
+		return data, err
+	}
+	changed := false
+	for name, value := range values {
+		if erase[name] && !isEmptyValue(value) {
+			values[name] = json.RawMessage(`"` + erased + `"`)
+			changed = true
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	encoded, err := json.Marshal(values)
+	return JSON(encoded), err
+}
+
+func eraseDiff(data JSON, erase map[string]bool) (JSON, error) {
+	if data == "" {
+		return data, nil
+	}
+	var changes map[string]map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(data), &changes); err != nil {
+		return data, err
+	}
+	changed := false
+	for name, change := range changes {
+		if !erase[name] {
+			continue
+		}
+		for side, value := range change {
+			if !isEmptyValue(value) {
+				change[side] = json.RawMessage(`"` + erased + `"`)
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return data, nil
+	}
+	encoded, err := json.Marshal(changes)
+	return JSON(encoded), err
+}
+
+func isEmptyValue(value json.RawMessage) bool {
+	switch string(value) {
+	case "null", `""`, "{}", "[]", `"` + erased + `"`:
+		return true
+	}
+	return false
+}
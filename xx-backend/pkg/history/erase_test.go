@@ -0,0 +1,146 @@
+package history
+
+import (
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+func TestEraseSnapshot(t *testing.T) {
+	erase := map[string]bool{"email": true, "phone": true, "attributes": true}
+	tests := []struct {
+		name    string
+		data    JSON
+		want    JSON
+		wantErr bool
+	}{
+		{name: "empty", data: "", want: ""},
+		{
+			name: "erases personal columns only",
+			data: `{"email":"a@example.com","id":1,"phone":"123"}`,
+			want: `{"email":"[erased]","id":1,"phone":"[erased]"}`,
+		},
+		{
+			name: "empty values are kept",
+			data: `{"attributes":{},"email":"","phone":null}`,
+			want: `{"attributes":{},"email":"","phone":null}`,
+		},
+		{
+			name: "already erased is unchanged",
+			data: `{"email":"[erased]","id":1}`,
+			want: `{"email":"[erased]","id":1}`,
+		},
+		{name: "invalid json", data: `{`, want: `{`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := eraseSnapshot(tt.data, erase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eraseSnapshot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("eraseSnapshot() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEraseDiff(t *testing.T) {
+	erase := map[string]bool{"email": true, "phone": true}
+	tests := []struct {
+		name    string
+		data    JSON
+		want    JSON
+		wantErr bool
+	}{
+		{name: "empty", data: "", want: ""},
+		{
+			name: "erases both sides",
+			data: `{"email":{"before":"a@example.com","after":"b@example.com"},"status":{"before":1,"after":0}}`,
+			want: `{"email":{"after":"[erased]","before":"[erased]"},"status":{"after":0,"before":1}}`,
+		},
+		{
+			name: "null side is kept",
+			data: `{"phone":{"before":null,"after":"123"}}`,
+			want: `{"phone":{"after":"[erased]","before":null}}`,
+		},
+		{
+			name: "untouched columns",
+			data: `{"nickname":{"before":"a","after":"b"}}`,
+			want: `{"nickname":{"before":"a","after":"b"}}`,
+		},
+		{name: "invalid json", data: `[]`, want: `[]`, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := eraseDiff(tt.data, erase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("eraseDiff() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("eraseDiff() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErase(t *testing.T) {
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test:test@tcp(127.0.0.1:3306)/test?parseTime=true", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	stored := []Entry{
+		{ID: 1, EntityType: "users", EntityID: 7, After: `{"email":"a@example.com","id":7}`,
+			Diff: `{"email":{"before":null,"after":"a@example.com"},"id":{"before":null,"after":7}}`},
+		{ID: 2, EntityType: "users", EntityID: 7, Before: `{"id":7,"status":1}`, After: `{"id":7,"status":0}`,
+			Diff: `{"status":{"before":1,"after":0}}`},
+	}
+	// 查询返回内存中的变更记录，更新只记录写入的值
+	err = db.Callback().Query().Replace("gorm:query", func(tx *gorm.DB) {
+		entries := tx.Statement.Dest.(*[]Entry)
+		*entries = append((*entries)[:0], stored...)
+		tx.RowsAffected = int64(len(stored))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	updates := make(map[interface{}]map[string]interface{}) // 按变更记录ID
+	err = db.Callback().Update().Replace("gorm:update", func(tx *gorm.DB) {
+		where := tx.Statement.Clauses["WHERE"].Expression.(clause.Where)
+		id := where.Exprs[0].(clause.Expr).Vars[0]
+		updates[id] = tx.Statement.Dest.(map[string]interface{})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Erase(db, "users", []int{7}, "email"); err != nil {
+		t.Fatalf("Erase() error = %v", err)
+	}
+	if len(updates) != 1 {
+		t.Fatalf("updates = %v, want only entry 1 updated", updates)
+	}
+	got := updates[1]
+	if got == nil {
+		t.Fatalf("updates = %v, want entry 1", updates)
+	}
+	want := map[string]interface{}{
+		"before": JSON(""),
+		"after":  JSON(`{"email":"[erased]","id":7}`),
+		"diff":   JSON(`{"email":{"after":"[erased]","before":null},"id":{"after":7,"before":null}}`),
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+
+	// 没有记录或字段时不查询
+	if err := Erase(db, "users", nil, "email"); err != nil {
+		t.Errorf("Erase() without ids error = %v", err)
+	}
+}
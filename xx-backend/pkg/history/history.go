@@ -0,0 +1,444 @@
+package history
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"time"
+
+	"xx-backend/pkg/tenant"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// 变更类型
+const (
+	OperationCreate  = "create"
+	OperationUpdate  = "update"
+	OperationDelete  = "delete"
+	OperationRestore = "restore"
+)
+
+// Entry 一条数据变更记录，before/after 为变更前后的完整快照，diff 为变化的字段
+type Entry struct {
+	ID         int       `json:"id" gorm:"primarykey"`
+	TenantID   uint      `json:"tenant_id" gorm:"not null;default:1;index"`
+	EntityType string    `json:"entity_type" gorm:"size:50;not null;index:idx_change_histories_entity,priority:1"` // 表名
+	EntityID   int       `json:"entity_id" gorm:"not null;index:idx_change_histories_entity,priority:2"`
+	Operation  string    `json:"operation" gorm:"size:20;not null"`
+	ActorID    uint      `json:"actor_id" gorm:"not null;default:0;index"` // 0 表示系统操作
+	Before     JSON      `json:"before" gorm:"type:mediumtext"`
+	After      JSON      `json:"after" gorm:"type:mediumtext"`
+	Diff       JSON      `json:"diff" gorm:"type:mediumtext"` // {"字段": {"before": 旧值, "after": 新值}}
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func (Entry) TableName() string { return "change_histories" }
+
+// JSON 以字符串存储的JSON，输出时原样嵌入
+type JSON string
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if j == "" {
+		return []byte("null"), nil
+	}
+	return []byte(j), nil
+}
+
+// 快照中需要脱敏的字段，只记录是否变化
+var redactedColumns = map[string]bool{"password": true, "token_nonce": true}
+
+const redacted = "******"
+
+// 每次修改都会变化，不计入字段差异
+var ignoredColumns = map[string]bool{"updated_at": true, "version": true, "deleted_key": true}
+
+type actorKey struct{}
+
+// WithActor 将操作人ID写入上下文，变更记录中的 actor_id 取自该值
+func WithActor(ctx context.Context, userID uint) context.Context {
+	return context.WithValue(ctx, actorKey{}, userID)
+}
+
+// ActorFromContext 从上下文中读取操作人ID
+func ActorFromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	userID, ok := ctx.Value(actorKey{}).(uint)
+	return userID, ok && userID != 0
+}
+
+const (
+	snapshotKey = "history:before"
+	entriesKey  = "history:entries"
+)
+
+type recorder struct {
+	exclude map[string]bool
+}
+
+// RegisterCallbacks 注册GORM回调，为所有单主键模型的创建、更新和删除记录变更历史。
+// 更新和删除前按相同条件查询受影响的记录作为变更前快照，执行后再查询变更后快照并计算差异，
+// 变更记录与数据在同一事务中写入。
+// exclude 为不需要记录的表（如频繁更新进度的后台任务表）。原生SQL（Raw/Exec）不会被记录。
+func RegisterCallbacks(db *gorm.DB, exclude ...string) error {
+	r := &recorder{exclude: map[string]bool{Entry{}.TableName(): true}}
+	for _, table := range exclude {
+		r.exclude[table] = true
+	}
+
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Before("gorm:commit_or_rollback_transaction").Register("history:create", r.afterCreate); err != nil {
+		return err
+	}
+	if err := cb.Update().After("tenant:update").Before("gorm:update").Register("history:before_update", r.beforeChange); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before("gorm:commit_or_rollback_transaction").Register("history:update", r.afterUpdate); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("tenant:delete").Before("gorm:delete").Register("history:before_delete", r.beforeChange); err != nil {
+		return err
+	}
+	return cb.Delete().After("gorm:delete").Before("gorm:commit_or_rollback_transaction").Register("history:delete", r.afterDelete)
+}
+
+func (r *recorder) tracked(db *gorm.DB) bool {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return false
+	}
+	return len(stmt.Schema.PrimaryFields) == 1 && !r.exclude[stmt.Table]
+}
+
+// row 一条记录的快照，值已序列化为JSON以便比较
+type row struct {
+	id     int
+	values map[string]json.RawMessage
+}
+
+func snapshot(ctx context.Context, s *schema.Schema, rv reflect.Value) (row, error) {
+	rv = reflect.Indirect(rv)
+	r := row{values: make(map[string]json.RawMessage, len(s.DBNames))}
+	for _, name := range s.DBNames {
+		value, _ := s.FieldsByDBName[name].ValueOf(ctx, rv)
+		data, err := json.Marshal(value)
+		if err != nil {
+			return r, err
+		}
+		r.values[name] = data
+	}
+
+	primary, _ := s.PrioritizedPrimaryField.ValueOf(ctx, rv)
+	switch id := reflect.ValueOf(primary); id.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		r.id = int(id.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		r.id = int(id.Uint())
+	}
+	return r, nil
+}
+
+// load 按条件查询受影响的记录，unscoped 时包括已软删除的记录
+func load(db *gorm.DB, unscoped bool, conds ...clause.Expression) ([]row, error) {
+	stmt := db.Statement
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Table(stmt.Table)
+	if unscoped {
+		tx = tx.Unscoped()
+	}
+	if len(conds) > 0 {
+		tx = tx.Clauses(conds...)
+	}
+
+	records := reflect.New(reflect.SliceOf(stmt.Schema.ModelType))
+	if err := tx.Find(records.Interface()).Error; err != nil {
+		return nil, err
+	}
+
+	rows := make([]row, 0, records.Elem().Len())
+	for i := 0; i < records.Elem().Len(); i++ {
+		r, err := snapshot(stmt.Context, stmt.Schema, records.Elem().Index(i))
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+func (r *recorder) beforeChange(db *gorm.DB) {
+	if !r.tracked(db) {
+		return
+	}
+
+	stmt := db.Statement
+	var conds []clause.Expression
+	if where, ok := stmt.Clauses["WHERE"]; ok && where.Expression != nil {
+		conds = append(conds, where.Expression)
+	}
+	// Model(&record) 的主键条件在 gorm:update/gorm:delete 中才追加，这里先补上
+	if stmt.ReflectValue.Kind() == reflect.Struct {
+		field := stmt.Schema.PrioritizedPrimaryField
+		if value, zero := field.ValueOf(stmt.Context, stmt.ReflectValue); !zero {
+			conds = append(conds, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: value})
+		}
+	}
+	// 没有任何条件时 GORM 会拒绝执行，不需要快照
+	if len(conds) == 0 {
+		return
+	}
+
+	rows, err := load(db, stmt.Unscoped, conds...)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(snapshotKey, rows)
+}
+
+func beforeRows(db *gorm.DB) []row {
+	value, ok := db.InstanceGet(snapshotKey)
+	if !ok {
+		return nil
+	}
+	rows, _ := value.([]row)
+	return rows
+}
+
+func (r *recorder) afterCreate(db *gorm.DB) {
+	if !r.tracked(db) {
+		return
+	}
+	// 关联保存（Association.Replace 等）会对已存在的记录执行 ON DUPLICATE KEY，无法区分是否新建，不记录
+	if _, upsert := db.Statement.Clauses["ON CONFLICT"]; upsert {
+		return
+	}
+
+	stmt := db.Statement
+	var ids []int
+	add := func(rv reflect.Value) bool {
+		created, err := snapshot(stmt.Context, stmt.Schema, rv)
+		if err != nil {
+			db.AddError(err)
+			return false
+		}
+		ids = append(ids, created.id)
+		return true
+	}
+	switch rv := stmt.ReflectValue; rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if !add(rv.Index(i)) {
+				return
+			}
+		}
+	case reflect.Struct:
+		if !add(rv) {
+			return
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	// 重新查询一次，快照中包含数据库填充的默认值
+	after, err := loadByIDs(db, ids)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	entries := make([]Entry, 0, len(after))
+	for i := range after {
+		entries = append(entries, newEntry(stmt, OperationCreate, nil, &after[i]))
+	}
+	save(db, entries)
+}
+
+func (r *recorder) afterUpdate(db *gorm.DB) {
+	if !r.tracked(db) {
+		return
+	}
+	before := beforeRows(db)
+	if len(before) == 0 {
+		return
+	}
+
+	stmt := db.Statement
+	ids := make([]int, 0, len(before))
+	for _, b := range before {
+		ids = append(ids, b.id)
+	}
+	after, err := loadByIDs(db, ids)
+	if err != nil {
+		db.AddError(err)
+		return
+	}
+	afterByID := make(map[int]*row, len(after))
+	for i := range after {
+		afterByID[after[i].id] = &after[i]
+	}
+
+	var entries []Entry
+	for i := range before {
+		b, a := &before[i], afterByID[before[i].id]
+		if a == nil {
+			continue
+		}
+		operation := OperationUpdate
+		if deletedAt, ok := b.values["deleted_at"]; ok {
+			wasDeleted, isDeleted := string(deletedAt) != "null", string(a.values["deleted_at"]) != "null"
+			switch {
+			case !wasDeleted && isDeleted:
+				operation = OperationDelete
+			case wasDeleted && !isDeleted:
+				operation = OperationRestore
+			}
+		}
+		entry := newEntry(stmt, operation, b, a)
+		if entry.Diff == "" {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	save(db, entries)
+}
+
+func (r *recorder) afterDelete(db *gorm.DB) {
+	if !r.tracked(db) {
+		return
+	}
+
+	before := beforeRows(db)
+	entries := make([]Entry, 0, len(before))
+	for i := range before {
+		entries = append(entries, newEntry(db.Statement, OperationDelete, &before[i], nil))
+	}
+	save(db, entries)
+}
+
+// loadByIDs 按主键查询变更后的记录，包括已软删除的记录
+func loadByIDs(db *gorm.DB, ids []int) ([]row, error) {
+	values := make([]interface{}, len(ids))
+	for i, id := range ids {
+		values[i] = id
+	}
+	return load(db, true, clause.IN{
+		Column: clause.Column{Table: clause.CurrentTable, Name: db.Statement.Schema.PrioritizedPrimaryField.DBName},
+		Values: values,
+	})
+}
+
+func newEntry(stmt *gorm.Statement, operation string, before, after *row) Entry {
+	entry := Entry{
+		EntityType: stmt.Table,
+		Operation:  operation,
+		Before:     encode(before),
+		After:      encode(after),
+		Diff:       diff(before, after),
+	}
+	entry.ActorID, _ = ActorFromContext(stmt.Context)
+
+	current := after
+	if current == nil {
+		current = before
+	}
+	entry.EntityID = current.id
+	// 记录所属租户与被修改的数据一致，后台任务跨租户修改时也能归到正确的租户
+	if raw, ok := current.values["tenant_id"]; ok {
+		_ = json.Unmarshal(raw, &entry.TenantID)
+	} else {
+		entry.TenantID, _ = tenant.FromContext(stmt.Context)
+	}
+	return entry
+}
+
+func encode(r *row) JSON {
+	if r == nil {
+		return ""
+	}
+	values := make(map[string]json.RawMessage, len(r.values))
+	for name, value := range r.values {
+		values[name] = redact(name, value)
+	}
+	data, _ := json.Marshal(values)
+	return JSON(data)
+}
+
+func redact(name string, value json.RawMessage) json.RawMessage {
+	if redactedColumns[name] && string(value) != "null" && string(value) != `""` {
+		return json.RawMessage(`"` + redacted + `"`)
+	}
+	return value
+}
+
+// diff 计算变化的字段，创建时变更前为 null，删除时变更后为 null
+func diff(before, after *row) JSON {
+	type change struct {
+		Before json.RawMessage `json:"before"`
+		After  json.RawMessage `json:"after"`
+	}
+	null := json.RawMessage("null")
+
+	changes := make(map[string]change)
+	names := make(map[string]bool)
+	for _, r := range []*row{before, after} {
+		if r != nil {
+			for name := range r.values {
+				names[name] = true
+			}
+		}
+	}
+	for name := range names {
+		if ignoredColumns[name] {
+			continue
+		}
+		c := change{Before: null, After: null}
+		if before != nil {
+			if value, ok := before.values[name]; ok {
+				c.Before = value
+			}
+		}
+		if after != nil {
+			if value, ok := after.values[name]; ok {
+				c.After = value
+			}
+		}
+		if string(c.Before) == string(c.After) {
+			continue
+		}
+		// 密码等字段只记录发生了变化
+		c.Before, c.After = redact(name, c.Before), redact(name, c.After)
+		changes[name] = c
+	}
+	if len(changes) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(changes)
+	return JSON(data)
+}
+
+// save 在同一事务中写入变更记录，租户已在记录上指定
+func save(db *gorm.DB, entries []Entry) {
+	if len(entries) == 0 {
+		return
+	}
+	tx := db.Session(&gorm.Session{NewDB: true, SkipHooks: true, Context: tenant.WithoutTenant(db.Statement.Context)})
+	if err := tx.Create(&entries).Error; err != nil {
+		db.AddError(err)
+		return
+	}
+	db.InstanceSet(entriesKey, entries)
+}
+
+// Changes 返回当前语句记录的变更，供在其后执行的回调使用（如提交后同步搜索索引）
+func Changes(db *gorm.DB) []Entry {
+	value, ok := db.InstanceGet(entriesKey)
+	if !ok {
+		return nil
+	}
+	entries, _ := value.([]Entry)
+	return entries
+}
@@ -0,0 +1,93 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func testRow(id int, values map[string]string) *row {
+	r := &row{id: id, values: make(map[string]json.RawMessage, len(values))}
+	for name, value := range values {
+		r.values[name] = json.RawMessage(value)
+	}
+	return r
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before *row
+		after  *row
+		want   JSON
+	}{
+		{
+			name:  "create",
+			after: testRow(1, map[string]string{"id": "1", "username": `"alice"`}),
+			want:  `{"id":{"before":null,"after":1},"username":{"before":null,"after":"alice"}}`,
+		},
+		{
+			name:   "delete",
+			before: testRow(1, map[string]string{"id": "1", "username": `"alice"`}),
+			want:   `{"id":{"before":1,"after":null},"username":{"before":"alice","after":null}}`,
+		},
+		{
+			name:   "update only records changed columns",
+			before: testRow(1, map[string]string{"id": "1", "nickname": `"a"`, "status": "1"}),
+			after:  testRow(1, map[string]string{"id": "1", "nickname": `"b"`, "status": "1"}),
+			want:   `{"nickname":{"before":"a","after":"b"}}`,
+		},
+		{
+			name:   "ignored columns",
+			before: testRow(1, map[string]string{"version": "1", "updated_at": `"2024-01-01T00:00:00Z"`, "deleted_key": "0"}),
+			after:  testRow(1, map[string]string{"version": "2", "updated_at": `"2024-01-02T00:00:00Z"`, "deleted_key": "1"}),
+			want:   "",
+		},
+		{
+			name:   "password is redacted",
+			before: testRow(1, map[string]string{"password": `"old-hash"`}),
+			after:  testRow(1, map[string]string{"password": `"new-hash"`}),
+			want:   `{"password":{"before":"******","after":"******"}}`,
+		},
+		{
+			name:   "empty token nonce is kept",
+			before: testRow(1, map[string]string{"token_nonce": `""`}),
+			after:  testRow(1, map[string]string{"token_nonce": `"n1"`}),
+			want:   `{"token_nonce":{"before":"","after":"******"}}`,
+		},
+		{
+			name:   "no change",
+			before: testRow(1, map[string]string{"id": "1", "username": `"alice"`}),
+			after:  testRow(1, map[string]string{"id": "1", "username": `"alice"`}),
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := diff(tt.before, tt.after); got != tt.want {
+				t.Errorf("diff() = %s\nwant     %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name string
+		row  *row
+		want JSON
+	}{
+		{name: "nil", row: nil, want: ""},
+		{
+			name: "password is redacted",
+			row:  testRow(1, map[string]string{"id": "1", "password": `"hash"`, "token_nonce": "null"}),
+			want: `{"id":1,"password":"******","token_nonce":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encode(tt.row); got != tt.want {
+				t.Errorf("encode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,555 @@
+// Package listquery 列表接口通用的查询语法：过滤、排序、字段选择、页码和游标分页。
+//
+// 查询参数格式：
+//
+//	status=1                       等于
+//	created_at[gte]=2024-01-01     操作符：eq ne gt gte lt lte like in null
+//	role_id[in]=1,2                多个值用逗号分隔
+//	attr.emp_no[like]=A1           字段名可以包含点号（如按JSON列中的属性过滤）
+//	search=abc                     在 Schema.Search 指定的列上模糊匹配
+//	sort=-created_at,username      前缀 - 表示降序，总是以 id 作为最后的排序字段
+//	fields=id,username,role        只返回指定字段
+//	page=2&page_size=20            页码分页
+//	cursor=xxx                     游标分页，取值为上次结果中的 next_cursor 或 prev_cursor
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidQuery 查询参数无效，处理器应返回400
+var ErrInvalidQuery = errors.New("查询参数无效")
+
+// 分页大小
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// FieldType 字段类型，决定参数如何解析以及允许的操作符
+type FieldType int
+
+const (
+	String FieldType = iota
+	Int
+	Time
+	Float
+)
+
+// Field 允许查询的字段
+type Field struct {
+	Column   string // 数据库列名，关联字段为外键列
+	Type     FieldType
+	Filter   bool   // 允许过滤
+	Sort     bool   // 允许排序，可为空的列不能排序（游标无法处理NULL）
+	Nullable bool   // 允许使用 [null] 过滤
+	Preload  string // 关联字段，返回该字段时需要预加载的关联名
+	// Expression 不是普通列时用于过滤的SQL表达式（如 JSON_EXTRACT），设置后只能用于过滤，
+	// 表达式由服务端生成，不能包含用户输入
+	Expression string
+}
+
+// Schema 某个模型允许查询的字段
+type Schema struct {
+	Table       string
+	Fields      map[string]Field // 键为JSON字段名
+	Search      []string         // search 参数模糊匹配的列
+	DefaultSort string           // 未指定 sort 时的排序
+	MaxPageSize int              // 为0时使用 MaxPageSize
+}
+
+func (s *Schema) maxPageSize() int {
+	if s.MaxPageSize > 0 {
+		return s.MaxPageSize
+	}
+	return MaxPageSize
+}
+
+func (s *Schema) column(column string) string {
+	return s.Table + "." + column
+}
+
+func (s *Schema) filterColumn(field Field) string {
+	if field.Expression != "" {
+		return field.Expression
+	}
+	return s.column(field.Column)
+}
+
+// Filter 过滤条件
+type Filter struct {
+	Field string
+	Op    string
+	Value interface{}
+}
+
+// Sort 排序字段
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// Query 解析后的列表查询
+type Query struct {
+	schema   *Schema
+	Filters  []Filter
+	Search   string
+	Sorts    []Sort
+	Fields   []string
+	Page     int
+	PageSize int
+	Cursor   string
+}
+
+var reserved = map[string]bool{
+	"search": true, "sort": true, "fields": true, "page": true, "page_size": true, "cursor": true,
+}
+
+var operators = map[FieldType][]string{
+	String: {"eq", "ne", "like", "in"},
+	Int:    {"eq", "ne", "gt", "gte", "lt", "lte", "in"},
+	Time:   {"gt", "gte", "lt", "lte"},
+	Float:  {"eq", "ne", "gt", "gte", "lt", "lte", "in"},
+}
+
+func invalid(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrInvalidQuery, fmt.Sprintf(format, args...))
+}
+
+// Parse 按 Schema 解析并校验查询参数，ignore 中的参数由调用方自行处理
+func Parse(values url.Values, schema *Schema, ignore ...string) (*Query, error) {
+	q := &Query{
+		schema:   schema,
+		Search:   values.Get("search"),
+		Cursor:   values.Get("cursor"),
+		Page:     1,
+		PageSize: DefaultPageSize,
+	}
+
+	var err error
+	if v := values.Get("page"); v != "" {
+		if q.Page, err = strconv.Atoi(v); err != nil || q.Page < 1 {
+			return nil, invalid("page 必须是正整数")
+		}
+	}
+	if v := values.Get("page_size"); v != "" {
+		if q.PageSize, err = strconv.Atoi(v); err != nil || q.PageSize < 1 {
+			return nil, invalid("page_size 必须是正整数")
+		}
+	}
+	if q.PageSize > schema.maxPageSize() {
+		q.PageSize = schema.maxPageSize()
+	}
+
+	sort := values.Get("sort")
+	if sort == "" {
+		sort = schema.DefaultSort
+	}
+	if q.Sorts, err = parseSort(sort, schema); err != nil {
+		return nil, err
+	}
+	if q.Fields, err = parseFields(values.Get("fields"), schema); err != nil {
+		return nil, err
+	}
+
+	skip := make(map[string]bool, len(ignore))
+	for _, name := range ignore {
+		skip[name] = true
+	}
+	for key, list := range values {
+		if reserved[key] || skip[key] {
+			continue
+		}
+		name, op := key, "eq"
+		if i := strings.Index(key, "["); i > 0 && strings.HasSuffix(key, "]") {
+			name, op = key[:i], key[i+1:len(key)-1]
+		}
+		field, ok := schema.Fields[name]
+		if !ok || !field.Filter {
+			return nil, invalid("不支持按 %s 过滤", name)
+		}
+		for _, raw := range list {
+			filter, err := parseFilter(name, op, raw, field)
+			if err != nil {
+				return nil, err
+			}
+			q.Filters = append(q.Filters, filter)
+		}
+	}
+	return q, nil
+}
+
+func parseSort(sort string, schema *Schema) ([]Sort, error) {
+	var sorts []Sort
+	seen := make(map[string]bool)
+	for _, item := range strings.Split(sort, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		desc := strings.HasPrefix(item, "-")
+		name := strings.TrimPrefix(strings.TrimPrefix(item, "-"), "+")
+		if field, ok := schema.Fields[name]; !ok || !field.Sort {
+			return nil, invalid("不支持按 %s 排序", name)
+		}
+		if seen[name] {
+			return nil, invalid("排序字段 %s 重复", name)
+		}
+		seen[name] = true
+		sorts = append(sorts, Sort{Field: name, Desc: desc})
+	}
+	if !seen["id"] {
+		sorts = append(sorts, Sort{Field: "id"})
+	}
+	return sorts, nil
+}
+
+func parseFields(fields string, schema *Schema) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(fields, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if field, ok := schema.Fields[name]; !ok || field.Expression != "" {
+			return nil, invalid("不支持的字段 %s", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func parseFilter(name, op, raw string, field Field) (Filter, error) {
+	filter := Filter{Field: name, Op: op}
+	if op == "null" {
+		if !field.Nullable {
+			return filter, invalid("%s 不支持 null 过滤", name)
+		}
+		isNull, err := strconv.ParseBool(raw)
+		if err != nil {
+			return filter, invalid("%s[null] 的值必须是 true 或 false", name)
+		}
+		filter.Value = isNull
+		return filter, nil
+	}
+
+	allowed := false
+	for _, candidate := range operators[field.Type] {
+		if candidate == op {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return filter, invalid("%s 不支持操作符 %s", name, op)
+	}
+
+	if op == "in" {
+		var values []interface{}
+		for _, item := range strings.Split(raw, ",") {
+			value, err := parseValue(name, strings.TrimSpace(item), field.Type)
+			if err != nil {
+				return filter, err
+			}
+			values = append(values, value)
+		}
+		filter.Value = values
+		return filter, nil
+	}
+
+	value, err := parseValue(name, raw, field.Type)
+	if err != nil {
+		return filter, err
+	}
+	filter.Value = value
+	return filter, nil
+}
+
+func parseValue(name, raw string, fieldType FieldType) (interface{}, error) {
+	switch fieldType {
+	case Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return nil, invalid("%s 必须是整数", name)
+		}
+		return n, nil
+	case Float:
+		n, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, invalid("%s 必须是数字", name)
+		}
+		return n, nil
+	case Time:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.ParseInLocation(layout, raw, time.Local); err == nil {
+				return t, nil
+			}
+		}
+		return nil, invalid("%s 时间格式错误，应为 RFC3339 或 2006-01-02", name)
+	default:
+		return raw, nil
+	}
+}
+
+var sqlOperators = map[string]string{
+	"eq": "=", "ne": "<>", "gt": ">", "gte": ">=", "lt": "<", "lte": "<=",
+}
+
+// likeClause 模糊匹配条件，以反斜杠作为转义字符
+const likeClause = ` LIKE ? ESCAPE '\\'`
+
+// likeEscaper 转义 LIKE 通配符，使用户输入的 %、_ 和 \ 按字面匹配
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// containsPattern 返回包含 value 的 LIKE 模式
+func containsPattern(value string) string {
+	return "%" + likeEscaper.Replace(value) + "%"
+}
+
+// Scope 作为GORM Scope使用，追加过滤和搜索条件（不包含排序和分页）
+func (q *Query) Scope(db *gorm.DB) *gorm.DB {
+	for _, f := range q.Filters {
+		column := q.schema.filterColumn(q.schema.Fields[f.Field])
+		switch f.Op {
+		case "like":
+			db = db.Where(column+likeClause, containsPattern(f.Value.(string)))
+		case "in":
+			db = db.Where(column+" IN ?", f.Value)
+		case "null":
+			if f.Value.(bool) {
+				db = db.Where(column + " IS NULL")
+			} else {
+				db = db.Where(column + " IS NOT NULL")
+			}
+		default:
+			db = db.Where(column+" "+sqlOperators[f.Op]+" ?", f.Value)
+		}
+	}
+
+	if q.Search != "" && len(q.schema.Search) > 0 {
+		conditions := make([]string, 0, len(q.schema.Search))
+		args := make([]interface{}, 0, len(q.schema.Search))
+		for _, column := range q.schema.Search {
+			conditions = append(conditions, q.schema.column(column)+likeClause)
+			args = append(args, containsPattern(q.Search))
+		}
+		db = db.Where(strings.Join(conditions, " OR "), args...)
+	}
+	return db
+}
+
+// Order 返回排序子句，可供不分页的查询（如导出）使用
+func (q *Query) Order() string {
+	return q.order(false)
+}
+
+func (q *Query) order(reverse bool) string {
+	parts := make([]string, 0, len(q.Sorts))
+	for _, s := range q.Sorts {
+		direction := "ASC"
+		if s.Desc != reverse {
+			direction = "DESC"
+		}
+		parts = append(parts, q.schema.column(q.schema.Fields[s.Field].Column)+" "+direction)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Selection 返回需要查询的列（为空表示全部列）和需要预加载的关联
+func (q *Query) Selection() (columns []string, preloads []string) {
+	if len(q.Fields) == 0 {
+		for _, field := range q.schema.Fields {
+			if field.Preload != "" {
+				preloads = append(preloads, field.Preload)
+			}
+		}
+		return nil, preloads
+	}
+
+	selected := make(map[string]bool)
+	add := func(column string) {
+		if !selected[column] {
+			selected[column] = true
+			columns = append(columns, q.schema.column(column))
+		}
+	}
+	add("id")
+	for _, name := range q.Fields {
+		field := q.schema.Fields[name]
+		add(field.Column)
+		if field.Preload != "" {
+			preloads = append(preloads, field.Preload)
+		}
+	}
+	// 游标需要排序字段的值
+	for _, s := range q.Sorts {
+		add(q.schema.Fields[s.Field].Column)
+	}
+	return columns, preloads
+}
+
+func (q *Query) signature() string {
+	parts := make([]string, 0, len(q.Sorts))
+	for _, s := range q.Sorts {
+		if s.Desc {
+			parts = append(parts, "-"+s.Field)
+		} else {
+			parts = append(parts, s.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// cursor 游标记录边界行的排序字段值，Backward 表示向前翻页
+type cursor struct {
+	Values   []interface{} `json:"v"`
+	Backward bool          `json:"b,omitempty"`
+	Sort     string        `json:"s"`
+}
+
+func (q *Query) decodeCursor() (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(q.Cursor)
+	if err != nil {
+		return nil, invalid("游标无效")
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, invalid("游标无效")
+	}
+	if c.Sort != q.signature() || len(c.Values) != len(q.Sorts) {
+		return nil, invalid("游标与排序条件不匹配")
+	}
+	for i, s := range q.Sorts {
+		if q.schema.Fields[s.Field].Type != Time {
+			continue
+		}
+		text, _ := c.Values[i].(string)
+		t, err := time.Parse(time.RFC3339Nano, text)
+		if err != nil {
+			return nil, invalid("游标无效")
+		}
+		c.Values[i] = t
+	}
+	return &c, nil
+}
+
+// keyset 生成游标条件，如 (a > ?) OR (a = ? AND b < ?) OR (a = ? AND b = ? AND id > ?)
+func (q *Query) keyset(values []interface{}, backward bool) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	for i, s := range q.Sorts {
+		var parts []string
+		for j := 0; j < i; j++ {
+			parts = append(parts, q.schema.column(q.schema.Fields[q.Sorts[j].Field].Column)+" = ?")
+			args = append(args, values[j])
+		}
+		op := "<"
+		if s.Desc == backward {
+			op = ">"
+		}
+		parts = append(parts, q.schema.column(q.schema.Fields[s.Field].Column)+" "+op+" ?")
+		args = append(args, values[i])
+		clauses = append(clauses, "("+strings.Join(parts, " AND ")+")")
+	}
+	return strings.Join(clauses, " OR "), args
+}
+
+// Result 列表查询结果
+type Result[T any] struct {
+	List       []T
+	Fields     []string // 非空时只返回这些字段
+	Total      *int64   // 仅页码分页时统计
+	Page       int
+	PageSize   int
+	NextCursor string
+	PrevCursor string
+}
+
+// Find 执行列表查询。db 可以预先附加其他条件（如数据范围），过滤、排序、字段选择和分页由 Query 负责
+func Find[T any](db *gorm.DB, q *Query) (*Result[T], error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(new(T)); err != nil {
+		return nil, err
+	}
+
+	var c *cursor
+	if q.Cursor != "" {
+		var err error
+		if c, err = q.decodeCursor(); err != nil {
+			return nil, err
+		}
+	}
+
+	query := db.Model(new(T)).Scopes(q.Scope)
+	result := &Result[T]{Fields: q.Fields, Page: q.Page, PageSize: q.PageSize}
+
+	// 获取总数（游标分页时不统计，避免大表上的全表计数）
+	if c == nil {
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			return nil, err
+		}
+		result.Total = &total
+	}
+
+	backward := c != nil && c.Backward
+	if c != nil {
+		condition, args := q.keyset(c.Values, backward)
+		query = query.Where(condition, args...)
+	} else {
+		query = query.Offset((q.Page - 1) * q.PageSize)
+	}
+	columns, preloads := q.Selection()
+	if len(columns) > 0 {
+		query = query.Select(columns)
+	}
+	for _, preload := range preloads {
+		query = query.Preload(preload)
+	}
+
+	// 多查一条判断是否还有数据
+	var rows []T
+	if err := query.Order(q.order(backward)).Limit(q.PageSize + 1).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	hasMore := len(rows) > q.PageSize
+	if hasMore {
+		rows = rows[:q.PageSize]
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+		}
+	}
+	result.List = rows
+
+	if len(rows) > 0 {
+		encode := func(row *T, backward bool) string {
+			c := cursor{Backward: backward, Sort: q.signature()}
+			rv := reflect.ValueOf(row).Elem()
+			for _, s := range q.Sorts {
+				value, _ := stmt.Schema.LookUpField(q.schema.Fields[s.Field].Column).ValueOf(db.Statement.Context, rv)
+				c.Values = append(c.Values, value)
+			}
+			data, _ := json.Marshal(c)
+			return base64.RawURLEncoding.EncodeToString(data)
+		}
+		if hasMore || backward {
+			result.NextCursor = encode(&rows[len(rows)-1], false)
+		}
+		if (backward && hasMore) || (!backward && (c != nil || q.Page > 1)) {
+			result.PrevCursor = encode(&rows[0], true)
+		}
+	}
+
+	return result, nil
+}
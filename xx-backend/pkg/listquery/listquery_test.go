@@ -0,0 +1,481 @@
+package listquery
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var testSchema = &Schema{
+	Table: "users",
+	Fields: map[string]Field{
+		"id":            {Column: "id", Type: Int, Filter: true, Sort: true},
+		"username":      {Column: "username", Type: String, Filter: true, Sort: true},
+		"status":        {Column: "status", Type: Int, Filter: true},
+		"score":         {Column: "score", Type: Float, Filter: true},
+		"created_at":    {Column: "created_at", Type: Time, Filter: true, Sort: true},
+		"department_id": {Column: "department_id", Type: Int, Filter: true, Nullable: true},
+		"role":          {Column: "role_id", Type: Int, Preload: "Role"},
+		"attr.emp_no":   {Type: String, Filter: true, Expression: "JSON_UNQUOTE(JSON_EXTRACT(users.attributes, '$.emp_no'))"},
+	},
+	Search:      []string{"username", "nickname"},
+	DefaultSort: "-created_at",
+	MaxPageSize: 50,
+}
+
+type testUser struct {
+	ID        int
+	Username  string
+	CreatedAt time.Time
+}
+
+func (testUser) TableName() string { return "users" }
+
+// dryRunDB 只生成SQL不连接数据库
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test:test@tcp(127.0.0.1:3306)/test?parseTime=true", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	return db
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		ignore   []string
+		wantErr  bool
+		page     int
+		pageSize int
+		sorts    []Sort
+		filters  []Filter
+		fields   []string
+	}{
+		{
+			name:     "defaults",
+			query:    "",
+			page:     1,
+			pageSize: DefaultPageSize,
+			sorts:    []Sort{{Field: "created_at", Desc: true}, {Field: "id"}},
+		},
+		{
+			name:     "page size capped by schema",
+			query:    "page=3&page_size=1000",
+			page:     3,
+			pageSize: 50,
+			sorts:    []Sort{{Field: "created_at", Desc: true}, {Field: "id"}},
+		},
+		{
+			name:     "explicit id sort is not appended twice",
+			query:    "sort=username,-id",
+			page:     1,
+			pageSize: DefaultPageSize,
+			sorts:    []Sort{{Field: "username"}, {Field: "id", Desc: true}},
+		},
+		{
+			name:     "filters with operators",
+			query:    "status[in]=1,2&username[like]=ad&department_id[null]=true",
+			page:     1,
+			pageSize: DefaultPageSize,
+			sorts:    []Sort{{Field: "created_at", Desc: true}, {Field: "id"}},
+			filters: []Filter{
+				{Field: "department_id", Op: "null", Value: true},
+				{Field: "status", Op: "in", Value: []interface{}{1, 2}},
+				{Field: "username", Op: "like", Value: "ad"},
+			},
+		},
+		{
+			name:     "fields",
+			query:    "fields=username,role",
+			page:     1,
+			pageSize: DefaultPageSize,
+			sorts:    []Sort{{Field: "created_at", Desc: true}, {Field: "id"}},
+			fields:   []string{"username", "role"},
+		},
+		{
+			name:     "ignored parameter",
+			query:    "async=true",
+			ignore:   []string{"async"},
+			page:     1,
+			pageSize: DefaultPageSize,
+			sorts:    []Sort{{Field: "created_at", Desc: true}, {Field: "id"}},
+		},
+		{name: "page must be positive", query: "page=0", wantErr: true},
+		{name: "page size must be a number", query: "page_size=abc", wantErr: true},
+		{name: "unknown filter field", query: "password=x", wantErr: true},
+		{name: "field not filterable", query: "role=1", wantErr: true},
+		{name: "unsupported operator", query: "username[gt]=a", wantErr: true},
+		{name: "time does not support eq", query: "created_at=2024-01-01", wantErr: true},
+		{name: "invalid int", query: "status=abc", wantErr: true},
+		{name: "invalid float", query: "score[gt]=abc", wantErr: true},
+		{name: "invalid time", query: "created_at[gte]=yesterday", wantErr: true},
+		{name: "null on non nullable field", query: "status[null]=true", wantErr: true},
+		{name: "invalid null value", query: "department_id[null]=maybe", wantErr: true},
+		{name: "unknown sort field", query: "sort=password", wantErr: true},
+		{name: "sort on non sortable field", query: "sort=status", wantErr: true},
+		{name: "duplicate sort field", query: "sort=username,-username", wantErr: true},
+		{name: "expression field cannot be selected", query: "fields=attr.emp_no", wantErr: true},
+		{name: "unknown field", query: "fields=password", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+			q, err := Parse(values, testSchema, tt.ignore...)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("Parse() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if q.Page != tt.page || q.PageSize != tt.pageSize {
+				t.Errorf("page = %d/%d, want %d/%d", q.Page, q.PageSize, tt.page, tt.pageSize)
+			}
+			if !reflect.DeepEqual(q.Sorts, tt.sorts) {
+				t.Errorf("sorts = %v, want %v", q.Sorts, tt.sorts)
+			}
+			if !reflect.DeepEqual(q.Fields, tt.fields) {
+				t.Errorf("fields = %v, want %v", q.Fields, tt.fields)
+			}
+			// 过滤条件来自 map 遍历，按字段名排序后比较
+			filters := append([]Filter(nil), q.Filters...)
+			for i := 1; i < len(filters); i++ {
+				for j := i; j > 0 && filters[j].Field < filters[j-1].Field; j-- {
+					filters[j], filters[j-1] = filters[j-1], filters[j]
+				}
+			}
+			if len(filters) != len(tt.filters) || (len(filters) > 0 && !reflect.DeepEqual(filters, tt.filters)) {
+				t.Errorf("filters = %v, want %v", filters, tt.filters)
+			}
+		})
+	}
+}
+
+func TestParseTimeFilter(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{"2024-01-02", time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)},
+		{"2024-01-02T03:04:05Z", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			q, err := Parse(url.Values{"created_at[gte]": {tt.raw}}, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			got, ok := q.Filters[0].Value.(time.Time)
+			if !ok || !got.Equal(tt.want) {
+				t.Errorf("value = %v, want %v", q.Filters[0].Value, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainsPattern(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"abc", "%abc%"},
+		{"", "%%"},
+		{"100%", `%100\%%`},
+		{"a_b", `%a\_b%`},
+		{`C:\dir`, `%C:\\dir%`},
+		{`\%_`, `%\\\%\_%`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := containsPattern(tt.value); got != tt.want {
+				t.Errorf("containsPattern(%q) = %q, want %q", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScope(t *testing.T) {
+	db := dryRunDB(t)
+	tests := []struct {
+		name  string
+		query string
+		sql   string
+		vars  []interface{}
+	}{
+		{
+			name:  "like is escaped",
+			query: "username[like]=a_1%25",
+			sql:   "SELECT * FROM `users` WHERE users.username LIKE ? ESCAPE '\\\\'",
+			vars:  []interface{}{`%a\_1\%%`},
+		},
+		{
+			name:  "search on every column",
+			query: "search=x_",
+			sql:   "SELECT * FROM `users` WHERE users.username LIKE ? ESCAPE '\\\\' OR users.nickname LIKE ? ESCAPE '\\\\'",
+			vars:  []interface{}{`%x\_%`, `%x\_%`},
+		},
+		{
+			name:  "search is grouped with other filters",
+			query: "status=1&search=x",
+			sql:   "SELECT * FROM `users` WHERE users.status = ? AND (users.username LIKE ? ESCAPE '\\\\' OR users.nickname LIKE ? ESCAPE '\\\\')",
+			vars:  []interface{}{1, "%x%", "%x%"},
+		},
+		{
+			name:  "comparison",
+			query: "status[ne]=0",
+			sql:   "SELECT * FROM `users` WHERE users.status <> ?",
+			vars:  []interface{}{0},
+		},
+		{
+			name:  "in",
+			query: "status[in]=1,2",
+			sql:   "SELECT * FROM `users` WHERE users.status IN (?,?)",
+			vars:  []interface{}{1, 2},
+		},
+		{
+			name:  "null",
+			query: "department_id[null]=false",
+			sql:   "SELECT * FROM `users` WHERE users.department_id IS NOT NULL",
+		},
+		{
+			name:  "expression",
+			query: "attr.emp_no=A1",
+			sql:   "SELECT * FROM `users` WHERE JSON_UNQUOTE(JSON_EXTRACT(users.attributes, '$.emp_no')) = ?",
+			vars:  []interface{}{"A1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+			q, err := Parse(values, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			var users []testUser
+			stmt := db.Scopes(q.Scope).Find(&users).Statement
+			if got := stmt.SQL.String(); got != tt.sql {
+				t.Errorf("sql = %s\nwant  %s", got, tt.sql)
+			}
+			if len(stmt.Vars) != len(tt.vars) || (len(tt.vars) > 0 && !reflect.DeepEqual(stmt.Vars, tt.vars)) {
+				t.Errorf("vars = %v, want %v", stmt.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	tests := []struct {
+		sort string
+		want string
+	}{
+		{"", "users.created_at DESC, users.id ASC"},
+		{"username", "users.username ASC, users.id ASC"},
+		{"-username,-id", "users.username DESC, users.id DESC"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.sort, func(t *testing.T) {
+			q, err := Parse(url.Values{"sort": {tt.sort}}, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			if got := q.Order(); got != tt.want {
+				t.Errorf("Order() = %q, want %q", got, tt.want)
+			}
+			// 向前翻页时方向全部相反
+			if got, want := q.order(true), q.order(false); got == want {
+				t.Errorf("order(true) = %q, want reversed", got)
+			}
+		})
+	}
+}
+
+func TestKeyset(t *testing.T) {
+	tests := []struct {
+		name     string
+		sort     string
+		values   []interface{}
+		backward bool
+		want     string
+	}{
+		{
+			name:   "single ascending",
+			sort:   "id",
+			values: []interface{}{10},
+			want:   "(users.id > ?)",
+		},
+		{
+			name:   "descending then id",
+			sort:   "-created_at",
+			values: []interface{}{"t", 10},
+			want:   "(users.created_at < ?) OR (users.created_at = ? AND users.id > ?)",
+		},
+		{
+			name:     "backward reverses every comparison",
+			sort:     "-created_at",
+			values:   []interface{}{"t", 10},
+			backward: true,
+			want:     "(users.created_at > ?) OR (users.created_at = ? AND users.id < ?)",
+		},
+		{
+			name:   "three columns",
+			sort:   "username,-created_at",
+			values: []interface{}{"a", "t", 10},
+			want:   "(users.username > ?) OR (users.username = ? AND users.created_at < ?) OR (users.username = ? AND users.created_at = ? AND users.id > ?)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(url.Values{"sort": {tt.sort}}, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			condition, args := q.keyset(tt.values, tt.backward)
+			if condition != tt.want {
+				t.Errorf("condition = %s\nwant        %s", condition, tt.want)
+			}
+			wantArgs := len(tt.values) * (len(tt.values) + 1) / 2
+			if len(args) != wantArgs {
+				t.Errorf("len(args) = %d, want %d", len(args), wantArgs)
+			}
+		})
+	}
+}
+
+func encodeTestCursor(t *testing.T, c cursor) string {
+	t.Helper()
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func TestDecodeCursor(t *testing.T) {
+	createdAt := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	tests := []struct {
+		name    string
+		sort    string
+		cursor  string
+		wantErr bool
+		want    []interface{}
+	}{
+		{
+			name:   "time values are restored",
+			sort:   "-created_at",
+			cursor: encodeTestCursor(t, cursor{Values: []interface{}{createdAt, 7}, Sort: "-created_at,id"}),
+			want:   []interface{}{createdAt, float64(7)},
+		},
+		{
+			name:    "sort changed",
+			sort:    "username",
+			cursor:  encodeTestCursor(t, cursor{Values: []interface{}{createdAt, 7}, Sort: "-created_at,id"}),
+			wantErr: true,
+		},
+		{
+			name:    "value count mismatch",
+			sort:    "-created_at",
+			cursor:  encodeTestCursor(t, cursor{Values: []interface{}{7}, Sort: "-created_at,id"}),
+			wantErr: true,
+		},
+		{
+			name:    "invalid time",
+			sort:    "-created_at",
+			cursor:  encodeTestCursor(t, cursor{Values: []interface{}{"yesterday", 7}, Sort: "-created_at,id"}),
+			wantErr: true,
+		},
+		{name: "not base64", sort: "id", cursor: "!!!", wantErr: true},
+		{name: "not json", sort: "id", cursor: base64.RawURLEncoding.EncodeToString([]byte("nope")), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(url.Values{"sort": {tt.sort}, "cursor": {tt.cursor}}, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			c, err := q.decodeCursor()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidQuery) {
+					t.Fatalf("decodeCursor() error = %v, want ErrInvalidQuery", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodeCursor() error = %v", err)
+			}
+			if len(c.Values) != len(tt.want) {
+				t.Fatalf("values = %v, want %v", c.Values, tt.want)
+			}
+			for i := range tt.want {
+				if want, ok := tt.want[i].(time.Time); ok {
+					if got, _ := c.Values[i].(time.Time); !got.Equal(want) {
+						t.Errorf("values[%d] = %v, want %v", i, c.Values[i], want)
+					}
+				} else if c.Values[i] != tt.want[i] {
+					t.Errorf("values[%d] = %v, want %v", i, c.Values[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		columns  []string
+		preloads []string
+	}{
+		{
+			name:     "all fields preload every association",
+			query:    "",
+			preloads: []string{"Role"},
+		},
+		{
+			name:    "selected fields include id and sort columns",
+			query:   "fields=username&sort=-created_at",
+			columns: []string{"users.id", "users.username", "users.created_at"},
+		},
+		{
+			name:     "association field",
+			query:    "fields=role&sort=id",
+			columns:  []string{"users.id", "users.role_id"},
+			preloads: []string{"Role"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, _ := url.ParseQuery(tt.query)
+			q, err := Parse(values, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+			columns, preloads := q.Selection()
+			if !reflect.DeepEqual(columns, tt.columns) {
+				t.Errorf("columns = %v, want %v", columns, tt.columns)
+			}
+			if !reflect.DeepEqual(preloads, tt.preloads) {
+				t.Errorf("preloads = %v, want %v", preloads, tt.preloads)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrMissingTenant 查询租户隔离的表时上下文中没有租户信息
+var ErrMissingTenant = errors.New("缺少租户信息，拒绝执行查询")
+
+// FieldName 租户字段名，模型包含该字段即视为租户隔离的表
+const FieldName = "TenantID"
+
+type tenantKey struct{}
+type skipKey struct{}
+
+// WithTenant 将租户ID写入上下文
+func WithTenant(ctx context.Context, tenantID uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenantID)
+}
+
+// FromContext 从上下文中读取租户ID
+func FromContext(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	tenantID, ok := ctx.Value(tenantKey{}).(uint)
+	return tenantID, ok && tenantID != 0
+}
+
+// WithoutTenant 标记为平台级操作，跳过租户过滤（仅用于平台管理和后台任务）
+func WithoutTenant(ctx context.Context) context.Context {
+	return context.WithValue(ctx, skipKey{}, true)
+}
+
+func skipped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	skip, _ := ctx.Value(skipKey{}).(bool)
+	return skip
+}
+
+// RegisterCallbacks 注册GORM回调：查询、更新、删除自动追加租户条件，创建时自动写入租户ID。
+// 对于包含 TenantID 字段的模型，上下文中没有租户时直接拒绝执行。
+// 原生SQL（Raw/Exec）无法分析，需要调用方自行保证租户条件。
+func RegisterCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:query", filter); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:row", filter); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:update", filter); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:delete", filter); err != nil {
+		return err
+	}
+	return cb.Create().Before("gorm:create").Register("tenant:create", stamp)
+}
+
+func isTenantScoped(db *gorm.DB) bool {
+	stmt := db.Statement
+	if stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		return false
+	}
+	return stmt.Schema.LookUpField(FieldName) != nil
+}
+
+func filter(db *gorm.DB) {
+	if db.Error != nil || !isTenantScoped(db) || skipped(db.Statement.Context) {
+		return
+	}
+
+	tenantID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(ErrMissingTenant)
+		return
+	}
+
+	// 不允许通过更新把记录移动到其他租户
+	if updates, ok := db.Statement.Dest.(map[string]interface{}); ok {
+		delete(updates, "tenant_id")
+		delete(updates, FieldName)
+	}
+
+	db.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "tenant_id"}, Value: tenantID},
+	}})
+}
+
+func stamp(db *gorm.DB) {
+	if db.Error != nil || !isTenantScoped(db) || skipped(db.Statement.Context) {
+		return
+	}
+
+	tenantID, ok := FromContext(db.Statement.Context)
+	if !ok {
+		db.AddError(ErrMissingTenant)
+		return
+	}
+
+	field := db.Statement.Schema.LookUpField(FieldName)
+	ctx := db.Statement.Context
+	rv := db.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			elem := reflect.Indirect(rv.Index(i))
+			if err := field.Set(ctx, elem, tenantID); err != nil {
+				db.AddError(err)
+				return
+			}
+		}
+	case reflect.Struct:
+		if err := field.Set(ctx, rv, tenantID); err != nil {
+			db.AddError(err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type scopedModel struct {
+	ID       uint
+	TenantID uint
+	Name     string
+}
+
+type globalModel struct {
+	ID   uint
+	Name string
+}
+
+// dryRunDB 只生成SQL不连接数据库
+func dryRunDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(mysql.New(mysql.Config{DSN: "test:test@tcp(127.0.0.1:3306)/test?parseTime=true", SkipInitializeWithVersion: true}),
+		&gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("open dry run db: %v", err)
+	}
+	if err := RegisterCallbacks(db); err != nil {
+		t.Fatalf("register callbacks: %v", err)
+	}
+	return db
+}
+
+func TestFromContext(t *testing.T) {
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		want   uint
+		wantOK bool
+	}{
+		{name: "nil context", ctx: nil},
+		{name: "no tenant", ctx: context.Background()},
+		{name: "zero tenant", ctx: WithTenant(context.Background(), 0)},
+		{name: "tenant", ctx: WithTenant(context.Background(), 7), want: 7, wantOK: true},
+		{name: "tenant survives skip marker", ctx: WithoutTenant(WithTenant(context.Background(), 3)), want: 3, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := FromContext(tt.ctx)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("FromContext() = %d, %v, want %d, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	db := dryRunDB(t)
+	tenantCtx := WithTenant(context.Background(), 7)
+	tests := []struct {
+		name    string
+		run     func(tx *gorm.DB) *gorm.DB
+		wantErr error
+		sql     string
+		vars    int
+	}{
+		{
+			name: "query adds tenant condition",
+			run: func(tx *gorm.DB) *gorm.DB {
+				var rows []scopedModel
+				return tx.WithContext(tenantCtx).Where("name = ?", "a").Find(&rows)
+			},
+			sql:  "SELECT * FROM `scoped_models` WHERE name = ? AND `scoped_models`.`tenant_id` = ?",
+			vars: 2,
+		},
+		{
+			name: "query without tenant is rejected",
+			run: func(tx *gorm.DB) *gorm.DB {
+				var rows []scopedModel
+				return tx.WithContext(context.Background()).Find(&rows)
+			},
+			wantErr: ErrMissingTenant,
+		},
+		{
+			name: "platform operation skips filter",
+			run: func(tx *gorm.DB) *gorm.DB {
+				var rows []scopedModel
+				return tx.WithContext(WithoutTenant(context.Background())).Find(&rows)
+			},
+			sql: "SELECT * FROM `scoped_models`",
+		},
+		{
+			name: "model without tenant field is untouched",
+			run: func(tx *gorm.DB) *gorm.DB {
+				var rows []globalModel
+				return tx.WithContext(context.Background()).Find(&rows)
+			},
+			sql: "SELECT * FROM `global_models`",
+		},
+		{
+			name: "count uses row callback",
+			run: func(tx *gorm.DB) *gorm.DB {
+				var total int64
+				return tx.WithContext(tenantCtx).Model(&scopedModel{}).Count(&total)
+			},
+			sql:  "SELECT count(*) FROM `scoped_models` WHERE `scoped_models`.`tenant_id` = ?",
+			vars: 1,
+		},
+		{
+			name: "delete adds tenant condition",
+			run: func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(tenantCtx).Delete(&scopedModel{}, 5)
+			},
+			sql:  "DELETE FROM `scoped_models` WHERE `scoped_models`.`id` = ? AND `scoped_models`.`tenant_id` = ?",
+			vars: 2,
+		},
+		{
+			name: "map update cannot move tenant",
+			run: func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(tenantCtx).Model(&scopedModel{}).Where("id = ?", 5).
+					Updates(map[string]interface{}{"name": "b", "tenant_id": 9})
+			},
+			sql:  "UPDATE `scoped_models` SET `name`=? WHERE id = ? AND `scoped_models`.`tenant_id` = ?",
+			vars: 3,
+		},
+		{
+			name: "update without tenant is rejected",
+			run: func(tx *gorm.DB) *gorm.DB {
+				return tx.WithContext(context.Background()).Model(&scopedModel{}).Where("id = ?", 5).Update("name", "b")
+			},
+			wantErr: ErrMissingTenant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.run(db.Session(&gorm.Session{NewDB: true}))
+			if tt.wantErr != nil {
+				if !errors.Is(result.Error, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", result.Error, tt.wantErr)
+				}
+				return
+			}
+			if result.Error != nil {
+				t.Fatalf("error = %v", result.Error)
+			}
+			if got := strings.TrimSpace(result.Statement.SQL.String()); got != tt.sql {
+				t.Errorf("sql = %s\nwant  %s", got, tt.sql)
+			}
+			if len(result.Statement.Vars) != tt.vars {
+				t.Errorf("vars = %v, want %d values", result.Statement.Vars, tt.vars)
+			}
+		})
+	}
+}
+
+func TestStamp(t *testing.T) {
+	db := dryRunDB(t)
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		value   func() []*scopedModel
+		want    uint
+		wantErr error
+	}{
+		{
+			name:  "single struct",
+			ctx:   WithTenant(context.Background(), 7),
+			value: func() []*scopedModel { return []*scopedModel{{Name: "a", TenantID: 99}} },
+			want:  7,
+		},
+		{
+			name:  "slice",
+			ctx:   WithTenant(context.Background(), 8),
+			value: func() []*scopedModel { return []*scopedModel{{Name: "a"}, {Name: "b"}} },
+			want:  8,
+		},
+		{
+			name:  "platform operation keeps explicit tenant",
+			ctx:   WithoutTenant(context.Background()),
+			value: func() []*scopedModel { return []*scopedModel{{Name: "a", TenantID: 3}} },
+			want:  3,
+		},
+		{
+			name:    "missing tenant",
+			ctx:     context.Background(),
+			value:   func() []*scopedModel { return []*scopedModel{{Name: "a"}} },
+			wantErr: ErrMissingTenant,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows := tt.value()
+			tx := db.WithContext(tt.ctx)
+			var result *gorm.DB
+			if len(rows) == 1 {
+				result = tx.Create(rows[0])
+			} else {
+				result = tx.Create(rows)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(result.Error, tt.wantErr) {
+					t.Fatalf("error = %v, want %v", result.Error, tt.wantErr)
+				}
+				return
+			}
+			if result.Error != nil {
+				t.Fatalf("error = %v", result.Error)
+			}
+			for i, row := range rows {
+				if row.TenantID != tt.want {
+					t.Errorf("rows[%d].TenantID = %d, want %d", i, row.TenantID, tt.want)
+				}
+			}
+		})
+	}
+}